@@ -20,8 +20,7 @@ import (
 )
 
 func main() {
-	// Parse command line flags
-	initSchema := flag.Bool("init-schema", false, "Initialize database schema")
+	// Parse command line flags; "migrate" runs a migration command instead of the server
 	flag.Parse()
 
 	// Initialize configuration
@@ -59,19 +58,21 @@ func main() {
 		logger.Fatal("Failed to initialize Postgres client", zap.Error(err))
 	}
 
-	// Initialize schemas if requested
-	if *initSchema {
-		logger.Info("Initializing database schemas")
-		if err := clickhouseClient.InitSchema(ctx); err != nil {
-			logger.Fatal("Failed to initialize ClickHouse schema", zap.Error(err))
+	// Run the migrate subcommand if requested
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(ctx, flag.Args()[1:], postgresClient, clickhouseClient, logger); err != nil {
+			logger.Fatal("Migration failed", zap.Error(err))
 		}
-		if err := postgresClient.InitSchema(ctx); err != nil {
-			logger.Fatal("Failed to initialize Postgres schema", zap.Error(err))
-		}
-		logger.Info("Database schemas initialized successfully")
 		return
 	}
 
+	// Bring the schemas up to date before serving
+	if viper.GetBool("migrations.on_start") {
+		if err := database.MigrateUp(ctx, postgresClient, clickhouseClient); err != nil {
+			logger.Fatal("Failed to migrate database schemas", zap.Error(err))
+		}
+	}
+
 	// Platform clients
 	platformClients := platforms.NewPlatformClients()
 
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"go.uber.org/zap"
+)
+
+const migrateUsage = `Usage: api migrate [-db all|postgres|clickhouse] <command>
+
+Commands:
+  up              apply all pending migrations
+  down [N]        revert the last N migrations (default 1)
+  status          show the applied version and pending migrations
+  force VERSION   record VERSION as applied after repairing a dirty schema
+`
+
+// runMigrate runs the migrate subcommand with the arguments following it
+func runMigrate(ctx context.Context, args []string, postgresClient *database.PostgresClient, clickhouseClient *database.ClickHouseClient, logger *zap.Logger) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	db := flags.String("db", "all", "Database to migrate: all, postgres or clickhouse")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing migrate command")
+	}
+	command := flags.Arg(0)
+
+	// Postgres goes first as ClickHouse migrations lock through it
+	var migrators []*database.Migrator
+	if *db == "all" || *db == "postgres" {
+		migrator, err := database.NewPostgresMigrator(postgresClient)
+		if err != nil {
+			return err
+		}
+		migrators = append(migrators, migrator)
+	}
+	if *db == "all" || *db == "clickhouse" {
+		migrator, err := database.NewClickHouseMigrator(clickhouseClient, postgresClient)
+		if err != nil {
+			return err
+		}
+		migrators = append(migrators, migrator)
+	}
+	if len(migrators) == 0 {
+		return fmt.Errorf("unknown database %q", *db)
+	}
+
+	// Reverting and forcing only make sense for one schema at a time
+	if (command == "down" || command == "force") && len(migrators) > 1 {
+		return fmt.Errorf("migrate %s needs -db postgres or -db clickhouse", command)
+	}
+
+	switch command {
+	case "up":
+		for _, migrator := range migrators {
+			applied, err := migrator.Up(ctx)
+			if err != nil {
+				return err
+			}
+			logger.Info("Applied migrations", zap.String("database", migrator.Name()), zap.Int("count", applied))
+		}
+
+	case "down":
+		steps := 1
+		if flags.NArg() > 1 {
+			n, err := strconv.Atoi(flags.Arg(1))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of migrations %q", flags.Arg(1))
+			}
+			steps = n
+		}
+		reverted, err := migrators[0].Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.Info("Reverted migrations", zap.String("database", migrators[0].Name()), zap.Int("count", reverted))
+
+	case "status":
+		for _, migrator := range migrators {
+			status, err := migrator.Status(ctx)
+			if err != nil {
+				return err
+			}
+			printMigrationStatus(migrator.Name(), status)
+		}
+
+	case "force":
+		if flags.NArg() < 2 {
+			return errors.New("migrate force needs a version")
+		}
+		version, err := strconv.Atoi(flags.Arg(1))
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", flags.Arg(1))
+		}
+		if err := migrators[0].Force(ctx, version); err != nil {
+			return err
+		}
+		logger.Info("Forced schema version", zap.String("database", migrators[0].Name()), zap.Int("version", version))
+
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	return nil
+}
+
+// printMigrationStatus writes the migrations of a database and whether each is applied
+func printMigrationStatus(name string, status *database.MigrationStatus) {
+	state := ""
+	if status.Dirty {
+		state = " (dirty)"
+	}
+	fmt.Printf("%s: version %d%s, %d pending\n", name, status.Version, state, len(status.Pending()))
+
+	for _, migration := range status.Migrations {
+		applied := "pending"
+		if migration.Version <= status.Version {
+			applied = "applied"
+		}
+		fmt.Printf("  %04d  %-30s %s\n", migration.Version, migration.Name, applied)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
+	"go.uber.org/zap"
+)
+
+// app holds the output and the connections of a command. Connections are
+// opened on first use, so a command only needs the stores it touches.
+type app struct {
+	out    *printer
+	logger *zap.Logger
+
+	postgres   *database.PostgresClient
+	clickhouse *database.ClickHouseClient
+	redis      *redis.Client
+}
+
+func newApp(out *printer, logger *zap.Logger) *app {
+	return &app{out: out, logger: logger}
+}
+
+// postgresClient returns the Postgres client, connecting on first use
+func (a *app) postgresClient() (*database.PostgresClient, error) {
+	if a.postgres == nil {
+		client, err := database.NewPostgresClient()
+		if err != nil {
+			return nil, fmt.Errorf("connect to Postgres: %w", err)
+		}
+		a.postgres = client
+	}
+	return a.postgres, nil
+}
+
+// clickhouseClient returns the ClickHouse client, connecting on first use
+func (a *app) clickhouseClient() (*database.ClickHouseClient, error) {
+	if a.clickhouse == nil {
+		client, err := database.NewClickHouseClient()
+		if err != nil {
+			return nil, fmt.Errorf("connect to ClickHouse: %w", err)
+		}
+		a.clickhouse = client
+	}
+	return a.clickhouse, nil
+}
+
+// redisClient returns the Redis client, connecting on first use
+func (a *app) redisClient(ctx context.Context) (*redis.Client, error) {
+	if a.redis == nil {
+		client, err := redis.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("connect to Redis: %w", err)
+		}
+		a.redis = client
+	}
+	return a.redis, nil
+}
+
+// close closes the connections opened by the command
+func (a *app) close() {
+	if a.postgres != nil {
+		a.postgres.Close()
+	}
+	if a.clickhouse != nil {
+		a.clickhouse.Close()
+	}
+	if a.redis != nil {
+		a.redis.Close()
+	}
+}
+
+// newFlagSet creates the flag set of a command, printing its usage on errors
+func newFlagSet(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: campaignctl %s %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseDate parses a YYYY-MM-DD flag value, or returns def when empty
+func parseDate(name, value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s %q (use YYYY-MM-DD)", name, value)
+	}
+	return date, nil
+}
+
+// parseDateRange parses the -start and -end flags, both required
+func parseDateRange(start, end string) (time.Time, time.Time, error) {
+	if start == "" || end == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("-start and -end are required")
+	}
+	startDate, err := parseDate("start", start, time.Time{})
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endDate, err := parseDate("end", end, time.Time{})
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if endDate.Before(startDate) {
+		return time.Time{}, time.Time{}, fmt.Errorf("-end is before -start")
+	}
+	return startDate, endDate, nil
+}
+
+// parseCampaignID parses the campaign ID argument of a command
+func parseCampaignID(flags *flag.FlagSet) (uuid.UUID, error) {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return uuid.Nil, fmt.Errorf("expected a campaign ID")
+	}
+	id, err := uuid.Parse(flags.Arg(0))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid campaign ID %q", flags.Arg(0))
+	}
+	return id, nil
+}
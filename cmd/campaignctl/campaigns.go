@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/codec"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/platforms"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/schema"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/secrets"
+)
+
+// listCampaigns handles "campaigns list"
+func listCampaigns(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("campaigns list", "[-user ID] [-platform PLATFORM] [-status STATUS]")
+	user := flags.String("user", "", "Only list the campaigns of this user ID")
+	platform := flags.String("platform", "", "Only list campaigns of this platform")
+	status := flags.String("status", "", "Only list campaigns with this status")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var filter repository.CampaignFilter
+	if *user != "" {
+		userID, err := uuid.Parse(*user)
+		if err != nil {
+			return fmt.Errorf("invalid user ID %q", *user)
+		}
+		filter.UserID = userID
+	}
+	if *platform != "" {
+		p := models.Platform(*platform)
+		if !p.IsValid() {
+			return fmt.Errorf("unknown platform %q", *platform)
+		}
+		filter.Platform = &p
+	}
+	if *status != "" {
+		filter.Status = status
+	}
+
+	postgres, err := app.postgresClient()
+	if err != nil {
+		return err
+	}
+	campaigns, err := database.NewCampaignRepository(postgres).List(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		rows = append(rows, []string{
+			campaign.ID.String(),
+			campaign.Name,
+			string(campaign.Platform),
+			campaign.Status,
+			campaign.StartDate.Format("2006-01-02"),
+			campaign.EndDate.Format("2006-01-02"),
+			strconv.FormatFloat(campaign.Budget, 'f', 2, 64),
+			campaign.UserID.String(),
+		})
+	}
+	return app.out.table(campaigns,
+		[]string{"ID", "NAME", "PLATFORM", "STATUS", "START", "END", "BUDGET", "USER"},
+		rows,
+	)
+}
+
+// fetchCampaign handles "campaigns fetch". The events are queued in the
+// outbox and published by the worker's relay.
+func fetchCampaign(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("campaigns fetch", "[-start DATE -end DATE] ID")
+	start := flags.String("start", "", "First day to fetch, instead of the sync window")
+	end := flags.String("end", "", "Last day to fetch, instead of the sync window")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	campaignID, err := parseCampaignID(flags)
+	if err != nil {
+		return err
+	}
+
+	campaignService, err := newCampaignService(app)
+	if err != nil {
+		return err
+	}
+
+	if *start == "" && *end == "" {
+		if err := campaignService.FetchCampaignData(ctx, campaignID); err != nil {
+			return err
+		}
+		return app.out.message(map[string]string{"campaign_id": campaignID.String()},
+			"Fetched campaign %s from its sync window", campaignID)
+	}
+
+	startDate, endDate, err := parseDateRange(*start, *end)
+	if err != nil {
+		return err
+	}
+	if err := campaignService.BackfillCampaignData(ctx, campaignID, startDate, endDate.AddDate(0, 0, 1)); err != nil {
+		return err
+	}
+	return app.out.message(
+		map[string]string{"campaign_id": campaignID.String(), "start_date": *start, "end_date": *end},
+		"Fetched campaign %s from %s to %s", campaignID, *start, *end,
+	)
+}
+
+// reaggregateCampaign handles "campaigns reaggregate"
+func reaggregateCampaign(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("campaigns reaggregate", "-start DATE -end DATE ID")
+	start := flags.String("start", "", "First day to re-aggregate")
+	end := flags.String("end", "", "Last day to re-aggregate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	campaignID, err := parseCampaignID(flags)
+	if err != nil {
+		return err
+	}
+	startDate, endDate, err := parseDateRange(*start, *end)
+	if err != nil {
+		return err
+	}
+
+	clickhouse, err := app.clickhouseClient()
+	if err != nil {
+		return err
+	}
+	redisClient, err := app.redisClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	aggregationService := services.NewAggregationService(database.NewInsightsStore(clickhouse), newFXService(app, clickhouse), redisClient, app.logger)
+	if err := aggregationService.TriggerReaggregation(ctx, campaignID, startDate, endDate); err != nil {
+		return err
+	}
+	return app.out.message(
+		map[string]string{"campaign_id": campaignID.String(), "start_date": *start, "end_date": *end},
+		"Re-aggregated campaign %s from %s to %s", campaignID, *start, *end,
+	)
+}
+
+// newCampaignService creates a campaign service fetching with the owners'
+// platform credentials, as the API does
+func newCampaignService(app *app) (*services.CampaignService, error) {
+	postgres, err := app.postgresClient()
+	if err != nil {
+		return nil, err
+	}
+
+	sealer, err := secrets.NewSealer()
+	if err != nil {
+		return nil, err
+	}
+	eventCodec, err := codec.NewCampaignEventCodec(schema.NewRegistry())
+	if err != nil {
+		return nil, err
+	}
+
+	return services.NewCampaignService(
+		database.NewCampaignRepository(postgres),
+		platforms.NewPlatformClients(),
+		services.NewCredentialsService(postgres, sealer, app.logger),
+		services.SyncWindowConfig{
+			InitialDays:     viper.GetInt("sync.initial_days"),
+			RestatementDays: viper.GetInt("sync.restatement_days"),
+		},
+		eventCodec,
+		app.logger,
+	), nil
+}
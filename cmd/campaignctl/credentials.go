@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/secrets"
+)
+
+// rewrapCredentials handles "credentials rewrap"
+func rewrapCredentials(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("credentials rewrap", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments")
+	}
+
+	postgres, err := app.postgresClient()
+	if err != nil {
+		return err
+	}
+	sealer, err := secrets.NewSealer()
+	if err != nil {
+		return err
+	}
+
+	rewrapped, err := services.NewCredentialsService(postgres, sealer, app.logger).RewrapAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	return app.out.message(map[string]interface{}{"key_id": sealer.KeyID(), "rewrapped": rewrapped},
+		"Re-wrapped %d credentials with key %s", rewrapped, sealer.KeyID())
+}
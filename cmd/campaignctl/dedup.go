@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// dedupPattern returns the deduplication key pattern selected by the
+// -campaign or -pattern flag. Keys are <platform>:<campaign ID>:<day>...
+func dedupPattern(campaign, pattern string) (string, error) {
+	if (campaign == "") == (pattern == "") {
+		return "", fmt.Errorf("exactly one of -campaign and -pattern is required")
+	}
+	if pattern != "" {
+		return pattern, nil
+	}
+
+	campaignID, err := uuid.Parse(campaign)
+	if err != nil {
+		return "", fmt.Errorf("invalid campaign ID %q", campaign)
+	}
+	return "*:" + campaignID.String() + ":*", nil
+}
+
+// dedupKey is a deduplication key and the hash of its last processed snapshot
+type dedupKey struct {
+	Key  string `json:"key"`
+	Hash string `json:"hash"`
+}
+
+// listDedupKeys handles "dedup list"
+func listDedupKeys(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("dedup list", "[-campaign ID | -pattern PATTERN] [-limit N]")
+	campaign := flags.String("campaign", "", "Only show the keys of this campaign ID")
+	pattern := flags.String("pattern", "", "Glob pattern of the keys to show, e.g. 'meta:*'")
+	limit := flags.Int("limit", 100, "Maximum number of keys to show, 0 for all")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *campaign == "" && *pattern == "" {
+		*pattern = "*"
+	}
+	match, err := dedupPattern(*campaign, *pattern)
+	if err != nil {
+		return err
+	}
+
+	redisClient, err := app.redisClient(ctx)
+	if err != nil {
+		return err
+	}
+	hashes, err := redisClient.ScanSnapshotHashes(ctx, match, *limit)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]dedupKey, 0, len(hashes))
+	for key, hash := range hashes {
+		keys = append(keys, dedupKey{Key: key, Hash: hash})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, []string{key.Key, key.Hash})
+	}
+	return app.out.table(keys, []string{"KEY", "HASH"}, rows)
+}
+
+// purgeDedupKeys handles "dedup purge". Purged keys are tombstoned rather
+// than deleted: without a hash in Redis the processor would compare snapshots
+// with the stored events and still skip unchanged ones.
+func purgeDedupKeys(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("dedup purge", "-campaign ID | -pattern PATTERN")
+	campaign := flags.String("campaign", "", "Purge the keys of this campaign ID")
+	pattern := flags.String("pattern", "", "Glob pattern of the keys to purge")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	match, err := dedupPattern(*campaign, *pattern)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	redisClient, err := app.redisClient(ctx)
+	if err != nil {
+		return err
+	}
+	purged, err := redisClient.PurgeSnapshotHashes(ctx, match)
+	if err != nil {
+		return err
+	}
+
+	return app.out.message(map[string]interface{}{"pattern": match, "purged": purged},
+		"Purged %d snapshot hashes matching %s", purged, match)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+)
+
+// defaultDeadLetterTopic is the source topic used when none is given
+const defaultDeadLetterTopic = "campaign_events"
+
+func newDeadLetterService(app *app) *services.DeadLetterService {
+	return services.NewDeadLetterService(viper.GetStringSlice("kafka.consumer.topics"), app.logger)
+}
+
+// listDeadLetters handles "dlq list"
+func listDeadLetters(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("dlq list", "[-topic TOPIC] [-partition N] [-offset N] [-limit N]")
+	topic := flags.String("topic", defaultDeadLetterTopic, "Source topic of the dead letters")
+	partition := flags.Int("partition", -1, "Only read this partition")
+	offset := flags.Int64("offset", -1, "First offset to read, -1 for the oldest")
+	limit := flags.Int("limit", 50, "Maximum number of dead letters")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("invalid -limit %d", *limit)
+	}
+
+	var partitionFilter *int
+	if *partition >= 0 {
+		partitionFilter = partition
+	}
+
+	deadLetters, err := newDeadLetterService(app).List(ctx, *topic, partitionFilter, *offset, *limit)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		rows = append(rows, []string{
+			strconv.Itoa(deadLetter.Partition),
+			strconv.FormatInt(deadLetter.Offset, 10),
+			deadLetter.Key,
+			strconv.Itoa(deadLetter.Attempts),
+			failedAt(deadLetter),
+			deadLetter.Error,
+		})
+	}
+	return app.out.table(deadLetters,
+		[]string{"PARTITION", "OFFSET", "KEY", "ATTEMPTS", "FAILED AT", "ERROR"},
+		rows,
+	)
+}
+
+// redriveDeadLetter handles "dlq redrive"
+func redriveDeadLetter(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("dlq redrive", "[-topic TOPIC] PARTITION OFFSET")
+	topic := flags.String("topic", defaultDeadLetterTopic, "Source topic of the dead letter")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected a partition and an offset")
+	}
+	partition, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || partition < 0 {
+		return fmt.Errorf("invalid partition %q", flags.Arg(0))
+	}
+	offset, err := strconv.ParseInt(flags.Arg(1), 10, 64)
+	if err != nil || offset < 0 {
+		return fmt.Errorf("invalid offset %q", flags.Arg(1))
+	}
+
+	deadLetter, err := newDeadLetterService(app).Redrive(ctx, *topic, partition, offset)
+	if err != nil {
+		return err
+	}
+	return app.out.message(deadLetter, "Re-drove dead letter %d/%d of %s", partition, offset, *topic)
+}
+
+// failedAt formats the failure time of a dead letter for the table
+func failedAt(deadLetter models.DeadLetter) string {
+	if deadLetter.FailedAt == nil {
+		return "-"
+	}
+	return deadLetter.FailedAt.Format("2006-01-02 15:04:05")
+}
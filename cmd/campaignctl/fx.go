@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+)
+
+// newFXService creates the exchange rate service on ClickHouse
+func newFXService(app *app, clickhouse *database.ClickHouseClient) *services.FXService {
+	return services.NewFXService(database.NewFXRateStore(clickhouse), viper.GetString("fx.base_currency"), app.logger)
+}
+
+// loadFXRates handles "fx load"
+func loadFXRates(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("fx load", "FILE")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a CSV file")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rates, err := services.ParseFXRates(file)
+	if err != nil {
+		return err
+	}
+
+	clickhouse, err := app.clickhouseClient()
+	if err != nil {
+		return err
+	}
+	fxService := newFXService(app, clickhouse)
+	if err := fxService.StoreRates(ctx, rates); err != nil {
+		return err
+	}
+
+	return app.out.message(map[string]interface{}{"file": flags.Arg(0), "rates": len(rates), "base": fxService.BaseCurrency()},
+		"Loaded %d rates against %s from %s", len(rates), fxService.BaseCurrency(), flags.Arg(0))
+}
+
+// listFXRates handles "fx list"
+func listFXRates(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("fx list", "-currency CODES [-start DATE] [-end DATE]")
+	currency := flags.String("currency", "", "Comma-separated currency codes")
+	start := flags.String("start", "", "First day, default 30 days ago")
+	end := flags.String("end", "", "Last day, default today")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *currency == "" {
+		flags.Usage()
+		return fmt.Errorf("-currency is required")
+	}
+	startDate, err := parseDate("start", *start, time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		return err
+	}
+	endDate, err := parseDate("end", *end, time.Now())
+	if err != nil {
+		return err
+	}
+
+	clickhouse, err := app.clickhouseClient()
+	if err != nil {
+		return err
+	}
+	base := newFXService(app, clickhouse).BaseCurrency()
+	rates, err := database.NewFXRateStore(clickhouse).List(ctx, base, strings.Split(strings.ToUpper(*currency), ","), startDate, endDate)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(rates))
+	for _, rate := range rates {
+		rows = append(rows, []string{
+			rate.Date.Format("2006-01-02"),
+			rate.Base,
+			rate.Currency,
+			strconv.FormatFloat(rate.Rate, 'f', -1, 64),
+		})
+	}
+	return app.out.table(rates, []string{"DATE", "BASE", "CURRENCY", "RATE"}, rows)
+}
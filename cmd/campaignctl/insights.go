@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+)
+
+// insightsCSVHeader is the header row of exported insights
+var insightsCSVHeader = []string{
+	"campaign_id", "date", "platform", "region", "currency",
+	"impressions", "clicks", "conversions", "spend", "revenue",
+	"ctr", "cpc", "cpa", "roas", "conversion_rate",
+}
+
+// exportInsights handles "insights export". Insights are read from ClickHouse
+// directly rather than through the API cache.
+func exportInsights(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("insights export", "-campaign ID [-start DATE] [-end DATE] [-granularity G] [-out FILE]")
+	campaign := flags.String("campaign", "", "Campaign ID")
+	start := flags.String("start", "", "First day, default 30 days ago")
+	end := flags.String("end", "", "Last day, default today")
+	granularityFlag := flags.String("granularity", "daily", "hourly, daily, weekly, monthly or quarterly")
+	platform := flags.String("platform", "", "Only export this platform")
+	region := flags.String("region", "", "Only export this region")
+	out := flags.String("out", "", "File to write, default standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	campaignID, err := uuid.Parse(*campaign)
+	if err != nil {
+		flags.Usage()
+		return fmt.Errorf("invalid -campaign %q", *campaign)
+	}
+	params := models.CampaignInsightsParams{CampaignID: campaignID}
+	if params.StartDate, err = parseDate("start", *start, time.Now().AddDate(0, 0, -30)); err != nil {
+		return err
+	}
+	if params.EndDate, err = parseDate("end", *end, time.Now()); err != nil {
+		return err
+	}
+	if params.Granularity, err = models.ParseGranularity(*granularityFlag); err != nil {
+		return err
+	}
+	if params.WeekStart, err = models.ParseWeekStart(viper.GetString("insights.week_start")); err != nil {
+		return err
+	}
+	if *platform != "" {
+		p := models.Platform(*platform)
+		params.Platform = &p
+	}
+	if *region != "" {
+		params.Region = region
+	}
+
+	clickhouse, err := app.clickhouseClient()
+	if err != nil {
+		return err
+	}
+	insights, err := database.NewInsightsStore(clickhouse).Query(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	// Without a file the CSV is the output, regardless of the output format
+	if *out == "" {
+		return writeInsightsCSV(os.Stdout, insights)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := writeInsightsCSV(file, insights); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return app.out.message(map[string]interface{}{"file": *out, "rows": len(insights)},
+		"Exported %d rows to %s", len(insights), *out)
+}
+
+// writeInsightsCSV writes insights as CSV with a header row
+func writeInsightsCSV(w io.Writer, insights []models.CampaignInsights) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(insightsCSVHeader); err != nil {
+		return err
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	for _, insight := range insights {
+		err := writer.Write([]string{
+			insight.CampaignID.String(),
+			insight.Date.Format(time.RFC3339),
+			string(insight.Platform),
+			insight.Region,
+			insight.Currency,
+			strconv.FormatInt(insight.Impressions, 10),
+			strconv.FormatInt(insight.Clicks, 10),
+			strconv.FormatInt(insight.Conversions, 10),
+			formatFloat(insight.Spend),
+			formatFloat(insight.Revenue),
+			formatFloat(insight.CTR),
+			formatFloat(insight.CPC),
+			formatFloat(insight.CPA),
+			formatFloat(insight.ROAS),
+			formatFloat(insight.ConversionRate),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/zocket/campaign-analytics/internal/config"
+	"go.uber.org/zap"
+)
+
+// command is a campaignctl command, named by a group and an action
+type command struct {
+	group  string
+	action string
+	args   string
+	help   string
+	run    func(ctx context.Context, app *app, args []string) error
+}
+
+// commands lists every command in the order of the usage text
+var commands = []command{
+	{"users", "create", "-email EMAIL -password PASSWORD [-name NAME] [-role ROLE]", "create a user", createUser},
+	{"users", "set-role", "EMAIL ROLE", "assign a role (user or admin) to a user", setUserRole},
+	{"campaigns", "list", "[-user ID] [-platform PLATFORM] [-status STATUS]", "list campaigns", listCampaigns},
+	{"campaigns", "fetch", "[-start DATE -end DATE] ID", "fetch a campaign, from its sync window or a date range", fetchCampaign},
+	{"campaigns", "reaggregate", "-start DATE -end DATE ID", "re-aggregate the insights of a campaign", reaggregateCampaign},
+	{"dedup", "list", "[-campaign ID | -pattern PATTERN] [-limit N]", "show recorded snapshot hashes", listDedupKeys},
+	{"dedup", "purge", "-campaign ID | -pattern PATTERN", "tombstone cached snapshot hashes so unchanged snapshots are processed again", purgeDedupKeys},
+	{"dlq", "list", "[-topic TOPIC] [-partition N] [-offset N] [-limit N]", "list dead letters", listDeadLetters},
+	{"dlq", "redrive", "[-topic TOPIC] PARTITION OFFSET", "re-drive a dead letter", redriveDeadLetter},
+	{"credentials", "rewrap", "", "re-wrap stored platform credentials with the current encryption key", rewrapCredentials},
+	{"migrate", "", "[-db all|postgres|clickhouse] up | down [N] | status | force VERSION", "run schema migrations", runMigrate},
+	{"insights", "export", "-campaign ID [-start DATE] [-end DATE] [-granularity G] [-out FILE]", "export insights to CSV", exportInsights},
+	{"fx", "load", "FILE", "load exchange rates from a CSV or ECB reference rates file", loadFXRates},
+	{"fx", "list", "-currency CODES [-start DATE] [-end DATE]", "list stored exchange rates", listFXRates},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: campaignctl [-o table|json] [-v] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		name := strings.TrimSpace(cmd.group + " " + cmd.action)
+		fmt.Fprintf(os.Stderr, "  %s %s\n        %s\n", name, cmd.args, cmd.help)
+	}
+	fmt.Fprintf(os.Stderr, "\nDates are YYYY-MM-DD. Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	// Parse command line flags
+	output := flag.String("o", "table", "Output format: table or json")
+	verbose := flag.Bool("v", false, "Log at info level instead of warnings only")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, args, ok := findCommand(flag.Args())
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	out, err := newPrinter(*output, os.Stdout)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Initialize configuration
+	if err := config.Init(); err != nil {
+		log.Fatalf("Failed to initialize configuration: %v", err)
+	}
+
+	// Log to stderr, keeping stdout for the output
+	logConfig := zap.NewProductionConfig()
+	logConfig.Encoding = "console"
+	if !*verbose {
+		logConfig.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+	}
+	logger, err := logConfig.Build()
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Sync()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	app := newApp(out, logger)
+	err = cmd.run(ctx, app, args)
+	app.close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "campaignctl %s: %v\n", strings.TrimSpace(cmd.group+" "+cmd.action), err)
+		os.Exit(1)
+	}
+}
+
+// findCommand returns the command named by the leading arguments and the
+// arguments following its name
+func findCommand(args []string) (command, []string, bool) {
+	if len(args) == 0 {
+		return command{}, nil, false
+	}
+	for _, cmd := range commands {
+		if cmd.group != args[0] {
+			continue
+		}
+		if cmd.action == "" {
+			return cmd, args[1:], true
+		}
+		if len(args) > 1 && cmd.action == args[1] {
+			return cmd, args[2:], true
+		}
+	}
+	return command{}, nil, false
+}
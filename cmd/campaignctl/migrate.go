@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+)
+
+// migrationRow is a migration in the status output
+type migrationRow struct {
+	Database string `json:"database"`
+	Version  int    `json:"version"`
+	Name     string `json:"name"`
+	Applied  bool   `json:"applied"`
+	Dirty    bool   `json:"dirty"`
+}
+
+// runMigrate handles "migrate"
+func runMigrate(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("migrate", "[-db all|postgres|clickhouse] up | down [N] | status | force VERSION")
+	db := flags.String("db", "all", "Database to migrate: all, postgres or clickhouse")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing migrate command")
+	}
+	command := flags.Arg(0)
+
+	// Reverting and forcing only make sense for one schema at a time
+	if (command == "down" || command == "force") && *db == "all" {
+		return fmt.Errorf("migrate %s needs -db postgres or -db clickhouse", command)
+	}
+
+	migrators, err := newMigrators(app, *db)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied := make(map[string]int)
+		var summary []string
+		for _, migrator := range migrators {
+			n, err := migrator.Up(ctx)
+			if err != nil {
+				return err
+			}
+			applied[migrator.Name()] = n
+			summary = append(summary, fmt.Sprintf("%s: applied %d migrations", migrator.Name(), n))
+		}
+		return app.out.message(applied, "%s", strings.Join(summary, "\n"))
+
+	case "down":
+		steps := 1
+		if flags.NArg() > 1 {
+			n, err := strconv.Atoi(flags.Arg(1))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of migrations %q", flags.Arg(1))
+			}
+			steps = n
+		}
+		reverted, err := migrators[0].Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		return app.out.message(map[string]int{migrators[0].Name(): reverted},
+			"%s: reverted %d migrations", migrators[0].Name(), reverted)
+
+	case "status":
+		var rows []migrationRow
+		for _, migrator := range migrators {
+			status, err := migrator.Status(ctx)
+			if err != nil {
+				return err
+			}
+			for _, migration := range status.Migrations {
+				rows = append(rows, migrationRow{
+					Database: migrator.Name(),
+					Version:  migration.Version,
+					Name:     migration.Name,
+					Applied:  migration.Version <= status.Version,
+					Dirty:    status.Dirty && migration.Version == status.Version,
+				})
+			}
+		}
+
+		table := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			state := "pending"
+			if row.Dirty {
+				state = "dirty"
+			} else if row.Applied {
+				state = "applied"
+			}
+			table = append(table, []string{row.Database, fmt.Sprintf("%04d", row.Version), row.Name, state})
+		}
+		return app.out.table(rows, []string{"DATABASE", "VERSION", "NAME", "STATE"}, table)
+
+	case "force":
+		if flags.NArg() < 2 {
+			return fmt.Errorf("migrate force needs a version")
+		}
+		version, err := strconv.Atoi(flags.Arg(1))
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", flags.Arg(1))
+		}
+		if err := migrators[0].Force(ctx, version); err != nil {
+			return err
+		}
+		return app.out.message(map[string]int{migrators[0].Name(): version},
+			"%s: forced version %d", migrators[0].Name(), version)
+
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+// newMigrators creates the migrators of the selected databases, Postgres
+// first as ClickHouse migrations lock through it
+func newMigrators(app *app, db string) ([]*database.Migrator, error) {
+	if db != "all" && db != "postgres" && db != "clickhouse" {
+		return nil, fmt.Errorf("unknown database %q", db)
+	}
+
+	postgres, err := app.postgresClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var migrators []*database.Migrator
+	if db == "all" || db == "postgres" {
+		migrator, err := database.NewPostgresMigrator(postgres)
+		if err != nil {
+			return nil, err
+		}
+		migrators = append(migrators, migrator)
+	}
+	if db == "all" || db == "clickhouse" {
+		clickhouse, err := app.clickhouseClient()
+		if err != nil {
+			return nil, err
+		}
+		migrator, err := database.NewClickHouseMigrator(clickhouse, postgres)
+		if err != nil {
+			return nil, err
+		}
+		migrators = append(migrators, migrator)
+	}
+	return migrators, nil
+}
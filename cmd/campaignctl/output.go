@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes command results as a table or as JSON
+type printer struct {
+	json bool
+	w    io.Writer
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{json: true, w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (use table or json)", format)
+	}
+}
+
+// table prints value as indented JSON, or the rows under headers as an
+// aligned table
+func (p *printer) table(value interface{}, headers []string, rows [][]string) error {
+	if p.json {
+		return p.value(value)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// message prints a one-line result, or value as JSON
+func (p *printer) message(value interface{}, format string, args ...interface{}) error {
+	if p.json {
+		return p.value(value)
+	}
+	_, err := fmt.Fprintf(p.w, format+"\n", args...)
+	return err
+}
+
+func (p *printer) value(value interface{}) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
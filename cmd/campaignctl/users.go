@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength matches the minimum enforced at registration
+const minPasswordLength = 8
+
+// createUser handles "users create"
+func createUser(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("users create", "-email EMAIL -password PASSWORD [-name NAME] [-role ROLE]")
+	email := flags.String("email", "", "Email address of the user")
+	password := flags.String("password", "", "Initial password")
+	name := flags.String("name", "", "Display name")
+	role := flags.String("role", models.RoleUser, "Role: user or admin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" || len(*password) < minPasswordLength {
+		flags.Usage()
+		return fmt.Errorf("-email and a -password of at least %d characters are required", minPasswordLength)
+	}
+	if !models.IsValidRole(*role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	postgres, err := app.postgresClient()
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:        uuid.New(),
+		Email:     *email,
+		Name:      *name,
+		Password:  string(hashedPassword),
+		Role:      *role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := database.NewUserRepository(postgres).Create(ctx, &user); err != nil {
+		return err
+	}
+
+	user.Password = ""
+	return app.out.message(user, "Created %s user %s (%s)", user.Role, user.Email, user.ID)
+}
+
+// setUserRole handles "users set-role"
+func setUserRole(ctx context.Context, app *app, args []string) error {
+	flags := newFlagSet("users set-role", "EMAIL ROLE")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected an email address and a role")
+	}
+	email, role := flags.Arg(0), flags.Arg(1)
+	if !models.IsValidRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	postgres, err := app.postgresClient()
+	if err != nil {
+		return err
+	}
+	if err := database.NewUserRepository(postgres).SetRole(ctx, email, role); err != nil {
+		return err
+	}
+
+	return app.out.message(map[string]string{"email": email, "role": role}, "%s is now %s", email, role)
+}
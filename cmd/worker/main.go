@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -10,17 +11,29 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zocket/campaign-analytics/internal/api/routes"
 	"github.com/zocket/campaign-analytics/internal/config"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
 	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/codec"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/kafka"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/oauth"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/platforms"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/schema"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/secrets"
 	"github.com/zocket/campaign-analytics/internal/version"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
 func main() {
+	// Parse command line flags
+	dev := flag.Bool("dev", false, "Also serve the API and use an in-memory message bus instead of Kafka")
+	flag.Parse()
+
 	// Initialize configuration
 	if err := config.Init(); err != nil {
 		log.Fatalf("Failed to initialize configuration: %v", err)
@@ -53,20 +66,118 @@ func main() {
 		logger.Fatal("Failed to initialize ClickHouse client", zap.Error(err))
 	}
 
-	// Initialize Kafka consumer
-	// We're passing an array with a single topic, which the updated NewConsumer will use correctly
-	consumer, err := kafka.NewConsumer([]string{"campaign_events"})
+	postgresClient, err := database.NewPostgresClient()
+	if err != nil {
+		logger.Fatal("Failed to initialize Postgres client", zap.Error(err))
+	}
+
+	// Bring the schemas up to date before consuming
+	if viper.GetBool("migrations.on_start") {
+		if err := database.MigrateUp(ctx, postgresClient, clickhouseClient); err != nil {
+			logger.Fatal("Failed to migrate database schemas", zap.Error(err))
+		}
+	}
+
+	sealer, err := secrets.NewSealer()
 	if err != nil {
-		logger.Fatal("Failed to initialize Kafka consumer", zap.Error(err))
+		logger.Fatal("Failed to initialize credentials sealer", zap.Error(err))
+	}
+
+	// Initialize the message bus. Messages are published to the topic they
+	// name, e.g. dead letters to the dead-letter topic of their topic. Dead
+	// letters re-driven from any consumed topic are consumed too.
+	topics := bus.WithRedriveTopics(viper.GetStringSlice("kafka.consumer.topics"))
+	var subscriber bus.Subscriber
+	var publisher bus.Publisher
+	if *dev {
+		memoryBus := bus.NewMemoryBus(viper.GetInt("bus.memory.partitions"))
+		subscriber = memoryBus.Subscribe(viper.GetString("kafka.consumer.group_id"), topics)
+		publisher = memoryBus
+		logger.Warn("Dev mode: using an in-memory message bus, unprocessed messages are lost on exit")
+	} else {
+		consumer, err := kafka.NewConsumer(topics)
+		if err != nil {
+			logger.Fatal("Failed to initialize Kafka consumer", zap.Error(err))
+		}
+		producer, err := kafka.NewProducer("")
+		if err != nil {
+			logger.Fatal("Failed to initialize Kafka producer", zap.Error(err))
+		}
+		subscriber = consumer
+		publisher = producer
 	}
+	defer publisher.Close()
 
 	// Initialize processors
-	eventProcessor := services.NewEventProcessor(clickhouseClient, redisClient, logger)
-	aggregationService := services.NewAggregationService(clickhouseClient, redisClient, logger)
+	fxService := services.NewFXService(database.NewFXRateStore(clickhouseClient), viper.GetString("fx.base_currency"), logger)
+	aggregationService := services.NewAggregationService(database.NewInsightsStore(clickhouseClient), fxService, redisClient, logger)
+	// Events are decoded by schema version; Protobuf payloads resolve their schema in the registry
+	eventCodec, err := codec.NewCampaignEventCodec(schema.NewRegistry())
+	if err != nil {
+		logger.Fatal("Failed to create campaign event codec", zap.Error(err))
+	}
+	eventProcessor := services.NewEventProcessor(database.NewEventStore(clickhouseClient), redisClient, aggregationService, eventCodec, logger)
+
+	credentialsService := services.NewCredentialsService(postgresClient, sealer, logger)
+	oauthService := services.NewOAuthService(oauth.NewProviders(), credentialsService, redisClient, oauth.StateKey(viper.GetString("jwt.key")), logger)
 
 	// Start worker
-	worker := services.NewWorker(consumer, eventProcessor, aggregationService, logger)
-	go worker.Start(ctx)
+	worker := services.NewWorker(subscriber, publisher, eventProcessor, aggregationService, services.RetryConfig{
+		MaxAttempts:    viper.GetInt("kafka.consumer.max_attempts"),
+		InitialBackoff: viper.GetDuration("kafka.consumer.initial_backoff"),
+		MaxBackoff:     viper.GetDuration("kafka.consumer.max_backoff"),
+	}, services.BatchConfig{
+		Size:    viper.GetInt("kafka.consumer.batch_size"),
+		Timeout: viper.GetDuration("kafka.consumer.batch_timeout"),
+	}, services.PoolConfig{
+		Concurrency:     viper.GetInt("kafka.consumer.concurrency"),
+		ShutdownTimeout: viper.GetDuration("kafka.consumer.shutdown_timeout"),
+	}, logger)
+	// Every topic currently carries campaign events in the same format
+	for _, topic := range subscriber.Topics() {
+		worker.Handle(topic, eventProcessor.PrepareEvent)
+	}
+
+	workerDone := make(chan struct{})
+	go func() {
+		worker.Start(ctx)
+		close(workerDone)
+	}()
+
+	syncWindow := services.SyncWindowConfig{
+		InitialDays:     viper.GetInt("sync.initial_days"),
+		RestatementDays: viper.GetInt("sync.restatement_days"),
+	}
+	campaignService := services.NewCampaignService(database.NewCampaignRepository(postgresClient), platforms.NewPlatformClients(), credentialsService, syncWindow, eventCodec, logger)
+
+	// Schedule automatic syncs of active campaigns
+	if viper.GetBool("scheduler.enabled") {
+		scheduler := services.NewScheduler(campaignService, redisClient, schedulerConfig(), logger)
+		go scheduler.Start(ctx)
+	}
+
+	// Run the backfill and re-aggregation jobs queued by the API
+	if viper.GetBool("jobs.enabled") {
+		jobService := services.NewJobService(database.NewJobRepository(postgresClient), campaignService, aggregationService, jobConfig(), logger)
+		go jobService.Start(ctx)
+	}
+
+	// Publish the messages queued in the outbox by the API and the scheduler.
+	// In dev mode the relay is the only way events reach the in-memory bus.
+	if viper.GetBool("outbox.enabled") || *dev {
+		relay := services.NewOutboxRelay(postgresClient, publisher, services.OutboxConfig{
+			PollInterval: viper.GetDuration("outbox.poll_interval"),
+			BatchSize:    viper.GetInt("outbox.batch_size"),
+			Retention:    viper.GetDuration("outbox.retention"),
+		}, logger)
+		go relay.Start(ctx)
+	}
+
+	// Keep platform tokens fresh
+	go oauthService.StartRefresher(ctx,
+		viper.GetDuration("oauth.refresh_interval"),
+		viper.GetDuration("oauth.refresh_window"),
+	)
 
 	// Setup health check HTTP server
 	router := gin.New()
@@ -89,6 +200,16 @@ func main() {
 		Addr:    ":8081", // Different port from API
 		Handler: router,
 	}
+
+	// In dev mode the same process serves the whole API instead
+	if *dev {
+		serverPort := viper.GetString("server.port")
+		if serverPort == "" {
+			serverPort = "8080"
+		}
+		server.Addr = ":" + serverPort
+		server.Handler = routes.SetupRouter(clickhouseClient, postgresClient, redisClient, platforms.NewPlatformClients(), logger)
+	}
 	
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -96,7 +217,7 @@ func main() {
 		}
 	}()
 	
-	logger.Info("Worker service started", zap.String("health_endpoint", "http://localhost:8081/health"))
+	logger.Info("Worker service started", zap.String("health_endpoint", "http://localhost"+server.Addr+"/health"))
 
 	// Wait for interrupt signal to gracefully shut down the worker
 	quit := make(chan os.Signal, 1)
@@ -110,8 +231,46 @@ func main() {
 		logger.Error("Server forced to shutdown", zap.Error(err))
 	}
 	
-	// Stop the worker
+	// Stop the worker and wait for in-flight messages to drain
 	cancel()
+	<-workerDone
+	if err := subscriber.Close(); err != nil {
+		logger.Error("Failed to close message bus subscriber", zap.Error(err))
+	}
 
 	logger.Info("Worker exiting")
 }
+
+// schedulerConfig reads the scheduler settings
+func schedulerConfig() services.SchedulerConfig {
+	concurrency := make(map[models.Platform]int)
+	for _, platform := range []models.Platform{
+		models.PlatformMeta,
+		models.PlatformGoogle,
+		models.PlatformLinkedIn,
+		models.PlatformTikTok,
+	} {
+		concurrency[platform] = viper.GetInt("scheduler.concurrency." + string(platform))
+	}
+
+	return services.SchedulerConfig{
+		Interval:            viper.GetDuration("scheduler.interval"),
+		Tick:                viper.GetDuration("scheduler.tick"),
+		Jitter:              viper.GetDuration("scheduler.jitter"),
+		LockTTL:             viper.GetDuration("scheduler.lock_ttl"),
+		PlatformConcurrency: concurrency,
+		DefaultConcurrency:  viper.GetInt("scheduler.concurrency.default"),
+	}
+}
+
+// jobConfig reads the job settings
+func jobConfig() services.JobConfig {
+	return services.JobConfig{
+		ChunkDays:     viper.GetInt("jobs.chunk_days"),
+		MaxDays:       viper.GetInt("jobs.max_days"),
+		PollInterval:  viper.GetDuration("jobs.poll_interval"),
+		LeaseTTL:      viper.GetDuration("jobs.lease_ttl"),
+		ChunkAttempts: viper.GetInt("jobs.chunk_attempts"),
+		RetryBackoff:  viper.GetDuration("jobs.retry_backoff"),
+	}
+}
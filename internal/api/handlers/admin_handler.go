@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"go.uber.org/zap"
+)
+
+// maxDeadLetterPage bounds the number of dead letters returned at once
+const maxDeadLetterPage = 500
+
+// AdminHandler handles operator-only HTTP requests
+type AdminHandler struct {
+	deadLetterService *services.DeadLetterService
+	fxService         *services.FXService
+	logger            *zap.Logger
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(
+	deadLetterService *services.DeadLetterService,
+	fxService *services.FXService,
+	logger *zap.Logger,
+) *AdminHandler {
+	return &AdminHandler{
+		deadLetterService: deadLetterService,
+		fxService:         fxService,
+		logger:            logger.With(zap.String("component", "admin_handler")),
+	}
+}
+
+// defaultDeadLetterTopic is the source topic used when none is given
+const defaultDeadLetterTopic = "campaign_events"
+
+// ListDeadLetters handles GET /admin/dlq
+func (h *AdminHandler) ListDeadLetters(c *gin.Context) {
+	topic := c.DefaultQuery("topic", defaultDeadLetterTopic)
+
+	var partition *int
+	if partitionStr := c.Query("partition"); partitionStr != "" {
+		p, err := strconv.Atoi(partitionStr)
+		if err != nil || p < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid partition"})
+			return
+		}
+		partition = &p
+	}
+
+	offset := int64(-1)
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		o, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || o < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		offset = o
+	}
+
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 || l > maxDeadLetterPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit (1-500)"})
+			return
+		}
+		limit = l
+	}
+
+	deadLetters, err := h.deadLetterService.List(c.Request.Context(), topic, partition, offset, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownTopic) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown topic"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deadLetters)
+}
+
+// RedriveDeadLetter handles POST /admin/dlq/:partition/:offset/redrive
+func (h *AdminHandler) RedriveDeadLetter(c *gin.Context) {
+	partition, err := strconv.Atoi(c.Param("partition"))
+	if err != nil || partition < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid partition"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.Param("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	topic := c.DefaultQuery("topic", defaultDeadLetterTopic)
+	deadLetter, err := h.deadLetterService.Redrive(c.Request.Context(), topic, partition, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownTopic) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown topic"})
+			return
+		}
+		if errors.Is(err, services.ErrDeadLetterNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to re-drive dead letter"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter re-driven", "dead_letter": deadLetter})
+}
+
+// fxRateRequest is an exchange rate in the body of a JSON request
+type fxRateRequest struct {
+	Date     string  `json:"date"` // YYYY-MM-DD
+	Base     string  `json:"base"` // the base currency by default
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+// LoadFXRates handles POST /admin/fx-rates. The body is a JSON array of
+// rates, or a CSV file (Content-Type text/csv) in a format read by
+// services.ParseFXRates.
+func (h *AdminHandler) LoadFXRates(c *gin.Context) {
+	var rates []models.FXRate
+	if c.ContentType() == "text/csv" {
+		parsed, err := services.ParseFXRates(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rates = parsed
+	} else {
+		var requests []fxRateRequest
+		if err := c.ShouldBindJSON(&requests); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for i, request := range requests {
+			date, err := time.Parse("2006-01-02", request.Date)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rate %d: invalid date %q (use YYYY-MM-DD)", i+1, request.Date)})
+				return
+			}
+			rates = append(rates, models.FXRate{Date: date, Base: request.Base, Currency: request.Currency, Rate: request.Rate})
+		}
+	}
+
+	if err := h.fxService.StoreRates(c.Request.Context(), rates); err != nil {
+		if services.IsInvalidFXRates(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rates stored", "count": len(rates), "base": h.fxService.BaseCurrency()})
+}
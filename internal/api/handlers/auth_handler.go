@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"database/sql"
 	"errors"
 	"net/http"
 	"time"
@@ -10,26 +9,26 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/zocket/campaign-analytics/internal/domain/models"
-	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
 	"golang.org/x/crypto/bcrypt"
 	"go.uber.org/zap"
 )
 
 // AuthHandler handles authentication requests
 type AuthHandler struct {
-	db     *database.PostgresClient
+	users  repository.UserRepository
 	logger *zap.Logger
 	jwtKey []byte
 }
 
 // NewAuthHandler creates a new authentication handler
 func NewAuthHandler(
-	db *database.PostgresClient,
+	users repository.UserRepository,
 	logger *zap.Logger,
 	jwtKey string,
 ) *AuthHandler {
 	return &AuthHandler{
-		db:     db,
+		users:  users,
 		logger: logger.With(zap.String("component", "auth_handler")),
 		jwtKey: []byte(jwtKey),
 	}
@@ -44,12 +43,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if user already exists
-	var existingUser models.User
-	err := h.db.GetDB().Get(&existingUser, "SELECT * FROM users WHERE email = $1", creds.Email)
+	_, err := h.users.GetByEmail(c.Request.Context(), creds.Email)
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
 		return
-	} else if !errors.Is(err, sql.ErrNoRows) {
+	} else if !errors.Is(err, repository.ErrUserNotFound) {
 		h.logger.Error("Failed to check existing user", zap.Error(err), zap.String("email", creds.Email))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
@@ -69,16 +67,17 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Email:     creds.Email,
 		Name:      c.PostForm("name"),
 		Password:  string(hashedPassword),
-		Role:      "user",
+		Role:      models.RoleUser,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	// Insert the user
-	_, err = h.db.GetDB().Exec(
-		"INSERT INTO users (id, email, name, password, role, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
-		user.ID, user.Email, user.Name, user.Password, user.Role, user.CreatedAt, user.UpdatedAt,
-	)
+	// Insert the user; a concurrent registration may have taken the email
+	err = h.users.Create(c.Request.Context(), &user)
+	if errors.Is(err, repository.ErrUserExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to create user", zap.Error(err), zap.String("email", user.Email))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -111,10 +110,9 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Get the user from the database
-	var user models.User
-	err := h.db.GetDB().Get(&user, "SELECT * FROM users WHERE email = $1", creds.Email)
+	user, err := h.users.GetByEmail(c.Request.Context(), creds.Email)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, repository.ErrUserNotFound) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
@@ -131,7 +129,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Generate JWT token
-	token, err := h.generateToken(user)
+	token, err := h.generateToken(*user)
 	if err != nil {
 		h.logger.Error("Failed to generate JWT token", zap.Error(err), zap.String("user_id", user.ID.String()))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication token"})
@@ -143,7 +141,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.AuthResponse{
 		Token: token,
-		User:  user,
+		User:  *user,
 	})
 }
 
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -15,6 +16,8 @@ import (
 type CampaignHandler struct {
 	campaignService    *services.CampaignService
 	aggregationService *services.AggregationService
+	jobService         *services.JobService
+	pacingService      *services.PacingService
 	logger             *zap.Logger
 }
 
@@ -22,11 +25,15 @@ type CampaignHandler struct {
 func NewCampaignHandler(
 	campaignService *services.CampaignService,
 	aggregationService *services.AggregationService,
+	jobService *services.JobService,
+	pacingService *services.PacingService,
 	logger *zap.Logger,
 ) *CampaignHandler {
 	return &CampaignHandler{
 		campaignService:    campaignService,
 		aggregationService: aggregationService,
+		jobService:         jobService,
+		pacingService:      pacingService,
 		logger:             logger.With(zap.String("component", "campaign_handler")),
 	}
 }
@@ -46,6 +53,14 @@ func (h *CampaignHandler) GetCampaign(c *gin.Context) {
 		return
 	}
 
+	// Surface whether data can currently be fetched for the campaign
+	status, err := h.campaignService.ConnectionStatus(c.Request.Context(), campaign)
+	if err != nil {
+		h.logger.Warn("Failed to get connection status", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+	} else {
+		campaign.ConnectionStatus = status
+	}
+
 	c.JSON(http.StatusOK, campaign)
 }
 
@@ -65,6 +80,11 @@ func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
 	}
 	campaign.UserID = userID.(uuid.UUID)
 
+	if _, err := models.LoadTimezone(campaign.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone (use an IANA timezone such as America/New_York)"})
+		return
+	}
+
 	if err := h.campaignService.CreateCampaign(c.Request.Context(), &campaign); err != nil {
 		h.logger.Error("Failed to create campaign", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create campaign"})
@@ -91,6 +111,11 @@ func (h *CampaignHandler) UpdateCampaign(c *gin.Context) {
 	// Ensure the ID in the URL matches the ID in the body
 	campaign.ID = campaignID
 
+	if _, err := models.LoadTimezone(campaign.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone (use an IANA timezone such as America/New_York)"})
+		return
+	}
+
 	// Verify the user owns this campaign
 	userID, _ := c.Get("user_id")
 	existingCampaign, err := h.campaignService.GetCampaign(c.Request.Context(), campaignID)
@@ -169,6 +194,22 @@ func (h *CampaignHandler) FetchCampaignData(c *gin.Context) {
 		return
 	}
 
+	// Fail fast when the platform connection cannot be used
+	status, err := h.campaignService.ConnectionStatus(c.Request.Context(), existingCampaign)
+	if err != nil {
+		h.logger.Error("Failed to get connection status", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check platform connection"})
+		return
+	}
+	switch status {
+	case models.ConnectionStatusNotConnected:
+		c.JSON(http.StatusConflict, gin.H{"error": "Platform account not connected", "connection_status": status})
+		return
+	case models.ConnectionStatusNeedsReauth:
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrConnectionNeedsReauth.Error(), "connection_status": status})
+		return
+	}
+
 	// Start data fetching in a goroutine to avoid blocking the API
 	go func() {
 		ctx := c.Request.Context()
@@ -180,6 +221,37 @@ func (h *CampaignHandler) FetchCampaignData(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Data fetch initiated"})
 }
 
+// GetSyncStatus handles GET /campaigns/:id/sync-status
+func (h *CampaignHandler) GetSyncStatus(c *gin.Context) {
+	campaignID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	// Verify the user owns this campaign
+	userID, _ := c.Get("user_id")
+	campaign, err := h.campaignService.GetCampaign(c.Request.Context(), campaignID)
+	if err != nil {
+		h.logger.Error("Failed to get campaign for sync status", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	if campaign.UserID != userID.(uuid.UUID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this campaign"})
+		return
+	}
+
+	state, err := h.campaignService.GetSyncState(c.Request.Context(), campaign)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sync status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
 // GetCampaignInsights handles GET /campaigns/:id/insights
 func (h *CampaignHandler) GetCampaignInsights(c *gin.Context) {
 	campaignID, err := uuid.Parse(c.Param("id"))
@@ -202,56 +274,58 @@ func (h *CampaignHandler) GetCampaignInsights(c *gin.Context) {
 		return
 	}
 
-	// Parse query parameters
-	var params models.CampaignInsightsParams
+	// Parse query parameters, in the campaign's timezone unless overridden
+	params, err := parseInsightsParams(c, existingCampaign.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	params.CampaignID = campaignID
 
-	// Parse start_date and end_date
-	startDateStr := c.Query("start_date")
-	if startDateStr != "" {
-		startDate, err := time.Parse("2006-01-02", startDateStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format (use YYYY-MM-DD)"})
-			return
-		}
-		params.StartDate = startDate
-	} else {
-		// Default to last 30 days
-		params.StartDate = time.Now().AddDate(0, 0, -30)
+	// Convert the amounts into a single currency if requested
+	currency, err := parseCurrency(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	endDateStr := c.Query("end_date")
-	if endDateStr != "" {
-		endDate, err := time.Parse("2006-01-02", endDateStr)
+	// Compare with another period if requested
+	compare, err := parseComparison(c, params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if compare != nil {
+		comparison, err := h.aggregationService.CompareCampaignInsights(c.Request.Context(), params, *compare, currency)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format (use YYYY-MM-DD)"})
+			h.logger.Error("Failed to compare campaign insights",
+				zap.Error(err),
+				zap.String("campaign_id", campaignID.String()),
+				zap.String("compare_to", string(compare.CompareTo)),
+			)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get campaign insights"})
 			return
 		}
-		params.EndDate = endDate
-	} else {
-		// Default to today
-		params.EndDate = time.Now()
-	}
 
-	// Parse platform filter
-	platformStr := c.Query("platform")
-	if platformStr != "" {
-		platform := models.Platform(platformStr)
-		params.Platform = &platform
+		c.JSON(http.StatusOK, comparison)
+		return
 	}
 
-	// Parse region filter
-	regionStr := c.Query("region")
-	if regionStr != "" {
-		params.Region = &regionStr
-	}
+	if currency != "" {
+		converted, err := h.aggregationService.GetConvertedCampaignInsights(c.Request.Context(), params, currency)
+		if err != nil {
+			h.logger.Error("Failed to get converted campaign insights",
+				zap.Error(err),
+				zap.String("campaign_id", campaignID.String()),
+				zap.String("currency", currency),
+			)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get campaign insights"})
+			return
+		}
 
-	// Parse granularity
-	granularity := c.Query("granularity")
-	if granularity == "" {
-		granularity = "daily" // Default granularity
+		c.JSON(http.StatusOK, converted)
+		return
 	}
-	params.Granularity = granularity
 
 	// Get insights
 	insights, err := h.aggregationService.GetCampaignInsights(c.Request.Context(), params)
@@ -267,8 +341,64 @@ func (h *CampaignHandler) GetCampaignInsights(c *gin.Context) {
 	c.JSON(http.StatusOK, insights)
 }
 
-// TriggerInsightsReaggregation handles POST /campaigns/:id/reaggregate
+// GetCampaignPacing handles GET /campaigns/:id/pacing. The budget is in the
+// currency query parameter if given, which spend is converted into.
+func (h *CampaignHandler) GetCampaignPacing(c *gin.Context) {
+	campaignID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	// Verify the user owns this campaign
+	userID, _ := c.Get("user_id")
+	campaign, err := h.campaignService.GetCampaign(c.Request.Context(), campaignID)
+	if err != nil {
+		h.logger.Error("Failed to get campaign for pacing", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	if campaign.UserID != userID.(uuid.UUID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this campaign"})
+		return
+	}
+
+	currency, err := parseCurrency(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pacing, err := h.pacingService.GetCampaignPacing(c.Request.Context(), campaign, currency, time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrPacingNeedsCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to get campaign pacing", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get campaign pacing"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pacing)
+}
+
+// TriggerInsightsReaggregation handles POST /campaigns/:id/reaggregate. The
+// range is re-aggregated by a job in the worker.
 func (h *CampaignHandler) TriggerInsightsReaggregation(c *gin.Context) {
+	h.createJob(c, models.JobTypeReaggregation)
+}
+
+// BackfillCampaignData handles POST /campaigns/:id/backfill. The range is
+// fetched again by a job in the worker, without moving the sync watermark.
+func (h *CampaignHandler) BackfillCampaignData(c *gin.Context) {
+	h.createJob(c, models.JobTypeBackfill)
+}
+
+// createJob queues a job over the start_date and end_date of the request,
+// the last 30 days by default
+func (h *CampaignHandler) createJob(c *gin.Context, jobType models.JobType) {
 	campaignID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
@@ -279,17 +409,18 @@ func (h *CampaignHandler) TriggerInsightsReaggregation(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	existingCampaign, err := h.campaignService.GetCampaign(c.Request.Context(), campaignID)
 	if err != nil {
-		h.logger.Error("Failed to get campaign for reaggregation", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+		h.logger.Error("Failed to get campaign for job", zap.Error(err), zap.String("campaign_id", campaignID.String()))
 		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
 		return
 	}
 
 	if existingCampaign.UserID != userID.(uuid.UUID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to reaggregate insights for this campaign"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to start jobs for this campaign"})
 		return
 	}
 
-	// Parse date range
+	// Parse date range, in days of the campaign's timezone
+	today := models.DateIn(time.Now(), existingCampaign.Location())
 	var startDate, endDate time.Time
 	startDateStr := c.Query("start_date")
 	if startDateStr != "" {
@@ -300,7 +431,7 @@ func (h *CampaignHandler) TriggerInsightsReaggregation(c *gin.Context) {
 		}
 	} else {
 		// Default to last 30 days
-		startDate = time.Now().AddDate(0, 0, -30)
+		startDate = today.AddDate(0, 0, -30)
 	}
 
 	endDateStr := c.Query("end_date")
@@ -312,19 +443,36 @@ func (h *CampaignHandler) TriggerInsightsReaggregation(c *gin.Context) {
 		}
 	} else {
 		// Default to today
-		endDate = time.Now()
+		endDate = today
 	}
 
-	// Trigger reaggregation in a goroutine
-	go func() {
-		ctx := c.Request.Context()
-		if err := h.aggregationService.TriggerReaggregation(ctx, campaignID, startDate, endDate); err != nil {
-			h.logger.Error("Failed to reaggregate insights", 
-				zap.Error(err), 
-				zap.String("campaign_id", campaignID.String()),
-			)
+	// A backfill needs a usable platform connection
+	if jobType == models.JobTypeBackfill {
+		status, err := h.campaignService.ConnectionStatus(c.Request.Context(), existingCampaign)
+		if err != nil {
+			h.logger.Error("Failed to get connection status", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check platform connection"})
+			return
 		}
-	}()
+		switch status {
+		case models.ConnectionStatusNotConnected:
+			c.JSON(http.StatusConflict, gin.H{"error": "Platform account not connected", "connection_status": status})
+			return
+		case models.ConnectionStatusNeedsReauth:
+			c.JSON(http.StatusConflict, gin.H{"error": services.ErrConnectionNeedsReauth.Error(), "connection_status": status})
+			return
+		}
+	}
+
+	job, err := h.jobService.CreateJob(c.Request.Context(), jobType, existingCampaign, startDate, endDate)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidJobRange) || errors.Is(err, services.ErrJobRangeTooLong) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Reaggregation initiated"})
+	c.JSON(http.StatusAccepted, newJobResponse(job))
 }
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"go.uber.org/zap"
+)
+
+// InsightsHandler handles HTTP requests for insights across campaigns
+type InsightsHandler struct {
+	portfolioService *services.PortfolioService
+	logger           *zap.Logger
+}
+
+// NewInsightsHandler creates a new insights handler
+func NewInsightsHandler(
+	portfolioService *services.PortfolioService,
+	logger *zap.Logger,
+) *InsightsHandler {
+	return &InsightsHandler{
+		portfolioService: portfolioService,
+		logger:           logger.With(zap.String("component", "insights_handler")),
+	}
+}
+
+// GetPortfolioInsights handles GET /insights. It aggregates the insights of
+// the user's campaigns, or of the campaign_ids given, narrowed down by
+// platform, status and tags, and splits them by the dimensions of group_by.
+func (h *InsightsHandler) GetPortfolioInsights(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Parse the campaign filters
+	var filter repository.CampaignFilter
+	if ids := c.Query("campaign_ids"); ids != "" {
+		filter.IDs = []uuid.UUID{}
+		for _, id := range strings.Split(ids, ",") {
+			campaignID, err := uuid.Parse(strings.TrimSpace(id))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID in campaign_ids"})
+				return
+			}
+			filter.IDs = append(filter.IDs, campaignID)
+		}
+	}
+	if platformStr := c.Query("platform"); platformStr != "" {
+		platform := models.Platform(platformStr)
+		if !platform.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid platform"})
+			return
+		}
+		filter.Platform = &platform
+	}
+	if status := c.Query("status"); status != "" {
+		filter.Status = &status
+	}
+	if tags := c.Query("tags"); tags != "" {
+		filter.Tags = strings.Split(tags, ",")
+	}
+
+	// Parse the insights parameters, in UTC unless overridden
+	params, err := parseInsightsParams(c, models.DefaultTimezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if params.GroupBy, err = models.ParseGroupBy(c.Query("group_by")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currency, err := parseCurrency(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Compare with another period if requested
+	compare, err := parseComparison(c, params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if compare != nil {
+		comparison, err := h.portfolioService.ComparePortfolioInsights(c.Request.Context(), userID.(uuid.UUID), filter, params, *compare, currency)
+		if err != nil {
+			h.logger.Error("Failed to compare portfolio insights", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get insights"})
+			return
+		}
+
+		c.JSON(http.StatusOK, comparison)
+		return
+	}
+
+	portfolio, err := h.portfolioService.GetPortfolioInsights(c.Request.Context(), userID.(uuid.UUID), filter, params, currency)
+	if err != nil {
+		h.logger.Error("Failed to get portfolio insights", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get insights"})
+		return
+	}
+
+	c.JSON(http.StatusOK, portfolio)
+}
+
+// parseInsightsParams parses the query parameters shared by the insights
+// endpoints. The timezone is the tz parameter, or defaultTimezone; days are
+// those of the ad accounts either way, and the timezone places hourly buckets
+// and the default range of the last 30 days. Since daily platform metrics
+// cannot be split across another timezone's days, a tz other than the
+// default is refused for granularities coarser than hourly.
+func parseInsightsParams(c *gin.Context, defaultTimezone string) (models.CampaignInsightsParams, error) {
+	var params models.CampaignInsightsParams
+
+	// Parse the timezone
+	tz := c.Query("tz")
+	if tz == "" {
+		tz = defaultTimezone
+	}
+	loc, err := models.LoadTimezone(tz)
+	if err != nil {
+		return params, errors.New("Invalid tz (use an IANA timezone such as America/New_York)")
+	}
+	params.Timezone = loc.String()
+	today := models.DateIn(time.Now(), loc)
+
+	// Parse start_date and end_date
+	startDateStr := c.Query("start_date")
+	if startDateStr != "" {
+		startDate, err := time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			return params, errors.New("Invalid start_date format (use YYYY-MM-DD)")
+		}
+		params.StartDate = startDate
+	} else {
+		// Default to last 30 days
+		params.StartDate = today.AddDate(0, 0, -30)
+	}
+
+	endDateStr := c.Query("end_date")
+	if endDateStr != "" {
+		endDate, err := time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			return params, errors.New("Invalid end_date format (use YYYY-MM-DD)")
+		}
+		params.EndDate = endDate
+	} else {
+		// Default to today
+		params.EndDate = today
+	}
+
+	// Parse platform filter
+	platformStr := c.Query("platform")
+	if platformStr != "" {
+		platform := models.Platform(platformStr)
+		params.Platform = &platform
+	}
+
+	// Parse region filter
+	regionStr := c.Query("region")
+	if regionStr != "" {
+		params.Region = &regionStr
+	}
+
+	// Parse granularity (defaults to daily)
+	granularity, err := models.ParseGranularity(c.Query("granularity"))
+	if err != nil {
+		return params, err
+	}
+	params.Granularity = granularity
+	if granularity != models.GranularityHourly && c.Query("tz") != "" {
+		defaultLoc, err := models.LoadTimezone(defaultTimezone)
+		if err != nil || defaultLoc.String() != params.Timezone {
+			return params, fmt.Errorf("tz only applies to hourly granularity; %s buckets are made of the ad accounts' days", granularity)
+		}
+	}
+
+	// Parse the first day of weekly buckets
+	weekStartStr := c.Query("week_start")
+	if weekStartStr == "" {
+		weekStartStr = viper.GetString("insights.week_start")
+	}
+	weekStart, err := models.ParseWeekStart(weekStartStr)
+	if err != nil {
+		return params, err
+	}
+	params.WeekStart = weekStart
+
+	return params, nil
+}
+
+// parseCurrency parses the currency amounts are converted into, "" when the
+// amounts are kept in the currencies they were reported in
+func parseCurrency(c *gin.Context) (string, error) {
+	currency := strings.ToUpper(c.Query("currency"))
+	if currency != "" && !models.IsValidCurrency(currency) {
+		return "", errors.New("Invalid currency (use an ISO 4217 code such as USD)")
+	}
+	return currency, nil
+}
+
+// parseComparison parses the period the insights of params are compared
+// with, nil when compare_to is not set. Custom periods are given by
+// compare_start_date and compare_end_date.
+func parseComparison(c *gin.Context, params models.CampaignInsightsParams) (*models.InsightsComparisonParams, error) {
+	compareToStr := c.Query("compare_to")
+	if compareToStr == "" {
+		return nil, nil
+	}
+	compareTo, err := models.ParseCompareTo(compareToStr)
+	if err != nil {
+		return nil, err
+	}
+
+	compare := &models.InsightsComparisonParams{CompareTo: compareTo}
+	if compareTo == models.CompareToCustom {
+		for _, date := range []struct {
+			name  string
+			value *time.Time
+		}{
+			{"compare_start_date", &compare.Custom.StartDate},
+			{"compare_end_date", &compare.Custom.EndDate},
+		} {
+			if *date.value, err = time.Parse("2006-01-02", c.Query(date.name)); err != nil {
+				return nil, fmt.Errorf("Invalid %s format (use YYYY-MM-DD)", date.name)
+			}
+		}
+	}
+
+	// Check that the periods can be compared
+	if _, err := compare.Range(models.DateRange{StartDate: params.StartDate, EndDate: params.EndDate}); err != nil {
+		return nil, err
+	}
+	return compare, nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseInsightsParamsTimezone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantTZ   string
+		wantFail bool
+	}{
+		{name: "default zone", query: "granularity=daily", wantTZ: "Europe/Berlin"},
+		{name: "hourly in another zone", query: "granularity=hourly&tz=America/New_York", wantTZ: "America/New_York"},
+		{name: "daily in the default zone", query: "granularity=daily&tz=Europe/Berlin", wantTZ: "Europe/Berlin"},
+		{name: "daily in another zone", query: "granularity=daily&tz=America/New_York", wantFail: true},
+		{name: "weekly in another zone", query: "granularity=weekly&tz=UTC", wantFail: true},
+		{name: "default granularity in another zone", query: "tz=Asia/Tokyo", wantFail: true},
+		{name: "unknown zone", query: "granularity=hourly&tz=Mars/Olympus", wantFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/insights?"+tt.query, nil)
+
+			params, err := parseInsightsParams(c, "Europe/Berlin")
+			if tt.wantFail {
+				if err == nil {
+					t.Errorf("parsed with tz %s, want an error", params.Timezone)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseInsightsParams: %v", err)
+			}
+			if params.Timezone != tt.wantTZ {
+				t.Errorf("timezone = %s, want %s", params.Timezone, tt.wantTZ)
+			}
+		})
+	}
+}
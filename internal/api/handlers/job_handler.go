@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"go.uber.org/zap"
+)
+
+// JobHandler handles job-related HTTP requests
+type JobHandler struct {
+	jobService *services.JobService
+	logger     *zap.Logger
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(
+	jobService *services.JobService,
+	logger *zap.Logger,
+) *JobHandler {
+	return &JobHandler{
+		jobService: jobService,
+		logger:     logger.With(zap.String("component", "job_handler")),
+	}
+}
+
+// jobResponse is a job with its progress
+type jobResponse struct {
+	*models.Job
+	Progress float64 `json:"progress"`
+}
+
+// newJobResponse creates the response body for a job
+func newJobResponse(job *models.Job) jobResponse {
+	return jobResponse{Job: job, Progress: job.Progress()}
+}
+
+// GetJob handles GET /jobs/:id
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, ok := h.ownedJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
+
+// CancelJob handles POST /jobs/:id/cancel
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	job, ok := h.ownedJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobService.CancelJob(c.Request.Context(), job.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrJobFinished) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Job already finished"})
+			return
+		}
+		if errors.Is(err, services.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		h.logger.Error("Failed to cancel job", zap.Error(err), zap.String("job_id", c.Param("id")))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
+
+// ownedJob loads the job of the request and verifies it belongs to the user.
+// It writes the error response and returns false otherwise.
+func (h *JobHandler) ownedJob(c *gin.Context) (*models.Job, bool) {
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return nil, false
+	}
+
+	job, err := h.jobService.GetJob(c.Request.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return nil, false
+		}
+		h.logger.Error("Failed to get job", zap.Error(err), zap.String("job_id", jobID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job"})
+		return nil, false
+	}
+
+	// Jobs of other users are reported as missing
+	userID, _ := c.Get("user_id")
+	if job.UserID != userID.(uuid.UUID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return nil, false
+	}
+
+	return job, true
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/oauth"
+	"go.uber.org/zap"
+)
+
+// oauthNonceCookie holds the state nonce of the browser's pending
+// authorization. It is only sent to the callback, and SameSite=Lax still
+// sends it on the top-level redirect from the consent page.
+const (
+	oauthNonceCookie     = "oauth_nonce"
+	oauthNonceCookiePath = "/api/v1/oauth/"
+)
+
+// PlatformHandler handles HTTP requests for connecting ad platform accounts
+type PlatformHandler struct {
+	credentialsService *services.CredentialsService
+	oauthService       *services.OAuthService
+	logger             *zap.Logger
+}
+
+// NewPlatformHandler creates a new platform handler
+func NewPlatformHandler(
+	credentialsService *services.CredentialsService,
+	oauthService *services.OAuthService,
+	logger *zap.Logger,
+) *PlatformHandler {
+	return &PlatformHandler{
+		credentialsService: credentialsService,
+		oauthService:       oauthService,
+		logger:             logger.With(zap.String("component", "platform_handler")),
+	}
+}
+
+// ListConnections handles GET /platforms
+func (h *PlatformHandler) ListConnections(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	connections, err := h.credentialsService.ListConnections(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		h.logger.Error("Failed to list platform connections", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list platform connections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, connections)
+}
+
+// ConnectPlatform handles POST /platforms/:platform/connect
+func (h *PlatformHandler) ConnectPlatform(c *gin.Context) {
+	platform := models.Platform(c.Param("platform"))
+	if !platform.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported platform"})
+		return
+	}
+
+	var req models.ConnectPlatformRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	connection, err := h.credentialsService.Connect(c.Request.Context(), userID.(uuid.UUID), platform, models.PlatformCredentials{
+		AccountID:       req.AccountID,
+		AccessToken:     req.AccessToken,
+		RefreshToken:    req.RefreshToken,
+		LoginCustomerID: req.LoginCustomerID,
+		ExpiresAt:       req.ExpiresAt,
+	})
+	if err != nil {
+		h.logger.Error("Failed to connect platform", zap.Error(err), zap.String("platform", string(platform)))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect platform"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, connection)
+}
+
+// DisconnectPlatform handles DELETE /platforms/:platform
+func (h *PlatformHandler) DisconnectPlatform(c *gin.Context) {
+	platform := models.Platform(c.Param("platform"))
+	if !platform.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported platform"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	err := h.credentialsService.Disconnect(c.Request.Context(), userID.(uuid.UUID), platform)
+	if err != nil {
+		if errors.Is(err, services.ErrCredentialsNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Platform not connected"})
+			return
+		}
+		h.logger.Error("Failed to disconnect platform", zap.Error(err), zap.String("platform", string(platform)))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect platform"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Platform disconnected"})
+}
+
+// Authorize handles GET /platforms/:platform/authorize
+func (h *PlatformHandler) Authorize(c *gin.Context) {
+	platform := models.Platform(c.Param("platform"))
+	if !platform.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported platform"})
+		return
+	}
+
+	accountID := c.Query("account_id")
+	if accountID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_id is required"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	url, nonce, err := h.oauthService.AuthorizeURL(c.Request.Context(), userID.(uuid.UUID), platform, accountID)
+	if err != nil {
+		if errors.Is(err, services.ErrOAuthNotConfigured) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to build authorization URL", zap.Error(err), zap.String("platform", string(platform)))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start authorization"})
+		return
+	}
+
+	setOAuthNonceCookie(c, nonce, int(services.StateLifetime/time.Second))
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+// OAuthCallback handles GET /oauth/:platform/callback.
+// The user is identified by the signed state, not by a JWT, because the
+// request is a redirect from the platform's consent page. The state must
+// carry the nonce of the browser's cookie, so it only completes in the
+// browser that started the flow.
+func (h *PlatformHandler) OAuthCallback(c *gin.Context) {
+	platform := models.Platform(c.Param("platform"))
+	if !platform.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported platform"})
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization denied: " + providerErr})
+		return
+	}
+
+	// TikTok names the code auth_code
+	code := c.Query("code")
+	if code == "" {
+		code = c.Query("auth_code")
+	}
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing authorization code"})
+		return
+	}
+
+	// The nonce is single-use, so the cookie is cleared whatever the outcome
+	nonce, _ := c.Cookie(oauthNonceCookie)
+	setOAuthNonceCookie(c, "", -1)
+
+	connection, err := h.oauthService.CompleteAuthorization(c.Request.Context(), platform, code, c.Query("state"), nonce)
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidState) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to complete authorization", zap.Error(err), zap.String("platform", string(platform)))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to complete authorization with the platform"})
+		return
+	}
+
+	c.JSON(http.StatusOK, connection)
+}
+
+// setOAuthNonceCookie sets the nonce cookie, or deletes it for a negative maxAge
+func setOAuthNonceCookie(c *gin.Context, nonce string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthNonceCookie, nonce, maxAge, oauthNonceCookiePath, "", secure, true)
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
 	"go.uber.org/zap"
 )
 
@@ -58,6 +59,17 @@ func (m *LoggerMiddleware) Logger() gin.HandlerFunc {
 	}
 }
 
+// TraceContext propagates the W3C trace context of a request, when the
+// caller sent one, to the Kafka messages produced while handling it
+func (m *LoggerMiddleware) TraceContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if traceParent := c.GetHeader(bus.HeaderTraceParent); traceParent != "" {
+			c.Request = c.Request.WithContext(bus.ContextWithTraceParent(c.Request.Context(), traceParent))
+		}
+		c.Next()
+	}
+}
+
 // ErrorLogger logs errors that occur during request processing
 func (m *LoggerMiddleware) ErrorLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -6,10 +6,15 @@ import (
 	"github.com/spf13/viper"
 	"github.com/zocket/campaign-analytics/internal/api/handlers"
 	"github.com/zocket/campaign-analytics/internal/api/middlewares"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
 	"github.com/zocket/campaign-analytics/internal/domain/services"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/codec"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/oauth"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/platforms"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/schema"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/secrets"
 	"github.com/zocket/campaign-analytics/internal/version"
 	"go.uber.org/zap"
 )
@@ -40,6 +45,7 @@ func SetupRouter(
 	router.Use(gin.Recovery())
 	router.Use(loggerMiddleware.Logger())
 	router.Use(loggerMiddleware.ErrorLogger())
+	router.Use(loggerMiddleware.TraceContext())
 
 	// Apply rate limiting with defaults if config not set
 	rateLimit := viper.GetInt("rate_limiting.default_rate")
@@ -49,31 +55,118 @@ func SetupRouter(
 	router.Use(rateLimiter.RateLimit(rateLimit, 60)) // Default: 100 requests per minute
 
 	// Create service instances
-	campaignService, err := services.NewCampaignService(
+	sealer, err := secrets.NewSealer()
+	if err != nil {
+		logger.Fatal("Failed to create credentials sealer", zap.Error(err))
+	}
+
+	credentialsService := services.NewCredentialsService(
 		postgresDB,
-		platformClients,
+		sealer,
 		logger,
 	)
+
+	eventCodec, err := codec.NewCampaignEventCodec(schema.NewRegistry())
 	if err != nil {
-		logger.Fatal("Failed to create campaign service", zap.Error(err))
+		logger.Fatal("Failed to create campaign event codec", zap.Error(err))
 	}
 
+	campaignRepository := database.NewCampaignRepository(postgresDB)
+
+	campaignService := services.NewCampaignService(
+		campaignRepository,
+		platformClients,
+		credentialsService,
+		services.SyncWindowConfig{
+			InitialDays:     viper.GetInt("sync.initial_days"),
+			RestatementDays: viper.GetInt("sync.restatement_days"),
+		},
+		eventCodec,
+		logger,
+	)
+
+	fxService := services.NewFXService(
+		database.NewFXRateStore(clickhouseDB),
+		viper.GetString("fx.base_currency"),
+		logger,
+	)
+
 	aggregationService := services.NewAggregationService(
-		clickhouseDB,
+		database.NewInsightsStore(clickhouseDB),
+		fxService,
 		redisClient,
 		logger,
 	)
 
+	portfolioService := services.NewPortfolioService(
+		campaignRepository,
+		aggregationService,
+		logger,
+	)
+
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(
-		postgresDB,
+		database.NewUserRepository(postgresDB),
 		logger,
 		jwtKey,
 	)
 
+	// Jobs are queued here and run by the worker
+	jobService := services.NewJobService(
+		database.NewJobRepository(postgresDB),
+		campaignService,
+		aggregationService,
+		services.JobConfig{
+			ChunkDays: viper.GetInt("jobs.chunk_days"),
+			MaxDays:   viper.GetInt("jobs.max_days"),
+		},
+		logger,
+	)
+
+	pacingService := services.NewPacingService(
+		aggregationService,
+		models.PacingConfig{
+			RunRateDays: viper.GetInt("pacing.run_rate_days"),
+			Tolerance:   viper.GetFloat64("pacing.tolerance"),
+		},
+		logger,
+	)
+
 	campaignHandler := handlers.NewCampaignHandler(
 		campaignService,
 		aggregationService,
+		jobService,
+		pacingService,
+		logger,
+	)
+
+	insightsHandler := handlers.NewInsightsHandler(
+		portfolioService,
+		logger,
+	)
+
+	jobHandler := handlers.NewJobHandler(
+		jobService,
+		logger,
+	)
+
+	oauthService := services.NewOAuthService(
+		oauth.NewProviders(),
+		credentialsService,
+		redisClient,
+		oauth.StateKey(jwtKey),
+		logger,
+	)
+
+	platformHandler := handlers.NewPlatformHandler(
+		credentialsService,
+		oauthService,
+		logger,
+	)
+
+	adminHandler := handlers.NewAdminHandler(
+		services.NewDeadLetterService(viper.GetStringSlice("kafka.consumer.topics"), logger),
+		fxService,
 		logger,
 	)
 
@@ -107,16 +200,49 @@ func SetupRouter(
 			campaigns.GET("/:id", campaignHandler.GetCampaign)
 			campaigns.PUT("/:id", campaignHandler.UpdateCampaign)
 			campaigns.POST("/:id/fetch-data", campaignHandler.FetchCampaignData)
+			campaigns.GET("/:id/sync-status", campaignHandler.GetSyncStatus)
 			campaigns.GET("/:id/insights", campaignHandler.GetCampaignInsights)
+			campaigns.GET("/:id/pacing", campaignHandler.GetCampaignPacing)
 			campaigns.POST("/:id/reaggregate", campaignHandler.TriggerInsightsReaggregation)
+			campaigns.POST("/:id/backfill", campaignHandler.BackfillCampaignData)
 		}
 
+		// Insights across campaigns (protected)
+		insights := v1.Group("/insights")
+		insights.Use(authMiddleware.AuthRequired())
+		{
+			insights.GET("", insightsHandler.GetPortfolioInsights)
+		}
+
+		// Job routes (protected)
+		jobs := v1.Group("/jobs")
+		jobs.Use(authMiddleware.AuthRequired())
+		{
+			jobs.GET("/:id", jobHandler.GetJob)
+			jobs.POST("/:id/cancel", jobHandler.CancelJob)
+		}
+
+		// Platform connection routes (protected)
+		platformRoutes := v1.Group("/platforms")
+		platformRoutes.Use(authMiddleware.AuthRequired())
+		{
+			platformRoutes.GET("", platformHandler.ListConnections)
+			platformRoutes.GET("/:platform/authorize", platformHandler.Authorize)
+			platformRoutes.POST("/:platform/connect", platformHandler.ConnectPlatform)
+			platformRoutes.DELETE("/:platform", platformHandler.DisconnectPlatform)
+		}
+
+		// OAuth callbacks are authenticated by their signed state
+		v1.GET("/oauth/:platform/callback", platformHandler.OAuthCallback)
+
 		// Admin routes (protected + role requirement)
 		admin := v1.Group("/admin")
 		admin.Use(authMiddleware.AuthRequired())
-		admin.Use(authMiddleware.RoleRequired("admin"))
+		admin.Use(authMiddleware.RoleRequired(models.RoleAdmin))
 		{
-			// Admin-only endpoints here
+			admin.GET("/dlq", adminHandler.ListDeadLetters)
+			admin.POST("/dlq/:partition/:offset/redrive", adminHandler.RedriveDeadLetter)
+			admin.POST("/fx-rates", adminHandler.LoadFXRates)
 		}
 	}
 
@@ -80,8 +80,18 @@ func setDefaults() {
 	// Kafka defaults
 	viper.SetDefault("kafka.brokers", []string{"localhost:9092"})
 	viper.SetDefault("kafka.consumer.group_id", "campaign-analytics-consumer")
+	viper.SetDefault("kafka.consumer.topics", []string{"campaign_events", "campaign_webhooks", "campaign_uploads"})
+	viper.SetDefault("kafka.consumer.max_attempts", 5)
+	viper.SetDefault("kafka.consumer.initial_backoff", 500*time.Millisecond)
+	viper.SetDefault("kafka.consumer.max_backoff", 30*time.Second)
+	viper.SetDefault("kafka.consumer.batch_size", 1000)
+	viper.SetDefault("kafka.consumer.batch_timeout", 1*time.Second)
+	viper.SetDefault("kafka.consumer.concurrency", 4)
+	viper.SetDefault("kafka.consumer.shutdown_timeout", 30*time.Second)
 	viper.SetDefault("kafka.producer.require_acks", "all")
 	viper.SetDefault("kafka.producer.max_attempts", 10)
+	viper.SetDefault("kafka.producer.encoding", "json")
+	viper.SetDefault("kafka.schema_registry.url", "")
 
 	// JWT defaults
 	viper.SetDefault("jwt.key", "default-jwt-secret-key-change-in-production")
@@ -91,6 +101,66 @@ func setDefaults() {
 	viper.SetDefault("rate_limiting.default_rate", 100) // per minute
 	viper.SetDefault("rate_limiting.heavy_rate", 20)    // per minute
 
+	// Platform OAuth defaults (client IDs and secrets must be configured)
+	viper.SetDefault("platforms.meta.oauth.auth_url", "https://www.facebook.com/v16.0/dialog/oauth")
+	viper.SetDefault("platforms.meta.oauth.token_url", "https://graph.facebook.com/v16.0/oauth/access_token")
+	viper.SetDefault("platforms.meta.oauth.scopes", []string{"ads_read"})
+	viper.SetDefault("platforms.google.oauth.auth_url", "https://accounts.google.com/o/oauth2/v2/auth")
+	viper.SetDefault("platforms.google.oauth.token_url", "https://oauth2.googleapis.com/token")
+	viper.SetDefault("platforms.google.oauth.scopes", []string{"https://www.googleapis.com/auth/adwords"})
+	viper.SetDefault("platforms.linkedin.oauth.auth_url", "https://www.linkedin.com/oauth/v2/authorization")
+	viper.SetDefault("platforms.linkedin.oauth.token_url", "https://www.linkedin.com/oauth/v2/accessToken")
+	viper.SetDefault("platforms.linkedin.oauth.scopes", []string{"r_ads_reporting"})
+	viper.SetDefault("platforms.tiktok.oauth.auth_url", "https://business-api.tiktok.com/portal/auth")
+	viper.SetDefault("platforms.tiktok.oauth.token_url", "https://business-api.tiktok.com/open_api/v1.3/oauth2/access_token/")
+
+	// Token refresher defaults
+	viper.SetDefault("oauth.refresh_interval", 1*time.Minute)
+	viper.SetDefault("oauth.refresh_window", 10*time.Minute)
+
+	// Sync window defaults
+	viper.SetDefault("sync.initial_days", 30)
+	viper.SetDefault("sync.restatement_days", 3)
+
+	// Scheduler defaults
+	viper.SetDefault("scheduler.enabled", true)
+	viper.SetDefault("scheduler.interval", 1*time.Hour)
+	viper.SetDefault("scheduler.tick", 1*time.Minute)
+	viper.SetDefault("scheduler.jitter", 30*time.Second)
+	viper.SetDefault("scheduler.lock_ttl", 10*time.Minute)
+	viper.SetDefault("scheduler.concurrency.default", 2)
+
+	// In-memory message bus of the worker's dev mode
+	viper.SetDefault("bus.memory.partitions", 4)
+
+	// Outbox relay defaults
+	viper.SetDefault("outbox.enabled", true)
+	viper.SetDefault("outbox.poll_interval", 1*time.Second)
+	viper.SetDefault("outbox.batch_size", 500)
+	viper.SetDefault("outbox.retention", 7*24*time.Hour)
+
+	// Job defaults
+	viper.SetDefault("jobs.enabled", true)
+	viper.SetDefault("jobs.chunk_days", 7)
+	viper.SetDefault("jobs.max_days", 730)
+	viper.SetDefault("jobs.poll_interval", 5*time.Second)
+	viper.SetDefault("jobs.lease_ttl", 10*time.Minute)
+	viper.SetDefault("jobs.chunk_attempts", 3)
+	viper.SetDefault("jobs.retry_backoff", 30*time.Second)
+
+	// Exchange rate defaults
+	viper.SetDefault("fx.base_currency", "EUR")
+
+	// Migration defaults
+	viper.SetDefault("migrations.on_start", true)
+
+	// Insights defaults
+	viper.SetDefault("insights.week_start", "monday")
+
+	// Pacing defaults
+	viper.SetDefault("pacing.run_rate_days", 7)
+	viper.SetDefault("pacing.tolerance", 0.1)
+
 	// Logging defaults
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.development", false)
@@ -111,5 +181,14 @@ func validateConfig() error {
 		}
 	}
 
+	// Meta breakdowns are limited to those events have a column for
+	for _, breakdown := range viper.GetStringSlice("platforms.meta.breakdowns") {
+		switch breakdown {
+		case "region", "publisher_platform", "device_platform":
+		default:
+			return fmt.Errorf("unsupported platforms.meta.breakdowns value %q: use region, publisher_platform or device_platform", breakdown)
+		}
+	}
+
 	return nil
 }
@@ -1,9 +1,13 @@
 package models
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // Platform represents an advertising platform (Meta, Google, etc.)
@@ -16,6 +20,16 @@ const (
 	PlatformTikTok   Platform = "tiktok"
 )
 
+// IsValid reports whether p is a supported platform
+func (p Platform) IsValid() bool {
+	switch p {
+	case PlatformMeta, PlatformGoogle, PlatformLinkedIn, PlatformTikTok:
+		return true
+	default:
+		return false
+	}
+}
+
 // Campaign represents a marketing campaign
 type Campaign struct {
 	ID          uuid.UUID `json:"id" db:"id"`
@@ -27,8 +41,117 @@ type Campaign struct {
 	EndDate     time.Time `json:"end_date" db:"end_date"`
 	Status      string    `json:"status" db:"status"`
 	ExternalID  string    `json:"external_id" db:"external_id"`
+	Timezone    string    `json:"timezone" db:"timezone"` // IANA timezone of the ad account, e.g. America/New_York
+	Tags        pq.StringArray `json:"tags" db:"tags"`     // free-form labels to group campaigns by, e.g. brand or q4
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+
+	// ConnectionStatus reports whether the owner's platform connection can be used to fetch data
+	ConnectionStatus ConnectionStatus `json:"connection_status,omitempty" db:"-"`
+}
+
+// NormalizeTags trims and lower-cases tags, dropping empty and repeated ones.
+// The result is sorted and never nil.
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// DefaultTimezone is the timezone of campaigns that do not set one
+const DefaultTimezone = "UTC"
+
+// LoadTimezone loads an IANA timezone, UTC when empty. The server's local
+// zone is rejected so results never depend on where the code runs.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// Location returns the timezone of the campaign's ad account, UTC when unset
+// or unknown
+func (c *Campaign) Location() *time.Location {
+	loc, err := LoadTimezone(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// DateIn returns the calendar day of t in loc, as midnight UTC
+func DateIn(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// StartOfDayIn returns the instant the calendar day of date, read in UTC,
+// starts in loc
+func StartOfDayIn(date time.Time, loc *time.Location) time.Time {
+	year, month, day := date.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// CampaignStatusActive is the status of campaigns that are synced automatically
+const CampaignStatusActive = "active"
+
+// LifecycleEventType is a kind of change to a campaign
+type LifecycleEventType string
+
+const (
+	LifecycleCampaignCreated       LifecycleEventType = "created"
+	LifecycleCampaignUpdated       LifecycleEventType = "updated"
+	LifecycleCampaignStatusChanged LifecycleEventType = "status_changed"
+)
+
+// CampaignLifecycleEvent announces a change to a campaign to downstream
+// services. Campaign is the state after the change.
+type CampaignLifecycleEvent struct {
+	ID             uuid.UUID          `json:"id"`
+	Type           LifecycleEventType `json:"type"`
+	CampaignID     uuid.UUID          `json:"campaign_id"`
+	PreviousStatus string             `json:"previous_status,omitempty"`
+	Campaign       Campaign           `json:"campaign"`
+	OccurredAt     time.Time          `json:"occurred_at"`
+}
+
+// SyncStatus is the outcome of the last platform sync of a campaign
+type SyncStatus string
+
+const (
+	SyncStatusNeverSynced SyncStatus = "never_synced"
+	SyncStatusSucceeded   SyncStatus = "succeeded"
+	SyncStatusPartial     SyncStatus = "partial"
+	SyncStatusFailed      SyncStatus = "failed"
+)
+
+// CampaignSyncState records the platform sync progress of a campaign. The
+// window of the last successful fetch is the watermark the next sync starts from.
+type CampaignSyncState struct {
+	CampaignID    uuid.UUID  `json:"campaign_id" db:"campaign_id"`
+	Platform      Platform   `json:"platform" db:"platform"`
+	WindowStart   *time.Time `json:"window_start,omitempty" db:"window_start"`
+	WindowEnd     *time.Time `json:"window_end,omitempty" db:"window_end"`
+	LastSyncedAt  *time.Time `json:"last_synced_at,omitempty" db:"last_synced_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty" db:"last_attempt_at"`
+	LastStatus    SyncStatus `json:"last_status" db:"last_status"`
+	LastError     *string    `json:"last_error,omitempty" db:"last_error"`
+	EventCount    int        `json:"event_count" db:"event_count"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // CampaignEvent represents raw event data received from ad platforms
@@ -43,7 +166,9 @@ type CampaignEvent struct {
 	Spend         float64   `json:"spend" db:"spend"`
 	Revenue       float64   `json:"revenue" db:"revenue"`
 	EventTime     time.Time `json:"event_time" db:"event_time"`
+	LocalDate     time.Time `json:"local_date" db:"local_date"` // Day of EventTime in the ad account's timezone, at UTC midnight
 	Region        string    `json:"region" db:"region"`
+	Placement     string    `json:"placement,omitempty" db:"placement"` // Where the ads ran, e.g. Meta's instagram/mobile_app; empty when not broken down
 	Currency      string    `json:"currency" db:"currency"`
 	DeduplicationKey string `json:"deduplication_key" db:"deduplication_key"`
 	ReceivedAt    time.Time `json:"received_at" db:"received_at"`
@@ -56,6 +181,7 @@ type CampaignInsights struct {
 	Date          time.Time `json:"date" db:"date"`
 	Platform      Platform  `json:"platform" db:"platform"`
 	Region        string    `json:"region" db:"region"`
+	Currency      string    `json:"currency" db:"currency"` // ISO 4217 code the amounts are in
 	Impressions   int64     `json:"impressions" db:"impressions"`
 	Clicks        int64     `json:"clicks" db:"clicks"`
 	Conversions   int64     `json:"conversions" db:"conversions"`
@@ -69,12 +195,99 @@ type CampaignInsights struct {
 	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Granularity represents the time bucket size used to roll up insights
+type Granularity string
+
+const (
+	GranularityHourly    Granularity = "hourly"
+	GranularityDaily     Granularity = "daily"
+	GranularityWeekly    Granularity = "weekly"
+	GranularityMonthly   Granularity = "monthly"
+	GranularityQuarterly Granularity = "quarterly"
+)
+
+// ParseGranularity validates a granularity string, defaulting to daily when empty
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case "":
+		return GranularityDaily, nil
+	case GranularityHourly, GranularityDaily, GranularityWeekly, GranularityMonthly, GranularityQuarterly:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unsupported granularity %q (use hourly, daily, weekly, monthly or quarterly)", s)
+	}
+}
+
+// ParseWeekStart parses the first day of the week used for weekly buckets.
+// Only monday (ISO 8601) and sunday are supported.
+func ParseWeekStart(s string) (time.Weekday, error) {
+	switch s {
+	case "", "monday":
+		return time.Monday, nil
+	case "sunday":
+		return time.Sunday, nil
+	default:
+		return time.Monday, fmt.Errorf("unsupported week start %q (use monday or sunday)", s)
+	}
+}
+
+// InsightsDimension is a dimension insights rows can be split by. Rows are
+// always split by currency.
+type InsightsDimension string
+
+const (
+	DimensionCampaign InsightsDimension = "campaign"
+	DimensionDate     InsightsDimension = "date"
+	DimensionPlatform InsightsDimension = "platform"
+	DimensionRegion   InsightsDimension = "region"
+)
+
+// ParseGroupBy parses a comma-separated list of dimensions, defaulting to
+// date buckets when empty
+func ParseGroupBy(s string) ([]InsightsDimension, error) {
+	if s == "" {
+		return []InsightsDimension{DimensionDate}, nil
+	}
+
+	var dimensions []InsightsDimension
+	seen := make(map[InsightsDimension]bool)
+	for _, name := range strings.Split(s, ",") {
+		switch d := InsightsDimension(strings.TrimSpace(name)); d {
+		case DimensionCampaign, DimensionDate, DimensionPlatform, DimensionRegion:
+			if !seen[d] {
+				seen[d] = true
+				dimensions = append(dimensions, d)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported group_by dimension %q (use campaign, date, platform or region)", name)
+		}
+	}
+	return dimensions, nil
+}
+
 // CampaignInsightsParams represents parameters for querying campaign insights
 type CampaignInsightsParams struct {
-	CampaignID  uuid.UUID  `json:"campaign_id" form:"campaign_id"`
-	StartDate   time.Time  `json:"start_date" form:"start_date"`
-	EndDate     time.Time  `json:"end_date" form:"end_date"`
-	Platform    *Platform  `json:"platform" form:"platform"`
-	Region      *string    `json:"region" form:"region"`
-	Granularity string     `json:"granularity" form:"granularity"` // daily, weekly, monthly
+	CampaignID  uuid.UUID    `json:"campaign_id" form:"campaign_id"`
+	CampaignIDs []uuid.UUID  `json:"campaign_ids" form:"-"`          // restricts the query to these campaigns unless nil
+	StartDate   time.Time    `json:"start_date" form:"start_date"`
+	EndDate     time.Time    `json:"end_date" form:"end_date"`
+	Platform    *Platform    `json:"platform" form:"platform"`
+	Region      *string      `json:"region" form:"region"`
+	Granularity Granularity  `json:"granularity" form:"granularity"` // hourly, daily, weekly, monthly, quarterly
+	WeekStart   time.Weekday `json:"week_start" form:"week_start"`   // first day of weekly buckets (Monday or Sunday)
+	Timezone    string       `json:"tz" form:"tz"`                   // IANA timezone of hourly buckets and their range, UTC when empty
+	GroupBy     []InsightsDimension `json:"group_by" form:"-"`       // dimensions rows are split by; nil splits by every dimension
+}
+
+// GroupsBy reports whether rows are split by a dimension
+func (p *CampaignInsightsParams) GroupsBy(dimension InsightsDimension) bool {
+	if p.GroupBy == nil {
+		return true
+	}
+	for _, d := range p.GroupBy {
+		if d == dimension {
+			return true
+		}
+	}
+	return false
 }
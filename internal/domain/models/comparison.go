@@ -0,0 +1,342 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CompareTo names the period insights are compared with
+type CompareTo string
+
+const (
+	// CompareToPreviousPeriod compares with as many days right before
+	CompareToPreviousPeriod CompareTo = "previous_period"
+	// CompareToPreviousYear compares with the same days a year earlier
+	CompareToPreviousYear CompareTo = "previous_year"
+	// CompareToCustom compares with a range given explicitly
+	CompareToCustom CompareTo = "custom"
+)
+
+// ParseCompareTo validates a comparison period string
+func ParseCompareTo(s string) (CompareTo, error) {
+	switch c := CompareTo(s); c {
+	case CompareToPreviousPeriod, CompareToPreviousYear, CompareToCustom:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unsupported compare_to %q (use previous_period, previous_year or custom)", s)
+	}
+}
+
+// DateRange is a range of days, both inclusive
+type DateRange struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+// InsightsComparisonParams selects the period insights are compared with
+type InsightsComparisonParams struct {
+	CompareTo CompareTo
+	Custom    DateRange // the range compared with, for CompareToCustom only
+}
+
+// Range returns the range of days current is compared with
+func (p InsightsComparisonParams) Range(current DateRange) (DateRange, error) {
+	if current.StartDate.IsZero() || current.EndDate.IsZero() || current.EndDate.Before(current.StartDate) {
+		return DateRange{}, errors.New("comparison needs a start date on or before the end date")
+	}
+
+	switch p.CompareTo {
+	case CompareToPreviousPeriod:
+		days := int(current.EndDate.Sub(current.StartDate)/(24*time.Hour)) + 1
+		return DateRange{
+			StartDate: current.StartDate.AddDate(0, 0, -days),
+			EndDate:   current.StartDate.AddDate(0, 0, -1),
+		}, nil
+	case CompareToPreviousYear:
+		return DateRange{StartDate: yearEarlier(current.StartDate), EndDate: yearEarlier(current.EndDate)}, nil
+	case CompareToCustom:
+		if p.Custom.StartDate.IsZero() || p.Custom.EndDate.IsZero() || p.Custom.EndDate.Before(p.Custom.StartDate) {
+			return DateRange{}, errors.New("custom comparison needs a compare_start_date on or before the compare_end_date")
+		}
+		return p.Custom, nil
+	default:
+		return DateRange{}, fmt.Errorf("unsupported compare_to %q", p.CompareTo)
+	}
+}
+
+// yearEarlier returns the same day a year earlier, February 29 becoming
+// February 28
+func yearEarlier(date time.Time) time.Time {
+	year, month, day := date.UTC().Date()
+	earlier := time.Date(year-1, month, day, 0, 0, 0, 0, time.UTC)
+	if earlier.Month() != month {
+		earlier = time.Date(year-1, month+1, 0, 0, 0, 0, 0, time.UTC)
+	}
+	return earlier
+}
+
+// InsightsComparison compares the insights of a range of days with those of
+// another. Buckets are aligned by position: the first bucket of the current
+// range with the first of the comparison range and so on, as listed in
+// Alignment. Rows and Totals pair the metrics of aligned buckets with the
+// same dimensions and currency; a side without data counts as zero.
+type InsightsComparison struct {
+	CompareTo    CompareTo               `json:"compare_to"`
+	Current      DateRange               `json:"current"`
+	Comparison   DateRange               `json:"comparison"`
+	Granularity  Granularity             `json:"granularity"`
+	CampaignIDs  []uuid.UUID             `json:"campaign_ids,omitempty"` // set for portfolios
+	GroupBy      []InsightsDimension     `json:"group_by,omitempty"`     // set for portfolios
+	Currency     string                  `json:"currency,omitempty"`     // set when amounts were converted
+	Alignment    []BucketAlignment       `json:"alignment"`
+	Rows         []InsightsComparisonRow `json:"rows"`
+	Totals       []InsightsComparisonRow `json:"totals"`
+	MissingRates []MissingFXRate         `json:"missing_rates,omitempty"`
+}
+
+// BucketAlignment pairs a bucket of the current range with the bucket of the
+// comparison range it is compared with. A range with fewer buckets than the
+// other leaves its side out.
+type BucketAlignment struct {
+	Date           *time.Time `json:"date,omitempty"`
+	ComparisonDate *time.Time `json:"comparison_date,omitempty"`
+}
+
+// InsightsComparisonRow compares the metrics of a row of insights. Like in
+// PortfolioInsightsRow, dimensions the rows are not split by are left out.
+type InsightsComparisonRow struct {
+	CampaignID     *uuid.UUID      `json:"campaign_id,omitempty"`
+	Date           *time.Time      `json:"date,omitempty"`
+	ComparisonDate *time.Time      `json:"comparison_date,omitempty"`
+	Platform       Platform        `json:"platform,omitempty"`
+	Region         string          `json:"region,omitempty"`
+	Currency       string          `json:"currency"`
+	Metrics        ComparedMetrics `json:"metrics"`
+}
+
+// ComparedMetrics compares each metric of an insights row
+type ComparedMetrics struct {
+	Impressions    MetricComparison `json:"impressions"`
+	Clicks         MetricComparison `json:"clicks"`
+	Conversions    MetricComparison `json:"conversions"`
+	Spend          MetricComparison `json:"spend"`
+	Revenue        MetricComparison `json:"revenue"`
+	CTR            MetricComparison `json:"ctr"`
+	CPC            MetricComparison `json:"cpc"`
+	CPA            MetricComparison `json:"cpa"`
+	ROAS           MetricComparison `json:"roas"`
+	ConversionRate MetricComparison `json:"conversion_rate"`
+}
+
+// MetricComparison is the value of a metric in both periods. DeltaPercent is
+// the change relative to the comparison value, in percent, and nil when the
+// comparison value is zero.
+type MetricComparison struct {
+	Current      float64  `json:"current"`
+	Comparison   float64  `json:"comparison"`
+	Delta        float64  `json:"delta"`
+	DeltaPercent *float64 `json:"delta_pct"`
+}
+
+// NewMetricComparison compares the value of a metric in two periods
+func NewMetricComparison(current, comparison float64) MetricComparison {
+	m := MetricComparison{Current: current, Comparison: comparison, Delta: current - comparison}
+	if comparison != 0 {
+		pct := m.Delta / comparison * 100
+		m.DeltaPercent = &pct
+	}
+	return m
+}
+
+// CompareMetrics compares the metrics of two insights rows
+func CompareMetrics(current, comparison CampaignInsights) ComparedMetrics {
+	return ComparedMetrics{
+		Impressions:    NewMetricComparison(float64(current.Impressions), float64(comparison.Impressions)),
+		Clicks:         NewMetricComparison(float64(current.Clicks), float64(comparison.Clicks)),
+		Conversions:    NewMetricComparison(float64(current.Conversions), float64(comparison.Conversions)),
+		Spend:          NewMetricComparison(current.Spend, comparison.Spend),
+		Revenue:        NewMetricComparison(current.Revenue, comparison.Revenue),
+		CTR:            NewMetricComparison(current.CTR, comparison.CTR),
+		CPC:            NewMetricComparison(current.CPC, comparison.CPC),
+		CPA:            NewMetricComparison(current.CPA, comparison.CPA),
+		ROAS:           NewMetricComparison(current.ROAS, comparison.ROAS),
+		ConversionRate: NewMetricComparison(current.ConversionRate, comparison.ConversionRate),
+	}
+}
+
+// BucketStarts lists the buckets of a granularity that cover a range of
+// days, in order. Hourly buckets are the hours of loc from the midnight
+// starting the range to the one ending it.
+func BucketStarts(granularity Granularity, weekStart time.Weekday, days DateRange, loc *time.Location) []time.Time {
+	var buckets []time.Time
+	if granularity == GranularityHourly {
+		end := StartOfDayIn(days.EndDate.AddDate(0, 0, 1), loc)
+		for hour := StartOfDayIn(days.StartDate, loc); hour.Before(end); hour = hour.Add(time.Hour) {
+			buckets = append(buckets, hour)
+		}
+		return buckets
+	}
+
+	end := DateIn(days.EndDate, time.UTC)
+	for bucket := BucketStart(granularity, weekStart, days.StartDate); !bucket.After(end); {
+		buckets = append(buckets, bucket)
+		switch granularity {
+		case GranularityWeekly:
+			bucket = bucket.AddDate(0, 0, 7)
+		case GranularityMonthly:
+			bucket = bucket.AddDate(0, 1, 0)
+		case GranularityQuarterly:
+			bucket = bucket.AddDate(0, 3, 0)
+		default:
+			bucket = bucket.AddDate(0, 0, 1)
+		}
+	}
+	return buckets
+}
+
+// comparisonKey identifies a row of an InsightsComparison
+type comparisonKey struct {
+	campaignID uuid.UUID
+	position   int
+	platform   Platform
+	region     string
+	currency   string
+}
+
+// comparedRows sums the rows of both periods that share a key
+type comparedRows struct {
+	key                 comparisonKey
+	current, comparison CampaignInsights
+}
+
+// CompareInsights pairs the rows of the current range with those of the
+// comparison range. Both are rows as returned by an InsightsStore for params,
+// one over each range; loc is the timezone of hourly buckets.
+func CompareInsights(params CampaignInsightsParams, loc *time.Location, current, comparison DateRange, currentRows, comparisonRows []CampaignInsights) *InsightsComparison {
+	result := &InsightsComparison{
+		Current:     current,
+		Comparison:  comparison,
+		Granularity: params.Granularity,
+		Alignment:   []BucketAlignment{},
+	}
+
+	// Number the buckets of both ranges
+	var currentBuckets, comparisonBuckets []time.Time
+	if params.GroupsBy(DimensionDate) {
+		currentBuckets = BucketStarts(params.Granularity, params.WeekStart, current, loc)
+		comparisonBuckets = BucketStarts(params.Granularity, params.WeekStart, comparison, loc)
+		for i := 0; i < len(currentBuckets) || i < len(comparisonBuckets); i++ {
+			result.Alignment = append(result.Alignment, BucketAlignment{
+				Date:           bucketAt(currentBuckets, i),
+				ComparisonDate: bucketAt(comparisonBuckets, i),
+			})
+		}
+	}
+
+	result.Rows = compareRows(params, currentBuckets, comparisonBuckets, currentRows, comparisonRows)
+
+	// Totals are re-summed from the rows, one per currency
+	total := []InsightsDimension{}
+	result.Totals = compareRows(CampaignInsightsParams{GroupBy: total}, nil, nil,
+		GroupInsights(currentRows, total, params.Granularity, params.WeekStart),
+		GroupInsights(comparisonRows, total, params.Granularity, params.WeekStart))
+	return result
+}
+
+// compareRows pairs rows by the position of their bucket, when split by
+// date, and their other dimensions
+func compareRows(params CampaignInsightsParams, currentBuckets, comparisonBuckets []time.Time, currentRows, comparisonRows []CampaignInsights) []InsightsComparisonRow {
+	positions := func(buckets []time.Time) map[int64]int {
+		index := make(map[int64]int, len(buckets))
+		for i, bucket := range buckets {
+			index[bucket.Unix()] = i
+		}
+		return index
+	}
+	currentPositions, comparisonPositions := positions(currentBuckets), positions(comparisonBuckets)
+
+	pairs := make(map[comparisonKey]*comparedRows)
+	add := func(row CampaignInsights, index map[int64]int, isCurrent bool) {
+		key := comparisonKey{
+			campaignID: row.CampaignID,
+			position:   index[row.Date.Unix()],
+			platform:   row.Platform,
+			region:     row.Region,
+			currency:   row.Currency,
+		}
+		pair, exists := pairs[key]
+		if !exists {
+			pair = &comparedRows{key: key}
+			pairs[key] = pair
+		}
+		if isCurrent {
+			pair.current = row
+		} else {
+			pair.comparison = row
+		}
+	}
+	for _, row := range currentRows {
+		add(row, currentPositions, true)
+	}
+	for _, row := range comparisonRows {
+		add(row, comparisonPositions, false)
+	}
+
+	sorted := make([]*comparedRows, 0, len(pairs))
+	for _, pair := range pairs {
+		sorted = append(sorted, pair)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := &sorted[i].key, &sorted[j].key
+		if a.position != b.position {
+			return a.position < b.position
+		}
+		if a.platform != b.platform {
+			return a.platform < b.platform
+		}
+		if a.region != b.region {
+			return a.region < b.region
+		}
+		if a.currency != b.currency {
+			return a.currency < b.currency
+		}
+		return a.campaignID.String() < b.campaignID.String()
+	})
+
+	rows := make([]InsightsComparisonRow, 0, len(sorted))
+	for _, pair := range sorted {
+		key := pair.key
+		row := InsightsComparisonRow{
+			Currency: key.currency,
+			Metrics:  CompareMetrics(pair.current, pair.comparison),
+		}
+		if params.GroupsBy(DimensionCampaign) {
+			row.CampaignID = &key.campaignID
+		}
+		if params.GroupsBy(DimensionDate) {
+			row.Date = bucketAt(currentBuckets, key.position)
+			row.ComparisonDate = bucketAt(comparisonBuckets, key.position)
+		}
+		if params.GroupsBy(DimensionPlatform) {
+			row.Platform = key.platform
+		}
+		if params.GroupsBy(DimensionRegion) {
+			row.Region = key.region
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// bucketAt returns the i-th bucket, or nil past the last one
+func bucketAt(buckets []time.Time, i int) *time.Time {
+	if i >= len(buckets) {
+		return nil
+	}
+	bucket := buckets[i]
+	return &bucket
+}
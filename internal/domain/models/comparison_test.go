@@ -0,0 +1,121 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInsightsComparisonParamsRange(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	days := func(start, end time.Time) DateRange {
+		return DateRange{StartDate: start, EndDate: end}
+	}
+
+	tests := []struct {
+		name    string
+		params  InsightsComparisonParams
+		current DateRange
+		want    DateRange
+		wantErr bool
+	}{
+		{
+			name:    "previous period of a week",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousPeriod},
+			current: days(day(2024, 3, 11), day(2024, 3, 17)),
+			want:    days(day(2024, 3, 4), day(2024, 3, 10)),
+		},
+		{
+			name:    "previous period of a single day",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousPeriod},
+			current: days(day(2024, 3, 1), day(2024, 3, 1)),
+			want:    days(day(2024, 2, 29), day(2024, 2, 29)),
+		},
+		{
+			name:    "previous period across a year boundary",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousPeriod},
+			current: days(day(2024, 1, 1), day(2024, 1, 31)),
+			want:    days(day(2023, 12, 1), day(2023, 12, 31)),
+		},
+		{
+			name:    "previous period counts days, not months",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousPeriod},
+			current: days(day(2024, 3, 1), day(2024, 3, 31)),
+			want:    days(day(2024, 1, 30), day(2024, 2, 29)),
+		},
+		{
+			name:    "previous year",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousYear},
+			current: days(day(2024, 3, 11), day(2024, 3, 17)),
+			want:    days(day(2023, 3, 11), day(2023, 3, 17)),
+		},
+		{
+			name:    "previous year of a leap day",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousYear},
+			current: days(day(2024, 2, 1), day(2024, 2, 29)),
+			want:    days(day(2023, 2, 1), day(2023, 2, 28)),
+		},
+		{
+			name:    "previous year keeps the calendar days",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousYear},
+			current: days(day(2025, 3, 1), day(2025, 3, 1)),
+			want:    days(day(2024, 3, 1), day(2024, 3, 1)),
+		},
+		{
+			name:    "custom range",
+			params:  InsightsComparisonParams{CompareTo: CompareToCustom, Custom: days(day(2023, 11, 24), day(2023, 11, 27))},
+			current: days(day(2024, 11, 29), day(2024, 12, 2)),
+			want:    days(day(2023, 11, 24), day(2023, 11, 27)),
+		},
+		{
+			name:    "custom range without dates",
+			params:  InsightsComparisonParams{CompareTo: CompareToCustom},
+			current: days(day(2024, 3, 1), day(2024, 3, 7)),
+			wantErr: true,
+		},
+		{
+			name:    "custom range ending before it starts",
+			params:  InsightsComparisonParams{CompareTo: CompareToCustom, Custom: days(day(2024, 2, 7), day(2024, 2, 1))},
+			current: days(day(2024, 3, 1), day(2024, 3, 7)),
+			wantErr: true,
+		},
+		{
+			name:    "current range ending before it starts",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousPeriod},
+			current: days(day(2024, 3, 7), day(2024, 3, 1)),
+			wantErr: true,
+		},
+		{
+			name:    "current range without an end",
+			params:  InsightsComparisonParams{CompareTo: CompareToPreviousYear},
+			current: DateRange{StartDate: day(2024, 3, 1)},
+			wantErr: true,
+		},
+		{
+			name:    "unknown comparison",
+			params:  InsightsComparisonParams{CompareTo: "next_year"},
+			current: days(day(2024, 3, 1), day(2024, 3, 7)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.params.Range(tt.current)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Range() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Range: %v", err)
+			}
+			if !got.StartDate.Equal(tt.want.StartDate) || !got.EndDate.Equal(tt.want.EndDate) {
+				t.Errorf("Range() = %s to %s, want %s to %s", got.StartDate.Format("2006-01-02"), got.EndDate.Format("2006-01-02"),
+					tt.want.StartDate.Format("2006-01-02"), tt.want.EndDate.Format("2006-01-02"))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConnectionStatus represents the health of a platform connection
+type ConnectionStatus string
+
+const (
+	ConnectionStatusActive       ConnectionStatus = "active"
+	ConnectionStatusNeedsReauth  ConnectionStatus = "needs_reauth"
+	ConnectionStatusNotConnected ConnectionStatus = "not_connected"
+)
+
+// PlatformCredentials holds the secrets used to call an ad platform on behalf of a user
+type PlatformCredentials struct {
+	AccountID       string     `json:"account_id"`
+	AccessToken     string     `json:"access_token"`
+	RefreshToken    string     `json:"refresh_token,omitempty"`
+	LoginCustomerID string     `json:"login_customer_id,omitempty"` // Google Ads manager account
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// PlatformConnection is the non-secret view of a user's connected platform account
+type PlatformConnection struct {
+	ID        uuid.UUID        `json:"id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	Platform  Platform         `json:"platform"`
+	AccountID string           `json:"account_id"`
+	Status    ConnectionStatus `json:"status"`
+	ExpiresAt *time.Time       `json:"expires_at,omitempty"`
+	LastError string           `json:"last_error,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ConnectPlatformRequest represents a request to connect a platform account
+type ConnectPlatformRequest struct {
+	AccountID       string     `json:"account_id" binding:"required"`
+	AccessToken     string     `json:"access_token" binding:"required"`
+	RefreshToken    string     `json:"refresh_token"`
+	LoginCustomerID string     `json:"login_customer_id"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+}
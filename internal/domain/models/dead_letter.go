@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// DeadLetter is a message that could not be processed, as stored in a
+// dead-letter topic
+type DeadLetter struct {
+	Partition         int        `json:"partition"`
+	Offset            int64      `json:"offset"`
+	Key               string     `json:"key"`
+	Payload           string     `json:"payload"`
+	Error             string     `json:"error"`
+	Attempts          int        `json:"attempts"`
+	OriginalTopic     string     `json:"original_topic"`
+	OriginalPartition int        `json:"original_partition"`
+	OriginalOffset    int64      `json:"original_offset"`
+	FailedAt          *time.Time `json:"failed_at,omitempty"`
+}
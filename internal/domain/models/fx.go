@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// FXRate is the exchange rate of a currency on a day, in units of Currency
+// per one unit of Base
+type FXRate struct {
+	Base     string    `json:"base"`
+	Date     time.Time `json:"date"`
+	Currency string    `json:"currency"`
+	Rate     float64   `json:"rate"`
+}
+
+// MissingFXRate is a day on which amounts in Currency could not be converted
+// for lack of a rate
+type MissingFXRate struct {
+	Date     time.Time `json:"date"`
+	Currency string    `json:"currency"`
+}
+
+// ConvertedInsights are insights with their amounts converted into Currency.
+// Rows of the days in MissingRates are left out rather than converted at a
+// guessed rate.
+type ConvertedInsights struct {
+	Currency     string             `json:"currency"`
+	Insights     []CampaignInsights `json:"insights"`
+	MissingRates []MissingFXRate    `json:"missing_rates"`
+}
+
+// IsValidCurrency reports whether code looks like an ISO 4217 currency code:
+// three upper-case letters
+func IsValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ComputeRatios derives the ratios of a row from its summed counters
+func (i *CampaignInsights) ComputeRatios() {
+	i.CTR, i.CPC, i.CPA, i.ROAS, i.ConversionRate = 0, 0, 0, 0, 0
+	if i.Impressions > 0 {
+		i.CTR = float64(i.Clicks) / float64(i.Impressions)
+	}
+	if i.Clicks > 0 {
+		i.CPC = i.Spend / float64(i.Clicks)
+		i.ConversionRate = float64(i.Conversions) / float64(i.Clicks)
+	}
+	if i.Conversions > 0 {
+		i.CPA = i.Spend / float64(i.Conversions)
+	}
+	if i.Spend > 0 {
+		i.ROAS = i.Revenue / i.Spend
+	}
+}
+
+// BucketStart truncates t to the start of its granularity bucket. Hours are
+// those of t's location, which matters for zones with a fractional offset;
+// coarser buckets start on the calendar days of t in UTC, where daily rows
+// hold their day. Weeks start on Sunday if requested and on Monday otherwise.
+func BucketStart(granularity Granularity, weekStart time.Weekday, t time.Time) time.Time {
+	if granularity == GranularityHourly {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	}
+
+	t = t.UTC()
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch granularity {
+	case GranularityWeekly:
+		if weekStart != time.Sunday {
+			weekStart = time.Monday
+		}
+		offset := (int(date.Weekday()) - int(weekStart) + 7) % 7
+		return date.AddDate(0, 0, -offset)
+	case GranularityMonthly:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case GranularityQuarterly:
+		month := (date.Month()-1)/3*3 + 1
+		return time.Date(date.Year(), month, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
+
+// insightsKey identifies a row of rolled-up insights
+type insightsKey struct {
+	campaignID uuid.UUID
+	bucket     int64
+	platform   Platform
+	region     string
+	currency   string
+}
+
+// RollUpInsights sums rows into buckets of a granularity, recomputing the
+// ratios from the sums. Rows are ordered like the rows of an InsightsStore:
+// by bucket, platform, region and currency.
+func RollUpInsights(rows []CampaignInsights, granularity Granularity, weekStart time.Weekday) []CampaignInsights {
+	buckets := make(map[insightsKey]*CampaignInsights)
+	for _, row := range rows {
+		bucket := BucketStart(granularity, weekStart, row.Date)
+		key := insightsKey{
+			campaignID: row.CampaignID,
+			bucket:     bucket.Unix(),
+			platform:   row.Platform,
+			region:     row.Region,
+			currency:   row.Currency,
+		}
+		sum, exists := buckets[key]
+		if !exists {
+			sum = &CampaignInsights{
+				CampaignID: row.CampaignID,
+				Date:       bucket,
+				Platform:   row.Platform,
+				Region:     row.Region,
+				Currency:   row.Currency,
+			}
+			buckets[key] = sum
+		}
+
+		sum.Impressions += row.Impressions
+		sum.Clicks += row.Clicks
+		sum.Conversions += row.Conversions
+		sum.Spend += row.Spend
+		sum.Revenue += row.Revenue
+		if row.UpdatedAt.After(sum.UpdatedAt) {
+			sum.UpdatedAt = row.UpdatedAt
+		}
+	}
+
+	insights := make([]CampaignInsights, 0, len(buckets))
+	for _, sum := range buckets {
+		sum.ComputeRatios()
+		insights = append(insights, *sum)
+	}
+	SortInsights(insights)
+	return insights
+}
+
+// GroupInsights rolls rows up like RollUpInsights, but only split by the
+// dimensions of groupBy and currency. The fields of other dimensions are left
+// zero; a nil groupBy splits by every dimension.
+func GroupInsights(rows []CampaignInsights, groupBy []InsightsDimension, granularity Granularity, weekStart time.Weekday) []CampaignInsights {
+	params := CampaignInsightsParams{GroupBy: groupBy}
+	if !params.GroupsBy(DimensionDate) {
+		// A single bucket, which daily buckets keep at the zero time
+		granularity = GranularityDaily
+	}
+
+	projected := make([]CampaignInsights, len(rows))
+	for i, row := range rows {
+		if !params.GroupsBy(DimensionCampaign) {
+			row.CampaignID = uuid.Nil
+		}
+		if !params.GroupsBy(DimensionDate) {
+			row.Date = time.Time{}
+		}
+		if !params.GroupsBy(DimensionPlatform) {
+			row.Platform = ""
+		}
+		if !params.GroupsBy(DimensionRegion) {
+			row.Region = ""
+		}
+		projected[i] = row
+	}
+	return RollUpInsights(projected, granularity, weekStart)
+}
+
+// SortInsights orders rows by bucket, platform, region and currency
+func SortInsights(insights []CampaignInsights) {
+	sort.Slice(insights, func(i, j int) bool {
+		a, b := &insights[i], &insights[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.CampaignID.String() < b.CampaignID.String()
+	})
+}
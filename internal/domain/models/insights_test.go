@@ -0,0 +1,183 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name        string
+		granularity Granularity
+		weekStart   time.Weekday
+		t           time.Time
+		want        time.Time
+	}{
+		{
+			name:        "hourly",
+			granularity: GranularityHourly,
+			t:           utc(2024, 3, 1, 10, 45),
+			want:        utc(2024, 3, 1, 10, 0),
+		},
+		{
+			name:        "hourly in a zone with a fractional offset",
+			granularity: GranularityHourly,
+			t:           time.Date(2024, 3, 1, 10, 45, 0, 0, kolkata),
+			want:        time.Date(2024, 3, 1, 10, 0, 0, 0, kolkata),
+		},
+		{
+			name:        "daily",
+			granularity: GranularityDaily,
+			t:           utc(2024, 3, 1, 23, 59),
+			want:        utc(2024, 3, 1, 0, 0),
+		},
+		{
+			name:        "daily uses the calendar day in UTC",
+			granularity: GranularityDaily,
+			t:           time.Date(2024, 3, 1, 23, 30, 0, 0, newYork),
+			want:        utc(2024, 3, 2, 0, 0),
+		},
+		{
+			name:        "weekly from Monday",
+			granularity: GranularityWeekly,
+			weekStart:   time.Monday,
+			t:           utc(2024, 3, 7, 12, 0),
+			want:        utc(2024, 3, 4, 0, 0),
+		},
+		{
+			name:        "weekly from Monday on a Monday",
+			granularity: GranularityWeekly,
+			weekStart:   time.Monday,
+			t:           utc(2024, 3, 4, 0, 0),
+			want:        utc(2024, 3, 4, 0, 0),
+		},
+		{
+			name:        "weekly from Monday on a Sunday",
+			granularity: GranularityWeekly,
+			weekStart:   time.Monday,
+			t:           utc(2024, 3, 10, 0, 0),
+			want:        utc(2024, 3, 4, 0, 0),
+		},
+		{
+			name:        "weekly from Sunday",
+			granularity: GranularityWeekly,
+			weekStart:   time.Sunday,
+			t:           utc(2024, 3, 7, 12, 0),
+			want:        utc(2024, 3, 3, 0, 0),
+		},
+		{
+			name:        "weekly from Sunday on a Sunday",
+			granularity: GranularityWeekly,
+			weekStart:   time.Sunday,
+			t:           utc(2024, 3, 10, 0, 0),
+			want:        utc(2024, 3, 10, 0, 0),
+		},
+		{
+			name:        "weekly across a year boundary",
+			granularity: GranularityWeekly,
+			weekStart:   time.Monday,
+			t:           utc(2023, 1, 1, 0, 0),
+			want:        utc(2022, 12, 26, 0, 0),
+		},
+		{
+			name:        "weeks starting on another day start on Monday",
+			granularity: GranularityWeekly,
+			weekStart:   time.Wednesday,
+			t:           utc(2024, 3, 7, 12, 0),
+			want:        utc(2024, 3, 4, 0, 0),
+		},
+		{
+			name:        "monthly",
+			granularity: GranularityMonthly,
+			t:           utc(2024, 2, 29, 18, 0),
+			want:        utc(2024, 2, 1, 0, 0),
+		},
+		{
+			name:        "quarterly",
+			granularity: GranularityQuarterly,
+			t:           utc(2024, 5, 15, 0, 0),
+			want:        utc(2024, 4, 1, 0, 0),
+		},
+		{
+			name:        "quarterly on the first day of a quarter",
+			granularity: GranularityQuarterly,
+			t:           utc(2024, 1, 1, 0, 0),
+			want:        utc(2024, 1, 1, 0, 0),
+		},
+		{
+			name:        "quarterly on the last day of a year",
+			granularity: GranularityQuarterly,
+			t:           utc(2024, 12, 31, 23, 59),
+			want:        utc(2024, 10, 1, 0, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BucketStart(tt.granularity, tt.weekStart, tt.t)
+			if !got.Equal(tt.want) || got.Location().String() != tt.want.Location().String() {
+				t.Errorf("BucketStart(%s, %v) = %v, want %v", tt.granularity, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGranularity(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Granularity
+		wantErr bool
+	}{
+		{s: "", want: GranularityDaily},
+		{s: "hourly", want: GranularityHourly},
+		{s: "daily", want: GranularityDaily},
+		{s: "weekly", want: GranularityWeekly},
+		{s: "monthly", want: GranularityMonthly},
+		{s: "quarterly", want: GranularityQuarterly},
+		{s: "yearly", wantErr: true},
+		{s: "Daily", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseGranularity(tt.s)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseGranularity(%q) = %q, %v, want %q (error %v)", tt.s, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseWeekStart(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Weekday
+		wantErr bool
+	}{
+		{s: "", want: time.Monday},
+		{s: "monday", want: time.Monday},
+		{s: "sunday", want: time.Sunday},
+		{s: "saturday", want: time.Monday, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseWeekStart(tt.s)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseWeekStart(%q) = %v, %v, want %v (error %v)", tt.s, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
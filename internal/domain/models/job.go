@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobType is the kind of work a job does over its date range
+type JobType string
+
+const (
+	// JobTypeBackfill fetches the days of the range from the platform again
+	JobTypeBackfill JobType = "backfill"
+	// JobTypeReaggregation rebuilds the insights of the range from the events
+	JobTypeReaggregation JobType = "reaggregation"
+)
+
+// JobState is the progress of a job
+type JobState string
+
+const (
+	JobStatePending   JobState = "pending"
+	JobStateRunning   JobState = "running"
+	JobStateSucceeded JobState = "succeeded"
+	JobStateFailed    JobState = "failed"
+	JobStateCancelled JobState = "cancelled"
+)
+
+// IsFinal reports whether a job in state s will not run anymore
+func (s JobState) IsFinal() bool {
+	return s == JobStateSucceeded || s == JobStateFailed || s == JobStateCancelled
+}
+
+// Job is a backfill or re-aggregation of a campaign's date range, run by the
+// worker in chunks of ChunkDays days. Checkpoint is the last day done, from
+// which a job interrupted by a crash resumes.
+type Job struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	Type        JobType    `json:"type" db:"type"`
+	CampaignID  uuid.UUID  `json:"campaign_id" db:"campaign_id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	State       JobState   `json:"state" db:"state"`
+	StartDate   time.Time  `json:"start_date" db:"start_date"`
+	EndDate     time.Time  `json:"end_date" db:"end_date"`
+	ChunkDays   int        `json:"chunk_days" db:"chunk_days"`
+	ChunksTotal int        `json:"chunks_total" db:"chunks_total"`
+	ChunksDone  int        `json:"chunks_done" db:"chunks_done"`
+	Checkpoint  *time.Time `json:"checkpoint,omitempty" db:"checkpoint"`
+	Attempts    int        `json:"attempts" db:"attempts"` // times a worker picked the job up
+	LastError   *string    `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+
+	// The worker holding the job and until when; another worker resumes the
+	// job once the lease expired
+	LeaseOwner     *string    `json:"-" db:"lease_owner"`
+	LeaseExpiresAt *time.Time `json:"-" db:"lease_expires_at"`
+}
+
+// Progress returns the share of chunks done, from 0 to 1
+func (j *Job) Progress() float64 {
+	if j.ChunksTotal == 0 {
+		return 0
+	}
+	return float64(j.ChunksDone) / float64(j.ChunksTotal)
+}
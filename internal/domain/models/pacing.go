@@ -0,0 +1,180 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PacingStatus tells how a campaign's spend compares with its ideal pacing
+type PacingStatus string
+
+const (
+	PacingStatusNotStarted  PacingStatus = "not_started"  // no complete day of the flight yet
+	PacingStatusNoBudget    PacingStatus = "no_budget"    // no budget to pace against
+	PacingStatusOnTrack     PacingStatus = "on_track"     // within the tolerance of the ideal
+	PacingStatusOverPacing  PacingStatus = "over_pacing"  // spending faster than the ideal
+	PacingStatusUnderPacing PacingStatus = "under_pacing" // spending slower than the ideal
+)
+
+// CampaignPacing compares the spend of a campaign with its budget, spread
+// evenly over the days of its flight. Days are those of the campaign's
+// timezone and only complete days count: AsOf is the last day counted,
+// yesterday during the flight. The projection extends the spend to date at
+// the average daily spend of the last RunRateDays days.
+type CampaignPacing struct {
+	CampaignID       uuid.UUID       `json:"campaign_id"`
+	Currency         string          `json:"currency,omitempty"` // of the amounts, empty without spend
+	Budget           float64         `json:"budget"`
+	StartDate        time.Time       `json:"start_date"`
+	EndDate          time.Time       `json:"end_date"`
+	AsOf             time.Time       `json:"as_of"`
+	FlightDays       int             `json:"flight_days"`
+	ElapsedDays      int             `json:"elapsed_days"`
+	SpendToDate      float64         `json:"spend_to_date"`
+	BudgetRemaining  float64         `json:"budget_remaining"` // negative once overspent
+	IdealSpendToDate float64         `json:"ideal_spend_to_date"`
+	PacingRatio      *float64        `json:"pacing_ratio"` // spend to date over ideal spend to date
+	RunRateDays      int             `json:"run_rate_days"`
+	DailyRunRate     float64         `json:"daily_run_rate"`
+	ProjectedSpend   float64         `json:"projected_spend"` // by the end of the flight
+	Status           PacingStatus    `json:"status"`
+	Curve            []PacingPoint   `json:"curve"`
+	MissingRates     []MissingFXRate `json:"missing_rates,omitempty"`
+}
+
+// PacingPoint is a day of the pacing curves, with cumulative spends through
+// the end of the day. Actual is set up to AsOf, Projected after it.
+type PacingPoint struct {
+	Date      time.Time `json:"date"`
+	Ideal     float64   `json:"ideal"`
+	Actual    *float64  `json:"actual,omitempty"`
+	Projected *float64  `json:"projected,omitempty"`
+}
+
+// PacingConfig configures budget pacing
+type PacingConfig struct {
+	// RunRateDays is the number of recent days the projection is based on
+	RunRateDays int
+	// Tolerance is how far, as a fraction of the ideal spend, the spend to
+	// date may be from it and still be on track
+	Tolerance float64
+}
+
+// FlightDates returns the first and last day of a campaign's flight in its
+// timezone
+func (c *Campaign) FlightDates() (time.Time, time.Time) {
+	loc := c.Location()
+	return DateIn(c.StartDate, loc), DateIn(c.EndDate, loc)
+}
+
+// PacingAsOf returns the last day pacing counts on the day today of a
+// campaign's timezone: yesterday, or the end of the flight once it is over
+func PacingAsOf(campaign *Campaign, today time.Time) time.Time {
+	_, end := campaign.FlightDates()
+	asOf := today.AddDate(0, 0, -1)
+	if asOf.After(end) {
+		return end
+	}
+	return asOf
+}
+
+// ComputePacing computes the pacing of a campaign from its daily spend, rows
+// in a single currency dated with their day, on the day today of its
+// timezone
+func ComputePacing(campaign *Campaign, daily []CampaignInsights, today time.Time, config PacingConfig) *CampaignPacing {
+	start, end := campaign.FlightDates()
+	pacing := &CampaignPacing{
+		CampaignID:  campaign.ID,
+		Budget:      campaign.Budget,
+		StartDate:   start,
+		EndDate:     end,
+		FlightDays:  daysBetween(start, end) + 1,
+		RunRateDays: config.RunRateDays,
+		Curve:       []PacingPoint{},
+	}
+	if pacing.FlightDays < 1 {
+		pacing.FlightDays = 0
+	}
+
+	// Count complete days only, within the flight
+	pacing.AsOf = PacingAsOf(campaign, today)
+	pacing.ElapsedDays = daysBetween(start, pacing.AsOf) + 1
+	if pacing.ElapsedDays < 0 {
+		pacing.ElapsedDays = 0
+	}
+
+	spendByDay := make(map[int64]float64)
+	for _, row := range daily {
+		day := DateIn(row.Date, time.UTC)
+		if day.Before(start) || day.After(pacing.AsOf) {
+			continue
+		}
+		spendByDay[day.Unix()] += row.Spend
+		pacing.SpendToDate += row.Spend
+		pacing.Currency = row.Currency
+	}
+	pacing.BudgetRemaining = pacing.Budget - pacing.SpendToDate
+
+	// The run rate averages the last days up to AsOf, days without spend
+	// included
+	if pacing.RunRateDays > pacing.ElapsedDays {
+		pacing.RunRateDays = pacing.ElapsedDays
+	}
+	if pacing.RunRateDays > 0 {
+		var recent float64
+		for i := 0; i < pacing.RunRateDays; i++ {
+			recent += spendByDay[pacing.AsOf.AddDate(0, 0, -i).Unix()]
+		}
+		pacing.DailyRunRate = recent / float64(pacing.RunRateDays)
+	}
+	remainingDays := pacing.FlightDays - pacing.ElapsedDays
+	pacing.ProjectedSpend = pacing.SpendToDate + pacing.DailyRunRate*float64(remainingDays)
+
+	// Curves over every day of the flight
+	idealPerDay := 0.0
+	if pacing.FlightDays > 0 {
+		idealPerDay = pacing.Budget / float64(pacing.FlightDays)
+	}
+	var actual float64
+	for i := 0; i < pacing.FlightDays; i++ {
+		date := start.AddDate(0, 0, i)
+		point := PacingPoint{Date: date, Ideal: idealPerDay * float64(i+1)}
+		if i < pacing.ElapsedDays {
+			actual += spendByDay[date.Unix()]
+			value := actual
+			point.Actual = &value
+		} else {
+			value := pacing.SpendToDate + pacing.DailyRunRate*float64(i+1-pacing.ElapsedDays)
+			point.Projected = &value
+		}
+		pacing.Curve = append(pacing.Curve, point)
+	}
+	pacing.IdealSpendToDate = idealPerDay * float64(pacing.ElapsedDays)
+
+	switch {
+	case pacing.ElapsedDays == 0:
+		pacing.Status = PacingStatusNotStarted
+	case pacing.Budget <= 0:
+		pacing.Status = PacingStatusNoBudget
+	default:
+		ratio := pacing.SpendToDate / pacing.IdealSpendToDate
+		pacing.PacingRatio = &ratio
+		switch {
+		case ratio > 1+config.Tolerance:
+			pacing.Status = PacingStatusOverPacing
+		case ratio < 1-config.Tolerance:
+			pacing.Status = PacingStatusUnderPacing
+		default:
+			pacing.Status = PacingStatusOnTrack
+		}
+	}
+
+	return pacing
+}
+
+// daysBetween returns the number of days from one date to another, both at
+// midnight UTC
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
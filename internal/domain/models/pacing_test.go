@@ -0,0 +1,219 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestComputePacing(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	spend := func(date time.Time, amount float64) CampaignInsights {
+		return CampaignInsights{Date: date, Currency: "USD", Spend: amount}
+	}
+	// The flight runs for 10 days, from March 1st to March 10th
+	config := PacingConfig{RunRateDays: 3, Tolerance: 0.05}
+
+	tests := []struct {
+		name             string
+		budget           float64
+		today            time.Time
+		daily            []CampaignInsights
+		wantAsOf         time.Time
+		wantElapsed      int
+		wantSpend        float64
+		wantRunRateDays  int
+		wantDailyRunRate float64
+		wantProjected    float64
+		wantStatus       PacingStatus
+	}{
+		{
+			name:   "on track mid-flight",
+			budget: 1000,
+			today:  day(3, 6),
+			daily: []CampaignInsights{
+				spend(day(3, 1), 100), spend(day(3, 2), 100), spend(day(3, 3), 100), spend(day(3, 4), 100), spend(day(3, 5), 100),
+			},
+			wantAsOf:         day(3, 5),
+			wantElapsed:      5,
+			wantSpend:        500,
+			wantRunRateDays:  3,
+			wantDailyRunRate: 100,
+			wantProjected:    1000,
+			wantStatus:       PacingStatusOnTrack,
+		},
+		{
+			name:   "the projection runs at the rate of the last days",
+			budget: 1000,
+			today:  day(3, 6),
+			daily: []CampaignInsights{
+				spend(day(3, 3), 150), spend(day(3, 4), 150), spend(day(3, 5), 150),
+			},
+			wantAsOf:         day(3, 5),
+			wantElapsed:      5,
+			wantSpend:        450,
+			wantRunRateDays:  3,
+			wantDailyRunRate: 150,
+			wantProjected:    1200,
+			wantStatus:       PacingStatusUnderPacing,
+		},
+		{
+			name:   "days without spend lower the run rate",
+			budget: 1000,
+			today:  day(3, 6),
+			daily: []CampaignInsights{
+				spend(day(3, 1), 200), spend(day(3, 2), 200), spend(day(3, 3), 150),
+			},
+			wantAsOf:         day(3, 5),
+			wantElapsed:      5,
+			wantSpend:        550,
+			wantRunRateDays:  3,
+			wantDailyRunRate: 50,
+			wantProjected:    800,
+			wantStatus:       PacingStatusOverPacing,
+		},
+		{
+			name:   "spend outside the counted days is left out",
+			budget: 1000,
+			today:  day(3, 6),
+			daily: []CampaignInsights{
+				spend(day(2, 29), 500), spend(day(3, 5), 100), spend(day(3, 6), 500),
+			},
+			wantAsOf:         day(3, 5),
+			wantElapsed:      5,
+			wantSpend:        100,
+			wantRunRateDays:  3,
+			wantDailyRunRate: 100.0 / 3,
+			wantProjected:    100 + 5*100.0/3,
+			wantStatus:       PacingStatusUnderPacing,
+		},
+		{
+			name:             "before the flight",
+			budget:           1000,
+			today:            day(2, 20),
+			wantAsOf:         day(2, 19),
+			wantElapsed:      0,
+			wantRunRateDays:  0,
+			wantDailyRunRate: 0,
+			wantProjected:    0,
+			wantStatus:       PacingStatusNotStarted,
+		},
+		{
+			name:             "on the first day of the flight",
+			budget:           1000,
+			today:            day(3, 1),
+			wantAsOf:         day(2, 29),
+			wantElapsed:      0,
+			wantRunRateDays:  0,
+			wantDailyRunRate: 0,
+			wantProjected:    0,
+			wantStatus:       PacingStatusNotStarted,
+		},
+		{
+			name:             "the run rate is capped at the elapsed days",
+			budget:           1000,
+			today:            day(3, 2),
+			daily:            []CampaignInsights{spend(day(3, 1), 150)},
+			wantAsOf:         day(3, 1),
+			wantElapsed:      1,
+			wantSpend:        150,
+			wantRunRateDays:  1,
+			wantDailyRunRate: 150,
+			wantProjected:    1500,
+			wantStatus:       PacingStatusOverPacing,
+		},
+		{
+			name:   "on the last day of the flight",
+			budget: 1000,
+			today:  day(3, 10),
+			daily: []CampaignInsights{
+				spend(day(3, 7), 100), spend(day(3, 8), 100), spend(day(3, 9), 100),
+			},
+			wantAsOf:         day(3, 9),
+			wantElapsed:      9,
+			wantSpend:        300,
+			wantRunRateDays:  3,
+			wantDailyRunRate: 100,
+			wantProjected:    400,
+			wantStatus:       PacingStatusUnderPacing,
+		},
+		{
+			name:   "after the flight",
+			budget: 1000,
+			today:  day(3, 20),
+			daily: []CampaignInsights{
+				spend(day(3, 1), 500), spend(day(3, 10), 480), spend(day(3, 11), 300),
+			},
+			wantAsOf:         day(3, 10),
+			wantElapsed:      10,
+			wantSpend:        980,
+			wantRunRateDays:  3,
+			wantDailyRunRate: 160,
+			wantProjected:    980,
+			wantStatus:       PacingStatusOnTrack,
+		},
+		{
+			name:             "no budget",
+			budget:           0,
+			today:            day(3, 6),
+			daily:            []CampaignInsights{spend(day(3, 5), 30)},
+			wantAsOf:         day(3, 5),
+			wantElapsed:      5,
+			wantSpend:        30,
+			wantRunRateDays:  3,
+			wantDailyRunRate: 10,
+			wantProjected:    80,
+			wantStatus:       PacingStatusNoBudget,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			campaign := &Campaign{Budget: tt.budget, StartDate: day(3, 1), EndDate: day(3, 10)}
+			pacing := ComputePacing(campaign, tt.daily, tt.today, config)
+
+			if pacing.FlightDays != 10 || len(pacing.Curve) != 10 {
+				t.Errorf("flight days = %d, curve points = %d, want 10", pacing.FlightDays, len(pacing.Curve))
+			}
+			if !pacing.AsOf.Equal(tt.wantAsOf) || pacing.ElapsedDays != tt.wantElapsed {
+				t.Errorf("as of %v after %d days, want %v after %d", pacing.AsOf, pacing.ElapsedDays, tt.wantAsOf, tt.wantElapsed)
+			}
+			if !closeTo(pacing.SpendToDate, tt.wantSpend) || !closeTo(pacing.BudgetRemaining, tt.budget-tt.wantSpend) {
+				t.Errorf("spend to date = %v, remaining %v, want %v", pacing.SpendToDate, pacing.BudgetRemaining, tt.wantSpend)
+			}
+			if pacing.RunRateDays != tt.wantRunRateDays || !closeTo(pacing.DailyRunRate, tt.wantDailyRunRate) {
+				t.Errorf("run rate = %v over %d days, want %v over %d", pacing.DailyRunRate, pacing.RunRateDays, tt.wantDailyRunRate, tt.wantRunRateDays)
+			}
+			if !closeTo(pacing.ProjectedSpend, tt.wantProjected) {
+				t.Errorf("projected spend = %v, want %v", pacing.ProjectedSpend, tt.wantProjected)
+			}
+			if pacing.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", pacing.Status, tt.wantStatus)
+			}
+			if hasRatio := pacing.PacingRatio != nil; hasRatio != (tt.wantElapsed > 0 && tt.budget > 0) {
+				t.Errorf("pacing ratio set = %v, want it set only with elapsed days and a budget", hasRatio)
+			}
+
+			// The curves split at AsOf and the projection ends at the projected spend
+			for i, point := range pacing.Curve {
+				if (point.Actual != nil) != (i < tt.wantElapsed) || (point.Projected != nil) == (point.Actual != nil) {
+					t.Fatalf("point %d: actual %v, projected %v, want actual up to day %d only", i, point.Actual, point.Projected, tt.wantElapsed)
+				}
+			}
+			last := pacing.Curve[len(pacing.Curve)-1]
+			if end := last.Projected; end != nil && !closeTo(*end, tt.wantProjected) {
+				t.Errorf("projected curve ends at %v, want %v", *end, tt.wantProjected)
+			}
+			if !closeTo(last.Ideal, tt.budget) {
+				t.Errorf("ideal curve ends at %v, want the budget %v", last.Ideal, tt.budget)
+			}
+		})
+	}
+}
+
+// closeTo reports whether two amounts are equal but for rounding
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
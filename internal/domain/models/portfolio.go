@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PortfolioInsights are insights aggregated across the campaigns of a user.
+// Rows are split by the dimensions of GroupBy and by currency; Totals hold a
+// row per currency over every matching campaign.
+type PortfolioInsights struct {
+	CampaignIDs  []uuid.UUID            `json:"campaign_ids"`
+	GroupBy      []InsightsDimension    `json:"group_by"`
+	Currency     string                 `json:"currency,omitempty"` // set when amounts were converted
+	Rows         []PortfolioInsightsRow `json:"rows"`
+	Totals       []PortfolioInsightsRow `json:"totals"`
+	MissingRates []MissingFXRate        `json:"missing_rates,omitempty"`
+}
+
+// PortfolioInsightsRow is a row of PortfolioInsights. Dimensions the row is
+// not split by are left out.
+type PortfolioInsightsRow struct {
+	CampaignID     *uuid.UUID `json:"campaign_id,omitempty"`
+	Date           *time.Time `json:"date,omitempty"`
+	Platform       Platform   `json:"platform,omitempty"`
+	Region         string     `json:"region,omitempty"`
+	Currency       string     `json:"currency"`
+	Impressions    int64      `json:"impressions"`
+	Clicks         int64      `json:"clicks"`
+	Conversions    int64      `json:"conversions"`
+	Spend          float64    `json:"spend"`
+	Revenue        float64    `json:"revenue"`
+	CTR            float64    `json:"ctr"`
+	CPC            float64    `json:"cpc"`
+	CPA            float64    `json:"cpa"`
+	ROAS           float64    `json:"roas"`
+	ConversionRate float64    `json:"conversion_rate"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// NewPortfolioInsightsRows converts rows grouped by groupBy into portfolio rows
+func NewPortfolioInsightsRows(rows []CampaignInsights, groupBy []InsightsDimension) []PortfolioInsightsRow {
+	params := CampaignInsightsParams{GroupBy: groupBy}
+	portfolio := make([]PortfolioInsightsRow, 0, len(rows))
+	for _, row := range rows {
+		row := row
+		p := PortfolioInsightsRow{
+			Currency:       row.Currency,
+			Impressions:    row.Impressions,
+			Clicks:         row.Clicks,
+			Conversions:    row.Conversions,
+			Spend:          row.Spend,
+			Revenue:        row.Revenue,
+			CTR:            row.CTR,
+			CPC:            row.CPC,
+			CPA:            row.CPA,
+			ROAS:           row.ROAS,
+			ConversionRate: row.ConversionRate,
+			UpdatedAt:      row.UpdatedAt,
+		}
+		if params.GroupsBy(DimensionCampaign) {
+			p.CampaignID = &row.CampaignID
+		}
+		if params.GroupsBy(DimensionDate) {
+			p.Date = &row.Date
+		}
+		if params.GroupsBy(DimensionPlatform) {
+			p.Platform = row.Platform
+		}
+		if params.GroupsBy(DimensionRegion) {
+			p.Region = row.Region
+		}
+		portfolio = append(portfolio, p)
+	}
+	return portfolio
+}
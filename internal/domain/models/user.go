@@ -6,6 +6,17 @@ import (
 	"github.com/google/uuid"
 )
 
+// Roles of users. Admins may use the admin API.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
 // User represents a user of the system
 type User struct {
 	ID        uuid.UUID `json:"id" db:"id"`
@@ -0,0 +1,156 @@
+// Package repository defines the storage the domain services depend on.
+// Postgres and ClickHouse implementations live in the database package and
+// in-memory ones in the memory package; both pass the contract suite in
+// repotest.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// CampaignRepository stores campaigns and their platform sync state. Messages
+// passed along with a change are queued in the outbox atomically with it: they
+// are published if and only if the change is stored.
+type CampaignRepository interface {
+	// Get returns a campaign, or ErrCampaignNotFound
+	Get(ctx context.Context, id uuid.UUID) (*models.Campaign, error)
+	// List returns the campaigns matching filter, newest first
+	List(ctx context.Context, filter CampaignFilter) ([]models.Campaign, error)
+	// ListDue returns the active campaigns whose date range covers day and
+	// that have not been attempted since syncedBefore, least recently
+	// attempted first
+	ListDue(ctx context.Context, day, syncedBefore time.Time) ([]models.Campaign, error)
+	// Create stores a new campaign
+	Create(ctx context.Context, campaign *models.Campaign, messages ...bus.Message) error
+	// Update replaces the editable fields of a stored campaign, or returns
+	// ErrCampaignNotFound. The owner and creation time are kept and copied
+	// into campaign. messages is called with the stored campaign, locked
+	// against concurrent updates, and its error aborts the update.
+	Update(ctx context.Context, campaign *models.Campaign, messages func(previous *models.Campaign) ([]bus.Message, error)) error
+
+	// GetSyncState returns the sync state of a campaign on a platform, or
+	// ErrSyncStateNotFound if it was never attempted
+	GetSyncState(ctx context.Context, campaignID uuid.UUID, platform models.Platform) (*models.CampaignSyncState, error)
+	// RecordSyncSuccess advances the watermark of a campaign to the fetched window
+	RecordSyncSuccess(ctx context.Context, campaign *models.Campaign, windowStart, windowEnd time.Time, eventCount int, messages ...bus.Message) error
+	// RecordSyncAttempt records an attempt without moving the watermark. A
+	// nil syncErr records an attempt without error, such as a backfill.
+	RecordSyncAttempt(ctx context.Context, campaign *models.Campaign, status models.SyncStatus, syncErr error, eventCount int, messages ...bus.Message) error
+}
+
+// CampaignFilter selects campaigns. A zero UserID matches every user and nil
+// fields match anything.
+type CampaignFilter struct {
+	UserID   uuid.UUID
+	IDs      []uuid.UUID // campaigns with one of these IDs
+	Platform *models.Platform
+	Status   *string
+	Tags     []string // campaigns with every one of these tags
+}
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	// GetByEmail returns the user with an email address, or ErrUserNotFound
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// Create stores a new user, or returns ErrUserExists if the email
+	// address is taken
+	Create(ctx context.Context, user *models.User) error
+	// SetRole changes the role of the user with an email address, or returns
+	// ErrUserNotFound
+	SetRole(ctx context.Context, email, role string) error
+}
+
+// EventStore stores the raw events fetched from platforms. An event replaces
+// the stored one with the same campaign, event time and deduplication key
+// when its ProcessedAt is not older. Events without a LocalDate are stored
+// on the UTC day of their EventTime.
+type EventStore interface {
+	// Insert stores a batch of events. Errors caused by the rows themselves,
+	// as opposed to the connection, are returned as *RejectedBatchError.
+	Insert(ctx context.Context, events []models.CampaignEvent) error
+	// Latest returns the stored event of a snapshot, or ErrEventNotFound
+	Latest(ctx context.Context, campaignID uuid.UUID, eventTime time.Time, deduplicationKey string) (*models.CampaignEvent, error)
+}
+
+// InsightsStore serves metrics aggregated from the events of an EventStore.
+// Ratios are always derived from the summed counters of a bucket. Days are
+// the local dates of the events, the days of the ad account's timezone.
+type InsightsStore interface {
+	// Query rolls up the insights matching params into buckets of the
+	// requested granularity, split by the dimensions of params.GroupBy and
+	// one row per currency, ordered by bucket, platform, region, currency
+	// and campaign. Fields of dimensions not grouped by are left zero.
+	// Hourly buckets, and the range of an hourly query, are in the timezone
+	// of params.
+	Query(ctx context.Context, params models.CampaignInsightsParams) ([]models.CampaignInsights, error)
+	// QueryPeriods runs Query over each of periods in place of the date
+	// range of params, in a single round trip, and returns the rows of each
+	// period in the order of periods
+	QueryPeriods(ctx context.Context, params models.CampaignInsightsParams, periods []models.DateRange) ([][]models.CampaignInsights, error)
+	// Reaggregate rebuilds the daily insights of a campaign between two local
+	// dates from the latest stored events, dropping superseded snapshots
+	Reaggregate(ctx context.Context, campaignID uuid.UUID, startDate, endDate time.Time) error
+}
+
+// FXRateStore stores daily exchange rates
+type FXRateStore interface {
+	// Store adds rates, replacing those of the same base, day and currency
+	Store(ctx context.Context, rates []models.FXRate) error
+	// List returns the rates against base of currencies from startDate to
+	// endDate, inclusive, ordered by day and currency
+	List(ctx context.Context, base string, currencies []string, startDate, endDate time.Time) ([]models.FXRate, error)
+}
+
+// JobRepository stores backfill and re-aggregation jobs. A worker claims a
+// job with a lease it renews at every checkpoint; updates by a worker whose
+// lease was lost or whose job was cancelled return ErrJobLeaseLost.
+type JobRepository interface {
+	// Create stores a new pending job
+	Create(ctx context.Context, job *models.Job) error
+	// Get returns a job, or ErrJobNotFound
+	Get(ctx context.Context, id uuid.UUID) (*models.Job, error)
+	// Claim leases the oldest pending job, or running job whose lease
+	// expired, to owner. It returns ErrNoJob when there is none.
+	Claim(ctx context.Context, owner string, leaseTTL time.Duration) (*models.Job, error)
+	// Checkpoint records the last day done and renews the lease
+	Checkpoint(ctx context.Context, id uuid.UUID, owner string, checkpoint time.Time, chunksDone int, leaseTTL time.Duration) error
+	// Finish moves a running job to a final state, recording jobErr if set
+	Finish(ctx context.Context, id uuid.UUID, owner string, state models.JobState, jobErr error) error
+	// Cancel cancels a pending or running job and returns it, or returns
+	// ErrJobFinished if it already reached a final state
+	Cancel(ctx context.Context, id uuid.UUID) (*models.Job, error)
+}
+
+// RejectedBatchError reports a batch that the store refused because of its
+// rows. Retrying the same rows does not help; the batch is split to isolate
+// the offending row.
+type RejectedBatchError struct {
+	Err error
+}
+
+func (e *RejectedBatchError) Error() string {
+	return "batch rejected: " + e.Err.Error()
+}
+
+func (e *RejectedBatchError) Unwrap() error {
+	return e.Err
+}
+
+// Error definitions
+var (
+	ErrCampaignNotFound  = errors.New("campaign not found")
+	ErrSyncStateNotFound = errors.New("sync state not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserExists        = errors.New("user already exists")
+	ErrEventNotFound     = errors.New("event not found")
+	ErrJobNotFound       = errors.New("job not found")
+	ErrNoJob             = errors.New("no job to run")
+	ErrJobLeaseLost      = errors.New("job lease lost")
+	ErrJobFinished       = errors.New("job already finished")
+)
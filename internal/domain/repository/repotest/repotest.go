@@ -0,0 +1,1189 @@
+// Package repotest is the contract suite of the repository interfaces. Every
+// implementation must pass it, so services behave the same on the in-memory
+// stores of their unit tests as on Postgres and ClickHouse:
+//
+//	func TestMemoryStores(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) repotest.Stores {
+//			events := memory.NewEventStore()
+//			return repotest.Stores{
+//				Campaigns: memory.NewCampaignRepository(),
+//				Users:     memory.NewUserRepository(),
+//				Events:    events,
+//				Insights:  memory.NewInsightsStore(events),
+//				Jobs:      memory.NewJobRepository(),
+//				FXRates:   memory.NewFXRateStore(),
+//			}
+//		})
+//	}
+//
+// Tests only look at the rows they create, under random IDs and emails, so
+// they can run against a shared database. Job tests claim the oldest runnable
+// job, so the database must not hold runnable jobs of its own.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// Stores is a set of implementations under test. Nil stores are skipped.
+// Insights must aggregate the events of Events, and Jobs needs Campaigns for
+// the campaigns its jobs belong to.
+type Stores struct {
+	Campaigns repository.CampaignRepository
+	Users     repository.UserRepository
+	Events    repository.EventStore
+	Insights  repository.InsightsStore
+	Jobs      repository.JobRepository
+	FXRates   repository.FXRateStore
+}
+
+// Run runs the contract suite. newStores is called once per test.
+func Run(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("CampaignRepository", func(t *testing.T) {
+		for name, test := range campaignTests {
+			test := test
+			t.Run(name, func(t *testing.T) {
+				stores := newStores(t)
+				if stores.Campaigns == nil {
+					t.Skip("no campaign repository")
+				}
+				test(t, stores)
+			})
+		}
+	})
+
+	t.Run("UserRepository", func(t *testing.T) {
+		for name, test := range userTests {
+			test := test
+			t.Run(name, func(t *testing.T) {
+				stores := newStores(t)
+				if stores.Users == nil {
+					t.Skip("no user repository")
+				}
+				test(t, stores.Users)
+			})
+		}
+	})
+
+	t.Run("EventStore", func(t *testing.T) {
+		for name, test := range eventTests {
+			test := test
+			t.Run(name, func(t *testing.T) {
+				stores := newStores(t)
+				if stores.Events == nil {
+					t.Skip("no event store")
+				}
+				test(t, stores.Events)
+			})
+		}
+	})
+
+	t.Run("InsightsStore", func(t *testing.T) {
+		for name, test := range insightsTests {
+			test := test
+			t.Run(name, func(t *testing.T) {
+				stores := newStores(t)
+				if stores.Events == nil || stores.Insights == nil {
+					t.Skip("no event and insights stores")
+				}
+				test(t, stores.Events, stores.Insights)
+			})
+		}
+	})
+
+	t.Run("JobRepository", func(t *testing.T) {
+		for name, test := range jobTests {
+			test := test
+			t.Run(name, func(t *testing.T) {
+				stores := newStores(t)
+				if stores.Campaigns == nil || stores.Jobs == nil {
+					t.Skip("no campaign and job repositories")
+				}
+				test(t, stores)
+			})
+		}
+	})
+
+	t.Run("FXRateStore", func(t *testing.T) {
+		for name, test := range fxRateTests {
+			test := test
+			t.Run(name, func(t *testing.T) {
+				stores := newStores(t)
+				if stores.FXRates == nil {
+					t.Skip("no exchange rate store")
+				}
+				test(t, stores.FXRates)
+			})
+		}
+	})
+}
+
+// day is the first day of a week, a Monday, that the tests store data on
+var day = time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+var campaignTests = map[string]func(t *testing.T, stores Stores){
+	"GetMissing": func(t *testing.T, stores Stores) {
+		_, err := stores.Campaigns.Get(context.Background(), uuid.New())
+		if !errors.Is(err, repository.ErrCampaignNotFound) {
+			t.Fatalf("Get of a missing campaign: got %v, want ErrCampaignNotFound", err)
+		}
+	},
+
+	"CreateAndGet": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		campaign := newCampaign(newUserID(t, stores))
+		if err := stores.Campaigns.Create(ctx, campaign, newMessage()); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		got, err := stores.Campaigns.Get(ctx, campaign.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		assertCampaign(t, got, campaign)
+	},
+
+	"List": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		userID := newUserID(t, stores)
+
+		older := newCampaign(userID)
+		older.Platform = models.PlatformGoogle
+		older.Status = "paused"
+		older.CreatedAt = older.CreatedAt.Add(-time.Hour)
+		older.Tags = []string{"brand"}
+		newer := newCampaign(userID)
+		newer.Tags = []string{"brand", "spring"}
+		other := newCampaign(newUserID(t, stores))
+		for _, campaign := range []*models.Campaign{older, newer, other} {
+			if err := stores.Campaigns.Create(ctx, campaign); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		google := models.PlatformGoogle
+		active := models.CampaignStatusActive
+		for _, tc := range []struct {
+			name   string
+			filter repository.CampaignFilter
+			want   []*models.Campaign
+		}{
+			{"user", repository.CampaignFilter{UserID: userID}, []*models.Campaign{newer, older}},
+			{"platform", repository.CampaignFilter{UserID: userID, Platform: &google}, []*models.Campaign{older}},
+			{"status", repository.CampaignFilter{UserID: userID, Status: &active}, []*models.Campaign{newer}},
+			{"IDs", repository.CampaignFilter{UserID: userID, IDs: []uuid.UUID{older.ID, other.ID}}, []*models.Campaign{older}},
+			{"no IDs", repository.CampaignFilter{UserID: userID, IDs: []uuid.UUID{}}, nil},
+			{"tag", repository.CampaignFilter{UserID: userID, Tags: []string{"brand"}}, []*models.Campaign{newer, older}},
+			{"tags", repository.CampaignFilter{UserID: userID, Tags: []string{"brand", "spring"}}, []*models.Campaign{newer}},
+			{"no campaigns", repository.CampaignFilter{UserID: uuid.New()}, nil},
+		} {
+			got, err := stores.Campaigns.List(ctx, tc.filter)
+			if err != nil {
+				t.Fatalf("List by %s: %v", tc.name, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("List by %s: got %d campaigns, want %d", tc.name, len(got), len(tc.want))
+			}
+			for i := range got {
+				assertCampaign(t, &got[i], tc.want[i])
+			}
+		}
+
+		// Without a user, the campaigns of every user are listed
+		all, err := stores.Campaigns.List(ctx, repository.CampaignFilter{})
+		if err != nil {
+			t.Fatalf("List of every user: %v", err)
+		}
+		listed := make(map[uuid.UUID]bool)
+		for _, campaign := range all {
+			listed[campaign.ID] = true
+		}
+		for _, campaign := range []*models.Campaign{older, newer, other} {
+			if !listed[campaign.ID] {
+				t.Errorf("List of every user did not list campaign %s", campaign.ID)
+			}
+		}
+	},
+
+	"Update": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		campaign := newCampaign(newUserID(t, stores))
+		if err := stores.Campaigns.Create(ctx, campaign); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		// The owner and creation time cannot be changed
+		update := *campaign
+		update.UserID = uuid.Nil
+		update.CreatedAt = time.Time{}
+		update.Name = "Renamed"
+		update.Status = "paused"
+		update.UpdatedAt = campaign.UpdatedAt.Add(time.Minute)
+
+		var previousStatus string
+		err := stores.Campaigns.Update(ctx, &update, func(previous *models.Campaign) ([]bus.Message, error) {
+			previousStatus = previous.Status
+			return []bus.Message{newMessage()}, nil
+		})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if previousStatus != campaign.Status {
+			t.Errorf("previous status: got %q, want %q", previousStatus, campaign.Status)
+		}
+		if update.UserID != campaign.UserID || !update.CreatedAt.Equal(campaign.CreatedAt) {
+			t.Errorf("Update did not copy the stored owner and creation time into the campaign")
+		}
+
+		got, err := stores.Campaigns.Get(ctx, campaign.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		want := update
+		want.UserID = campaign.UserID
+		want.CreatedAt = campaign.CreatedAt
+		assertCampaign(t, got, &want)
+	},
+
+	"UpdateMissing": func(t *testing.T, stores Stores) {
+		campaign := newCampaign(uuid.New())
+		err := stores.Campaigns.Update(context.Background(), campaign, func(*models.Campaign) ([]bus.Message, error) {
+			t.Error("messages called for a missing campaign")
+			return nil, nil
+		})
+		if !errors.Is(err, repository.ErrCampaignNotFound) {
+			t.Fatalf("Update of a missing campaign: got %v, want ErrCampaignNotFound", err)
+		}
+	},
+
+	"UpdateAbortedByMessages": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		campaign := newCampaign(newUserID(t, stores))
+		if err := stores.Campaigns.Create(ctx, campaign); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		errEncode := errors.New("encode failed")
+		update := *campaign
+		update.Name = "Renamed"
+		err := stores.Campaigns.Update(ctx, &update, func(*models.Campaign) ([]bus.Message, error) {
+			return nil, errEncode
+		})
+		if !errors.Is(err, errEncode) {
+			t.Fatalf("Update: got %v, want the error of messages", err)
+		}
+
+		got, err := stores.Campaigns.Get(ctx, campaign.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		assertCampaign(t, got, campaign)
+	},
+
+	"SyncState": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		campaign := newCampaign(newUserID(t, stores))
+		if err := stores.Campaigns.Create(ctx, campaign); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		_, err := stores.Campaigns.GetSyncState(ctx, campaign.ID, campaign.Platform)
+		if !errors.Is(err, repository.ErrSyncStateNotFound) {
+			t.Fatalf("GetSyncState before any sync: got %v, want ErrSyncStateNotFound", err)
+		}
+
+		// A failure is recorded without a watermark
+		if err := stores.Campaigns.RecordSyncAttempt(ctx, campaign, models.SyncStatusFailed, errors.New("platform down"), 0); err != nil {
+			t.Fatalf("RecordSyncAttempt: %v", err)
+		}
+		state := getSyncState(t, stores, campaign)
+		if state.LastStatus != models.SyncStatusFailed || state.LastError == nil || *state.LastError != "platform down" {
+			t.Errorf("after a failure: got status %q and error %v", state.LastStatus, state.LastError)
+		}
+		if state.WindowEnd != nil || state.LastSyncedAt != nil || state.LastAttemptAt == nil {
+			t.Errorf("after a failure: got window end %v, last synced %v and last attempt %v", state.WindowEnd, state.LastSyncedAt, state.LastAttemptAt)
+		}
+
+		// A success advances the watermark and clears the error
+		windowEnd := day.AddDate(0, 0, 6).Add(15 * time.Hour)
+		if err := stores.Campaigns.RecordSyncSuccess(ctx, campaign, day, windowEnd, 42, newMessage()); err != nil {
+			t.Fatalf("RecordSyncSuccess: %v", err)
+		}
+		state = getSyncState(t, stores, campaign)
+		if state.LastStatus != models.SyncStatusSucceeded || state.LastError != nil || state.EventCount != 42 {
+			t.Errorf("after a success: got status %q, error %v and %d events", state.LastStatus, state.LastError, state.EventCount)
+		}
+		assertDate(t, "window start", state.WindowStart, day)
+		assertDate(t, "window end", state.WindowEnd, day.AddDate(0, 0, 6))
+		if state.LastSyncedAt == nil {
+			t.Errorf("after a success: last synced not set")
+		}
+
+		// A partial result keeps the watermark
+		if err := stores.Campaigns.RecordSyncAttempt(ctx, campaign, models.SyncStatusPartial, errors.New("rate limited"), 7); err != nil {
+			t.Fatalf("RecordSyncAttempt: %v", err)
+		}
+		state = getSyncState(t, stores, campaign)
+		if state.LastStatus != models.SyncStatusPartial || state.EventCount != 7 {
+			t.Errorf("after a partial result: got status %q and %d events", state.LastStatus, state.EventCount)
+		}
+		assertDate(t, "window end after a partial result", state.WindowEnd, day.AddDate(0, 0, 6))
+
+		// An attempt without error, like a backfill, clears the error
+		if err := stores.Campaigns.RecordSyncAttempt(ctx, campaign, models.SyncStatusSucceeded, nil, 3); err != nil {
+			t.Fatalf("RecordSyncAttempt without error: %v", err)
+		}
+		state = getSyncState(t, stores, campaign)
+		if state.LastStatus != models.SyncStatusSucceeded || state.LastError != nil {
+			t.Errorf("after an attempt without error: got status %q and error %v", state.LastStatus, state.LastError)
+		}
+		assertDate(t, "window end after an attempt without error", state.WindowEnd, day.AddDate(0, 0, 6))
+	},
+
+	"ListDue": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		userID := newUserID(t, stores)
+		now := time.Now()
+
+		neverSynced := newCampaign(userID)
+		attemptedBefore := newCampaign(userID)
+		attemptedRecently := newCampaign(userID)
+		paused := newCampaign(userID)
+		paused.Status = "paused"
+		ended := newCampaign(userID)
+		ended.EndDate = now.AddDate(0, 0, -2)
+		for _, campaign := range []*models.Campaign{neverSynced, attemptedBefore, attemptedRecently, paused, ended} {
+			if err := stores.Campaigns.Create(ctx, campaign); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		if err := stores.Campaigns.RecordSyncAttempt(ctx, attemptedBefore, models.SyncStatusFailed, errors.New("timeout"), 0); err != nil {
+			t.Fatalf("RecordSyncAttempt: %v", err)
+		}
+		syncedBefore := time.Now()
+		time.Sleep(10 * time.Millisecond)
+		if err := stores.Campaigns.RecordSyncSuccess(ctx, attemptedRecently, now, now, 1); err != nil {
+			t.Fatalf("RecordSyncSuccess: %v", err)
+		}
+
+		due, err := stores.Campaigns.ListDue(ctx, now, syncedBefore)
+		if err != nil {
+			t.Fatalf("ListDue: %v", err)
+		}
+		position := make(map[uuid.UUID]int)
+		for i, campaign := range due {
+			position[campaign.ID] = i
+		}
+		for name, campaign := range map[string]*models.Campaign{"recently attempted": attemptedRecently, "paused": paused, "ended": ended} {
+			if _, listed := position[campaign.ID]; listed {
+				t.Errorf("ListDue listed the %s campaign", name)
+			}
+		}
+		first, firstListed := position[neverSynced.ID]
+		second, secondListed := position[attemptedBefore.ID]
+		if !firstListed || !secondListed {
+			t.Fatalf("ListDue did not list the never synced and the previously attempted campaigns")
+		}
+		if first > second {
+			t.Errorf("ListDue listed the previously attempted campaign before the never synced one")
+		}
+	},
+}
+
+var userTests = map[string]func(t *testing.T, users repository.UserRepository){
+	"GetMissing": func(t *testing.T, users repository.UserRepository) {
+		_, err := users.GetByEmail(context.Background(), uuid.NewString()+"@example.com")
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("GetByEmail of a missing user: got %v, want ErrUserNotFound", err)
+		}
+	},
+
+	"CreateAndGet": func(t *testing.T, users repository.UserRepository) {
+		ctx := context.Background()
+		user := newUser()
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		got, err := users.GetByEmail(ctx, user.Email)
+		if err != nil {
+			t.Fatalf("GetByEmail: %v", err)
+		}
+		if got.ID != user.ID || got.Name != user.Name || got.Password != user.Password || got.Role != user.Role ||
+			!got.CreatedAt.Equal(user.CreatedAt) {
+			t.Errorf("GetByEmail: got %+v, want %+v", got, user)
+		}
+	},
+
+	"CreateDuplicateEmail": func(t *testing.T, users repository.UserRepository) {
+		ctx := context.Background()
+		user := newUser()
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		duplicate := newUser()
+		duplicate.Email = user.Email
+		if err := users.Create(ctx, duplicate); !errors.Is(err, repository.ErrUserExists) {
+			t.Fatalf("Create with a taken email: got %v, want ErrUserExists", err)
+		}
+	},
+
+	"SetRole": func(t *testing.T, users repository.UserRepository) {
+		ctx := context.Background()
+		user := newUser()
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if err := users.SetRole(ctx, user.Email, models.RoleAdmin); err != nil {
+			t.Fatalf("SetRole: %v", err)
+		}
+		got, err := users.GetByEmail(ctx, user.Email)
+		if err != nil {
+			t.Fatalf("GetByEmail: %v", err)
+		}
+		if got.Role != models.RoleAdmin {
+			t.Errorf("SetRole: got role %q, want %q", got.Role, models.RoleAdmin)
+		}
+
+		if err := users.SetRole(ctx, uuid.NewString()+"@example.com", models.RoleAdmin); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("SetRole of a missing user: got %v, want ErrUserNotFound", err)
+		}
+	},
+}
+
+var eventTests = map[string]func(t *testing.T, events repository.EventStore){
+	"LatestMissing": func(t *testing.T, events repository.EventStore) {
+		_, err := events.Latest(context.Background(), uuid.New(), day, "missing")
+		if !errors.Is(err, repository.ErrEventNotFound) {
+			t.Fatalf("Latest of a missing snapshot: got %v, want ErrEventNotFound", err)
+		}
+	},
+
+	"InsertAndLatest": func(t *testing.T, events repository.EventStore) {
+		ctx := context.Background()
+		event := newEvent(uuid.New(), day.Add(9*time.Hour), "us", 1000, 50, 5, 25.5, 80.25)
+		event.LocalDate = day.AddDate(0, 0, -1)
+		event.Placement = "instagram/mobile_app"
+		if err := events.Insert(ctx, []models.CampaignEvent{event}); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+
+		got := latest(t, events, &event)
+		if got.ID != event.ID || got.Platform != event.Platform || got.EventType != event.EventType ||
+			got.Impressions != event.Impressions || got.Clicks != event.Clicks || got.Conversions != event.Conversions ||
+			!closeTo(got.Spend, event.Spend) || !closeTo(got.Revenue, event.Revenue) ||
+			!got.EventTime.Equal(event.EventTime) || !got.LocalDate.Equal(event.LocalDate) ||
+			got.Region != event.Region || got.Placement != event.Placement || got.Currency != event.Currency {
+			t.Errorf("Latest: got %+v, want %+v", got, event)
+		}
+	},
+
+	"LocalDateDefaultsToUTCDay": func(t *testing.T, events repository.EventStore) {
+		event := newEvent(uuid.New(), day.Add(23*time.Hour), "us", 1000, 50, 5, 25, 80)
+		if err := events.Insert(context.Background(), []models.CampaignEvent{event}); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+
+		if got := latest(t, events, &event); !got.LocalDate.Equal(day) {
+			t.Errorf("Latest: got local date %v, want %v", got.LocalDate, day)
+		}
+	},
+
+	"LatestProcessedWins": func(t *testing.T, events repository.EventStore) {
+		ctx := context.Background()
+		original := newEvent(uuid.New(), day, "us", 1000, 50, 5, 25, 80)
+		restated := original
+		restated.ID = uuid.New()
+		restated.Impressions = 1200
+		restated.ProcessedAt = original.ProcessedAt.Add(time.Hour)
+		stale := original
+		stale.ID = uuid.New()
+		stale.Impressions = 900
+		stale.ProcessedAt = original.ProcessedAt.Add(-time.Hour)
+
+		for _, event := range []models.CampaignEvent{original, restated, stale} {
+			if err := events.Insert(ctx, []models.CampaignEvent{event}); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+		}
+
+		if got := latest(t, events, &original); got.Impressions != restated.Impressions {
+			t.Errorf("Latest: got %d impressions, want the %d of the latest processed snapshot", got.Impressions, restated.Impressions)
+		}
+	},
+}
+
+var insightsTests = map[string]func(t *testing.T, events repository.EventStore, insights repository.InsightsStore){
+	"Daily": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		campaignID := uuid.New()
+		insertEvents(t, events,
+			newEvent(campaignID, day.Add(9*time.Hour), "us", 1000, 50, 5, 25, 100),
+			newEvent(campaignID, day.Add(15*time.Hour), "us", 1000, 30, 3, 15, 50),
+			newEvent(campaignID, day.Add(10*time.Hour), "eu", 500, 0, 0, 0, 0),
+			newEvent(campaignID, day.AddDate(0, 0, 1), "us", 200, 10, 1, 5, 10),
+			newEvent(uuid.New(), day, "us", 1, 1, 1, 1, 1),
+		)
+		reaggregate(t, insights, campaignID, day, day.AddDate(0, 0, 1))
+
+		got := query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			StartDate:   day,
+			EndDate:     day.AddDate(0, 0, 1),
+			Granularity: models.GranularityDaily,
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day, Region: "eu", Impressions: 500},
+			{CampaignID: campaignID, Date: day, Region: "us", Impressions: 2000, Clicks: 80, Conversions: 8, Spend: 40, Revenue: 150,
+				CTR: 0.04, CPC: 0.5, CPA: 5, ROAS: 3.75, ConversionRate: 0.1},
+			{CampaignID: campaignID, Date: day.AddDate(0, 0, 1), Region: "us", Impressions: 200, Clicks: 10, Conversions: 1, Spend: 5, Revenue: 10,
+				CTR: 0.05, CPC: 0.5, CPA: 5, ROAS: 2, ConversionRate: 0.1},
+		})
+
+		// Filters narrow the rows down
+		region := "eu"
+		got = query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			StartDate:   day,
+			EndDate:     day,
+			Region:      &region,
+			Granularity: models.GranularityDaily,
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day, Region: "eu", Impressions: 500},
+		})
+	},
+
+	"Restatement": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		campaignID := uuid.New()
+		original := newEvent(campaignID, day, "us", 1000, 50, 5, 25, 100)
+		insertEvents(t, events, original)
+
+		restated := original
+		restated.ID = uuid.New()
+		restated.Clicks = 60
+		restated.ProcessedAt = original.ProcessedAt.Add(time.Minute)
+		insertEvents(t, events, restated)
+		reaggregate(t, insights, campaignID, day, day)
+
+		got := query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			Granularity: models.GranularityDaily,
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day, Region: "us", Impressions: 1000, Clicks: 60, Conversions: 5, Spend: 25, Revenue: 100,
+				CTR: 0.06, CPC: 25.0 / 60, CPA: 5, ROAS: 4, ConversionRate: 5.0 / 60},
+		})
+	},
+
+	"Weekly": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		campaignID := uuid.New()
+		sunday := day.AddDate(0, 0, 6)
+		insertEvents(t, events,
+			newEvent(campaignID, day, "us", 100, 0, 0, 0, 0),
+			newEvent(campaignID, sunday, "us", 10, 0, 0, 0, 0),
+		)
+		reaggregate(t, insights, campaignID, day, sunday)
+
+		params := models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			Granularity: models.GranularityWeekly,
+			WeekStart:   time.Monday,
+		}
+		assertInsights(t, query(t, insights, params), []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day, Region: "us", Impressions: 110},
+		})
+
+		params.WeekStart = time.Sunday
+		assertInsights(t, query(t, insights, params), []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day.AddDate(0, 0, -1), Region: "us", Impressions: 100},
+			{CampaignID: campaignID, Date: sunday, Region: "us", Impressions: 10},
+		})
+	},
+
+	"Currencies": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		campaignID := uuid.New()
+		eur := newEvent(campaignID, day.Add(9*time.Hour), "us", 100, 10, 1, 20, 40)
+		eur.Currency = "EUR"
+		eur.DeduplicationKey += "|EUR"
+		insertEvents(t, events,
+			newEvent(campaignID, day.Add(9*time.Hour), "us", 1000, 50, 5, 25, 100),
+			eur,
+		)
+		reaggregate(t, insights, campaignID, day, day)
+
+		// Amounts in different currencies are never summed
+		got := query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			Granularity: models.GranularityDaily,
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day, Region: "us", Currency: "EUR", Impressions: 100, Clicks: 10, Conversions: 1, Spend: 20, Revenue: 40,
+				CTR: 0.1, CPC: 2, CPA: 20, ROAS: 2, ConversionRate: 0.1},
+			{CampaignID: campaignID, Date: day, Region: "us", Impressions: 1000, Clicks: 50, Conversions: 5, Spend: 25, Revenue: 100,
+				CTR: 0.05, CPC: 0.5, CPA: 5, ROAS: 4, ConversionRate: 0.1},
+		})
+	},
+
+	"GroupBy": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		a, b, other := uuid.New(), uuid.New(), uuid.New()
+		insertEvents(t, events,
+			newEvent(a, day, "us", 100, 10, 1, 5, 10),
+			newEvent(a, day, "eu", 200, 0, 0, 0, 0),
+			newEvent(b, day, "us", 300, 20, 2, 10, 40),
+			newEvent(b, day.AddDate(0, 0, 1), "us", 50, 0, 0, 0, 0),
+			newEvent(other, day, "us", 1000, 0, 0, 0, 0),
+		)
+		for _, campaignID := range []uuid.UUID{a, b, other} {
+			reaggregate(t, insights, campaignID, day, day.AddDate(0, 0, 1))
+		}
+
+		// Dimensions left out of GroupBy are summed over and zero
+		params := models.CampaignInsightsParams{
+			CampaignIDs: []uuid.UUID{a, b},
+			StartDate:   day,
+			EndDate:     day.AddDate(0, 0, 1),
+			Granularity: models.GranularityDaily,
+			GroupBy:     []models.InsightsDimension{models.DimensionPlatform, models.DimensionRegion},
+		}
+		assertInsights(t, query(t, insights, params), []models.CampaignInsights{
+			{Region: "eu", Impressions: 200},
+			{Region: "us", Impressions: 450, Clicks: 30, Conversions: 3, Spend: 15, Revenue: 50,
+				CTR: 30.0 / 450, CPC: 0.5, CPA: 5, ROAS: 50.0 / 15, ConversionRate: 0.1},
+		})
+
+		params.CampaignIDs = []uuid.UUID{b}
+		params.GroupBy = []models.InsightsDimension{models.DimensionCampaign, models.DimensionDate, models.DimensionPlatform}
+		assertInsights(t, query(t, insights, params), []models.CampaignInsights{
+			{CampaignID: b, Date: day, Impressions: 300, Clicks: 20, Conversions: 2, Spend: 10, Revenue: 40,
+				CTR: 20.0 / 300, CPC: 0.5, CPA: 5, ROAS: 4, ConversionRate: 0.1},
+			{CampaignID: b, Date: day.AddDate(0, 0, 1), Impressions: 50},
+		})
+
+		// An empty set of campaigns matches nothing
+		params.CampaignIDs = []uuid.UUID{}
+		assertInsights(t, query(t, insights, params), nil)
+	},
+
+	"QueryPeriods": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		campaignID := uuid.New()
+		lastWeek := day.AddDate(0, 0, -7)
+		insertEvents(t, events,
+			newEvent(campaignID, lastWeek, "us", 100, 10, 1, 5, 10),
+			newEvent(campaignID, day, "us", 200, 20, 2, 10, 40),
+			newEvent(campaignID, day.AddDate(0, 0, 1), "us", 50, 0, 0, 0, 0),
+		)
+		reaggregate(t, insights, campaignID, lastWeek, day.AddDate(0, 0, 1))
+
+		// Each period is queried on its own, overlapping or not
+		params := models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			Granularity: models.GranularityDaily,
+		}
+		got, err := insights.QueryPeriods(context.Background(), params, []models.DateRange{
+			{StartDate: day, EndDate: day.AddDate(0, 0, 6)},
+			{StartDate: lastWeek, EndDate: day.AddDate(0, 0, -1)},
+			{StartDate: lastWeek, EndDate: day},
+		})
+		if err != nil {
+			t.Fatalf("QueryPeriods: %v", err)
+		}
+		if len(got) != 3 {
+			t.Fatalf("QueryPeriods: got %d periods, want 3", len(got))
+		}
+		assertInsights(t, got[0], []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day, Region: "us", Impressions: 200, Clicks: 20, Conversions: 2, Spend: 10, Revenue: 40,
+				CTR: 0.1, CPC: 0.5, CPA: 5, ROAS: 4, ConversionRate: 0.1},
+			{CampaignID: campaignID, Date: day.AddDate(0, 0, 1), Region: "us", Impressions: 50},
+		})
+		lastWeekRow := models.CampaignInsights{CampaignID: campaignID, Date: lastWeek, Region: "us", Impressions: 100, Clicks: 10, Conversions: 1, Spend: 5, Revenue: 10,
+			CTR: 0.1, CPC: 0.5, CPA: 5, ROAS: 2, ConversionRate: 0.1}
+		assertInsights(t, got[1], []models.CampaignInsights{lastWeekRow})
+		assertInsights(t, got[2], []models.CampaignInsights{lastWeekRow, got[0][0]})
+
+		// An empty set of campaigns matches nothing in any period
+		params.CampaignID = uuid.Nil
+		params.CampaignIDs = []uuid.UUID{}
+		got, err = insights.QueryPeriods(context.Background(), params, []models.DateRange{{StartDate: day, EndDate: day}})
+		if err != nil {
+			t.Fatalf("QueryPeriods of no campaigns: %v", err)
+		}
+		if len(got) != 1 || len(got[0]) != 0 {
+			t.Fatalf("QueryPeriods of no campaigns: got %+v, want one empty period", got)
+		}
+	},
+
+	"Hourly": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		campaignID := uuid.New()
+		insertEvents(t, events,
+			newEvent(campaignID, day.Add(9*time.Hour), "us", 100, 0, 0, 0, 0),
+			newEvent(campaignID, day.Add(23*time.Hour), "us", 10, 0, 0, 0, 0),
+			newEvent(campaignID, day.AddDate(0, 0, 1), "us", 1, 0, 0, 0, 0),
+		)
+
+		// The end date includes every hour of its day
+		got := query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			StartDate:   day,
+			EndDate:     day,
+			Granularity: models.GranularityHourly,
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day.Add(9 * time.Hour), Region: "us", Impressions: 100},
+			{CampaignID: campaignID, Date: day.Add(23 * time.Hour), Region: "us", Impressions: 10},
+		})
+	},
+
+	"LocalDates": func(t *testing.T, events repository.EventStore, insights repository.InsightsStore) {
+		campaignID := uuid.New()
+		evening := newEvent(campaignID, day.Add(2*time.Hour), "us", 100, 0, 0, 0, 0)
+		evening.LocalDate = day.AddDate(0, 0, -1)
+		insertEvents(t, events,
+			evening,
+			newEvent(campaignID, day.Add(9*time.Hour), "us", 10, 0, 0, 0, 0),
+		)
+		reaggregate(t, insights, campaignID, day.AddDate(0, 0, -1), day)
+
+		// Days are the local dates of the events
+		got := query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			StartDate:   day.AddDate(0, 0, -1),
+			EndDate:     day,
+			Granularity: models.GranularityDaily,
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day.AddDate(0, 0, -1), Region: "us", Impressions: 100},
+			{CampaignID: campaignID, Date: day, Region: "us", Impressions: 10},
+		})
+
+		// Hourly ranges run from midnight to midnight in the timezone
+		got = query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			StartDate:   day.AddDate(0, 0, -1),
+			EndDate:     day.AddDate(0, 0, -1),
+			Granularity: models.GranularityHourly,
+			Timezone:    "America/New_York",
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day.Add(2 * time.Hour), Region: "us", Impressions: 100},
+		})
+
+		// Hours are those of the timezone, starting at half past in UTC+5:30
+		got = query(t, insights, models.CampaignInsightsParams{
+			CampaignID:  campaignID,
+			StartDate:   day,
+			EndDate:     day,
+			Granularity: models.GranularityHourly,
+			Timezone:    "Asia/Kolkata",
+		})
+		assertInsights(t, got, []models.CampaignInsights{
+			{CampaignID: campaignID, Date: day.Add(90 * time.Minute), Region: "us", Impressions: 100},
+			{CampaignID: campaignID, Date: day.Add(8*time.Hour + 30*time.Minute), Region: "us", Impressions: 10},
+		})
+	},
+}
+
+var jobTests = map[string]func(t *testing.T, stores Stores){
+	"GetMissing": func(t *testing.T, stores Stores) {
+		_, err := stores.Jobs.Get(context.Background(), uuid.New())
+		if !errors.Is(err, repository.ErrJobNotFound) {
+			t.Fatalf("Get of a missing job: got %v, want ErrJobNotFound", err)
+		}
+	},
+
+	"CreateAndGet": func(t *testing.T, stores Stores) {
+		job := newJob(t, stores)
+		got, err := stores.Jobs.Get(context.Background(), job.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Type != job.Type || got.CampaignID != job.CampaignID || got.UserID != job.UserID ||
+			got.State != models.JobStatePending || got.ChunkDays != job.ChunkDays || got.ChunksTotal != job.ChunksTotal ||
+			got.ChunksDone != 0 || got.Checkpoint != nil || got.Attempts != 0 {
+			t.Errorf("Get: got %+v, want %+v", got, job)
+		}
+		assertDate(t, "start date", &got.StartDate, job.StartDate)
+		assertDate(t, "end date", &got.EndDate, job.EndDate)
+
+		// Leave no runnable job behind for the claim tests
+		if _, err := stores.Jobs.Cancel(context.Background(), job.ID); err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+	},
+
+	"ClaimCheckpointFinish": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		job := newJob(t, stores)
+
+		claimed := claim(t, stores, job, "worker-a", time.Minute)
+		if claimed.State != models.JobStateRunning || claimed.Attempts != 1 || claimed.StartedAt == nil {
+			t.Errorf("Claim: got state %q, %d attempts and started %v", claimed.State, claimed.Attempts, claimed.StartedAt)
+		}
+		if _, err := stores.Jobs.Claim(ctx, "worker-b", time.Minute); !errors.Is(err, repository.ErrNoJob) {
+			t.Fatalf("Claim of a leased job: got %v, want ErrNoJob", err)
+		}
+
+		checkpoint := day.AddDate(0, 0, 6)
+		if err := stores.Jobs.Checkpoint(ctx, job.ID, "worker-b", checkpoint, 1, time.Minute); !errors.Is(err, repository.ErrJobLeaseLost) {
+			t.Fatalf("Checkpoint by another worker: got %v, want ErrJobLeaseLost", err)
+		}
+		if err := stores.Jobs.Checkpoint(ctx, job.ID, "worker-a", checkpoint, 1, time.Minute); err != nil {
+			t.Fatalf("Checkpoint: %v", err)
+		}
+		got := getJob(t, stores, job.ID)
+		if got.ChunksDone != 1 {
+			t.Errorf("after a checkpoint: got %d chunks done, want 1", got.ChunksDone)
+		}
+		assertDate(t, "checkpoint", got.Checkpoint, checkpoint)
+
+		if err := stores.Jobs.Finish(ctx, job.ID, "worker-a", models.JobStateSucceeded, nil); err != nil {
+			t.Fatalf("Finish: %v", err)
+		}
+		got = getJob(t, stores, job.ID)
+		if got.State != models.JobStateSucceeded || got.FinishedAt == nil || got.LastError != nil {
+			t.Errorf("after Finish: got state %q, finished %v and error %v", got.State, got.FinishedAt, got.LastError)
+		}
+		if err := stores.Jobs.Finish(ctx, job.ID, "worker-a", models.JobStateFailed, nil); !errors.Is(err, repository.ErrJobLeaseLost) {
+			t.Fatalf("Finish of a finished job: got %v, want ErrJobLeaseLost", err)
+		}
+	},
+
+	"ResumeAfterLeaseExpired": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+		job := newJob(t, stores)
+
+		claim(t, stores, job, "worker-a", 10*time.Millisecond)
+		if err := stores.Jobs.Checkpoint(ctx, job.ID, "worker-a", day, 1, 10*time.Millisecond); err != nil {
+			t.Fatalf("Checkpoint: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		// The lease expired, as if worker-a crashed
+		resumed := claim(t, stores, job, "worker-b", time.Minute)
+		if resumed.Attempts != 2 || resumed.ChunksDone != 1 {
+			t.Errorf("resumed: got %d attempts and %d chunks done, want 2 and 1", resumed.Attempts, resumed.ChunksDone)
+		}
+		assertDate(t, "resumed checkpoint", resumed.Checkpoint, day)
+		if err := stores.Jobs.Checkpoint(ctx, job.ID, "worker-a", day.AddDate(0, 0, 1), 2, time.Minute); !errors.Is(err, repository.ErrJobLeaseLost) {
+			t.Fatalf("Checkpoint by the previous worker: got %v, want ErrJobLeaseLost", err)
+		}
+
+		if err := stores.Jobs.Finish(ctx, job.ID, "worker-b", models.JobStateFailed, errors.New("platform down")); err != nil {
+			t.Fatalf("Finish: %v", err)
+		}
+		got := getJob(t, stores, job.ID)
+		if got.State != models.JobStateFailed || got.LastError == nil || *got.LastError != "platform down" {
+			t.Errorf("after a failure: got state %q and error %v", got.State, got.LastError)
+		}
+	},
+
+	"Cancel": func(t *testing.T, stores Stores) {
+		ctx := context.Background()
+
+		pending := newJob(t, stores)
+		cancelled, err := stores.Jobs.Cancel(ctx, pending.ID)
+		if err != nil {
+			t.Fatalf("Cancel of a pending job: %v", err)
+		}
+		if cancelled.State != models.JobStateCancelled || cancelled.FinishedAt == nil {
+			t.Errorf("Cancel: got state %q and finished %v", cancelled.State, cancelled.FinishedAt)
+		}
+		if _, err := stores.Jobs.Cancel(ctx, pending.ID); !errors.Is(err, repository.ErrJobFinished) {
+			t.Fatalf("Cancel of a cancelled job: got %v, want ErrJobFinished", err)
+		}
+		if _, err := stores.Jobs.Cancel(ctx, uuid.New()); !errors.Is(err, repository.ErrJobNotFound) {
+			t.Fatalf("Cancel of a missing job: got %v, want ErrJobNotFound", err)
+		}
+
+		// A running job loses its lease
+		running := newJob(t, stores)
+		claim(t, stores, running, "worker-a", time.Minute)
+		if _, err := stores.Jobs.Cancel(ctx, running.ID); err != nil {
+			t.Fatalf("Cancel of a running job: %v", err)
+		}
+		if err := stores.Jobs.Checkpoint(ctx, running.ID, "worker-a", day, 1, time.Minute); !errors.Is(err, repository.ErrJobLeaseLost) {
+			t.Fatalf("Checkpoint of a cancelled job: got %v, want ErrJobLeaseLost", err)
+		}
+	},
+}
+
+var fxRateTests = map[string]func(t *testing.T, rates repository.FXRateStore){
+	"StoreAndList": func(t *testing.T, rates repository.FXRateStore) {
+		ctx := context.Background()
+		// A random base keeps the rates apart from those of other tests
+		base := "X" + strings.ToUpper(uuid.NewString()[:2])
+		stored := []models.FXRate{
+			{Base: base, Date: day, Currency: "USD", Rate: 1.08},
+			{Base: base, Date: day, Currency: "GBP", Rate: 0.85},
+			{Base: base, Date: day.AddDate(0, 0, 1), Currency: "USD", Rate: 1.09},
+			{Base: base, Date: day.AddDate(0, 0, 2), Currency: "USD", Rate: 1.1},
+			{Base: base, Date: day, Currency: "JPY", Rate: 162},
+		}
+		if err := rates.Store(ctx, stored); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+
+		// Storing a day again replaces its rate
+		if err := rates.Store(ctx, []models.FXRate{{Base: base, Date: day.AddDate(0, 0, 1), Currency: "USD", Rate: 1.07}}); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+
+		got, err := rates.List(ctx, base, []string{"USD", "GBP"}, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		want := []models.FXRate{
+			{Base: base, Date: day, Currency: "GBP", Rate: 0.85},
+			{Base: base, Date: day, Currency: "USD", Rate: 1.08},
+			{Base: base, Date: day.AddDate(0, 0, 1), Currency: "USD", Rate: 1.07},
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got %d rates, want %d: %+v", len(got), len(want), got)
+		}
+		for i := range want {
+			g, w := got[i], want[i]
+			if g.Base != w.Base || g.Currency != w.Currency || !closeTo(g.Rate, w.Rate) ||
+				g.Date.Format("2006-01-02") != w.Date.Format("2006-01-02") {
+				t.Errorf("rate %d:\n got %+v\nwant %+v", i, g, w)
+			}
+		}
+	},
+}
+
+// newUserID returns the ID of a new stored user, as campaigns may have to
+// reference one
+func newUserID(t *testing.T, stores Stores) uuid.UUID {
+	t.Helper()
+	user := newUser()
+	if stores.Users != nil {
+		if err := stores.Users.Create(context.Background(), user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	return user.ID
+}
+
+// newUser returns a user with a unique email address
+func newUser() *models.User {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &models.User{
+		ID:        uuid.New(),
+		Email:     uuid.NewString() + "@example.com",
+		Name:      "Test User",
+		Password:  "$2a$10$hash",
+		Role:      models.RoleUser,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// newCampaign returns an active campaign of a user running from yesterday
+// until next month
+func newCampaign(userID uuid.UUID) *models.Campaign {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &models.Campaign{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Name:       "Spring Sale",
+		Platform:   models.PlatformMeta,
+		Budget:     1500.5,
+		StartDate:  now.AddDate(0, 0, -1),
+		EndDate:    now.AddDate(0, 1, 0),
+		Status:     models.CampaignStatusActive,
+		ExternalID: "ext-" + uuid.NewString(),
+		Timezone:   "Europe/Berlin",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+// newEvent returns a stats event of a campaign on the Meta platform
+func newEvent(campaignID uuid.UUID, eventTime time.Time, region string, impressions, clicks, conversions int64, spend, revenue float64) models.CampaignEvent {
+	now := time.Now().UTC().Truncate(time.Second)
+	return models.CampaignEvent{
+		ID:               uuid.New(),
+		CampaignID:       campaignID,
+		Platform:         models.PlatformMeta,
+		EventType:        "stats",
+		Impressions:      impressions,
+		Clicks:           clicks,
+		Conversions:      conversions,
+		Spend:            spend,
+		Revenue:          revenue,
+		EventTime:        eventTime,
+		Region:           region,
+		Currency:         "USD",
+		DeduplicationKey: campaignID.String() + "|" + eventTime.Format(time.RFC3339) + "|" + region,
+		ReceivedAt:       now,
+		ProcessedAt:      now,
+	}
+}
+
+// newJob stores a pending backfill job of a new campaign, over two weeks
+// in chunks of a week
+func newJob(t *testing.T, stores Stores) *models.Job {
+	t.Helper()
+	campaign := newCampaign(newUserID(t, stores))
+	if err := stores.Campaigns.Create(context.Background(), campaign); err != nil {
+		t.Fatalf("create campaign: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	job := &models.Job{
+		ID:          uuid.New(),
+		Type:        models.JobTypeBackfill,
+		CampaignID:  campaign.ID,
+		UserID:      campaign.UserID,
+		State:       models.JobStatePending,
+		StartDate:   day,
+		EndDate:     day.AddDate(0, 0, 13),
+		ChunkDays:   7,
+		ChunksTotal: 2,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := stores.Jobs.Create(context.Background(), job); err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	return job
+}
+
+// newMessage returns an outbox message
+func newMessage() bus.Message {
+	return bus.Message{
+		Topic: "repotest",
+		Key:   []byte(uuid.NewString()),
+		Value: []byte(`{}`),
+	}
+}
+
+func getSyncState(t *testing.T, stores Stores, campaign *models.Campaign) *models.CampaignSyncState {
+	t.Helper()
+	state, err := stores.Campaigns.GetSyncState(context.Background(), campaign.ID, campaign.Platform)
+	if err != nil {
+		t.Fatalf("GetSyncState: %v", err)
+	}
+	return state
+}
+
+func getJob(t *testing.T, stores Stores, id uuid.UUID) *models.Job {
+	t.Helper()
+	job, err := stores.Jobs.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Get job: %v", err)
+	}
+	return job
+}
+
+// claim claims the next job as owner and checks that it is job
+func claim(t *testing.T, stores Stores, job *models.Job, owner string, leaseTTL time.Duration) *models.Job {
+	t.Helper()
+	claimed, err := stores.Jobs.Claim(context.Background(), owner, leaseTTL)
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if claimed.ID != job.ID {
+		t.Fatalf("Claim: got job %s, want %s", claimed.ID, job.ID)
+	}
+	return claimed
+}
+
+func latest(t *testing.T, events repository.EventStore, event *models.CampaignEvent) *models.CampaignEvent {
+	t.Helper()
+	got, err := events.Latest(context.Background(), event.CampaignID, event.EventTime, event.DeduplicationKey)
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	return got
+}
+
+func insertEvents(t *testing.T, events repository.EventStore, batch ...models.CampaignEvent) {
+	t.Helper()
+	if err := events.Insert(context.Background(), batch); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+}
+
+func reaggregate(t *testing.T, insights repository.InsightsStore, campaignID uuid.UUID, startDate, endDate time.Time) {
+	t.Helper()
+	if err := insights.Reaggregate(context.Background(), campaignID, startDate, endDate); err != nil {
+		t.Fatalf("Reaggregate: %v", err)
+	}
+}
+
+func query(t *testing.T, insights repository.InsightsStore, params models.CampaignInsightsParams) []models.CampaignInsights {
+	t.Helper()
+	got, err := insights.Query(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	return got
+}
+
+// assertCampaign compares the stored fields of two campaigns
+func assertCampaign(t *testing.T, got, want *models.Campaign) {
+	t.Helper()
+	if got.ID != want.ID || got.UserID != want.UserID || got.Name != want.Name || got.Platform != want.Platform ||
+		!closeTo(got.Budget, want.Budget) || !got.StartDate.Equal(want.StartDate) || !got.EndDate.Equal(want.EndDate) ||
+		got.Status != want.Status || got.ExternalID != want.ExternalID || got.Timezone != want.Timezone ||
+		strings.Join(got.Tags, ",") != strings.Join(want.Tags, ",") ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("campaign:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+// assertDate checks that a stored date is the UTC date of want
+func assertDate(t *testing.T, name string, got *time.Time, want time.Time) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("%s: not set, want %s", name, want.Format("2006-01-02"))
+		return
+	}
+	if got.Format("2006-01-02") != want.Format("2006-01-02") {
+		t.Errorf("%s: got %s, want %s", name, got.Format("2006-01-02"), want.Format("2006-01-02"))
+	}
+}
+
+// assertInsights compares insights rows in order, leaving out UpdatedAt. The
+// platform of want rows defaults to Meta and the currency to USD.
+func assertInsights(t *testing.T, got, want []models.CampaignInsights) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d insights rows, want %d: %+v", len(got), len(want), got)
+	}
+
+	for i := range want {
+		g, w := &got[i], &want[i]
+		if w.Platform == "" {
+			w.Platform = models.PlatformMeta
+		}
+		if w.Currency == "" {
+			w.Currency = "USD"
+		}
+		if g.CampaignID != w.CampaignID || !g.Date.Equal(w.Date) || g.Platform != w.Platform || g.Region != w.Region ||
+			g.Currency != w.Currency ||
+			g.Impressions != w.Impressions || g.Clicks != w.Clicks || g.Conversions != w.Conversions ||
+			!closeTo(g.Spend, w.Spend) || !closeTo(g.Revenue, w.Revenue) ||
+			!closeTo(g.CTR, w.CTR) || !closeTo(g.CPC, w.CPC) || !closeTo(g.CPA, w.CPA) ||
+			!closeTo(g.ROAS, w.ROAS) || !closeTo(g.ConversionRate, w.ConversionRate) {
+			t.Errorf("insights row %d:\n got %+v\nwant %+v", i, *g, *w)
+		}
+	}
+}
+
+// closeTo compares amounts that went through floating point sums
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
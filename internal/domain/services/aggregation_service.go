@@ -2,33 +2,40 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zocket/campaign-analytics/internal/domain/models"
-	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
 	"go.uber.org/zap"
 )
 
 // AggregationService handles metric aggregation
 type AggregationService struct {
-	db     *database.ClickHouseClient
-	redis  *redis.Client
-	logger *zap.Logger
+	insights repository.InsightsStore
+	fx       *FXService
+	redis    *redis.Client
+	logger   *zap.Logger
 }
 
 // NewAggregationService creates a new aggregation service
 func NewAggregationService(
-	db *database.ClickHouseClient,
+	insights repository.InsightsStore,
+	fx *FXService,
 	redis *redis.Client,
 	logger *zap.Logger,
 ) *AggregationService {
 	return &AggregationService{
-		db:     db,
-		redis:  redis,
-		logger: logger.With(zap.String("component", "aggregation_service")),
+		insights: insights,
+		fx:       fx,
+		redis:    redis,
+		logger:   logger.With(zap.String("component", "aggregation_service")),
 	}
 }
 
@@ -47,62 +54,11 @@ func (s *AggregationService) GetCampaignInsights(ctx context.Context, params mod
 	// Cache miss, query from database
 	s.logger.Debug("Cache miss, querying from database", zap.String("cache_key", cacheKey))
 
-	// Build the query based on parameters
-	query, args := s.buildInsightsQuery(params)
-
-	// Execute the query
-	conn := s.db.GetConn()
-	rows, err := conn.Query(ctx, query, args...)
+	insights, err = s.insights.Query(ctx, params)
 	if err != nil {
 		s.logger.Error("Failed to query insights", zap.Error(err))
 		return nil, err
 	}
-	defer rows.Close()
-
-	// Parse the results
-	insights = []models.CampaignInsights{}
-	for rows.Next() {
-		var insight models.CampaignInsights
-		var campaignIDStr, platformStr string
-
-		err := rows.Scan(
-			&campaignIDStr,
-			&insight.Date,
-			&platformStr,
-			&insight.Region,
-			&insight.Impressions,
-			&insight.Clicks,
-			&insight.Conversions,
-			&insight.Spend,
-			&insight.Revenue,
-			&insight.CTR,
-			&insight.CPC,
-			&insight.CPA,
-			&insight.ROAS,
-			&insight.ConversionRate,
-			&insight.UpdatedAt,
-		)
-		if err != nil {
-			s.logger.Error("Failed to scan insight row", zap.Error(err))
-			return nil, err
-		}
-
-		// Convert string IDs to UUID
-		campaignID, err := uuid.Parse(campaignIDStr)
-		if err != nil {
-			s.logger.Error("Failed to parse campaign ID", zap.Error(err), zap.String("campaign_id", campaignIDStr))
-			return nil, err
-		}
-		insight.CampaignID = campaignID
-		insight.Platform = models.Platform(platformStr)
-
-		insights = append(insights, insight)
-	}
-
-	if err := rows.Err(); err != nil {
-		s.logger.Error("Error iterating over insight rows", zap.Error(err))
-		return nil, err
-	}
 
 	// Cache the results (only if there are results to cache)
 	if len(insights) > 0 {
@@ -117,68 +73,138 @@ func (s *AggregationService) GetCampaignInsights(ctx context.Context, params mod
 	return insights, nil
 }
 
-// buildInsightsQuery builds the SQL query for retrieving insights
-func (s *AggregationService) buildInsightsQuery(params models.CampaignInsightsParams) (string, []interface{}) {
-	// Start with the base query
-	query := `
-		SELECT
-			campaign_id,
-			date,
-			platform,
-			region,
-			impressions,
-			clicks,
-			conversions,
-			spend,
-			revenue,
-			ctr,
-			cpc,
-			cpa,
-			roas,
-			conversion_rate,
-			updated_at
-		FROM campaign_insights
-		WHERE 1=1
-	`
-
-	var args []interface{}
-
-	// Add filters
-	if params.CampaignID != uuid.Nil {
-		query += " AND campaign_id = ?"
-		args = append(args, params.CampaignID.String())
+// GetConvertedCampaignInsights retrieves campaign insights with their amounts
+// converted into currency. Days are converted at their own rate before they
+// are rolled up, so weekly and longer buckets mix the rates of their days.
+func (s *AggregationService) GetConvertedCampaignInsights(ctx context.Context, params models.CampaignInsightsParams, currency string) (*models.ConvertedInsights, error) {
+	rows, err := s.GetCampaignInsights(ctx, dailyParams(params))
+	if err != nil {
+		return nil, err
 	}
 
-	if !params.StartDate.IsZero() {
-		query += " AND date >= ?"
-		args = append(args, params.StartDate)
+	converted, missing, err := s.fx.ConvertInsights(ctx, rows, currency)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		s.logger.Debug("Exchange rates missing for insights",
+			zap.String("campaign_id", params.CampaignID.String()),
+			zap.String("currency", currency),
+			zap.Int("missing", len(missing)),
+		)
 	}
 
-	if !params.EndDate.IsZero() {
-		query += " AND date <= ?"
-		args = append(args, params.EndDate)
+	return &models.ConvertedInsights{
+		Currency:     currency,
+		Insights:     models.GroupInsights(converted, params.GroupBy, params.Granularity, params.WeekStart),
+		MissingRates: missing,
+	}, nil
+}
+
+// dailyParams returns the query of the rows that params are converted from:
+// days, or hours for hourly insights, that rates can be looked up for
+func dailyParams(params models.CampaignInsightsParams) models.CampaignInsightsParams {
+	daily := params
+	if daily.Granularity != models.GranularityHourly {
+		daily.Granularity = models.GranularityDaily
+	}
+	if !daily.GroupsBy(models.DimensionDate) {
+		daily.GroupBy = append([]models.InsightsDimension{models.DimensionDate}, daily.GroupBy...)
 	}
+	return daily
+}
 
-	if params.Platform != nil {
-		query += " AND platform = ?"
-		args = append(args, string(*params.Platform))
+// CompareCampaignInsights compares the insights of the date range of params
+// with those of the period selected by compare. Amounts are converted into
+// currency unless it is empty, each side like GetConvertedCampaignInsights.
+func (s *AggregationService) CompareCampaignInsights(ctx context.Context, params models.CampaignInsightsParams, compare models.InsightsComparisonParams, currency string) (*models.InsightsComparison, error) {
+	loc, err := models.LoadTimezone(params.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	current := models.DateRange{StartDate: params.StartDate, EndDate: params.EndDate}
+	comparison, err := compare.Range(current)
+	if err != nil {
+		return nil, err
+	}
+
+	query := params
+	if currency != "" {
+		query = dailyParams(params)
+	}
+	currentRows, comparisonRows, err := s.getComparedInsights(ctx, query, comparison)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []models.MissingFXRate
+	if currency != "" {
+		convert := func(rows []models.CampaignInsights) ([]models.CampaignInsights, error) {
+			converted, rowsMissing, err := s.fx.ConvertInsights(ctx, rows, currency)
+			if err != nil {
+				return nil, err
+			}
+			missing = mergeMissingRates(missing, rowsMissing)
+			return models.GroupInsights(converted, params.GroupBy, params.Granularity, params.WeekStart), nil
+		}
+		if currentRows, err = convert(currentRows); err != nil {
+			return nil, err
+		}
+		if comparisonRows, err = convert(comparisonRows); err != nil {
+			return nil, err
+		}
 	}
 
-	if params.Region != nil && *params.Region != "" {
-		query += " AND region = ?"
-		args = append(args, *params.Region)
+	result := models.CompareInsights(params, loc, current, comparison, currentRows, comparisonRows)
+	result.CompareTo = compare.CompareTo
+	result.Currency = currency
+	result.MissingRates = missing
+	return result, nil
+}
+
+// getComparedInsights retrieves the insights of the date range of params and
+// of a comparison range in one query. Both are cached together, under the
+// key of the current range extended with the comparison range.
+func (s *AggregationService) getComparedInsights(ctx context.Context, params models.CampaignInsightsParams, comparison models.DateRange) ([]models.CampaignInsights, []models.CampaignInsights, error) {
+	cacheKey := s.getCacheKey(params) + fmt.Sprintf("compare:%s:%s:",
+		comparison.StartDate.Format("2006-01-02"), comparison.EndDate.Format("2006-01-02"))
+	var series [][]models.CampaignInsights
+
+	err := s.redis.GetObject(ctx, cacheKey, &series)
+	if err == nil && len(series) == 2 {
+		s.logger.Debug("Retrieved compared insights from cache", zap.String("cache_key", cacheKey))
+		return series[0], series[1], nil
 	}
 
-	// Add ordering
-	query += " ORDER BY date ASC"
+	s.logger.Debug("Cache miss, querying from database", zap.String("cache_key", cacheKey))
 
-	return query, args
+	series, err = s.insights.QueryPeriods(ctx, params, []models.DateRange{
+		{StartDate: params.StartDate, EndDate: params.EndDate},
+		comparison,
+	})
+	if err != nil {
+		s.logger.Error("Failed to query compared insights", zap.Error(err))
+		return nil, nil, err
+	}
+
+	// Cache the results (only if there are results to cache)
+	if len(series[0]) > 0 || len(series[1]) > 0 {
+		if err := s.redis.Set(ctx, cacheKey, series, 5*time.Minute); err != nil {
+			s.logger.Warn("Failed to cache compared insights", zap.Error(err), zap.String("cache_key", cacheKey))
+		}
+	}
+
+	return series[0], series[1], nil
 }
 
-// getCacheKey generates a cache key for the insights query
+// getCacheKey generates a cache key for the insights query. Queries over a
+// set of campaigns are keyed under insights:portfolio: by a hash of the set.
 func (s *AggregationService) getCacheKey(params models.CampaignInsightsParams) string {
 	// Build a cache key based on the query parameters
 	cacheKey := fmt.Sprintf("insights:%s:", params.CampaignID.String())
+	if params.CampaignID == uuid.Nil && params.CampaignIDs != nil {
+		cacheKey = fmt.Sprintf("%s%s:", portfolioCachePrefix, campaignSetHash(params.CampaignIDs))
+	}
 
 	if !params.StartDate.IsZero() {
 		cacheKey += fmt.Sprintf("start:%s:", params.StartDate.Format("2006-01-02"))
@@ -200,68 +226,110 @@ func (s *AggregationService) getCacheKey(params models.CampaignInsightsParams) s
 		cacheKey += fmt.Sprintf("granularity:%s:", params.Granularity)
 	}
 
+	if params.Granularity == models.GranularityWeekly {
+		cacheKey += fmt.Sprintf("week_start:%s:", strings.ToLower(params.WeekStart.String()))
+	}
+
+	// Only hourly buckets depend on the timezone
+	if params.Granularity == models.GranularityHourly && params.Timezone != "" {
+		cacheKey += fmt.Sprintf("tz:%s:", params.Timezone)
+	}
+
+	if params.GroupBy != nil {
+		dimensions := make([]string, len(params.GroupBy))
+		for i, dimension := range params.GroupBy {
+			dimensions[i] = string(dimension)
+		}
+		sort.Strings(dimensions)
+		cacheKey += fmt.Sprintf("group_by:%s:", strings.Join(dimensions, ","))
+	}
+
 	return cacheKey
 }
 
 // TriggerReaggregation triggers re-aggregation of metrics for a campaign
+// and drops the cached insights of the campaign and of every portfolio
 func (s *AggregationService) TriggerReaggregation(ctx context.Context, campaignID uuid.UUID, startDate, endDate time.Time) error {
-	// Execute a query to re-aggregate the metrics
-	query := `
-		INSERT INTO campaign_insights
-		SELECT
-			campaign_id,
-			toDate(event_time) as date,
-			platform,
-			region,
-			sum(impressions) as impressions,
-			sum(clicks) as clicks,
-			sum(conversions) as conversions,
-			sum(spend) as spend,
-			sum(revenue) as revenue,
-			if(sum(impressions) > 0, sum(clicks) / sum(impressions), 0) as ctr,
-			if(sum(clicks) > 0, sum(spend) / sum(clicks), 0) as cpc,
-			if(sum(conversions) > 0, sum(spend) / sum(conversions), 0) as cpa,
-			if(sum(spend) > 0, sum(revenue) / sum(spend), 0) as roas,
-			if(sum(clicks) > 0, sum(conversions) / sum(clicks), 0) as conversion_rate,
-			now() as updated_at
-		FROM campaign_events
-		WHERE campaign_id = ? AND event_time >= ? AND event_time <= ?
-		GROUP BY campaign_id, toDate(event_time), platform, region
-	`
-
-	conn := s.db.GetConn()
-	err := conn.Exec(ctx, query, campaignID.String(), startDate, endDate)
-	if err != nil {
-		s.logger.Error("Failed to re-aggregate insights",
-			zap.Error(err),
+	return s.ReaggregateCampaigns(ctx, map[uuid.UUID]models.DateRange{
+		campaignID: {StartDate: startDate, EndDate: endDate},
+	})
+}
+
+// ReaggregateCampaigns re-aggregates a range of days of each campaign, one
+// rebuild per campaign, and then drops the cached insights of the campaigns
+// and of every portfolio once for all of them
+func (s *AggregationService) ReaggregateCampaigns(ctx context.Context, ranges map[uuid.UUID]models.DateRange) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	campaignIDs := make([]uuid.UUID, 0, len(ranges))
+	for campaignID, days := range ranges {
+		if err := s.insights.Reaggregate(ctx, campaignID, days.StartDate, days.EndDate); err != nil {
+			s.logger.Error("Failed to re-aggregate insights",
+				zap.Error(err),
+				zap.String("campaign_id", campaignID.String()),
+				zap.Time("start_date", days.StartDate),
+				zap.Time("end_date", days.EndDate),
+			)
+			return err
+		}
+
+		s.logger.Info("Successfully re-aggregated insights",
 			zap.String("campaign_id", campaignID.String()),
-			zap.Time("start_date", startDate),
-			zap.Time("end_date", endDate),
+			zap.Time("start_date", days.StartDate),
+			zap.Time("end_date", days.EndDate),
 		)
-		return err
+		campaignIDs = append(campaignIDs, campaignID)
 	}
 
-	s.logger.Info("Successfully re-aggregated insights",
-		zap.String("campaign_id", campaignID.String()),
-		zap.Time("start_date", startDate),
-		zap.Time("end_date", endDate),
-	)
+	s.invalidateInsights(ctx, campaignIDs)
+	return nil
+}
 
-	// Invalidate cache
-	cachePattern := fmt.Sprintf("insights:%s:*", campaignID.String())
-	keys, err := s.redis.GetClient().Keys(ctx, cachePattern).Result()
-	if err != nil {
-		s.logger.Warn("Failed to get cache keys for invalidation", zap.Error(err), zap.String("pattern", cachePattern))
-		// Continue even if cache invalidation fails
-	} else {
-		if len(keys) > 0 {
-			if err := s.redis.GetClient().Del(ctx, keys...).Err(); err != nil {
-				s.logger.Warn("Failed to invalidate cache", zap.Error(err), zap.Strings("keys", keys))
-			} else {
-				s.logger.Debug("Invalidated cache", zap.Int("key_count", len(keys)))
-			}
+// invalidateInsights drops the cached insights of campaigns and of every
+// portfolio, which may include them. Keys are found with SCAN so large
+// caches do not block Redis; failures are logged, as entries expire anyway.
+func (s *AggregationService) invalidateInsights(ctx context.Context, campaignIDs []uuid.UUID) {
+	patterns := make([]string, 0, len(campaignIDs)+1)
+	for _, campaignID := range campaignIDs {
+		patterns = append(patterns, fmt.Sprintf("insights:%s:*", campaignID.String()))
+	}
+	patterns = append(patterns, portfolioCachePrefix+"*")
+
+	client := s.redis.GetClient()
+	var keys []string
+	for _, cachePattern := range patterns {
+		iter := client.Scan(ctx, 0, cachePattern, 500).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			s.logger.Warn("Failed to get cache keys for invalidation", zap.Error(err), zap.String("pattern", cachePattern))
+			// Continue even if cache invalidation fails
 		}
 	}
 
-	return nil
+	if len(keys) > 0 {
+		if err := client.Del(ctx, keys...).Err(); err != nil {
+			s.logger.Warn("Failed to invalidate cache", zap.Error(err), zap.Int("key_count", len(keys)))
+		} else {
+			s.logger.Debug("Invalidated cache", zap.Int("key_count", len(keys)))
+		}
+	}
+}
+
+// portfolioCachePrefix prefixes the cache keys of queries over a set of campaigns
+const portfolioCachePrefix = "insights:portfolio:"
+
+// campaignSetHash fingerprints a set of campaigns regardless of their order
+func campaignSetHash(ids []uuid.UUID) string {
+	sorted := make([]string, len(ids))
+	for i, id := range ids {
+		sorted[i] = id.String()
+	}
+	sort.Strings(sorted)
+
+	h := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+	return hex.EncodeToString(h[:16])
 }
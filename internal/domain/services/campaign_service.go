@@ -2,64 +2,86 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zocket/campaign-analytics/internal/domain/models"
-	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
-	"github.com/zocket/campaign-analytics/internal/infrastructure/kafka"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/codec"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/platforms"
 	"go.uber.org/zap"
 )
 
+// Topics the campaign service publishes to through the outbox
+const (
+	// campaignEventsTopic receives the events fetched from platforms
+	campaignEventsTopic = "campaign_events"
+	// campaignLifecycleTopic receives campaign changes for downstream services
+	campaignLifecycleTopic = "campaign_lifecycle"
+)
+
 // CampaignService handles campaign-related operations
 type CampaignService struct {
-	db              *database.PostgresClient
+	campaigns       repository.CampaignRepository
 	platformClients *platforms.PlatformClients
-	producer        *kafka.Producer
+	credentials     *CredentialsService
+	events          *codec.CampaignEventCodec
+	lifecycle       *codec.LifecycleEventCodec
+	window          SyncWindowConfig
 	logger          *zap.Logger
 }
 
-// NewCampaignService creates a new campaign service
+// SyncWindowConfig controls which days a sync fetches
+type SyncWindowConfig struct {
+	// InitialDays is how far back the first sync of a campaign fetches
+	InitialDays int
+	// RestatementDays is how many days before the watermark are fetched again,
+	// since platforms revise recent data after the fact
+	RestatementDays int
+}
+
+// NewCampaignService creates a new campaign service. Its Kafka messages are
+// queued in the outbox of the campaign repository along with the change they
+// describe.
 func NewCampaignService(
-	db *database.PostgresClient,
+	campaigns repository.CampaignRepository,
 	platformClients *platforms.PlatformClients,
+	credentials *CredentialsService,
+	window SyncWindowConfig,
+	events *codec.CampaignEventCodec,
 	logger *zap.Logger,
-) (*CampaignService, error) {
-	// Create a Kafka producer for the campaign events topic
-	producer, err := kafka.NewProducer("campaign_events")
-	if err != nil {
-		return nil, err
+) *CampaignService {
+	if window.InitialDays <= 0 {
+		window.InitialDays = 30
+	}
+	if window.RestatementDays < 0 {
+		window.RestatementDays = 0
 	}
 
 	return &CampaignService{
-		db:              db,
+		campaigns:       campaigns,
 		platformClients: platformClients,
-		producer:        producer,
+		credentials:     credentials,
+		events:          events,
+		lifecycle:       codec.NewLifecycleEventCodec(),
+		window:          window,
 		logger:          logger.With(zap.String("component", "campaign_service")),
-	}, nil
+	}
 }
 
 // GetCampaign retrieves a campaign by ID
 func (s *CampaignService) GetCampaign(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
-	query := `
-		SELECT * FROM campaigns 
-		WHERE id = $1
-	`
-
-	var campaign models.Campaign
-	err := s.db.GetDB().GetContext(ctx, &campaign, query, id)
+	campaign, err := s.campaigns.Get(ctx, id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("campaign not found")
+		if !errors.Is(err, ErrCampaignNotFound) {
+			s.logger.Error("Failed to get campaign", zap.Error(err), zap.String("campaign_id", id.String()))
 		}
-		s.logger.Error("Failed to get campaign", zap.Error(err), zap.String("campaign_id", id.String()))
 		return nil, err
 	}
 
-	return &campaign, nil
+	return campaign, nil
 }
 
 // CreateCampaign creates a new campaign
@@ -74,29 +96,16 @@ func (s *CampaignService) CreateCampaign(ctx context.Context, campaign *models.C
 	campaign.CreatedAt = now
 	campaign.UpdatedAt = now
 
-	// Execute the insert
-	query := `
-		INSERT INTO campaigns (
-			id, user_id, name, platform, budget, start_date, end_date, 
-			status, external_id, created_at, updated_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
-		)
-	`
-
-	_, err := s.db.GetDB().ExecContext(ctx, query,
-		campaign.ID,
-		campaign.UserID,
-		campaign.Name,
-		campaign.Platform,
-		campaign.Budget,
-		campaign.StartDate,
-		campaign.EndDate,
-		campaign.Status,
-		campaign.ExternalID,
-		campaign.CreatedAt,
-		campaign.UpdatedAt,
-	)
+	if campaign.Timezone == "" {
+		campaign.Timezone = models.DefaultTimezone
+	}
+	campaign.Tags = models.NormalizeTags(campaign.Tags)
+
+	// Announce the campaign along with storing it
+	msg, err := s.lifecycleMessage(ctx, models.LifecycleCampaignCreated, campaign, "")
+	if err == nil {
+		err = s.campaigns.Create(ctx, campaign, msg)
+	}
 	if err != nil {
 		s.logger.Error("Failed to create campaign",
 			zap.Error(err),
@@ -114,32 +123,32 @@ func (s *CampaignService) UpdateCampaign(ctx context.Context, campaign *models.C
 	// Update the timestamp
 	campaign.UpdatedAt = time.Now()
 
-	// Execute the update
-	query := `
-		UPDATE campaigns SET
-			name = $1,
-			platform = $2,
-			budget = $3,
-			start_date = $4,
-			end_date = $5,
-			status = $6,
-			external_id = $7,
-			updated_at = $8
-		WHERE id = $9
-	`
-
-	result, err := s.db.GetDB().ExecContext(ctx, query,
-		campaign.Name,
-		campaign.Platform,
-		campaign.Budget,
-		campaign.StartDate,
-		campaign.EndDate,
-		campaign.Status,
-		campaign.ExternalID,
-		campaign.UpdatedAt,
-		campaign.ID,
-	)
+	if campaign.Timezone == "" {
+		campaign.Timezone = models.DefaultTimezone
+	}
+	campaign.Tags = models.NormalizeTags(campaign.Tags)
+
+	// Compare the status against the stored campaign, locked until the update is done
+	err := s.campaigns.Update(ctx, campaign, func(previous *models.Campaign) ([]bus.Message, error) {
+		updated, err := s.lifecycleMessage(ctx, models.LifecycleCampaignUpdated, campaign, previous.Status)
+		if err != nil {
+			return nil, err
+		}
+		messages := []bus.Message{updated}
+
+		if previous.Status != campaign.Status {
+			changed, err := s.lifecycleMessage(ctx, models.LifecycleCampaignStatusChanged, campaign, previous.Status)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, changed)
+		}
+		return messages, nil
+	})
 	if err != nil {
+		if errors.Is(err, ErrCampaignNotFound) {
+			return err
+		}
 		s.logger.Error("Failed to update campaign",
 			zap.Error(err),
 			zap.String("campaign_id", campaign.ID.String()),
@@ -147,50 +156,133 @@ func (s *CampaignService) UpdateCampaign(ctx context.Context, campaign *models.C
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+	s.logger.Info("Campaign updated successfully", zap.String("campaign_id", campaign.ID.String()))
+	return nil
+}
 
-	if rowsAffected == 0 {
-		return errors.New("campaign not found")
+// lifecycleMessage encodes a lifecycle event of a campaign for the outbox
+func (s *CampaignService) lifecycleMessage(ctx context.Context, eventType models.LifecycleEventType, campaign *models.Campaign, previousStatus string) (bus.Message, error) {
+	msg, err := s.lifecycle.Encode(ctx, &models.CampaignLifecycleEvent{
+		ID:             uuid.New(),
+		Type:           eventType,
+		CampaignID:     campaign.ID,
+		PreviousStatus: previousStatus,
+		Campaign:       *campaign,
+		OccurredAt:     time.Now(),
+	})
+	if err != nil {
+		return bus.Message{}, err
 	}
 
-	s.logger.Info("Campaign updated successfully", zap.String("campaign_id", campaign.ID.String()))
-	return nil
+	msg.Topic = campaignLifecycleTopic
+	return msg, nil
 }
 
 // ListCampaigns lists campaigns with optional filters
 func (s *CampaignService) ListCampaigns(ctx context.Context, userID uuid.UUID, platform *models.Platform, status *string) ([]models.Campaign, error) {
-	// Build the query with filters
-	query := "SELECT * FROM campaigns WHERE user_id = $1"
-	args := []interface{}{userID}
-
-	if platform != nil {
-		query += " AND platform = $" + string(len(args)+1)
-		args = append(args, string(*platform))
+	campaigns, err := s.campaigns.List(ctx, repository.CampaignFilter{
+		UserID:   userID,
+		Platform: platform,
+		Status:   status,
+	})
+	if err != nil {
+		s.logger.Error("Failed to list campaigns", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
 	}
 
-	if status != nil {
-		query += " AND status = $" + string(len(args)+1)
-		args = append(args, *status)
+	return campaigns, nil
+}
+
+// ListDueCampaigns lists active campaigns whose date range covers day and
+// that have not been attempted since syncedBefore, least recently attempted first
+func (s *CampaignService) ListDueCampaigns(ctx context.Context, day, syncedBefore time.Time) ([]models.Campaign, error) {
+	campaigns, err := s.campaigns.ListDue(ctx, day, syncedBefore)
+	if err != nil {
+		s.logger.Error("Failed to list campaigns due for sync", zap.Error(err))
+		return nil, err
 	}
 
-	query += " ORDER BY created_at DESC"
+	return campaigns, nil
+}
 
-	// Execute the query
-	var campaigns []models.Campaign
-	err := s.db.GetDB().SelectContext(ctx, &campaigns, query, args...)
+// GetSyncState returns the sync progress of a campaign. A campaign that was
+// never synced gets a state with SyncStatusNeverSynced.
+func (s *CampaignService) GetSyncState(ctx context.Context, campaign *models.Campaign) (*models.CampaignSyncState, error) {
+	state, err := s.campaigns.GetSyncState(ctx, campaign.ID, campaign.Platform)
 	if err != nil {
-		s.logger.Error("Failed to list campaigns", zap.Error(err), zap.String("user_id", userID.String()))
+		if errors.Is(err, repository.ErrSyncStateNotFound) {
+			return &models.CampaignSyncState{
+				CampaignID: campaign.ID,
+				Platform:   campaign.Platform,
+				LastStatus: models.SyncStatusNeverSynced,
+			}, nil
+		}
+		s.logger.Error("Failed to get sync state", zap.Error(err), zap.String("campaign_id", campaign.ID.String()))
 		return nil, err
 	}
 
-	return campaigns, nil
+	return state, nil
+}
+
+// syncWindow returns the range to fetch: from the watermark minus the
+// restatement lookback, or the initial lookback for a first sync, never
+// before the campaign start. The range is in the location of now, so
+// platforms that are asked for days get those of the ad account.
+func (s *CampaignService) syncWindow(campaign *models.Campaign, state *models.CampaignSyncState, now time.Time) (time.Time, time.Time) {
+	endTime := now
+	startTime := endTime.AddDate(0, 0, -s.window.InitialDays)
+	if state.WindowEnd != nil {
+		startTime = state.WindowEnd.In(now.Location()).AddDate(0, 0, -s.window.RestatementDays)
+	}
+	if campaign.StartDate.After(startTime) {
+		startTime = campaign.StartDate
+	}
+	return startTime, endTime
+}
+
+// recordSyncFailure records a failed attempt. Failures to record are logged
+// rather than returned to keep the original error.
+func (s *CampaignService) recordSyncFailure(ctx context.Context, campaign *models.Campaign, status models.SyncStatus, syncErr error, eventCount int) {
+	if err := s.campaigns.RecordSyncAttempt(ctx, campaign, status, syncErr, eventCount); err != nil {
+		s.logger.Error("Failed to record sync failure",
+			zap.Error(err),
+			zap.String("campaign_id", campaign.ID.String()),
+		)
+	}
+}
+
+// ConnectionStatus reports whether the campaign owner's platform connection can be used to fetch data
+func (s *CampaignService) ConnectionStatus(ctx context.Context, campaign *models.Campaign) (models.ConnectionStatus, error) {
+	connection, err := s.credentials.GetConnection(ctx, campaign.UserID, campaign.Platform)
+	if err != nil {
+		if errors.Is(err, ErrCredentialsNotFound) {
+			return models.ConnectionStatusNotConnected, nil
+		}
+		return "", err
+	}
+	return connection.Status, nil
 }
 
 // FetchCampaignData fetches the latest campaign data from the external platform
 func (s *CampaignService) FetchCampaignData(ctx context.Context, campaignID uuid.UUID) error {
+	return s.fetchCampaignData(ctx, campaignID, nil)
+}
+
+// BackfillCampaignData fetches a given date range of a campaign again, e.g.
+// days restated after the restatement lookback. The watermark is left as is.
+func (s *CampaignService) BackfillCampaignData(ctx context.Context, campaignID uuid.UUID, startTime, endTime time.Time) error {
+	return s.fetchCampaignData(ctx, campaignID, &fetchRange{start: startTime, end: endTime})
+}
+
+// fetchRange is the explicit date range of a backfill
+type fetchRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// fetchCampaignData fetches a campaign from its sync window, or from backfill
+// when given, and queues the events
+func (s *CampaignService) fetchCampaignData(ctx context.Context, campaignID uuid.UUID, backfill *fetchRange) error {
 	// Get the campaign
 	campaign, err := s.GetCampaign(ctx, campaignID)
 	if err != nil {
@@ -207,51 +299,110 @@ func (s *CampaignService) FetchCampaignData(ctx context.Context, campaignID uuid
 		return err
 	}
 
-	// Calculate time range (last 30 days by default)
-	endTime := time.Now()
-	startTime := endTime.AddDate(0, 0, -30)
-	if campaign.StartDate.After(startTime) {
-		startTime = campaign.StartDate
+	// Fetch with the campaign owner's own platform account
+	creds, err := s.credentials.GetCredentials(ctx, campaign.UserID, campaign.Platform)
+	if err != nil {
+		s.logger.Error("Failed to load platform credentials",
+			zap.Error(err),
+			zap.String("campaign_id", campaignID.String()),
+			zap.String("platform", string(campaign.Platform)),
+		)
+		s.recordSyncFailure(ctx, campaign, models.SyncStatusFailed, err, 0)
+		return err
+	}
+
+	// Only fetch the days since the last successful sync, unless backfilling
+	var startTime, endTime time.Time
+	if backfill != nil {
+		startTime, endTime = backfill.start, backfill.end
+	} else {
+		state, err := s.GetSyncState(ctx, campaign)
+		if err != nil {
+			return err
+		}
+		startTime, endTime = s.syncWindow(campaign, state, time.Now().In(campaign.Location()))
 	}
 
 	// Fetch data from the platform
-	events, err := client.FetchData(ctx, campaign.ExternalID, startTime, endTime)
-	if err != nil {
+	events, err := client.FetchData(ctx, creds, campaign.ExternalID, startTime, endTime)
+	var partialErr *platforms.PartialResultError
+	if errors.As(err, &partialErr) {
+		// Publish what was fetched; the remainder is picked up by the next fetch
+		s.logger.Warn("Platform returned a partial result",
+			zap.Error(err),
+			zap.String("campaign_id", campaignID.String()),
+			zap.String("platform", string(campaign.Platform)),
+			zap.Int("event_count", len(events)),
+		)
+	} else if err != nil {
 		s.logger.Error("Failed to fetch campaign data",
 			zap.Error(err),
 			zap.String("campaign_id", campaignID.String()),
 			zap.String("platform", string(campaign.Platform)),
 		)
+		s.recordSyncFailure(ctx, campaign, models.SyncStatusFailed, err, 0)
 		return err
 	}
 
-	// Publish events to Kafka for processing
-	for _, event := range events {
+	// Queue the events in the outbox along with the sync state, so the
+	// watermark only advances together with the events
+	messages := make([]bus.Message, 0, len(events))
+	for i := range events {
 		// Ensure the campaign ID is set correctly
+		event := &events[i]
 		event.CampaignID = campaignID
 
-		// Send the event to Kafka
-		err := s.producer.SendMessage(ctx, campaignID.String(), event)
+		// Events of platforms that do not report days belong to the day of
+		// their time in the ad account's timezone
+		if event.LocalDate.IsZero() && !event.EventTime.IsZero() {
+			event.LocalDate = models.DateIn(event.EventTime, campaign.Location())
+		}
+
+		// Encode the event in the current schema version
+		msg, err := s.events.Encode(ctx, campaignEventsTopic, event)
 		if err != nil {
-			s.logger.Error("Failed to publish event to Kafka",
-				zap.Error(err),
-				zap.String("campaign_id", campaignID.String()),
-				zap.String("event_id", event.ID.String()),
-			)
-			// Continue processing other events even if one fails
+			s.logger.Error("Failed to encode campaign event", zap.Error(err), zap.String("campaign_id", campaignID.String()))
+			s.recordSyncFailure(ctx, campaign, models.SyncStatusFailed, err, 0)
+			return err
 		}
+		msg.Topic = campaignEventsTopic
+		messages = append(messages, msg)
+	}
+
+	// A partial result keeps the watermark so the missing days are fetched
+	// again, and a backfill lies behind it
+	if partialErr != nil {
+		err = s.campaigns.RecordSyncAttempt(ctx, campaign, models.SyncStatusPartial, partialErr, len(events), messages...)
+	} else if backfill != nil {
+		err = s.campaigns.RecordSyncAttempt(ctx, campaign, models.SyncStatusSucceeded, nil, len(events), messages...)
+	} else {
+		err = s.campaigns.RecordSyncSuccess(ctx, campaign, startTime, endTime, len(events), messages...)
+	}
+	if err != nil {
+		s.logger.Error("Failed to queue campaign events",
+			zap.Error(err),
+			zap.String("campaign_id", campaignID.String()),
+		)
+		s.recordSyncFailure(ctx, campaign, models.SyncStatusFailed, err, 0)
+		return err
+	}
+	if partialErr != nil {
+		return nil
 	}
 
-	s.logger.Info("Campaign data fetched and published",
+	s.logger.Info("Campaign data fetched and queued",
 		zap.String("campaign_id", campaignID.String()),
 		zap.String("platform", string(campaign.Platform)),
+		zap.Time("window_start", startTime),
+		zap.Time("window_end", endTime),
+		zap.Bool("backfill", backfill != nil),
 		zap.Int("event_count", len(events)),
 	)
 
 	return nil
 }
 
-// Close closes the campaign service and releases resources
-func (s *CampaignService) Close() error {
-	return s.producer.Close()
-}
+// Error definitions
+var (
+	ErrCampaignNotFound = repository.ErrCampaignNotFound
+)
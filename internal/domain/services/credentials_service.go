@@ -0,0 +1,381 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/secrets"
+	"go.uber.org/zap"
+)
+
+// CredentialsService stores users' platform credentials, encrypted at rest
+type CredentialsService struct {
+	db     *database.PostgresClient
+	sealer *secrets.Sealer
+	logger *zap.Logger
+}
+
+// NewCredentialsService creates a new credentials service
+func NewCredentialsService(
+	db *database.PostgresClient,
+	sealer *secrets.Sealer,
+	logger *zap.Logger,
+) *CredentialsService {
+	return &CredentialsService{
+		db:     db,
+		sealer: sealer,
+		logger: logger.With(zap.String("component", "credentials_service")),
+	}
+}
+
+// storedCredentials is the document kept in platform_credentials.credentials.
+// Only the account ID is stored in clear so connections can be listed
+// without decrypting anything.
+type storedCredentials struct {
+	AccountID string            `json:"account_id"`
+	Secret    *secrets.Envelope `json:"secret"`
+}
+
+// credentialsRow is a row of the platform_credentials table
+type credentialsRow struct {
+	ID          uuid.UUID      `db:"id"`
+	UserID      uuid.UUID      `db:"user_id"`
+	Platform    string         `db:"platform"`
+	Credentials []byte         `db:"credentials"`
+	Status      string         `db:"status"`
+	ExpiresAt   sql.NullTime   `db:"expires_at"`
+	LastError   sql.NullString `db:"last_error"`
+	CreatedAt   time.Time      `db:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at"`
+}
+
+// credentialsColumns lists the columns scanned into credentialsRow
+const credentialsColumns = "id, user_id, platform, credentials, status, expires_at, last_error, created_at, updated_at"
+
+// connection converts the row to its non-secret view
+func (r credentialsRow) connection() (models.PlatformConnection, error) {
+	var stored storedCredentials
+	if err := json.Unmarshal(r.Credentials, &stored); err != nil {
+		return models.PlatformConnection{}, err
+	}
+
+	connection := models.PlatformConnection{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		Platform:  models.Platform(r.Platform),
+		AccountID: stored.AccountID,
+		Status:    models.ConnectionStatus(r.Status),
+		LastError: r.LastError.String,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+	if r.ExpiresAt.Valid {
+		expiresAt := r.ExpiresAt.Time
+		connection.ExpiresAt = &expiresAt
+	}
+	return connection, nil
+}
+
+// Connect stores credentials for a user's platform account, replacing any
+// existing connection and marking it active again
+func (s *CredentialsService) Connect(ctx context.Context, userID uuid.UUID, platform models.Platform, creds models.PlatformCredentials) (*models.PlatformConnection, error) {
+	plaintext, err := json.Marshal(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := s.sealer.Seal(plaintext, credentialsAAD(userID, platform))
+	if err != nil {
+		s.logger.Error("Failed to encrypt credentials", zap.Error(err))
+		return nil, err
+	}
+
+	document, err := json.Marshal(storedCredentials{AccountID: creds.AccountID, Secret: envelope})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	query := `
+		INSERT INTO platform_credentials (id, user_id, platform, credentials, status, expires_at, last_error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULL, $7, $7)
+		ON CONFLICT (user_id, platform) DO UPDATE SET
+			credentials = EXCLUDED.credentials,
+			status = EXCLUDED.status,
+			expires_at = EXCLUDED.expires_at,
+			last_error = NULL,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at, updated_at
+	`
+
+	connection := models.PlatformConnection{
+		UserID:    userID,
+		Platform:  platform,
+		AccountID: creds.AccountID,
+		Status:    models.ConnectionStatusActive,
+		ExpiresAt: creds.ExpiresAt,
+	}
+	err = s.db.GetDB().QueryRowxContext(ctx, query,
+		uuid.New(), userID, string(platform), document, string(models.ConnectionStatusActive), creds.ExpiresAt, now,
+	).Scan(&connection.ID, &connection.CreatedAt, &connection.UpdatedAt)
+	if err != nil {
+		s.logger.Error("Failed to store credentials",
+			zap.Error(err),
+			zap.String("user_id", userID.String()),
+			zap.String("platform", string(platform)),
+		)
+		return nil, err
+	}
+
+	s.logger.Info("Platform connected",
+		zap.String("user_id", userID.String()),
+		zap.String("platform", string(platform)),
+	)
+	return &connection, nil
+}
+
+// Disconnect removes a user's platform connection
+func (s *CredentialsService) Disconnect(ctx context.Context, userID uuid.UUID, platform models.Platform) error {
+	result, err := s.db.GetDB().ExecContext(ctx,
+		"DELETE FROM platform_credentials WHERE user_id = $1 AND platform = $2",
+		userID, string(platform),
+	)
+	if err != nil {
+		s.logger.Error("Failed to delete credentials", zap.Error(err), zap.String("user_id", userID.String()))
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCredentialsNotFound
+	}
+
+	s.logger.Info("Platform disconnected",
+		zap.String("user_id", userID.String()),
+		zap.String("platform", string(platform)),
+	)
+	return nil
+}
+
+// ListConnections lists a user's platform connections without their secrets
+func (s *CredentialsService) ListConnections(ctx context.Context, userID uuid.UUID) ([]models.PlatformConnection, error) {
+	var rows []credentialsRow
+	err := s.db.GetDB().SelectContext(ctx, &rows,
+		"SELECT "+credentialsColumns+" FROM platform_credentials WHERE user_id = $1 ORDER BY platform",
+		userID,
+	)
+	if err != nil {
+		s.logger.Error("Failed to list connections", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+
+	return rowsToConnections(rows)
+}
+
+// ListExpiring lists active connections whose access token expires before the given time
+func (s *CredentialsService) ListExpiring(ctx context.Context, before time.Time) ([]models.PlatformConnection, error) {
+	var rows []credentialsRow
+	err := s.db.GetDB().SelectContext(ctx, &rows,
+		"SELECT "+credentialsColumns+" FROM platform_credentials WHERE status = $1 AND expires_at IS NOT NULL AND expires_at < $2 ORDER BY expires_at",
+		string(models.ConnectionStatusActive), before,
+	)
+	if err != nil {
+		s.logger.Error("Failed to list expiring connections", zap.Error(err))
+		return nil, err
+	}
+
+	return rowsToConnections(rows)
+}
+
+// GetConnection returns a user's connection for a platform without its secrets
+func (s *CredentialsService) GetConnection(ctx context.Context, userID uuid.UUID, platform models.Platform) (*models.PlatformConnection, error) {
+	row, err := s.getRow(ctx, userID, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	connection, err := row.connection()
+	if err != nil {
+		return nil, err
+	}
+	return &connection, nil
+}
+
+// MarkNeedsReauth flags a connection whose tokens can no longer be refreshed.
+// Fetches fail fast until the user reconnects the account.
+func (s *CredentialsService) MarkNeedsReauth(ctx context.Context, userID uuid.UUID, platform models.Platform, reason string) error {
+	_, err := s.db.GetDB().ExecContext(ctx,
+		"UPDATE platform_credentials SET status = $1, last_error = $2, updated_at = $3 WHERE user_id = $4 AND platform = $5",
+		string(models.ConnectionStatusNeedsReauth), reason, time.Now(), userID, string(platform),
+	)
+	if err != nil {
+		s.logger.Error("Failed to mark connection for re-authorization", zap.Error(err), zap.String("user_id", userID.String()))
+		return err
+	}
+
+	s.logger.Warn("Platform connection needs re-authorization",
+		zap.String("user_id", userID.String()),
+		zap.String("platform", string(platform)),
+		zap.String("reason", reason),
+	)
+	return nil
+}
+
+// GetCredentials loads and decrypts a user's credentials for a platform.
+// It returns ErrConnectionNeedsReauth when the connection must be renewed by the user.
+func (s *CredentialsService) GetCredentials(ctx context.Context, userID uuid.UUID, platform models.Platform) (*models.PlatformCredentials, error) {
+	row, err := s.getRow(ctx, userID, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	if models.ConnectionStatus(row.Status) == models.ConnectionStatusNeedsReauth {
+		return nil, ErrConnectionNeedsReauth
+	}
+
+	var stored storedCredentials
+	if err := json.Unmarshal(row.Credentials, &stored); err != nil {
+		return nil, err
+	}
+	if stored.Secret == nil {
+		return nil, ErrCredentialsNotFound
+	}
+
+	plaintext, err := s.sealer.Open(stored.Secret, credentialsAAD(userID, platform))
+	if err != nil {
+		s.logger.Error("Failed to decrypt credentials",
+			zap.Error(err),
+			zap.String("user_id", userID.String()),
+			zap.String("platform", string(platform)),
+		)
+		return nil, err
+	}
+
+	var creds models.PlatformCredentials
+	if err := json.Unmarshal(plaintext, &creds); err != nil {
+		return nil, err
+	}
+
+	return &creds, nil
+}
+
+// RewrapAll re-wraps the data keys of stored credentials sealed with a
+// previous encryption key under the current one, and returns how many were
+// re-wrapped. Rows are updated one at a time, each locked against concurrent
+// token refreshes. Once it returns, previous keys can be removed.
+func (s *CredentialsService) RewrapAll(ctx context.Context) (int, error) {
+	var ids []uuid.UUID
+	if err := s.db.GetDB().SelectContext(ctx, &ids, "SELECT id FROM platform_credentials ORDER BY id"); err != nil {
+		s.logger.Error("Failed to list credentials", zap.Error(err))
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, id := range ids {
+		done, err := s.rewrap(ctx, id)
+		if err != nil {
+			s.logger.Error("Failed to re-wrap credentials", zap.Error(err), zap.String("id", id.String()))
+			return rewrapped, err
+		}
+		if done {
+			rewrapped++
+		}
+	}
+
+	s.logger.Info("Re-wrapped credentials",
+		zap.Int("rewrapped", rewrapped),
+		zap.Int("total", len(ids)),
+		zap.String("key_id", s.sealer.KeyID()),
+	)
+	return rewrapped, nil
+}
+
+// rewrap re-wraps the credentials of a row unless they already use the
+// current key, reporting whether they were updated
+func (s *CredentialsService) rewrap(ctx context.Context, id uuid.UUID) (bool, error) {
+	tx, err := s.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var document []byte
+	err = tx.GetContext(ctx, &document, "SELECT credentials FROM platform_credentials WHERE id = $1 FOR UPDATE", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Disconnected since it was listed
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var stored storedCredentials
+	if err := json.Unmarshal(document, &stored); err != nil {
+		return false, err
+	}
+	if stored.Secret == nil || stored.Secret.KeyID == s.sealer.KeyID() {
+		return false, nil
+	}
+
+	if stored.Secret, err = s.sealer.Rewrap(stored.Secret); err != nil {
+		return false, err
+	}
+	if document, err = json.Marshal(stored); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE platform_credentials SET credentials = $1 WHERE id = $2", document, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// getRow loads a user's platform_credentials row
+func (s *CredentialsService) getRow(ctx context.Context, userID uuid.UUID, platform models.Platform) (*credentialsRow, error) {
+	var row credentialsRow
+	err := s.db.GetDB().GetContext(ctx, &row,
+		"SELECT "+credentialsColumns+" FROM platform_credentials WHERE user_id = $1 AND platform = $2",
+		userID, string(platform),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCredentialsNotFound
+		}
+		s.logger.Error("Failed to get credentials", zap.Error(err), zap.String("user_id", userID.String()))
+		return nil, err
+	}
+	return &row, nil
+}
+
+// credentialsAAD is the additional data a user's platform credentials are
+// sealed with, so a secret moved to another row cannot be opened
+func credentialsAAD(userID uuid.UUID, platform models.Platform) []byte {
+	return []byte(userID.String() + "|" + string(platform))
+}
+
+// rowsToConnections converts rows to their non-secret views
+func rowsToConnections(rows []credentialsRow) ([]models.PlatformConnection, error) {
+	connections := make([]models.PlatformConnection, 0, len(rows))
+	for _, row := range rows {
+		connection, err := row.connection()
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, connection)
+	}
+	return connections, nil
+}
+
+// Error definitions
+var (
+	ErrCredentialsNotFound   = NewError("platform credentials not found")
+	ErrConnectionNeedsReauth = NewError("platform connection needs re-authorization; reconnect the account")
+)
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/kafka"
+	"go.uber.org/zap"
+)
+
+// DeadLetterService inspects and re-drives the dead-letter topics of the
+// consumed topics
+type DeadLetterService struct {
+	topics map[string]bool
+	logger *zap.Logger
+}
+
+// NewDeadLetterService creates a new dead-letter service for the given
+// source topics. Re-drive topics share the dead-letter topic of their source.
+func NewDeadLetterService(topics []string, logger *zap.Logger) *DeadLetterService {
+	known := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		if bus.RedriveTopic(topic) != topic {
+			known[topic] = true
+		}
+	}
+
+	return &DeadLetterService{
+		topics: known,
+		logger: logger.With(zap.String("component", "dead_letter_service")),
+	}
+}
+
+// List returns up to limit dead letters of a source topic starting at offset.
+// Without a partition, every partition is read in turn from the same offset.
+func (s *DeadLetterService) List(ctx context.Context, topic string, partition *int, offset int64, limit int) ([]models.DeadLetter, error) {
+	if !s.topics[topic] {
+		return nil, ErrUnknownTopic
+	}
+	deadLetterTopic := bus.DeadLetterTopic(topic)
+
+	var partitions []int
+	if partition != nil {
+		partitions = []int{*partition}
+	} else {
+		var err error
+		partitions, err = kafka.Partitions(ctx, deadLetterTopic)
+		if err != nil {
+			s.logger.Error("Failed to list dead-letter partitions", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	deadLetters := []models.DeadLetter{}
+	for _, p := range partitions {
+		remaining := limit - len(deadLetters)
+		if remaining <= 0 {
+			break
+		}
+
+		messages, err := kafka.ReadPartition(ctx, deadLetterTopic, p, offset, remaining)
+		if err != nil {
+			s.logger.Error("Failed to read dead letters", zap.Error(err), zap.Int("partition", p))
+			return nil, err
+		}
+		for _, msg := range messages {
+			deadLetters = append(deadLetters, toDeadLetter(msg))
+		}
+	}
+
+	return deadLetters, nil
+}
+
+// Redrive publishes a dead letter of a source topic to the topic's re-drive
+// topic so the worker processes it again. The dead letter itself stays in
+// the dead-letter topic.
+func (s *DeadLetterService) Redrive(ctx context.Context, topic string, partition int, offset int64) (*models.DeadLetter, error) {
+	if !s.topics[topic] {
+		return nil, ErrUnknownTopic
+	}
+	deadLetterTopic := bus.DeadLetterTopic(topic)
+
+	msg, err := kafka.ReadMessageAt(ctx, deadLetterTopic, partition, offset)
+	if err != nil {
+		if errors.Is(err, kafka.ErrNoMessage) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+
+	msg.Topic = deadLetterTopic
+	deadLetter := toDeadLetter(msg)
+	redriveTopic := bus.RedriveTopic(topic)
+
+	// The re-driven message names its topic
+	producer, err := kafka.NewProducer("")
+	if err != nil {
+		return nil, err
+	}
+	defer producer.Close()
+
+	// Keep the envelope headers the payload is decoded by
+	err = producer.WriteMessages(ctx, bus.NewRedrive(msg, redriveTopic))
+	if err != nil {
+		s.logger.Error("Failed to re-drive dead letter",
+			zap.Error(err),
+			zap.Int("partition", partition),
+			zap.Int64("offset", offset),
+		)
+		return nil, err
+	}
+
+	deadLetterRedrivesTotal.WithLabelValues(topic).Inc()
+	s.logger.Info("Re-drove dead letter",
+		zap.String("topic", redriveTopic),
+		zap.Int("partition", partition),
+		zap.Int64("offset", offset),
+	)
+	return &deadLetter, nil
+}
+
+// toDeadLetter converts a dead-letter topic message to its API view
+func toDeadLetter(msg bus.Message) models.DeadLetter {
+	deadLetter := models.DeadLetter{
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		Key:           string(msg.Key),
+		Payload:       string(msg.Value),
+		Error:         bus.HeaderValue(msg, bus.HeaderError),
+		OriginalTopic: bus.HeaderValue(msg, bus.HeaderOriginalTopic),
+	}
+
+	deadLetter.Attempts, _ = strconv.Atoi(bus.HeaderValue(msg, bus.HeaderAttempts))
+	deadLetter.OriginalPartition, _ = strconv.Atoi(bus.HeaderValue(msg, bus.HeaderOriginalPartition))
+	deadLetter.OriginalOffset, _ = strconv.ParseInt(bus.HeaderValue(msg, bus.HeaderOriginalOffset), 10, 64)
+	if failedAt, err := time.Parse(time.RFC3339, bus.HeaderValue(msg, bus.HeaderFailedAt)); err == nil {
+		deadLetter.FailedAt = &failedAt
+	}
+
+	return deadLetter
+}
+
+// Error definitions
+var (
+	ErrDeadLetterNotFound = NewError("dead letter not found")
+	ErrUnknownTopic       = NewError("unknown topic")
+)
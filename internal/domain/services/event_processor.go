@@ -2,84 +2,182 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zocket/campaign-analytics/internal/domain/models"
-	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
-	"github.com/zocket/campaign-analytics/internal/infrastructure/kafka"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/codec"
 	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
 	"go.uber.org/zap"
 )
 
-// EventProcessor processes campaign events
+// snapshotHashTTL is how long the hash of a processed snapshot is cached in
+// Redis. It outlives the window platforms restate data in; older snapshots
+// are compared against campaign_events instead.
+const snapshotHashTTL = 35 * 24 * time.Hour
+
+// EventProcessor processes campaign events. Each deduplication key (campaign,
+// day and breakdown) is a snapshot that platforms may restate: an identical
+// snapshot is skipped, a changed one replaces the stored event and the day's
+// insights are re-aggregated.
 type EventProcessor struct {
-	db     *database.ClickHouseClient
-	redis  *redis.Client
-	logger *zap.Logger
+	store       repository.EventStore
+	redis       *redis.Client
+	aggregation *AggregationService
+	events      *codec.CampaignEventCodec
+	logger      *zap.Logger
 }
 
 // NewEventProcessor creates a new event processor
 func NewEventProcessor(
-	db *database.ClickHouseClient,
+	store repository.EventStore,
 	redis *redis.Client,
+	aggregation *AggregationService,
+	events *codec.CampaignEventCodec,
 	logger *zap.Logger,
 ) *EventProcessor {
 	return &EventProcessor{
-		db:     db,
-		redis:  redis,
-		logger: logger.With(zap.String("component", "event_processor")),
+		store:       store,
+		redis:       redis,
+		aggregation: aggregation,
+		events:      events,
+		logger:      logger.With(zap.String("component", "event_processor")),
 	}
 }
 
-// ProcessEvent processes a single event
-func (p *EventProcessor) ProcessEvent(ctx context.Context, msg kafka.Message) error {
-	// Parse the event from the message
-	var event models.CampaignEvent
-	if err := json.Unmarshal(msg.Value, &event); err != nil {
-		p.logger.Error("Failed to unmarshal event", zap.Error(err))
-		return err
-	}
+// PendingEvent is a message prepared for a batch insert
+type PendingEvent struct {
+	Message bus.Message
+	Event   models.CampaignEvent
+	// Hash is the content hash of the snapshot
+	Hash string
+	// Restated is set when the snapshot supersedes a different stored one
+	Restated bool
+	// Unchanged is set when the snapshot is the stored one, so there is
+	// nothing to insert
+	Unchanged bool
+}
 
-	// Check if this event has already been processed (idempotence)
-	isProcessed, err := p.redis.IsDeduplicationKeyProcessed(ctx, event.DeduplicationKey)
+// PrepareEvent parses and validates a message and compares it with the last
+// stored snapshot of its key. An unchanged snapshot is returned with
+// Unchanged set: it is not inserted, but still supersedes a different
+// snapshot of its key waiting in the same batch.
+func (p *EventProcessor) PrepareEvent(ctx context.Context, msg bus.Message) (*PendingEvent, error) {
+	// Decode the event with the decoder of its schema version
+	decoded, err := p.events.Decode(ctx, msg)
 	if err != nil {
-		p.logger.Error("Failed to check deduplication key", zap.Error(err), zap.String("key", event.DeduplicationKey))
-		// Continue processing, worst case we process the same event twice
-	}
-
-	if isProcessed {
-		p.logger.Debug("Skipping already processed event", zap.String("key", event.DeduplicationKey))
-		return nil
+		var invalid *codec.DecodeError
+		if errors.As(err, &invalid) {
+			p.logger.Error("Failed to decode event",
+				zap.Error(err),
+				zap.String("traceparent", bus.HeaderValue(msg, bus.HeaderTraceParent)),
+			)
+			return nil, &InvalidEventError{Err: err}
+		}
+		p.logger.Error("Failed to look up event schema", zap.Error(err))
+		return nil, err
 	}
+	event := *decoded
 
 	// Validate the event
 	if err := p.validateEvent(&event); err != nil {
 		p.logger.Error("Event validation failed", zap.Error(err), zap.String("event_id", event.ID.String()))
-		return err
+		return nil, &InvalidEventError{Err: err}
 	}
 
-	// Set processed time
-	event.ProcessedAt = time.Now()
+	// Compare with the last snapshot of the same key (idempotence)
+	hash := snapshotHash(&event)
+	previousHash, err := p.previousSnapshotHash(ctx, &event)
+	if err != nil {
+		p.logger.Error("Failed to look up previous snapshot", zap.Error(err), zap.String("key", event.DeduplicationKey))
+		return nil, err
+	}
 
-	// Store the event in ClickHouse
-	if err := p.storeEvent(ctx, &event); err != nil {
-		p.logger.Error("Failed to store event", zap.Error(err), zap.String("event_id", event.ID.String()))
-		return err
+	if previousHash == hash {
+		p.logger.Debug("Skipping unchanged snapshot", zap.String("key", event.DeduplicationKey))
+		return &PendingEvent{
+			Message:   msg,
+			Event:     event,
+			Hash:      hash,
+			Unchanged: true,
+		}, nil
+	}
+
+	return &PendingEvent{
+		Message:  msg,
+		Event:    event,
+		Hash:     hash,
+		Restated: previousHash != "",
+	}, nil
+}
+
+// StoreEvents inserts events into the event store as a single batch. Errors
+// caused by the rows themselves, as opposed to the connection, are returned
+// as *repository.RejectedBatchError.
+func (p *EventProcessor) StoreEvents(ctx context.Context, events []*PendingEvent) error {
+	// The latest processed_at wins in the event store
+	processedAt := time.Now()
+	batch := make([]models.CampaignEvent, 0, len(events))
+	for _, pending := range events {
+		pending.Event.ProcessedAt = processedAt
+		batch = append(batch, pending.Event)
 	}
 
-	// Mark the event as processed in Redis to prevent duplicate processing
-	if err := p.redis.MarkDeduplicationKeyProcessed(ctx, event.DeduplicationKey, 7*24*time.Hour); err != nil {
-		p.logger.Error("Failed to mark event as processed", zap.Error(err), zap.String("key", event.DeduplicationKey))
-		// Continue, as the event has been stored successfully
+	return p.store.Insert(ctx, batch)
+}
+
+// CompleteEvents finishes stored events: the restated days of each campaign
+// are re-aggregated together and the snapshot hashes are recorded. It is
+// safe to call again after a failure.
+func (p *EventProcessor) CompleteEvents(ctx context.Context, events []*PendingEvent) error {
+	// A restatement was also added on top of the superseded snapshot by the
+	// materialized view, so rebuild its days from the latest snapshots. Each
+	// campaign is rebuilt once, over the days from its first to its last
+	// restated one, rather than with a mutation per day.
+	restated := make(map[uuid.UUID]models.DateRange)
+	for _, pending := range events {
+		if !pending.Restated {
+			continue
+		}
+		campaignID, day := pending.Event.CampaignID, pending.Event.LocalDate
+		days, exists := restated[campaignID]
+		if !exists {
+			days = models.DateRange{StartDate: day, EndDate: day}
+		}
+		if day.Before(days.StartDate) {
+			days.StartDate = day
+		}
+		if day.After(days.EndDate) {
+			days.EndDate = day
+		}
+		restated[campaignID] = days
+
+		p.logger.Info("Superseded restated snapshot",
+			zap.String("campaign_id", campaignID.String()),
+			zap.String("key", pending.Event.DeduplicationKey),
+		)
 	}
 
-	p.logger.Info("Event processed successfully", 
-		zap.String("event_id", event.ID.String()),
-		zap.String("campaign_id", event.CampaignID.String()),
-		zap.String("platform", string(event.Platform)),
-	)
+	if err := p.aggregation.ReaggregateCampaigns(ctx, restated); err != nil {
+		p.logger.Error("Failed to re-aggregate restated days", zap.Error(err), zap.Int("campaign_count", len(restated)))
+		return err
+	}
+
+	// Record the snapshot hashes in Redis to skip unchanged re-deliveries
+	for _, pending := range events {
+		if err := p.redis.SetSnapshotHash(ctx, pending.Event.DeduplicationKey, pending.Hash, snapshotHashTTL); err != nil {
+			p.logger.Error("Failed to record snapshot hash", zap.Error(err), zap.String("key", pending.Event.DeduplicationKey))
+			// Continue, as the event has been stored successfully
+		}
+	}
 
 	return nil
 }
@@ -102,6 +200,10 @@ func (p *EventProcessor) validateEvent(event *models.CampaignEvent) error {
 	if event.DeduplicationKey == "" {
 		return ErrMissingDeduplicationKey
 	}
+	// Events from producers that predate local dates belong to their UTC day
+	if event.LocalDate.IsZero() {
+		event.LocalDate = models.DateIn(event.EventTime, time.UTC)
+	}
 
 	// Ensure non-negative metrics
 	if event.Impressions < 0 {
@@ -127,9 +229,9 @@ func (p *EventProcessor) validateEvent(event *models.CampaignEvent) error {
 	if event.Region == "" {
 		event.Region = "all"
 	}
-	if event.Currency == "" {
-		event.Currency = "USD"
-	}
+	// Amounts stay in the currency they were reported in; an unknown
+	// currency is kept empty rather than guessed
+	event.Currency = strings.ToUpper(strings.TrimSpace(event.Currency))
 	if event.ReceivedAt.IsZero() {
 		event.ReceivedAt = time.Now()
 	}
@@ -137,40 +239,56 @@ func (p *EventProcessor) validateEvent(event *models.CampaignEvent) error {
 	return nil
 }
 
-// storeEvent stores an event in ClickHouse
-func (p *EventProcessor) storeEvent(ctx context.Context, event *models.CampaignEvent) error {
-	// Insert the event into ClickHouse
-	query := `
-		INSERT INTO campaign_events (
-			id, campaign_id, platform, event_type, impressions, clicks, conversions,
-			spend, revenue, event_time, region, currency, deduplication_key,
-			received_at, processed_at
-		) VALUES (
-			?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
-		)
-	`
+// previousSnapshotHash returns the hash of the last stored snapshot of the
+// event's deduplication key, or an empty string for a new key. Redis is
+// consulted first; on a miss or error the stored event is read back. A key
+// purged with redis.PurgedSnapshotHash matches no snapshot, so the next one
+// is processed as a restatement.
+func (p *EventProcessor) previousSnapshotHash(ctx context.Context, event *models.CampaignEvent) (string, error) {
+	hash, err := p.redis.GetSnapshotHash(ctx, event.DeduplicationKey)
+	if err != nil {
+		p.logger.Warn("Failed to get snapshot hash from Redis", zap.Error(err), zap.String("key", event.DeduplicationKey))
+	} else if hash != "" {
+		return hash, nil
+	}
 
-	conn := p.db.GetConn()
-	
-	err := conn.Exec(ctx, query,
-		event.ID.String(),
-		event.CampaignID.String(),
+	stored, err := p.store.Latest(ctx, event.CampaignID, event.EventTime, event.DeduplicationKey)
+	if errors.Is(err, repository.ErrEventNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return snapshotHash(stored), nil
+}
+
+// snapshotHash fingerprints the reported values of an event, leaving out
+// per-delivery fields such as the event ID and timestamps of processing. The
+// local date only counts when it is not the UTC day of the event, and the
+// placement when there is one, so hashes recorded before they existed still
+// match.
+func snapshotHash(event *models.CampaignEvent) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%d|%d|%s|%s|%s|%s",
 		event.Platform,
 		event.EventType,
+		event.EventTime.Unix(),
 		event.Impressions,
 		event.Clicks,
 		event.Conversions,
-		event.Spend,
-		event.Revenue,
-		event.EventTime,
+		strconv.FormatFloat(event.Spend, 'g', -1, 64),
+		strconv.FormatFloat(event.Revenue, 'g', -1, 64),
 		event.Region,
 		event.Currency,
-		event.DeduplicationKey,
-		event.ReceivedAt,
-		event.ProcessedAt,
 	)
-
-	return err
+	if !event.LocalDate.IsZero() && !event.LocalDate.Equal(models.DateIn(event.EventTime, time.UTC)) {
+		fmt.Fprintf(h, "|%s", event.LocalDate.Format("2006-01-02"))
+	}
+	if event.Placement != "" {
+		fmt.Fprintf(h, "|placement=%s", event.Placement)
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // Error definitions
@@ -181,6 +299,20 @@ var (
 	ErrMissingDeduplicationKey  = NewError("missing deduplication key")
 )
 
+// InvalidEventError reports a message that can never be processed, such as
+// malformed JSON or a missing required field. It is not retried.
+type InvalidEventError struct {
+	Err error
+}
+
+func (e *InvalidEventError) Error() string {
+	return "invalid event: " + e.Err.Error()
+}
+
+func (e *InvalidEventError) Unwrap() error {
+	return e.Err
+}
+
 // Error wraps errors with additional context
 type Error struct {
 	Message string
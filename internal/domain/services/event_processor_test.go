@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/memory"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis/redistest"
+	"go.uber.org/zap"
+)
+
+func TestPrepareEventPurgedKey(t *testing.T) {
+	ctx := context.Background()
+	p := newPipeline(t)
+	event := pipelineEvent(uuid.New(), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 100, 10)
+
+	prepare := func() *PendingEvent {
+		t.Helper()
+		msg, err := p.codec.Encode(ctx, pipelineTopic, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending, err := p.processor.PrepareEvent(ctx, msg)
+		if err != nil {
+			t.Fatalf("PrepareEvent: %v", err)
+		}
+		return pending
+	}
+
+	// Store the snapshot
+	first := prepare()
+	if first.Unchanged || first.Restated {
+		t.Fatalf("new snapshot prepared as unchanged=%v restated=%v", first.Unchanged, first.Restated)
+	}
+	if err := p.processor.StoreEvents(ctx, []*PendingEvent{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.processor.CompleteEvents(ctx, []*PendingEvent{first}); err != nil {
+		t.Fatal(err)
+	}
+	if again := prepare(); !again.Unchanged {
+		t.Errorf("unchanged snapshot not recognized")
+	}
+
+	// Once purged, the stored event is not compared and the same snapshot
+	// is processed again, re-aggregating its day
+	if _, err := p.processor.redis.PurgeSnapshotHashes(ctx, "*"); err != nil {
+		t.Fatal(err)
+	}
+	purged := prepare()
+	if purged.Unchanged || !purged.Restated {
+		t.Errorf("purged snapshot prepared as unchanged=%v restated=%v, want a restatement", purged.Unchanged, purged.Restated)
+	}
+
+	// Without a hash at all, the stored event is compared
+	if err := p.processor.redis.Delete(ctx, "snapshot:"+event.DeduplicationKey); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := prepare(); !deleted.Unchanged {
+		t.Errorf("snapshot without a cached hash not compared with the stored event")
+	}
+}
+
+// countingInsightsStore records the ranges re-aggregated
+type countingInsightsStore struct {
+	*memory.InsightsStore
+	reaggregated map[uuid.UUID][]models.DateRange
+}
+
+func (s *countingInsightsStore) Reaggregate(ctx context.Context, campaignID uuid.UUID, startDate, endDate time.Time) error {
+	s.reaggregated[campaignID] = append(s.reaggregated[campaignID], models.DateRange{StartDate: startDate, EndDate: endDate})
+	return s.InsightsStore.Reaggregate(ctx, campaignID, startDate, endDate)
+}
+
+func TestCompleteEventsCoalescesReaggregation(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	redisClient := redistest.NewClient(t)
+	events := memory.NewEventStore()
+	insights := &countingInsightsStore{InsightsStore: memory.NewInsightsStore(events), reaggregated: make(map[uuid.UUID][]models.DateRange)}
+	aggregation := NewAggregationService(insights, NewFXService(memory.NewFXRateStore(), "USD", logger), redisClient, logger)
+	processor := NewEventProcessor(events, redisClient, aggregation, nil, logger)
+
+	campaignA, campaignB, campaignC := uuid.New(), uuid.New(), uuid.New()
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	restated := func(campaignID uuid.UUID, d int) *PendingEvent {
+		event := pipelineEvent(campaignID, day(d), 100, 10)
+		return &PendingEvent{Event: *event, Hash: "h", Restated: true}
+	}
+
+	cached := []string{
+		"insights:" + campaignA.String() + ":daily",
+		"insights:" + campaignC.String() + ":daily",
+		portfolioCachePrefix + "abc",
+	}
+	for _, key := range cached {
+		if err := redisClient.Set(ctx, key, "[]", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := processor.CompleteEvents(ctx, []*PendingEvent{
+		restated(campaignA, 3),
+		restated(campaignB, 2),
+		restated(campaignA, 1),
+		{Event: *pipelineEvent(campaignC, day(5), 1, 1), Hash: "new"},
+		restated(campaignA, 2),
+	})
+	if err != nil {
+		t.Fatalf("CompleteEvents: %v", err)
+	}
+
+	// One rebuild per restated campaign, over its restated days
+	want := map[uuid.UUID]string{
+		campaignA: "[2024-03-01 2024-03-03]",
+		campaignB: "[2024-03-02 2024-03-02]",
+	}
+	if len(insights.reaggregated) != len(want) {
+		t.Errorf("re-aggregated %d campaigns, want %d", len(insights.reaggregated), len(want))
+	}
+	for campaignID, ranges := range insights.reaggregated {
+		if len(ranges) != 1 {
+			t.Errorf("campaign re-aggregated %d times, want once", len(ranges))
+			continue
+		}
+		got := fmt.Sprintf("[%s %s]", ranges[0].StartDate.Format("2006-01-02"), ranges[0].EndDate.Format("2006-01-02"))
+		if got != want[campaignID] {
+			t.Errorf("re-aggregated %s, want %s", got, want[campaignID])
+		}
+	}
+
+	// The caches of the restated campaigns and of portfolios are dropped
+	for _, key := range cached {
+		_, err := redisClient.Get(ctx, key)
+		if kept := err == nil; kept != strings.Contains(key, campaignC.String()) {
+			t.Errorf("cache key %s kept = %v", key, kept)
+		}
+	}
+}
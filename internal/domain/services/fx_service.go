@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// ecbBaseCurrency is the base of the ECB reference rates
+const ecbBaseCurrency = "EUR"
+
+// FXService loads daily exchange rates and converts insights with them.
+// Rates are stored against a single base currency; conversions between two
+// other currencies cross through it.
+type FXService struct {
+	rates  repository.FXRateStore
+	base   string
+	logger *zap.Logger
+}
+
+// NewFXService creates a new exchange rate service. The base currency
+// defaults to EUR, the base of the ECB reference rates.
+func NewFXService(rates repository.FXRateStore, baseCurrency string, logger *zap.Logger) *FXService {
+	baseCurrency = strings.ToUpper(baseCurrency)
+	if baseCurrency == "" {
+		baseCurrency = ecbBaseCurrency
+	}
+
+	return &FXService{
+		rates:  rates,
+		base:   baseCurrency,
+		logger: logger.With(zap.String("component", "fx_service")),
+	}
+}
+
+// BaseCurrency returns the currency rates are stored against
+func (s *FXService) BaseCurrency() string {
+	return s.base
+}
+
+// StoreRates validates and stores rates, replacing the stored rates of the
+// same days and currencies. Rates without a base are against the base
+// currency; rates against another base are rejected.
+func (s *FXService) StoreRates(ctx context.Context, rates []models.FXRate) error {
+	if len(rates) == 0 {
+		return ErrNoFXRates
+	}
+
+	stored := make([]models.FXRate, len(rates))
+	for i, rate := range rates {
+		rate.Base = strings.ToUpper(rate.Base)
+		if rate.Base == "" {
+			rate.Base = s.base
+		}
+		rate.Currency = strings.ToUpper(rate.Currency)
+		rate.Date = rate.Date.UTC().Truncate(24 * time.Hour)
+
+		if err := validateFXRate(rate); err != nil {
+			return &InvalidFXRateError{Row: i + 1, Err: err}
+		}
+		if rate.Base != s.base {
+			return &InvalidFXRateError{Row: i + 1, Err: ErrFXBaseMismatch}
+		}
+		stored[i] = rate
+	}
+
+	if err := s.rates.Store(ctx, stored); err != nil {
+		s.logger.Error("Failed to store exchange rates", zap.Error(err))
+		return err
+	}
+
+	s.logger.Info("Stored exchange rates", zap.Int("count", len(stored)), zap.String("base", s.base))
+	return nil
+}
+
+// ConvertInsights converts the amounts of insights rows, each within a
+// single day, into currency at the rates of their day. The day of an hourly
+// row is its date in the row's own timezone. Rows of a day that
+// lacks a rate are left out and the missing rates are returned, ordered by
+// day and currency.
+func (s *FXService) ConvertInsights(ctx context.Context, rows []models.CampaignInsights, currency string) ([]models.CampaignInsights, []models.MissingFXRate, error) {
+	missing := []models.MissingFXRate{}
+	if len(rows) == 0 {
+		return rows, missing, nil
+	}
+
+	// Look up the rates of every currency involved over the days of the rows
+	currencies := []string{}
+	seen := map[string]bool{s.base: true}
+	addCurrency := func(currency string) {
+		if !seen[currency] {
+			seen[currency] = true
+			currencies = append(currencies, currency)
+		}
+	}
+	addCurrency(currency)
+	start, end := rowDay(rows[0]), rowDay(rows[0])
+	for _, row := range rows {
+		addCurrency(row.Currency)
+		if day := rowDay(row); day.Before(start) {
+			start = day
+		} else if day.After(end) {
+			end = day
+		}
+	}
+
+	type rateKey struct {
+		day      int64
+		currency string
+	}
+	rates := make(map[rateKey]float64)
+	if len(currencies) > 0 {
+		stored, err := s.rates.List(ctx, s.base, currencies, start, end)
+		if err != nil {
+			s.logger.Error("Failed to list exchange rates", zap.Error(err))
+			return nil, nil, err
+		}
+		for _, rate := range stored {
+			rates[rateKey{day: rate.Date.UTC().Truncate(24 * time.Hour).Unix(), currency: rate.Currency}] = rate.Rate
+		}
+	}
+
+	missingDays := make(map[rateKey]bool)
+	rateOf := func(day time.Time, currency string) (float64, bool) {
+		if currency == s.base {
+			return 1, true
+		}
+		key := rateKey{day: day.Unix(), currency: currency}
+		rate, ok := rates[key]
+		if !ok && !missingDays[key] {
+			missingDays[key] = true
+			missing = append(missing, models.MissingFXRate{Date: day, Currency: currency})
+		}
+		return rate, ok
+	}
+
+	converted := make([]models.CampaignInsights, 0, len(rows))
+	for _, row := range rows {
+		if row.Currency == currency {
+			converted = append(converted, row)
+			continue
+		}
+
+		day := rowDay(row)
+		from, fromOK := rateOf(day, row.Currency)
+		to, toOK := rateOf(day, currency)
+		if !fromOK || !toOK {
+			continue
+		}
+
+		row.Spend = row.Spend / from * to
+		row.Revenue = row.Revenue / from * to
+		row.Currency = currency
+		row.ComputeRatios()
+		converted = append(converted, row)
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		if !missing[i].Date.Equal(missing[j].Date) {
+			return missing[i].Date.Before(missing[j].Date)
+		}
+		return missing[i].Currency < missing[j].Currency
+	})
+	return converted, missing, nil
+}
+
+// rowDay returns the day of an insights row, at midnight UTC
+func rowDay(row models.CampaignInsights) time.Time {
+	return models.DateIn(row.Date, row.Date.Location())
+}
+
+// mergeMissingRates merges two lists of missing rates, ordered by day and
+// currency, into one without duplicates
+func mergeMissingRates(a, b []models.MissingFXRate) []models.MissingFXRate {
+	merged := append(append([]models.MissingFXRate{}, a...), b...)
+	sort.Slice(merged, func(i, j int) bool {
+		if !merged[i].Date.Equal(merged[j].Date) {
+			return merged[i].Date.Before(merged[j].Date)
+		}
+		return merged[i].Currency < merged[j].Currency
+	})
+
+	unique := merged[:0]
+	for _, rate := range merged {
+		if n := len(unique); n > 0 && unique[n-1].Date.Equal(rate.Date) && unique[n-1].Currency == rate.Currency {
+			continue
+		}
+		unique = append(unique, rate)
+	}
+	return unique
+}
+
+// ParseFXRates reads exchange rates from a CSV file in one of two formats:
+//
+//   - one rate per line, under a header naming the columns date, currency and
+//     rate, and optionally base (the base currency by default)
+//   - the ECB reference rates, under a header of Date followed by currency
+//     codes, one day per line and rates against EUR
+//
+// Dates are YYYY-MM-DD or, as in the ECB daily file, "02 January 2006".
+// Empty and N/A cells are skipped.
+func ParseFXRates(r io.Reader) ([]models.FXRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrNoFXRates
+	}
+	if err != nil {
+		return nil, &InvalidFXRateError{Row: 1, Err: err}
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, hasCurrency := columns["currency"]
+	_, hasRate := columns["rate"]
+	dateColumn, hasDate := columns["date"]
+	if !hasDate {
+		return nil, &InvalidFXRateError{Row: 1, Err: ErrInvalidFXFile}
+	}
+
+	var rates []models.FXRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &InvalidFXRateError{Row: line, Err: err}
+		}
+
+		date, err := parseFXDate(cell(record, dateColumn))
+		if err != nil {
+			return nil, &InvalidFXRateError{Row: line, Err: err}
+		}
+
+		if hasCurrency && hasRate {
+			value := cell(record, columns["rate"])
+			if value == "" || strings.EqualFold(value, "N/A") {
+				continue
+			}
+			rate := models.FXRate{Date: date, Currency: strings.ToUpper(cell(record, columns["currency"]))}
+			if baseColumn, ok := columns["base"]; ok {
+				rate.Base = strings.ToUpper(cell(record, baseColumn))
+			}
+			if rate.Rate, err = parseFXRateValue(value); err != nil {
+				return nil, &InvalidFXRateError{Row: line, Err: err}
+			}
+			rates = append(rates, rate)
+			continue
+		}
+
+		// ECB layout: a column per currency
+		for i, name := range header {
+			currency := strings.ToUpper(strings.TrimSpace(name))
+			value := cell(record, i)
+			if i == dateColumn || currency == "" || value == "" || strings.EqualFold(value, "N/A") {
+				continue
+			}
+			rate := models.FXRate{Base: ecbBaseCurrency, Date: date, Currency: currency}
+			if rate.Rate, err = parseFXRateValue(value); err != nil {
+				return nil, &InvalidFXRateError{Row: line, Err: err}
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	if len(rates) == 0 {
+		return nil, ErrNoFXRates
+	}
+	return rates, nil
+}
+
+// cell returns a trimmed field of a CSV record, or "" past its end
+func cell(record []string, i int) string {
+	if i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// parseFXDate parses the day of a rate
+func parseFXDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "02 January 2006"} {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseFXRateValue parses a rate
+func parseFXRateValue(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return rate, nil
+}
+
+// validateFXRate checks the fields of a rate
+func validateFXRate(rate models.FXRate) error {
+	if !models.IsValidCurrency(rate.Currency) || !models.IsValidCurrency(rate.Base) {
+		return ErrInvalidCurrency
+	}
+	if rate.Date.IsZero() {
+		return ErrMissingFXDate
+	}
+	if rate.Rate <= 0 || math.IsInf(rate.Rate, 0) || math.IsNaN(rate.Rate) {
+		return ErrInvalidFXRate
+	}
+	return nil
+}
+
+// InvalidFXRateError reports a rate that cannot be stored. Row is the line
+// of a CSV file, or the position in a list of rates, counting from 1.
+type InvalidFXRateError struct {
+	Row int
+	Err error
+}
+
+func (e *InvalidFXRateError) Error() string {
+	return fmt.Sprintf("rate %d: %v", e.Row, e.Err)
+}
+
+func (e *InvalidFXRateError) Unwrap() error {
+	return e.Err
+}
+
+// IsInvalidFXRates reports whether err was caused by the rates themselves
+func IsInvalidFXRates(err error) bool {
+	var invalid *InvalidFXRateError
+	return errors.As(err, &invalid) || errors.Is(err, ErrNoFXRates)
+}
+
+// Error definitions
+var (
+	ErrNoFXRates       = NewError("no exchange rates")
+	ErrInvalidFXFile   = NewError("exchange rate file needs a date column")
+	ErrInvalidCurrency = NewError("invalid currency code")
+	ErrMissingFXDate   = NewError("missing date")
+	ErrInvalidFXRate   = NewError("rate must be a positive number")
+	ErrFXBaseMismatch  = NewError("rate is not against the base currency")
+)
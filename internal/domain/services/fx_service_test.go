@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/memory"
+	"go.uber.org/zap"
+)
+
+func TestParseFXRates(t *testing.T) {
+	march1 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	march4 := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		csv     string
+		want    []models.FXRate
+		wantErr error
+	}{
+		{
+			name: "one rate per line",
+			csv:  "date,currency,rate\n2024-03-01,usd,1.0830\n2024-03-01,GBP,0.8560\n",
+			want: []models.FXRate{
+				{Date: march1, Currency: "USD", Rate: 1.083},
+				{Date: march1, Currency: "GBP", Rate: 0.856},
+			},
+		},
+		{
+			name: "one rate per line with a base column",
+			csv:  "Currency, Rate, Base, Date\nJPY, 150.2, usd, 2024-03-04\n",
+			want: []models.FXRate{
+				{Base: "USD", Date: march4, Currency: "JPY", Rate: 150.2},
+			},
+		},
+		{
+			name: "ECB daily file",
+			csv:  "Date, USD, JPY, BGN, \n01 March 2024, 1.0830, 162.07, N/A, \n",
+			want: []models.FXRate{
+				{Base: "EUR", Date: march1, Currency: "USD", Rate: 1.083},
+				{Base: "EUR", Date: march1, Currency: "JPY", Rate: 162.07},
+			},
+		},
+		{
+			name: "ECB history file",
+			csv:  "Date,USD,GBP\n2024-03-04,1.0855,\n2024-03-01,1.0830,0.8560\n",
+			want: []models.FXRate{
+				{Base: "EUR", Date: march4, Currency: "USD", Rate: 1.0855},
+				{Base: "EUR", Date: march1, Currency: "USD", Rate: 1.083},
+				{Base: "EUR", Date: march1, Currency: "GBP", Rate: 0.856},
+			},
+		},
+		{
+			name: "empty and N/A rates are skipped",
+			csv:  "date,currency,rate\n2024-03-01,USD,\n2024-03-01,GBP,n/a\n2024-03-04,USD,1.0855\n",
+			want: []models.FXRate{
+				{Date: march4, Currency: "USD", Rate: 1.0855},
+			},
+		},
+		{
+			name:    "empty file",
+			csv:     "",
+			wantErr: ErrNoFXRates,
+		},
+		{
+			name:    "header only",
+			csv:     "date,currency,rate\n",
+			wantErr: ErrNoFXRates,
+		},
+		{
+			name:    "no date column",
+			csv:     "currency,rate\nUSD,1.08\n",
+			wantErr: ErrInvalidFXFile,
+		},
+		{
+			name:    "invalid date",
+			csv:     "date,currency,rate\n03/01/2024,USD,1.08\n",
+			wantErr: &InvalidFXRateError{Row: 2},
+		},
+		{
+			name:    "invalid rate",
+			csv:     "Date,USD\n2024-03-01,1.08\n2024-03-04,one\n",
+			wantErr: &InvalidFXRateError{Row: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFXRates(strings.NewReader(tt.csv))
+
+			var wantRow *InvalidFXRateError
+			switch {
+			case errors.As(tt.wantErr, &wantRow):
+				var row *InvalidFXRateError
+				if !errors.As(err, &row) || row.Row != wantRow.Row {
+					t.Fatalf("error = %v, want an invalid rate on row %d", err, wantRow.Row)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("ParseFXRates: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFXRates() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertInsights(t *testing.T) {
+	march1 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	march2 := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	// Rates against EUR: 1 EUR = 1.25 USD = 0.8 GBP on March 1st, and only
+	// USD is known on March 2nd
+	rates := memory.NewFXRateStore()
+	if err := rates.Store(context.Background(), []models.FXRate{
+		{Base: "EUR", Date: march1, Currency: "USD", Rate: 1.25},
+		{Base: "EUR", Date: march1, Currency: "GBP", Rate: 0.8},
+		{Base: "EUR", Date: march2, Currency: "USD", Rate: 1.5},
+	}); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	service := NewFXService(rates, "EUR", zap.NewNop())
+
+	row := func(date time.Time, currency string, spend float64) models.CampaignInsights {
+		insights := models.CampaignInsights{Date: date, Currency: currency, Clicks: 10, Spend: spend, Revenue: 2 * spend}
+		insights.ComputeRatios()
+		return insights
+	}
+
+	tests := []struct {
+		name        string
+		rows        []models.CampaignInsights
+		currency    string
+		want        []models.CampaignInsights
+		wantMissing []models.MissingFXRate
+	}{
+		{
+			name:     "from the base currency",
+			rows:     []models.CampaignInsights{row(march1, "EUR", 100)},
+			currency: "USD",
+			want:     []models.CampaignInsights{row(march1, "USD", 125)},
+		},
+		{
+			name:     "into the base currency",
+			rows:     []models.CampaignInsights{row(march2, "USD", 150)},
+			currency: "EUR",
+			want:     []models.CampaignInsights{row(march2, "EUR", 100)},
+		},
+		{
+			name:     "cross rate through the base currency",
+			rows:     []models.CampaignInsights{row(march1, "GBP", 80)},
+			currency: "USD",
+			want:     []models.CampaignInsights{row(march1, "USD", 125)},
+		},
+		{
+			name:     "rows already in the currency are kept",
+			rows:     []models.CampaignInsights{row(march1, "USD", 42)},
+			currency: "USD",
+			want:     []models.CampaignInsights{row(march1, "USD", 42)},
+		},
+		{
+			name: "hourly rows use the day in their own timezone",
+			// 01:00 UTC on March 2nd is still March 1st in New York
+			rows:     []models.CampaignInsights{row(time.Date(2024, 3, 1, 20, 0, 0, 0, newYork), "GBP", 80)},
+			currency: "USD",
+			want:     []models.CampaignInsights{row(time.Date(2024, 3, 1, 20, 0, 0, 0, newYork), "USD", 125)},
+		},
+		{
+			name:     "rows of a day without a rate are left out",
+			rows:     []models.CampaignInsights{row(march2, "GBP", 80), row(march1, "GBP", 80), row(march2, "GBP", 40)},
+			currency: "USD",
+			want:     []models.CampaignInsights{row(march1, "USD", 125)},
+			wantMissing: []models.MissingFXRate{
+				{Date: march2, Currency: "GBP"},
+			},
+		},
+		{
+			name:     "missing rates of both currencies are reported",
+			rows:     []models.CampaignInsights{row(march2, "JPY", 1000)},
+			currency: "GBP",
+			want:     []models.CampaignInsights{},
+			wantMissing: []models.MissingFXRate{
+				{Date: march2, Currency: "GBP"},
+				{Date: march2, Currency: "JPY"},
+			},
+		},
+		{
+			name:     "no rows",
+			currency: "USD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, missing, err := service.ConvertInsights(context.Background(), tt.rows, tt.currency)
+			if err != nil {
+				t.Fatalf("ConvertInsights: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				// Amounts are compared with a tolerance for the division by the rate
+				if math.Abs(got[i].Spend-want.Spend) > 1e-9 || math.Abs(got[i].Revenue-want.Revenue) > 1e-9 ||
+					math.Abs(got[i].CPC-want.CPC) > 1e-9 {
+					t.Errorf("row %d: spend/revenue/cpc = %v/%v/%v, want %v/%v/%v", i,
+						got[i].Spend, got[i].Revenue, got[i].CPC, want.Spend, want.Revenue, want.CPC)
+				}
+				if got[i].Currency != want.Currency || !got[i].Date.Equal(want.Date) {
+					t.Errorf("row %d: %s on %v, want %s on %v", i, got[i].Currency, got[i].Date, want.Currency, want.Date)
+				}
+			}
+
+			if tt.wantMissing == nil {
+				tt.wantMissing = []models.MissingFXRate{}
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("missing = %+v, want %+v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// JobConfig configures backfill and re-aggregation jobs
+type JobConfig struct {
+	// ChunkDays is the number of days a job processes between checkpoints
+	ChunkDays int
+	// MaxDays bounds the date range of a single job
+	MaxDays int
+	// PollInterval is how often an idle worker looks for a job
+	PollInterval time.Duration
+	// LeaseTTL is how long a job stays with a worker without a checkpoint.
+	// It must outlast a chunk, or another worker runs the chunk again.
+	LeaseTTL time.Duration
+	// ChunkAttempts is how often a chunk is tried before the job fails
+	ChunkAttempts int
+	// RetryBackoff is the wait before trying a failed chunk again
+	RetryBackoff time.Duration
+}
+
+// JobService queues jobs and, in the worker, runs them chunk by chunk. Every
+// chunk is checkpointed, so a job interrupted by a crash resumes after its
+// last finished chunk once its lease expired. Chunks are safe to run twice:
+// fetched snapshots are deduplicated and re-aggregation replaces its days.
+type JobService struct {
+	jobs        repository.JobRepository
+	campaigns   *CampaignService
+	aggregation *AggregationService
+	config      JobConfig
+	owner       string
+	logger      *zap.Logger
+}
+
+// NewJobService creates a new job service
+func NewJobService(
+	jobs repository.JobRepository,
+	campaignService *CampaignService,
+	aggregationService *AggregationService,
+	config JobConfig,
+	logger *zap.Logger,
+) *JobService {
+	if config.ChunkDays <= 0 {
+		config.ChunkDays = 7
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+	if config.LeaseTTL <= 0 {
+		config.LeaseTTL = 10 * time.Minute
+	}
+	if config.ChunkAttempts <= 0 {
+		config.ChunkAttempts = 1
+	}
+
+	return &JobService{
+		jobs:        jobs,
+		campaigns:   campaignService,
+		aggregation: aggregationService,
+		config:      config,
+		owner:       uuid.New().String(),
+		logger:      logger.With(zap.String("component", "job_service")),
+	}
+}
+
+// CreateJob queues a job over the days from startDate to endDate, inclusive
+func (s *JobService) CreateJob(ctx context.Context, jobType models.JobType, campaign *models.Campaign, startDate, endDate time.Time) (*models.Job, error) {
+	if jobType != models.JobTypeBackfill && jobType != models.JobTypeReaggregation {
+		return nil, ErrUnknownJobType
+	}
+
+	startDate = startDate.UTC().Truncate(24 * time.Hour)
+	endDate = endDate.UTC().Truncate(24 * time.Hour)
+	if endDate.Before(startDate) {
+		return nil, ErrInvalidJobRange
+	}
+	days := int(endDate.Sub(startDate).Hours()/24) + 1
+	if s.config.MaxDays > 0 && days > s.config.MaxDays {
+		return nil, ErrJobRangeTooLong
+	}
+
+	now := time.Now()
+	job := &models.Job{
+		ID:          uuid.New(),
+		Type:        jobType,
+		CampaignID:  campaign.ID,
+		UserID:      campaign.UserID,
+		State:       models.JobStatePending,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		ChunkDays:   s.config.ChunkDays,
+		ChunksTotal: (days + s.config.ChunkDays - 1) / s.config.ChunkDays,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.jobs.Create(ctx, job); err != nil {
+		s.logger.Error("Failed to create job", zap.Error(err), zap.String("campaign_id", campaign.ID.String()))
+		return nil, err
+	}
+
+	s.logger.Info("Queued job",
+		zap.String("job_id", job.ID.String()),
+		zap.String("type", string(job.Type)),
+		zap.String("campaign_id", campaign.ID.String()),
+		zap.Int("chunks", job.ChunksTotal),
+	)
+	return job, nil
+}
+
+// GetJob returns a job
+func (s *JobService) GetJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	return s.jobs.Get(ctx, id)
+}
+
+// CancelJob cancels a pending or running job. A running job stops after
+// the chunk in progress.
+func (s *JobService) CancelJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	job, err := s.jobs.Cancel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Cancelled job", zap.String("job_id", id.String()))
+	return job, nil
+}
+
+// Start runs queued jobs one at a time until the context is cancelled. A job
+// interrupted by shutdown keeps its lease and is resumed once it expired.
+func (s *JobService) Start(ctx context.Context) {
+	s.logger.Info("Starting job runner",
+		zap.Duration("poll_interval", s.config.PollInterval),
+		zap.Duration("lease_ttl", s.config.LeaseTTL),
+	)
+
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := s.jobs.Claim(ctx, s.owner, s.config.LeaseTTL)
+		if err == nil {
+			s.run(ctx, job)
+			continue
+		}
+		if !errors.Is(err, repository.ErrNoJob) && ctx.Err() == nil {
+			s.logger.Error("Failed to claim job", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Job runner shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run processes the chunks of a job after its checkpoint
+func (s *JobService) run(ctx context.Context, job *models.Job) {
+	logger := s.logger.With(
+		zap.String("job_id", job.ID.String()),
+		zap.String("type", string(job.Type)),
+		zap.String("campaign_id", job.CampaignID.String()),
+	)
+
+	chunkStart := job.StartDate
+	if job.Checkpoint != nil {
+		chunkStart = job.Checkpoint.AddDate(0, 0, 1)
+		logger.Info("Resuming job", zap.Time("checkpoint", *job.Checkpoint), zap.Int("attempt", job.Attempts))
+	} else {
+		logger.Info("Starting job", zap.Int("chunks", job.ChunksTotal))
+	}
+
+	chunksDone := job.ChunksDone
+	for !chunkStart.After(job.EndDate) {
+		chunkEnd := chunkStart.AddDate(0, 0, job.ChunkDays-1)
+		if chunkEnd.After(job.EndDate) {
+			chunkEnd = job.EndDate
+		}
+
+		if err := s.runChunk(ctx, job, chunkStart, chunkEnd); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			jobChunksTotal.WithLabelValues(string(job.Type), "failed").Inc()
+			logger.Error("Job failed", zap.Error(err), zap.Time("chunk_start", chunkStart))
+			s.finish(ctx, job, models.JobStateFailed, err, logger)
+			return
+		}
+		jobChunksTotal.WithLabelValues(string(job.Type), "succeeded").Inc()
+
+		chunksDone++
+		err := s.jobs.Checkpoint(ctx, job.ID, s.owner, chunkEnd, chunksDone, s.config.LeaseTTL)
+		if errors.Is(err, repository.ErrJobLeaseLost) {
+			logger.Info("Job was cancelled or taken over, stopping")
+			return
+		}
+		if err != nil {
+			// The lease expires and the chunk is run again
+			logger.Error("Failed to checkpoint job", zap.Error(err))
+			return
+		}
+
+		chunkStart = chunkEnd.AddDate(0, 0, 1)
+	}
+
+	s.finish(ctx, job, models.JobStateSucceeded, nil, logger)
+}
+
+// runChunk processes the days of a chunk, trying up to ChunkAttempts times
+func (s *JobService) runChunk(ctx context.Context, job *models.Job, chunkStart, chunkEnd time.Time) error {
+	var err error
+	for attempt := 1; attempt <= s.config.ChunkAttempts; attempt++ {
+		switch job.Type {
+		case models.JobTypeBackfill:
+			// The fetch end is exclusive
+			err = s.campaigns.BackfillCampaignData(ctx, job.CampaignID, chunkStart, chunkEnd.AddDate(0, 0, 1))
+		case models.JobTypeReaggregation:
+			err = s.aggregation.TriggerReaggregation(ctx, job.CampaignID, chunkStart, chunkEnd)
+		default:
+			return ErrUnknownJobType
+		}
+		if err == nil || attempt == s.config.ChunkAttempts {
+			break
+		}
+
+		s.logger.Warn("Job chunk failed, retrying",
+			zap.Error(err),
+			zap.String("job_id", job.ID.String()),
+			zap.Int("attempt", attempt),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.config.RetryBackoff):
+		}
+	}
+	return err
+}
+
+// finish records the final state of a job. Shutdown does not interrupt it.
+func (s *JobService) finish(ctx context.Context, job *models.Job, state models.JobState, jobErr error, logger *zap.Logger) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	err := s.jobs.Finish(ctx, job.ID, s.owner, state, jobErr)
+	if errors.Is(err, repository.ErrJobLeaseLost) {
+		logger.Info("Job was cancelled or taken over before finishing")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to finish job", zap.Error(err))
+		return
+	}
+	logger.Info("Job finished", zap.String("state", string(state)))
+}
+
+// Error definitions
+var (
+	ErrJobNotFound     = repository.ErrJobNotFound
+	ErrJobFinished     = repository.ErrJobFinished
+	ErrUnknownJobType  = NewError("unknown job type")
+	ErrInvalidJobRange = NewError("end date is before start date")
+	ErrJobRangeTooLong = NewError("date range is too long for a single job")
+)
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics of the event pipeline
+var (
+	messagesFetchedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "campaign_analytics_messages_fetched_total",
+		Help: "Number of Kafka messages fetched, per topic.",
+	}, []string{"topic"})
+
+	messageRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "campaign_analytics_message_retries_total",
+		Help: "Number of times processing of a Kafka message was retried.",
+	}, []string{"topic"})
+
+	deadLetterWritesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "campaign_analytics_dlq_writes_total",
+		Help: "Number of messages written to a dead-letter topic.",
+	}, []string{"topic", "reason"})
+
+	deadLetterWriteErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "campaign_analytics_dlq_write_errors_total",
+		Help: "Number of failed attempts to write a message to a dead-letter topic.",
+	}, []string{"topic"})
+
+	deadLetterRedrivesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "campaign_analytics_dlq_redrives_total",
+		Help: "Number of dead-lettered messages re-driven to their original topic.",
+	}, []string{"topic"})
+
+	eventsInsertedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "campaign_analytics_events_inserted_total",
+		Help: "Number of events written to ClickHouse.",
+	})
+
+	eventsUnchangedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "campaign_analytics_events_unchanged_total",
+		Help: "Number of events skipped because their snapshot was already stored.",
+	})
+
+	insertBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "campaign_analytics_insert_batch_size",
+		Help:    "Number of events per ClickHouse insert batch.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	insertBatchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "campaign_analytics_insert_batch_duration_seconds",
+		Help:    "Time to write a batch to ClickHouse, including retries and bisection.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	batchLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "campaign_analytics_batch_latency_seconds",
+		Help:    "Time from fetching the first message of a batch to committing its offsets.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	insertRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "campaign_analytics_insert_retries_total",
+		Help: "Number of ClickHouse batch writes retried after a transient error.",
+	})
+
+	insertBisectionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "campaign_analytics_insert_bisections_total",
+		Help: "Number of rejected ClickHouse batches split in two.",
+	})
+
+	outboxPublishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "campaign_analytics_outbox_published_total",
+		Help: "Number of outbox messages published to Kafka, per topic.",
+	}, []string{"topic"})
+
+	outboxPublishErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "campaign_analytics_outbox_publish_errors_total",
+		Help: "Number of outbox batches that failed to publish.",
+	})
+
+	jobChunksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "campaign_analytics_job_chunks_total",
+		Help: "Number of job chunks processed, per job type and outcome.",
+	}, []string{"type", "outcome"})
+)
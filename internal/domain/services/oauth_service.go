@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/oauth"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
+	"go.uber.org/zap"
+)
+
+// StateLifetime bounds how long a user may take on the provider's consent page
+const StateLifetime = 15 * time.Minute
+
+// refreshLockTTL bounds a single token refresh; its Redis lock expires after it
+const refreshLockTTL = 2 * time.Minute
+
+// stateNonceScope namespaces the nonces of pending authorizations in Redis
+const stateNonceScope = "oauth_state"
+
+// OAuthService runs the OAuth2 connection flow and keeps tokens fresh
+type OAuthService struct {
+	providers   map[models.Platform]*oauth.Provider
+	credentials *CredentialsService
+	redis       *redis.Client
+	stateKey    []byte
+	instanceID  string
+	logger      *zap.Logger
+}
+
+// NewOAuthService creates a new OAuth service
+func NewOAuthService(
+	providers map[models.Platform]*oauth.Provider,
+	credentials *CredentialsService,
+	redis *redis.Client,
+	stateKey []byte,
+	logger *zap.Logger,
+) *OAuthService {
+	return &OAuthService{
+		providers:   providers,
+		credentials: credentials,
+		redis:       redis,
+		stateKey:    stateKey,
+		instanceID:  uuid.New().String(),
+		logger:      logger.With(zap.String("component", "oauth_service")),
+	}
+}
+
+// AuthorizeURL returns the provider consent URL for a user connecting an ad
+// account, and the nonce of its state. The nonce must come back with the
+// callback from the same browser, which keeps an attacker from completing
+// a flow they started in a victim's browser, and is accepted once.
+func (s *OAuthService) AuthorizeURL(ctx context.Context, userID uuid.UUID, platform models.Platform, accountID string) (url, nonce string, err error) {
+	provider, exists := s.providers[platform]
+	if !exists {
+		return "", "", ErrOAuthNotConfigured
+	}
+
+	nonce, err = oauth.NewNonce()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.redis.AddNonce(ctx, stateNonceScope, nonce, StateLifetime); err != nil {
+		return "", "", err
+	}
+
+	state, err := oauth.SignState(s.stateKey, oauth.State{
+		UserID:    userID,
+		Platform:  platform,
+		AccountID: accountID,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(StateLifetime).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return provider.AuthCodeURL(state), nonce, nil
+}
+
+// CompleteAuthorization handles the provider callback: it verifies the state
+// and that nonce, the one given to the browser that started the flow, is its
+// unused nonce, then exchanges the code and stores the resulting tokens
+func (s *OAuthService) CompleteAuthorization(ctx context.Context, platform models.Platform, code, signedState, nonce string) (*models.PlatformConnection, error) {
+	state, err := oauth.VerifyState(s.stateKey, signedState)
+	if err != nil {
+		return nil, err
+	}
+	if state.Platform != platform {
+		return nil, oauth.ErrInvalidState
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(state.Nonce)) != 1 {
+		return nil, oauth.ErrInvalidState
+	}
+
+	provider, exists := s.providers[platform]
+	if !exists {
+		return nil, ErrOAuthNotConfigured
+	}
+
+	consumed, err := s.redis.ConsumeNonce(ctx, stateNonceScope, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, oauth.ErrInvalidState
+	}
+
+	token, err := provider.Exchange(ctx, code)
+	if err != nil {
+		s.logger.Error("Failed to exchange authorization code",
+			zap.Error(err),
+			zap.String("user_id", state.UserID.String()),
+			zap.String("platform", string(platform)),
+		)
+		return nil, err
+	}
+
+	return s.credentials.Connect(ctx, state.UserID, platform, models.PlatformCredentials{
+		AccountID:    state.AccountID,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    token.ExpiresAt,
+	})
+}
+
+// StartRefresher renews tokens that expire within window every interval
+// until the context is cancelled
+func (s *OAuthService) StartRefresher(ctx context.Context, interval, window time.Duration) {
+	s.logger.Info("Starting token refresher",
+		zap.Duration("interval", interval),
+		zap.Duration("window", window),
+	)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RefreshExpiring(ctx, window); err != nil {
+			s.logger.Error("Token refresh run failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Token refresher shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RefreshExpiring refreshes every active connection expiring within window
+func (s *OAuthService) RefreshExpiring(ctx context.Context, window time.Duration) error {
+	before := time.Now().Add(window)
+	connections, err := s.credentials.ListExpiring(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	for _, connection := range connections {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.refresh(ctx, connection, before)
+	}
+
+	return nil
+}
+
+// refresh renews one connection still expiring before the given time once its
+// lock is held. Permanent failures, and any failure once the token has
+// already expired, mark the connection as needing re-authorization;
+// transient failures are retried on the next run.
+func (s *OAuthService) refresh(ctx context.Context, listed models.PlatformConnection, before time.Time) {
+	logger := s.logger.With(
+		zap.String("user_id", listed.UserID.String()),
+		zap.String("platform", string(listed.Platform)),
+	)
+
+	// Replicas refresh the same connections; only the lock holder may spend a
+	// refresh token, since providers that rotate them reject the second use
+	lockKey := "oauth_refresh:" + listed.UserID.String() + ":" + string(listed.Platform)
+	acquired, err := s.redis.AcquireLock(ctx, lockKey, s.instanceID, refreshLockTTL)
+	if err != nil {
+		logger.Error("Failed to acquire refresh lock", zap.Error(err))
+		return
+	}
+	if !acquired {
+		logger.Debug("Token is being refreshed by another worker")
+		return
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.redis.ReleaseLock(releaseCtx, lockKey, s.instanceID); err != nil {
+			logger.Warn("Failed to release refresh lock", zap.Error(err))
+		}
+	}()
+
+	// Another replica may have refreshed or flagged the connection since it
+	// was listed, so work from what is stored now
+	connection, err := s.credentials.GetConnection(ctx, listed.UserID, listed.Platform)
+	if err != nil {
+		logger.Error("Failed to reload connection for refresh", zap.Error(err))
+		return
+	}
+	if connection.Status != models.ConnectionStatusActive || connection.ExpiresAt == nil || !connection.ExpiresAt.Before(before) {
+		logger.Debug("Connection was refreshed since it was listed")
+		return
+	}
+	expired := connection.ExpiresAt.Before(time.Now())
+
+	provider, exists := s.providers[connection.Platform]
+	if !exists {
+		if expired {
+			s.markNeedsReauth(ctx, *connection, "token expired and no oauth provider is configured")
+		}
+		return
+	}
+
+	creds, err := s.credentials.GetCredentials(ctx, connection.UserID, connection.Platform)
+	if err != nil {
+		logger.Error("Failed to load credentials for refresh", zap.Error(err))
+		return
+	}
+
+	token, err := provider.Refresh(ctx, oauth.Token{
+		AccessToken:  creds.AccessToken,
+		RefreshToken: creds.RefreshToken,
+		ExpiresAt:    creds.ExpiresAt,
+	})
+	if err != nil {
+		var tokenErr *oauth.TokenError
+		if (errors.As(err, &tokenErr) && tokenErr.Permanent()) || expired {
+			s.markNeedsReauth(ctx, *connection, err.Error())
+			return
+		}
+		logger.Warn("Token refresh failed, will retry", zap.Error(err))
+		return
+	}
+
+	creds.AccessToken = token.AccessToken
+	creds.RefreshToken = token.RefreshToken
+	creds.ExpiresAt = token.ExpiresAt
+	if _, err := s.credentials.Connect(ctx, connection.UserID, connection.Platform, *creds); err != nil {
+		logger.Error("Failed to persist refreshed token", zap.Error(err))
+		return
+	}
+
+	logger.Info("Refreshed platform token")
+}
+
+// markNeedsReauth flags a connection, logging rather than returning failures
+func (s *OAuthService) markNeedsReauth(ctx context.Context, connection models.PlatformConnection, reason string) {
+	if err := s.credentials.MarkNeedsReauth(ctx, connection.UserID, connection.Platform, reason); err != nil {
+		s.logger.Error("Failed to flag connection", zap.Error(err))
+	}
+}
+
+// Error definitions
+var (
+	ErrOAuthNotConfigured = NewError("oauth is not configured for this platform")
+)
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/oauth"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis/redistest"
+	"go.uber.org/zap"
+)
+
+func TestCompleteAuthorizationNonce(t *testing.T) {
+	// The token endpoint fails, so an accepted callback stops after the exchange
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer tokenServer.Close()
+
+	providers := map[models.Platform]*oauth.Provider{
+		models.PlatformGoogle: oauth.NewProvider(models.PlatformGoogle, oauth.Config{
+			ClientID: "client",
+			AuthURL:  "https://accounts.example.com/auth",
+			TokenURL: tokenServer.URL,
+		}),
+	}
+	service := NewOAuthService(providers, nil, redistest.NewClient(t), oauth.StateKey("jwt-secret"), zap.NewNop())
+	ctx := context.Background()
+
+	authorize := func() (state, nonce string) {
+		t.Helper()
+		authURL, nonce, err := service.AuthorizeURL(ctx, uuid.New(), models.PlatformGoogle, "1234567890")
+		if err != nil {
+			t.Fatalf("AuthorizeURL: %v", err)
+		}
+		parsed, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Query().Get("state"), nonce
+	}
+	complete := func(state, nonce string) error {
+		_, err := service.CompleteAuthorization(ctx, models.PlatformGoogle, "code", state, nonce)
+		return err
+	}
+
+	state, nonce := authorize()
+	_, otherNonce := authorize()
+
+	// Callbacks from a browser without the flow's nonce are rejected
+	for name, nonce := range map[string]string{"missing": "", "another flow's": otherNonce, "forged": "AAAAAAAAAAAAAAAAAAAAAA"} {
+		if err := complete(state, nonce); !errors.Is(err, oauth.ErrInvalidState) {
+			t.Errorf("%s nonce: err = %v, want ErrInvalidState", name, err)
+		}
+	}
+
+	// The browser's nonce is accepted, once
+	if err := complete(state, nonce); err == nil || errors.Is(err, oauth.ErrInvalidState) {
+		t.Fatalf("first callback: err = %v, want the token endpoint failure", err)
+	}
+	if err := complete(state, nonce); !errors.Is(err, oauth.ErrInvalidState) {
+		t.Errorf("replayed callback: err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestRefreshSkipsLockedConnection(t *testing.T) {
+	redisClient := redistest.NewClient(t)
+	service := NewOAuthService(nil, nil, redisClient, oauth.StateKey("jwt-secret"), zap.NewNop())
+	connection := models.PlatformConnection{UserID: uuid.New(), Platform: models.PlatformGoogle}
+
+	// Another replica is refreshing the connection: this one leaves it alone,
+	// without loading credentials it has no service for
+	lockKey := "oauth_refresh:" + connection.UserID.String() + ":google"
+	acquired, err := redisClient.AcquireLock(context.Background(), lockKey, "other-replica", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("AcquireLock = %v, %v", acquired, err)
+	}
+	service.refresh(context.Background(), connection, time.Now().Add(time.Hour))
+
+	if value, err := redisClient.Get(context.Background(), "lock:"+lockKey); err != nil || value != "other-replica" {
+		t.Errorf("lock = %q, %v; want it still held by the other replica", value, err)
+	}
+}
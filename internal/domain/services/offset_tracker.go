@@ -0,0 +1,80 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// topicPartition identifies a Kafka partition
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// offsetTracker records fetched messages per partition and reports how far
+// each partition can be committed: up to the last offset before the first
+// message that is still in flight. Messages finish out of order when they
+// are handled by different lanes.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+}
+
+// partitionOffsets holds the unfinished offsets of a partition in fetch order
+type partitionOffsets struct {
+	offsets []int64
+	done    map[int64]bool
+}
+
+// newOffsetTracker creates an empty tracker
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[topicPartition]*partitionOffsets)}
+}
+
+// fetched records a message as in flight. Messages of a partition must be
+// recorded in the order they were fetched.
+func (t *offsetTracker) fetched(msg bus.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	p, exists := t.partitions[key]
+	if !exists {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[key] = p
+	}
+	p.offsets = append(p.offsets, msg.Offset)
+}
+
+// done marks messages as finished and returns, per partition that advanced,
+// the message to commit up to
+func (t *offsetTracker) done(msgs []bus.Message) []bus.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	touched := make(map[topicPartition]bool)
+	for _, msg := range msgs {
+		key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+		if p, exists := t.partitions[key]; exists {
+			p.done[msg.Offset] = true
+			touched[key] = true
+		}
+	}
+
+	var commits []bus.Message
+	for key := range touched {
+		p := t.partitions[key]
+		last := int64(-1)
+		for len(p.offsets) > 0 && p.done[p.offsets[0]] {
+			last = p.offsets[0]
+			delete(p.done, last)
+			p.offsets = p.offsets[1:]
+		}
+		if last >= 0 {
+			commits = append(commits, bus.Message{Topic: key.topic, Partition: key.partition, Offset: last})
+		}
+	}
+
+	return commits
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	msg := func(topic string, partition int, offset int64) bus.Message {
+		return bus.Message{Topic: topic, Partition: partition, Offset: offset}
+	}
+
+	tests := []struct {
+		name    string
+		fetched []bus.Message
+		done    [][]bus.Message // batches finished one after the other
+		want    [][]bus.Message // commits after each batch
+	}{
+		{
+			name:    "in order completion commits each message",
+			fetched: []bus.Message{msg("events", 0, 10), msg("events", 0, 11), msg("events", 0, 12)},
+			done:    [][]bus.Message{{msg("events", 0, 10)}, {msg("events", 0, 11), msg("events", 0, 12)}},
+			want:    [][]bus.Message{{msg("events", 0, 10)}, {msg("events", 0, 12)}},
+		},
+		{
+			name:    "a later message waits for the one in flight before it",
+			fetched: []bus.Message{msg("events", 0, 10), msg("events", 0, 11), msg("events", 0, 12)},
+			done:    [][]bus.Message{{msg("events", 0, 12)}, {msg("events", 0, 11)}, {msg("events", 0, 10)}},
+			want:    [][]bus.Message{nil, nil, {msg("events", 0, 12)}},
+		},
+		{
+			name:    "commits stop at the first gap",
+			fetched: []bus.Message{msg("events", 0, 10), msg("events", 0, 11), msg("events", 0, 12)},
+			done:    [][]bus.Message{{msg("events", 0, 11)}, {msg("events", 0, 10)}, {msg("events", 0, 12)}},
+			want:    [][]bus.Message{nil, {msg("events", 0, 11)}, {msg("events", 0, 12)}},
+		},
+		{
+			name:    "offsets need not be consecutive",
+			fetched: []bus.Message{msg("events", 0, 10), msg("events", 0, 15), msg("events", 0, 40)},
+			done:    [][]bus.Message{{msg("events", 0, 15), msg("events", 0, 10)}},
+			want:    [][]bus.Message{{msg("events", 0, 15)}},
+		},
+		{
+			name: "partitions and topics advance independently",
+			fetched: []bus.Message{
+				msg("events", 0, 10), msg("events", 1, 10), msg("events", 0, 11), msg("webhooks", 0, 10),
+			},
+			done: [][]bus.Message{
+				{msg("events", 0, 11), msg("events", 1, 10)},
+				{msg("webhooks", 0, 10), msg("events", 0, 10)},
+			},
+			want: [][]bus.Message{
+				{msg("events", 1, 10)},
+				{msg("events", 0, 11), msg("webhooks", 0, 10)},
+			},
+		},
+		{
+			name:    "messages never fetched are ignored",
+			fetched: []bus.Message{msg("events", 0, 10)},
+			done:    [][]bus.Message{{msg("events", 1, 10)}, {msg("events", 0, 10)}},
+			want:    [][]bus.Message{nil, {msg("events", 0, 10)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for _, m := range tt.fetched {
+				tracker.fetched(m)
+			}
+			for i, batch := range tt.done {
+				got := tracker.done(batch)
+				// Partitions are reported in no particular order
+				sort.Slice(got, func(a, b int) bool {
+					if got[a].Topic != got[b].Topic {
+						return got[a].Topic < got[b].Topic
+					}
+					return got[a].Partition < got[b].Partition
+				})
+				if !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("done(%v) = %v, want %v", batch, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
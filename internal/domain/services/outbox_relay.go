@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/database"
+	"go.uber.org/zap"
+)
+
+// outboxRelayLockID is the Postgres advisory lock held by the active relay.
+// A single relay publishes at a time so messages keep their outbox order.
+const outboxRelayLockID = 7_001_001
+
+// OutboxConfig configures the outbox relay
+type OutboxConfig struct {
+	// PollInterval is how often the outbox is checked for new messages
+	PollInterval time.Duration
+	// BatchSize is the maximum number of messages published at once
+	BatchSize int
+	// Retention is how long published messages are kept for inspection
+	Retention time.Duration
+}
+
+// OutboxRelay publishes the messages queued in the Postgres outbox to the message bus.
+// Messages are marked published only after the bus acknowledged them, so each
+// is delivered at least once; consumers must tolerate duplicates.
+type OutboxRelay struct {
+	db       *database.PostgresClient
+	producer bus.Publisher
+	config   OutboxConfig
+	logger   *zap.Logger
+}
+
+// NewOutboxRelay creates a new outbox relay. The producer must not be bound to
+// a topic since every outbox row names its own.
+func NewOutboxRelay(db *database.PostgresClient, producer bus.Publisher, config OutboxConfig, logger *zap.Logger) *OutboxRelay {
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+
+	return &OutboxRelay{
+		db:       db,
+		producer: producer,
+		config:   config,
+		logger:   logger.With(zap.String("component", "outbox_relay")),
+	}
+}
+
+// outboxRow is an unpublished outbox message
+type outboxRow struct {
+	ID      int64  `db:"id"`
+	Topic   string `db:"topic"`
+	Key     []byte `db:"message_key"`
+	Payload []byte `db:"payload"`
+	Headers []byte `db:"headers"`
+}
+
+// Start relays messages until the context is cancelled. Full batches are
+// followed immediately by the next one so a backlog drains quickly.
+func (r *OutboxRelay) Start(ctx context.Context) {
+	r.logger.Info("Starting outbox relay",
+		zap.Duration("poll_interval", r.config.PollInterval),
+		zap.Int("batch_size", r.config.BatchSize),
+	)
+
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+
+	for {
+		published, err := r.relayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("Failed to relay outbox messages", zap.Error(err))
+		}
+
+		if r.config.Retention > 0 && time.Since(lastCleanup) >= time.Hour {
+			r.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+
+		if err == nil && published == r.config.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes the oldest unpublished messages and marks them
+// published. It returns how many were published, or 0 when another relay
+// holds the lock.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The lock is released with the transaction
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, "SELECT pg_try_advisory_xact_lock($1)", outboxRelayLockID); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	var rows []outboxRow
+	err = tx.SelectContext(ctx, &rows, `
+		SELECT id, topic, message_key, payload, headers
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`, r.config.BatchSize)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int64, 0, len(rows))
+	messages := make([]bus.Message, 0, len(rows))
+	for _, row := range rows {
+		msg, err := row.message()
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, row.ID)
+		messages = append(messages, msg)
+	}
+
+	if err := r.producer.WriteMessages(ctx, messages...); err != nil {
+		outboxPublishErrorsTotal.Inc()
+		// Record the failure; the whole batch is published again next time
+		if _, updateErr := tx.ExecContext(ctx, `
+			UPDATE outbox SET attempts = attempts + 1, last_error = $2
+			WHERE id = ANY($1)
+		`, pq.Array(ids), err.Error()); updateErr != nil {
+			return 0, err
+		}
+		if commitErr := tx.Commit(); commitErr != nil {
+			r.logger.Warn("Failed to record outbox publish failure", zap.Error(commitErr))
+		}
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE outbox SET published_at = NOW(), last_error = NULL
+		WHERE id = ANY($1)
+	`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	// A failed commit leaves the batch unpublished, so it is sent again
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		outboxPublishedTotal.WithLabelValues(msg.Topic).Inc()
+	}
+	r.logger.Debug("Relayed outbox messages", zap.Int("message_count", len(messages)))
+	return len(messages), nil
+}
+
+// message converts an outbox row back into a bus message
+func (row *outboxRow) message() (bus.Message, error) {
+	var headers []database.OutboxHeader
+	if err := json.Unmarshal(row.Headers, &headers); err != nil {
+		return bus.Message{}, err
+	}
+
+	msg := bus.Message{
+		Topic: row.Topic,
+		Key:   row.Key,
+		Value: row.Payload,
+		Time:  time.Now(),
+	}
+	for _, header := range headers {
+		msg.Headers = append(msg.Headers, bus.Header{Key: header.Key, Value: header.Value})
+	}
+	return msg, nil
+}
+
+// cleanup deletes published messages older than the retention
+func (r *OutboxRelay) cleanup(ctx context.Context) {
+	result, err := r.db.GetDB().ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE published_at IS NOT NULL AND published_at < $1
+	`, time.Now().Add(-r.config.Retention))
+	if err != nil {
+		r.logger.Warn("Failed to clean up outbox", zap.Error(err))
+		return
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted > 0 {
+		r.logger.Info("Cleaned up published outbox messages", zap.Int64("message_count", deleted))
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"go.uber.org/zap"
+)
+
+// PacingService compares the spend of campaigns with their budget
+type PacingService struct {
+	aggregation *AggregationService
+	config      models.PacingConfig
+	logger      *zap.Logger
+}
+
+// NewPacingService creates a new pacing service. The run rate defaults to
+// the last 7 days and the tolerance to 10% of the ideal spend.
+func NewPacingService(
+	aggregationService *AggregationService,
+	config models.PacingConfig,
+	logger *zap.Logger,
+) *PacingService {
+	if config.RunRateDays <= 0 {
+		config.RunRateDays = 7
+	}
+	if config.Tolerance <= 0 {
+		config.Tolerance = 0.1
+	}
+
+	return &PacingService{
+		aggregation: aggregationService,
+		config:      config,
+		logger:      logger.With(zap.String("component", "pacing_service")),
+	}
+}
+
+// GetCampaignPacing computes the pacing of a campaign at now from its daily
+// insights. The budget is taken to be in currency, into which spend is
+// converted; without a currency, spend must be reported in a single one.
+func (s *PacingService) GetCampaignPacing(ctx context.Context, campaign *models.Campaign, currency string, now time.Time) (*models.CampaignPacing, error) {
+	loc := campaign.Location()
+	start, _ := campaign.FlightDates()
+	today := models.DateIn(now, loc)
+	asOf := models.PacingAsOf(campaign, today)
+
+	var rows []models.CampaignInsights
+	var missing []models.MissingFXRate
+	if !asOf.Before(start) {
+		params := models.CampaignInsightsParams{
+			CampaignID:  campaign.ID,
+			StartDate:   start,
+			EndDate:     asOf,
+			Granularity: models.GranularityDaily,
+			GroupBy:     []models.InsightsDimension{models.DimensionDate},
+			Timezone:    loc.String(),
+		}
+
+		if currency != "" {
+			converted, err := s.aggregation.GetConvertedCampaignInsights(ctx, params, currency)
+			if err != nil {
+				return nil, err
+			}
+			rows, missing = converted.Insights, converted.MissingRates
+		} else {
+			insights, err := s.aggregation.GetCampaignInsights(ctx, params)
+			if err != nil {
+				return nil, err
+			}
+			for _, row := range insights {
+				if row.Currency != insights[0].Currency {
+					return nil, ErrPacingNeedsCurrency
+				}
+			}
+			rows = insights
+		}
+	}
+
+	pacing := models.ComputePacing(campaign, rows, today, s.config)
+	if currency != "" {
+		pacing.Currency = currency
+	}
+	pacing.MissingRates = missing
+
+	s.logger.Debug("Computed campaign pacing",
+		zap.String("campaign_id", campaign.ID.String()),
+		zap.String("status", string(pacing.Status)),
+	)
+	return pacing, nil
+}
+
+// Error definitions
+var (
+	ErrPacingNeedsCurrency = NewError("spend is reported in several currencies; pass the budget's currency")
+)
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// PortfolioService aggregates insights across the campaigns of a user
+type PortfolioService struct {
+	campaigns   repository.CampaignRepository
+	aggregation *AggregationService
+	logger      *zap.Logger
+}
+
+// NewPortfolioService creates a new portfolio service
+func NewPortfolioService(
+	campaigns repository.CampaignRepository,
+	aggregation *AggregationService,
+	logger *zap.Logger,
+) *PortfolioService {
+	return &PortfolioService{
+		campaigns:   campaigns,
+		aggregation: aggregation,
+		logger:      logger.With(zap.String("component", "portfolio_service")),
+	}
+}
+
+// GetPortfolioInsights aggregates the insights of the campaigns of userID
+// that match filter. The campaigns are selected with the user as part of the
+// query, so IDs in filter that belong to other users match nothing, and the
+// insights query is restricted to the selected campaigns. Amounts are
+// converted into currency unless it is empty.
+func (s *PortfolioService) GetPortfolioInsights(ctx context.Context, userID uuid.UUID, filter repository.CampaignFilter, params models.CampaignInsightsParams, currency string) (*models.PortfolioInsights, error) {
+	params, err := s.selectCampaigns(ctx, userID, filter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio := &models.PortfolioInsights{
+		CampaignIDs: params.CampaignIDs,
+		GroupBy:     params.GroupBy,
+		Currency:    currency,
+	}
+
+	var rows []models.CampaignInsights
+	switch {
+	case len(params.CampaignIDs) == 0:
+		// Nothing to query
+	case currency != "":
+		converted, err := s.aggregation.GetConvertedCampaignInsights(ctx, params, currency)
+		if err != nil {
+			return nil, err
+		}
+		rows = converted.Insights
+		portfolio.MissingRates = converted.MissingRates
+	default:
+		if rows, err = s.aggregation.GetCampaignInsights(ctx, params); err != nil {
+			return nil, err
+		}
+	}
+
+	// Totals are re-summed from the rows, one per currency
+	totals := models.GroupInsights(rows, []models.InsightsDimension{}, params.Granularity, params.WeekStart)
+	portfolio.Rows = models.NewPortfolioInsightsRows(rows, params.GroupBy)
+	portfolio.Totals = models.NewPortfolioInsightsRows(totals, []models.InsightsDimension{})
+	return portfolio, nil
+}
+
+// ComparePortfolioInsights compares the insights of the campaigns of userID
+// that match filter with those of the period selected by compare. Campaigns
+// are selected like in GetPortfolioInsights.
+func (s *PortfolioService) ComparePortfolioInsights(ctx context.Context, userID uuid.UUID, filter repository.CampaignFilter, params models.CampaignInsightsParams, compare models.InsightsComparisonParams, currency string) (*models.InsightsComparison, error) {
+	params, err := s.selectCampaigns(ctx, userID, filter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison, err := s.aggregation.CompareCampaignInsights(ctx, params, compare, currency)
+	if err != nil {
+		return nil, err
+	}
+	comparison.CampaignIDs = params.CampaignIDs
+	comparison.GroupBy = params.GroupBy
+	return comparison, nil
+}
+
+// selectCampaigns restricts params to the campaigns of userID that match
+// filter
+func (s *PortfolioService) selectCampaigns(ctx context.Context, userID uuid.UUID, filter repository.CampaignFilter, params models.CampaignInsightsParams) (models.CampaignInsightsParams, error) {
+	filter.UserID = userID
+	filter.Tags = models.NormalizeTags(filter.Tags)
+	campaigns, err := s.campaigns.List(ctx, filter)
+	if err != nil {
+		s.logger.Error("Failed to list portfolio campaigns", zap.Error(err), zap.String("user_id", userID.String()))
+		return params, err
+	}
+
+	params.CampaignID = uuid.Nil
+	params.CampaignIDs = make([]uuid.UUID, len(campaigns))
+	for i, campaign := range campaigns {
+		params.CampaignIDs[i] = campaign.ID
+	}
+	return params, nil
+}
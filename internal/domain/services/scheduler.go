@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
+	"go.uber.org/zap"
+)
+
+// SchedulerConfig configures the automatic campaign sync
+type SchedulerConfig struct {
+	// Interval is the minimum time between two syncs of the same campaign
+	Interval time.Duration
+	// Tick is how often due campaigns are looked up
+	Tick time.Duration
+	// Jitter is the maximum random delay before a sync starts, spreading
+	// platform API calls out instead of firing them all on the tick
+	Jitter time.Duration
+	// LockTTL bounds a single sync; the Redis lock expires after it
+	LockTTL time.Duration
+	// PlatformConcurrency limits concurrent syncs per platform on this replica
+	PlatformConcurrency map[models.Platform]int
+	// DefaultConcurrency applies to platforms without an explicit limit
+	DefaultConcurrency int
+}
+
+// Scheduler periodically fetches data for every active campaign. A Redis
+// lock per campaign ensures only one worker replica syncs a given campaign.
+type Scheduler struct {
+	campaignService *CampaignService
+	redis           *redis.Client
+	config          SchedulerConfig
+	instanceID      string
+	limits          map[models.Platform]chan struct{}
+	inFlight        sync.Map
+	wg              sync.WaitGroup
+	logger          *zap.Logger
+}
+
+// NewScheduler creates a new scheduler
+func NewScheduler(
+	campaignService *CampaignService,
+	redis *redis.Client,
+	config SchedulerConfig,
+	logger *zap.Logger,
+) *Scheduler {
+	if config.DefaultConcurrency <= 0 {
+		config.DefaultConcurrency = 1
+	}
+
+	limits := make(map[models.Platform]chan struct{})
+	for _, platform := range []models.Platform{
+		models.PlatformMeta,
+		models.PlatformGoogle,
+		models.PlatformLinkedIn,
+		models.PlatformTikTok,
+	} {
+		limit := config.PlatformConcurrency[platform]
+		if limit <= 0 {
+			limit = config.DefaultConcurrency
+		}
+		limits[platform] = make(chan struct{}, limit)
+	}
+
+	return &Scheduler{
+		campaignService: campaignService,
+		redis:           redis,
+		config:          config,
+		instanceID:      uuid.New().String(),
+		limits:          limits,
+		logger:          logger.With(zap.String("component", "scheduler")),
+	}
+}
+
+// Start runs the scheduler until the context is cancelled, then waits for
+// in-flight syncs to finish
+func (s *Scheduler) Start(ctx context.Context) {
+	s.logger.Info("Starting scheduler",
+		zap.Duration("interval", s.config.Interval),
+		zap.Duration("tick", s.config.Tick),
+		zap.String("instance_id", s.instanceID),
+	)
+
+	ticker := time.NewTicker(s.config.Tick)
+	defer ticker.Stop()
+
+	for {
+		s.scheduleDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Scheduler shutting down, waiting for in-flight syncs")
+			s.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scheduleDue starts a sync for every campaign that is due and not already running here
+func (s *Scheduler) scheduleDue(ctx context.Context) {
+	now := time.Now()
+	dueBefore := now.Add(-s.config.Interval)
+	campaigns, err := s.campaignService.ListDueCampaigns(ctx, now, dueBefore)
+	if err != nil {
+		s.logger.Error("Failed to list campaigns due for sync", zap.Error(err))
+		return
+	}
+
+	for i := range campaigns {
+		campaign := campaigns[i]
+		if _, running := s.inFlight.LoadOrStore(campaign.ID, struct{}{}); running {
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.inFlight.Delete(campaign.ID)
+			s.sync(ctx, &campaign, dueBefore)
+		}()
+	}
+}
+
+// sync fetches one campaign's data under the platform limit and the campaign
+// lock, unless it was attempted after dueBefore by the time the lock is held
+func (s *Scheduler) sync(ctx context.Context, campaign *models.Campaign, dueBefore time.Time) {
+	logger := s.logger.With(
+		zap.String("campaign_id", campaign.ID.String()),
+		zap.String("platform", string(campaign.Platform)),
+	)
+
+	// Spread the start time
+	if s.config.Jitter > 0 {
+		delay := time.Duration(rand.Int63n(int64(s.config.Jitter)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	limit, exists := s.limits[campaign.Platform]
+	if !exists {
+		logger.Warn("Skipping campaign with unknown platform")
+		return
+	}
+	select {
+	case <-ctx.Done():
+		return
+	case limit <- struct{}{}:
+	}
+	defer func() { <-limit }()
+
+	lockKey := "sync:" + campaign.ID.String()
+	acquired, err := s.redis.AcquireLock(ctx, lockKey, s.instanceID, s.config.LockTTL)
+	if err != nil {
+		logger.Error("Failed to acquire sync lock", zap.Error(err))
+		return
+	}
+	if !acquired {
+		logger.Debug("Campaign is being synced by another worker")
+		return
+	}
+	defer func() {
+		// Release with a fresh context so shutdown does not leave the lock behind
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.redis.ReleaseLock(releaseCtx, lockKey, s.instanceID); err != nil {
+			logger.Warn("Failed to release sync lock", zap.Error(err))
+		}
+	}()
+
+	// Another replica may have synced the campaign between the listing and
+	// the lock, so check it is still due now that no one else can
+	state, err := s.campaignService.GetSyncState(ctx, campaign)
+	if err != nil {
+		logger.Error("Failed to get sync state", zap.Error(err))
+		return
+	}
+	lastAttempt := state.LastAttemptAt
+	if lastAttempt == nil {
+		lastAttempt = state.LastSyncedAt
+	}
+	if lastAttempt != nil && lastAttempt.After(dueBefore) {
+		logger.Debug("Campaign was synced since it was listed", zap.Time("last_attempt_at", *lastAttempt))
+		return
+	}
+
+	// The sync must finish before the lock expires
+	syncCtx, cancel := context.WithTimeout(ctx, s.config.LockTTL)
+	defer cancel()
+
+	start := time.Now()
+	if err := s.campaignService.FetchCampaignData(syncCtx, campaign.ID); err != nil {
+		logger.Error("Scheduled sync failed", zap.Error(err))
+		return
+	}
+
+	logger.Info("Scheduled sync completed", zap.Duration("duration", time.Since(start)))
+}
@@ -2,86 +2,524 @@ package services
 
 import (
 	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
 	"time"
 
-	"github.com/zocket/campaign-analytics/internal/infrastructure/kafka"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
 	"go.uber.org/zap"
 )
 
-// Worker processes messages from Kafka
+// RetryConfig bounds how often a failing message is retried before it is
+// dead-lettered. Backoff doubles after each attempt up to MaxBackoff.
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// BatchConfig controls how events are grouped into ClickHouse inserts. A
+// batch is flushed when it holds Size messages or Timeout after its first one.
+type BatchConfig struct {
+	Size    int
+	Timeout time.Duration
+}
+
+// PoolConfig sizes the worker's processing lanes
+type PoolConfig struct {
+	// Concurrency is the number of lanes processing messages in parallel
+	Concurrency int
+	// ShutdownTimeout bounds how long in-flight work may drain on shutdown
+	ShutdownTimeout time.Duration
+}
+
+// MessageHandler turns a message of a topic into an event to insert, or nil
+// to skip it. Events with Unchanged set are not inserted but replace what the
+// batch holds for their key. Errors wrapping *InvalidEventError are
+// dead-lettered without retries.
+type MessageHandler func(ctx context.Context, msg bus.Message) (*PendingEvent, error)
+
+// Worker processes messages from the message bus. Each topic is handled by the handler
+// registered for it; the resulting events share the same batches. Messages are spread over a pool of
+// lanes by key, so messages of one campaign are handled in order by a single
+// lane while different campaigns are processed in parallel.
 type Worker struct {
-	consumer           *kafka.Consumer
+	consumer           bus.Subscriber
+	deadLetters        bus.Publisher
 	eventProcessor     *EventProcessor
 	aggregationService *AggregationService
+	retry              RetryConfig
+	batch              BatchConfig
+	pool               PoolConfig
+	handlers           map[string]MessageHandler
+	offsets            *offsetTracker
 	logger             *zap.Logger
 }
 
-// NewWorker creates a new worker
+// NewWorker creates a new worker. Messages that fail permanently, or still
+// fail after the configured retries, are written to deadLetters.
 func NewWorker(
-	consumer *kafka.Consumer,
+	consumer bus.Subscriber,
+	deadLetters bus.Publisher,
 	eventProcessor *EventProcessor,
 	aggregationService *AggregationService,
+	retry RetryConfig,
+	batch BatchConfig,
+	pool PoolConfig,
 	logger *zap.Logger,
 ) *Worker {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = 1
+	}
+	if retry.InitialBackoff <= 0 {
+		retry.InitialBackoff = 500 * time.Millisecond
+	}
+	if retry.MaxBackoff < retry.InitialBackoff {
+		retry.MaxBackoff = retry.InitialBackoff
+	}
+	if batch.Size <= 0 {
+		batch.Size = 1
+	}
+	if batch.Timeout <= 0 {
+		batch.Timeout = time.Second
+	}
+	if pool.Concurrency <= 0 {
+		pool.Concurrency = 1
+	}
+	if pool.ShutdownTimeout <= 0 {
+		pool.ShutdownTimeout = 30 * time.Second
+	}
+
 	return &Worker{
 		consumer:           consumer,
+		deadLetters:        deadLetters,
 		eventProcessor:     eventProcessor,
 		aggregationService: aggregationService,
+		retry:              retry,
+		batch:              batch,
+		pool:               pool,
+		handlers:           make(map[string]MessageHandler),
+		offsets:            newOffsetTracker(),
 		logger:             logger.With(zap.String("component", "worker")),
 	}
 }
 
-// Start starts the worker
+// Handle registers the handler of a topic. It must be called before Start;
+// messages of topics without a handler are dead-lettered.
+func (w *Worker) Handle(topic string, handler MessageHandler) {
+	w.handlers[topic] = handler
+}
+
+// eventBatch accumulates fetched messages until they are flushed
+type eventBatch struct {
+	// messages are all fetched messages, committed together after the flush
+	messages []bus.Message
+	// events are the messages to insert, one per deduplication key
+	events    []*PendingEvent
+	byKey     map[string]int
+	startedAt time.Time
+}
+
+// add queues a prepared event. A later snapshot of a key already in the
+// batch replaces the earlier one so each key is inserted once. An unchanged
+// snapshot, one restated back to the stored snapshot, drops the earlier one.
+func (b *eventBatch) add(pending *PendingEvent) {
+	key := pending.Event.DeduplicationKey
+	if pending.Unchanged {
+		if i, exists := b.byKey[key]; exists {
+			b.remove(i)
+		}
+		return
+	}
+	if i, exists := b.byKey[key]; exists {
+		if b.events[i].Hash == pending.Hash {
+			eventsUnchangedTotal.Inc()
+			return
+		}
+		pending.Restated = pending.Restated || b.events[i].Restated
+		b.events[i] = pending
+		return
+	}
+
+	b.byKey[key] = len(b.events)
+	b.events = append(b.events, pending)
+}
+
+// remove drops the event at index i, keeping the order of the others
+func (b *eventBatch) remove(i int) {
+	delete(b.byKey, b.events[i].Event.DeduplicationKey)
+	b.events = append(b.events[:i], b.events[i+1:]...)
+	for j := i; j < len(b.events); j++ {
+		b.byKey[b.events[j].Event.DeduplicationKey] = j
+	}
+}
+
+// Start fetches messages and dispatches them to the lanes until the context
+// is cancelled. It then stops fetching, lets the lanes drain and flush what
+// they hold, and returns once they are done or the shutdown timeout expires.
 func (w *Worker) Start(ctx context.Context) {
-	w.logger.Info("Starting worker")
+	w.logger.Info("Starting worker",
+		zap.Int("concurrency", w.pool.Concurrency),
+		zap.Int("batch_size", w.batch.Size),
+		zap.Duration("batch_timeout", w.batch.Timeout),
+	)
 
-	for {
+	// Lanes keep working after ctx is cancelled so in-flight work can drain
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	lanes := make([]chan bus.Message, w.pool.Concurrency)
+	var wg sync.WaitGroup
+	for i := range lanes {
+		lanes[i] = make(chan bus.Message, w.batch.Size)
+		wg.Add(1)
+		go func(messages <-chan bus.Message) {
+			defer wg.Done()
+			w.runLane(workCtx, messages)
+		}(lanes[i])
+	}
+
+	for ctx.Err() == nil {
+		// Read a message from the bus; it is only committed once handled
+		msg, err := w.consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			w.logger.Error("Error reading message from the message bus", zap.Error(err))
+			time.Sleep(1 * time.Second) // Backoff before retrying
+			continue
+		}
+
+		messagesFetchedTotal.WithLabelValues(msg.Topic).Inc()
+		w.offsets.fetched(msg)
 		select {
+		case lanes[w.laneFor(msg)] <- msg:
 		case <-ctx.Done():
-			w.logger.Info("Worker shutting down")
-			return
-		default:
-			// Read a message from Kafka
-			msg, err := w.consumer.ReadMessage(ctx)
-			if err != nil {
-				w.logger.Error("Error reading message from Kafka", zap.Error(err))
-				time.Sleep(1 * time.Second) // Backoff before retrying
-				continue
+			// Not dispatched, so never committed and redelivered later
+		}
+	}
+
+	w.logger.Info("Worker shutting down, draining lanes")
+	for _, lane := range lanes {
+		close(lane)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		w.logger.Info("Worker drained")
+	case <-time.After(w.pool.ShutdownTimeout):
+		// Unfinished messages stay uncommitted and are redelivered
+		w.logger.Warn("Drain timed out, abandoning in-flight work")
+		cancelWork()
+		<-drained
+	}
+}
+
+// laneFor picks the lane of a message from its key, so every message of a
+// campaign goes to the same lane. Keyless messages are spread by partition.
+func (w *Worker) laneFor(msg bus.Message) int {
+	if len(msg.Key) == 0 {
+		return msg.Partition % w.pool.Concurrency
+	}
+
+	h := fnv.New32a()
+	h.Write(msg.Key)
+	return int(h.Sum32() % uint32(w.pool.Concurrency))
+}
+
+// runLane processes the messages of one lane in order, batching them until
+// the batch is full or its window expires. Remaining messages are flushed
+// when the channel is closed.
+func (w *Worker) runLane(ctx context.Context, messages <-chan bus.Message) {
+	batch := w.newBatch()
+	var timer *time.Timer
+	var timeout <-chan time.Time
+
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		timeout = nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				stopTimer()
+				if len(batch.messages) > 0 {
+					w.flush(ctx, batch)
+				}
+				return
 			}
 
-			// Process the message
 			w.logger.Debug("Processing message",
 				zap.String("topic", msg.Topic),
 				zap.String("key", string(msg.Key)),
 			)
 
-			if err := w.processMessage(ctx, msg); err != nil {
-				w.logger.Error("Error processing message",
-					zap.Error(err),
-					zap.String("key", string(msg.Key)),
-				)
-				// Do not commit the message so it will be reprocessed
+			if len(batch.messages) == 0 {
+				batch.startedAt = time.Now()
+				timer = time.NewTimer(w.batch.Timeout)
+				timeout = timer.C
+			}
+
+			pending, err := w.prepareMessage(ctx, msg)
+			if err != nil {
+				// Only happens when the drain is abandoned
 				continue
 			}
+			batch.messages = append(batch.messages, msg)
+			if pending != nil {
+				batch.add(pending)
+			}
 
-			// Commit the message
-			if err := w.consumer.CommitMessages(ctx, msg); err != nil {
-				w.logger.Error("Error committing message", zap.Error(err))
-				// Continue processing other messages even if commit fails
+			if len(batch.messages) >= w.batch.Size {
+				stopTimer()
+				batch = w.flush(ctx, batch)
 			}
+
+		case <-timeout:
+			stopTimer()
+			batch = w.flush(ctx, batch)
 		}
 	}
 }
 
-// processMessage processes a single message
-func (w *Worker) processMessage(ctx context.Context, msg kafka.Message) error {
-	// Process the event
-	if err := w.eventProcessor.ProcessEvent(ctx, msg); err != nil {
+// newBatch returns an empty batch
+func (w *Worker) newBatch() *eventBatch {
+	return &eventBatch{byKey: make(map[string]int)}
+}
+
+// flush writes the batch to ClickHouse and commits its partitions as far as
+// every earlier message has finished. When the drain is abandoned the batch
+// is dropped uncommitted so its messages are redelivered.
+func (w *Worker) flush(ctx context.Context, batch *eventBatch) *eventBatch {
+	if len(batch.events) > 0 {
+		start := time.Now()
+		if err := w.storeEvents(ctx, batch.events); err != nil {
+			w.logger.Warn("Batch left uncommitted", zap.Error(err), zap.Int("message_count", len(batch.messages)))
+			return w.newBatch()
+		}
+		insertBatchSize.Observe(float64(len(batch.events)))
+		insertBatchDuration.Observe(time.Since(start).Seconds())
+	}
+
+	// Commit only once the batch is durably written, and never past a
+	// message another lane is still working on
+	if commits := w.offsets.done(batch.messages); len(commits) > 0 {
+		if err := w.consumer.CommitMessages(ctx, commits...); err != nil {
+			w.logger.Error("Error committing messages", zap.Error(err))
+			// Continue processing other messages even if commit fails
+		}
+	}
+	batchLatency.Observe(time.Since(batch.startedAt).Seconds())
+
+	w.logger.Debug("Flushed batch",
+		zap.Int("message_count", len(batch.messages)),
+		zap.Int("event_count", len(batch.events)),
+	)
+	return w.newBatch()
+}
+
+// storeEvents inserts events and completes them. A batch rejected because of
+// its rows is split in two until the offending row is isolated and
+// dead-lettered. It only returns an error when the context is cancelled.
+func (w *Worker) storeEvents(ctx context.Context, events []*PendingEvent) error {
+	err := w.insertWithRetry(ctx, events)
+	if err == nil {
+		eventsInsertedTotal.Add(float64(len(events)))
+		return w.completeWithRetry(ctx, events)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(events) == 1 {
+		w.logger.Error("Dead-lettering event rejected by ClickHouse",
+			zap.Error(err),
+			zap.String("key", events[0].Event.DeduplicationKey),
+		)
+		return w.deadLetter(ctx, events[0].Message, err, 1, "insert_rejected")
+	}
+
+	insertBisectionsTotal.Inc()
+	w.logger.Warn("Batch rejected, splitting", zap.Error(err), zap.Int("event_count", len(events)))
+	mid := len(events) / 2
+	if err := w.storeEvents(ctx, events[:mid]); err != nil {
+		return err
+	}
+	return w.storeEvents(ctx, events[mid:])
+}
+
+// insertWithRetry inserts a batch, retrying transient errors such as a lost
+// connection until the context is cancelled: a ClickHouse outage stalls
+// consumption rather than dead-lettering every message. A rejected batch is
+// returned immediately.
+func (w *Worker) insertWithRetry(ctx context.Context, events []*PendingEvent) error {
+	return w.retryTransient(ctx, "Failed to insert batch, retrying", func() error {
+		err := w.eventProcessor.StoreEvents(ctx, events)
+		var rejected *repository.RejectedBatchError
+		if errors.As(err, &rejected) {
+			return &permanentError{err}
+		}
 		return err
+	})
+}
+
+// completeWithRetry completes stored events, retrying until it succeeds
+func (w *Worker) completeWithRetry(ctx context.Context, events []*PendingEvent) error {
+	return w.retryTransient(ctx, "Failed to complete batch, retrying", func() error {
+		return w.eventProcessor.CompleteEvents(ctx, events)
+	})
+}
+
+// permanentError stops retryTransient
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// retryTransient runs fn with exponential backoff until it succeeds, fails
+// with a permanentError or the context is cancelled
+func (w *Worker) retryTransient(ctx context.Context, message string, fn func() error) error {
+	backoff := w.retry.InitialBackoff
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		insertRetriesTotal.Inc()
+		w.logger.Warn(message, zap.Error(err), zap.Duration("backoff", backoff))
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > w.retry.MaxBackoff {
+			backoff = w.retry.MaxBackoff
+		}
+	}
+}
+
+// prepareMessage prepares a message with bounded retries and dead-letters it
+// when preparation does not succeed. It returns nil for skipped or
+// dead-lettered messages, and an error only when the context is cancelled.
+func (w *Worker) prepareMessage(ctx context.Context, msg bus.Message) (*PendingEvent, error) {
+	handler, exists := w.handlers[msg.Topic]
+	if !exists {
+		w.logger.Error("Dead-lettering message of a topic without handler", zap.String("topic", msg.Topic))
+		return nil, w.deadLetter(ctx, msg, ErrNoTopicHandler, 1, "unhandled_topic")
+	}
+
+	backoff := w.retry.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		pending, err := handler(ctx, msg)
+		if err == nil {
+			if pending == nil || pending.Unchanged {
+				eventsUnchangedTotal.Inc()
+			}
+			return pending, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		logger := w.logger.With(
+			zap.Error(err),
+			zap.String("topic", msg.Topic),
+			zap.String("key", string(msg.Key)),
+			zap.Int64("offset", msg.Offset),
+			zap.Int("attempt", attempt),
+		)
+
+		var invalid *InvalidEventError
+		if errors.As(err, &invalid) {
+			logger.Error("Dead-lettering invalid message")
+			return nil, w.deadLetter(ctx, msg, err, attempt, "invalid")
+		}
+		if attempt >= w.retry.MaxAttempts {
+			logger.Error("Dead-lettering message after exhausting retries")
+			return nil, w.deadLetter(ctx, msg, err, attempt, "retries_exhausted")
+		}
+
+		logger.Warn("Error processing message, retrying", zap.Duration("backoff", backoff))
+		messageRetriesTotal.WithLabelValues(msg.Topic).Inc()
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+		if backoff > w.retry.MaxBackoff {
+			backoff = w.retry.MaxBackoff
+		}
+	}
+}
+
+// deadLetter writes the message to the dead-letter topic. The write is
+// retried until it succeeds so a message is never committed without being
+// either processed or dead-lettered.
+func (w *Worker) deadLetter(ctx context.Context, msg bus.Message, cause error, attempts int, reason string) error {
+	deadLetter := bus.NewDeadLetter(msg, cause, attempts)
+	backoff := w.retry.InitialBackoff
+
+	for {
+		err := w.deadLetters.WriteMessages(ctx, deadLetter)
+		if err == nil {
+			deadLetterWritesTotal.WithLabelValues(msg.Topic, reason).Inc()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		deadLetterWriteErrorsTotal.WithLabelValues(msg.Topic).Inc()
+		w.logger.Error("Failed to write dead letter, retrying",
+			zap.Error(err),
+			zap.String("key", string(msg.Key)),
+			zap.Duration("backoff", backoff),
+		)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > w.retry.MaxBackoff {
+			backoff = w.retry.MaxBackoff
+		}
 	}
+}
 
-	// We could implement additional processing here,
-	// like triggering aggregations or notifications
+// sleepContext waits for d or until the context is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	return nil
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
+
+// Error definitions
+var (
+	ErrNoTopicHandler = NewError("no handler registered for topic")
+)
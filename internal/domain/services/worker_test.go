@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/codec"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/memory"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis/redistest"
+	"go.uber.org/zap"
+)
+
+const pipelineTopic = "campaign-events"
+
+// pipeline is a worker wired to a MemoryBus and the in-memory stores
+type pipeline struct {
+	bus         *bus.MemoryBus
+	codec       *codec.CampaignEventCodec
+	aggregation *AggregationService
+	processor   *EventProcessor
+}
+
+func newPipeline(t *testing.T) *pipeline {
+	t.Helper()
+	logger := zap.NewNop()
+	redisClient := redistest.NewClient(t)
+
+	events := memory.NewEventStore()
+	fxService := NewFXService(memory.NewFXRateStore(), "USD", logger)
+	aggregation := NewAggregationService(memory.NewInsightsStore(events), fxService, redisClient, logger)
+	eventCodec, err := codec.NewCampaignEventCodec(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &pipeline{
+		bus:         bus.NewMemoryBus(4),
+		codec:       eventCodec,
+		aggregation: aggregation,
+		processor:   NewEventProcessor(events, redisClient, aggregation, eventCodec, logger),
+	}
+}
+
+// start runs a worker until stopped or the end of the test
+func (p *pipeline) start(t *testing.T) (stop func()) {
+	t.Helper()
+	subscriber := p.bus.Subscribe("worker", []string{pipelineTopic})
+	worker := NewWorker(subscriber, p.bus, p.processor, p.aggregation,
+		RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+		BatchConfig{Size: 10, Timeout: 20 * time.Millisecond},
+		PoolConfig{Concurrency: 2, ShutdownTimeout: time.Second},
+		zap.NewNop(),
+	)
+	worker.Handle(pipelineTopic, p.processor.PrepareEvent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		worker.Start(ctx)
+	}()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			<-done
+			subscriber.Close()
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// publish encodes events and writes them to the topic
+func (p *pipeline) publish(t *testing.T, events ...*models.CampaignEvent) {
+	t.Helper()
+	for _, event := range events {
+		msg, err := p.codec.Encode(context.Background(), pipelineTopic, event)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		msg.Topic = pipelineTopic
+		if err := p.bus.WriteMessages(context.Background(), msg); err != nil {
+			t.Fatalf("WriteMessages: %v", err)
+		}
+	}
+}
+
+// waitFor polls until cond holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// spend returns the insights of a campaign on a day, through the cache
+func (p *pipeline) spend(t *testing.T, campaignID uuid.UUID, day time.Time) (int64, float64) {
+	t.Helper()
+	rows, err := p.aggregation.GetCampaignInsights(context.Background(), models.CampaignInsightsParams{
+		CampaignID:  campaignID,
+		StartDate:   day,
+		EndDate:     day,
+		Granularity: models.GranularityDaily,
+		Timezone:    models.DefaultTimezone,
+	})
+	if err != nil {
+		t.Fatalf("GetCampaignInsights: %v", err)
+	}
+
+	var impressions int64
+	var spend float64
+	for _, row := range rows {
+		impressions += row.Impressions
+		spend += row.Spend
+	}
+	return impressions, spend
+}
+
+func pipelineEvent(campaignID uuid.UUID, day time.Time, impressions int64, spend float64) *models.CampaignEvent {
+	return &models.CampaignEvent{
+		ID:               uuid.New(),
+		CampaignID:       campaignID,
+		Platform:         models.PlatformMeta,
+		EventType:        "stats",
+		Impressions:      impressions,
+		Spend:            spend,
+		EventTime:        day,
+		LocalDate:        day,
+		Region:           "US",
+		Currency:         "USD",
+		DeduplicationKey: fmt.Sprintf("meta:%s:%s:US", campaignID, day.Format("2006-01-02")),
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := newPipeline(t)
+	stop := p.start(t)
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	campaignA, campaignB := uuid.New(), uuid.New()
+
+	// New snapshots are inserted
+	p.publish(t,
+		pipelineEvent(campaignA, day, 100, 10),
+		pipelineEvent(campaignB, day, 200, 20),
+	)
+	waitFor(t, "the first snapshots", func() bool {
+		impressionsA, spendA := p.spend(t, campaignA, day)
+		impressionsB, spendB := p.spend(t, campaignB, day)
+		return impressionsA == 100 && spendA == 10 && impressionsB == 200 && spendB == 20
+	})
+
+	// An unchanged snapshot is skipped, a restatement replaces the stored one
+	// and drops the cached insights, an undecodable message is dead-lettered
+	p.publish(t,
+		pipelineEvent(campaignA, day, 100, 10),
+		pipelineEvent(campaignA, day, 150, 15),
+	)
+	if err := p.bus.WriteMessages(context.Background(), bus.Message{
+		Topic: pipelineTopic,
+		Key:   []byte(campaignB.String()),
+		Value: []byte("{not json"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the restatement", func() bool {
+		impressions, spend := p.spend(t, campaignA, day)
+		return impressions == 150 && spend == 15
+	})
+	waitFor(t, "the dead letter", func() bool {
+		return len(p.bus.Messages(bus.DeadLetterTopic(pipelineTopic))) == 1
+	})
+
+	deadLetter := p.bus.Messages(bus.DeadLetterTopic(pipelineTopic))[0]
+	if string(deadLetter.Value) != "{not json" || bus.HeaderValue(deadLetter, bus.HeaderError) == "" {
+		t.Errorf("dead letter = %q with error %q, want the original payload and its error", deadLetter.Value, bus.HeaderValue(deadLetter, bus.HeaderError))
+	}
+	if impressions, spend := p.spend(t, campaignB, day); impressions != 200 || spend != 20 {
+		t.Errorf("campaign B = %d impressions, %v spend; want 200, 20", impressions, spend)
+	}
+
+	// Every message is committed by the time the worker has drained
+	stop()
+	if !committedAll(p.bus, "worker", pipelineTopic) {
+		t.Error("messages left uncommitted after shutdown")
+	}
+}
+
+// committedAll reports whether a consumer group has committed every message
+// of a topic, by joining it and looking for anything left to fetch
+func committedAll(b *bus.MemoryBus, group, topic string) bool {
+	member := b.Subscribe(group, []string{topic})
+	defer member.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := member.FetchMessage(ctx)
+	return err == context.DeadlineExceeded
+}
+
+func TestEventBatchAdd(t *testing.T) {
+	pending := func(key, hash string, unchanged bool) *PendingEvent {
+		return &PendingEvent{
+			Event:     models.CampaignEvent{DeduplicationKey: key},
+			Hash:      hash,
+			Unchanged: unchanged,
+		}
+	}
+	keysOf := func(b *eventBatch) string {
+		var keys []string
+		for i, event := range b.events {
+			key := event.Event.DeduplicationKey
+			if b.byKey[key] != i {
+				t.Errorf("byKey[%s] = %d, want %d", key, b.byKey[key], i)
+			}
+			keys = append(keys, key+"="+event.Hash)
+		}
+		return fmt.Sprint(keys)
+	}
+
+	b := (&Worker{}).newBatch()
+	b.add(pending("a", "a1", false))
+	b.add(pending("b", "b1", false))
+	b.add(pending("c", "c1", false))
+
+	// A later snapshot replaces the earlier one
+	b.add(pending("b", "b2", false))
+	if got := keysOf(b); got != "[a=a1 b=b2 c=c1]" {
+		t.Errorf("after a restatement: %s", got)
+	}
+
+	// A snapshot restated back to the stored one drops the pending one
+	b.add(pending("a", "a0", true))
+	if got := keysOf(b); got != "[b=b2 c=c1]" {
+		t.Errorf("after a restatement back to the stored snapshot: %s", got)
+	}
+
+	// Unchanged snapshots of keys not in the batch are not inserted
+	b.add(pending("d", "d0", true))
+	if got := keysOf(b); got != "[b=b2 c=c1]" {
+		t.Errorf("after an unchanged snapshot: %s", got)
+	}
+
+	// A key dropped from the batch can be queued again
+	b.add(pending("a", "a2", false))
+	if got := keysOf(b); got != "[b=b2 c=c1 a=a2]" {
+		t.Errorf("after re-adding a dropped key: %s", got)
+	}
+}
@@ -0,0 +1,54 @@
+package bus
+
+import (
+	"context"
+	"time"
+)
+
+// Message is a message of the bus, independent of the broker carrying it
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+	Time      time.Time
+}
+
+// Header is a message header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Publisher writes messages to topics
+type Publisher interface {
+	// WriteMessages writes messages, keeping their keys and headers. Messages
+	// with the same key land on the same partition and stay in order.
+	WriteMessages(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// Subscriber reads the topics of a consumer group. Messages are delivered at
+// least once: those not committed are redelivered to the group after a
+// restart or rebalance.
+type Subscriber interface {
+	// FetchMessage returns the next message without committing it
+	FetchMessage(ctx context.Context) (Message, error)
+	// CommitMessages commits each partition up to the given messages
+	CommitMessages(ctx context.Context, msgs ...Message) error
+	// Topics returns the topics the subscriber reads
+	Topics() []string
+	Close() error
+}
+
+// HeaderValue returns the value of the last header with the given key
+func HeaderValue(msg Message, key string) string {
+	for i := len(msg.Headers) - 1; i >= 0; i-- {
+		if msg.Headers[i].Key == key {
+			return string(msg.Headers[i].Value)
+		}
+	}
+	return ""
+}
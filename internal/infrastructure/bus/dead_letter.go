@@ -0,0 +1,110 @@
+package bus
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on dead-lettered messages
+const (
+	HeaderError             = "x-error"
+	HeaderAttempts          = "x-attempts"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderFailedAt          = "x-failed-at"
+	HeaderRedrivenFrom      = "x-redriven-from"
+)
+
+// DeadLetterTopic returns the dead-letter topic of a topic. Re-driven
+// messages that fail again go back to the dead-letter topic they came from.
+func DeadLetterTopic(topic string) string {
+	return strings.TrimSuffix(topic, redriveSuffix) + ".dlq"
+}
+
+// redriveSuffix names the topic re-driven dead letters are published to
+const redriveSuffix = ".redrive"
+
+// RedriveTopic returns the topic dead letters of a topic are re-driven to.
+// Keeping re-drive traffic apart lets it be consumed without delaying live events.
+func RedriveTopic(topic string) string {
+	return strings.TrimSuffix(topic, redriveSuffix) + redriveSuffix
+}
+
+// WithRedriveTopics returns topics followed by the re-drive topic of each one
+// not already listed, so the dead letters of every consumed topic can be
+// re-driven to a topic that is consumed too
+func WithRedriveTopics(topics []string) []string {
+	all := append([]string(nil), topics...)
+	listed := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		listed[topic] = true
+	}
+	for _, topic := range topics {
+		if redrive := RedriveTopic(topic); !listed[redrive] {
+			all = append(all, redrive)
+			listed[redrive] = true
+		}
+	}
+	return all
+}
+
+// NewDeadLetter wraps a message that could not be processed, addressed to the
+// dead-letter topic of its topic. The original key and payload are kept
+// as-is; the failure is described in headers.
+func NewDeadLetter(msg Message, cause error, attempts int) Message {
+	headers := append([]Header(nil), msg.Headers...)
+	headers = append(headers,
+		Header{Key: HeaderError, Value: []byte(cause.Error())},
+		Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(attempts))},
+		Header{Key: HeaderOriginalTopic, Value: []byte(msg.Topic)},
+		Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		Header{Key: HeaderFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	return Message{
+		Topic:   DeadLetterTopic(msg.Topic),
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+		Time:    time.Now(),
+	}
+}
+
+// deadLetterHeaders are the headers NewDeadLetter and NewRedrive add
+var deadLetterHeaders = map[string]bool{
+	HeaderError:             true,
+	HeaderAttempts:          true,
+	HeaderOriginalTopic:     true,
+	HeaderOriginalPartition: true,
+	HeaderOriginalOffset:    true,
+	HeaderFailedAt:          true,
+	HeaderRedrivenFrom:      true,
+}
+
+// NewRedrive unwraps a dead letter read from a dead-letter topic for
+// publishing to a re-drive topic. The original envelope headers, such as the
+// event type, schema version and content type the payload is decoded by, are
+// kept; the failure headers are replaced by one naming the dead letter.
+func NewRedrive(deadLetter Message, topic string) Message {
+	var headers []Header
+	for _, header := range deadLetter.Headers {
+		if !deadLetterHeaders[header.Key] {
+			headers = append(headers, header)
+		}
+	}
+	headers = append(headers, Header{
+		Key:   HeaderRedrivenFrom,
+		Value: []byte(deadLetter.Topic + "/" + strconv.Itoa(deadLetter.Partition) + "/" + strconv.FormatInt(deadLetter.Offset, 10)),
+	})
+
+	return Message{
+		Topic:   topic,
+		Key:     deadLetter.Key,
+		Value:   deadLetter.Value,
+		Headers: headers,
+		Time:    time.Now(),
+	}
+}
@@ -0,0 +1,42 @@
+package bus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithRedriveTopics(t *testing.T) {
+	tests := []struct {
+		name   string
+		topics []string
+		want   []string
+	}{
+		{
+			name:   "every topic gets its re-drive topic",
+			topics: []string{"campaign_events", "campaign_webhooks"},
+			want:   []string{"campaign_events", "campaign_webhooks", "campaign_events.redrive", "campaign_webhooks.redrive"},
+		},
+		{
+			name:   "listed re-drive topics are kept once",
+			topics: []string{"campaign_events", "campaign_events.redrive", "campaign_uploads"},
+			want:   []string{"campaign_events", "campaign_events.redrive", "campaign_uploads", "campaign_uploads.redrive"},
+		},
+		{
+			name:   "a re-drive topic alone is its own re-drive topic",
+			topics: []string{"campaign_events.redrive"},
+			want:   []string{"campaign_events.redrive"},
+		},
+		{
+			name: "no topics",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WithRedriveTopics(tt.topics); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithRedriveTopics(%v) = %v, want %v", tt.topics, got, tt.want)
+			}
+		})
+	}
+}
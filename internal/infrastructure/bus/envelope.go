@@ -0,0 +1,86 @@
+package bus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers describing the payload of a message
+const (
+	HeaderEventType     = "x-event-type"
+	HeaderSchemaVersion = "x-schema-version"
+	HeaderProducerID    = "x-producer-id"
+	HeaderContentType   = "content-type"
+	// HeaderTraceParent carries the W3C trace context of the producer
+	HeaderTraceParent = "traceparent"
+)
+
+// Envelope is the metadata of a message payload, carried in its headers so
+// consumers can pick a decoder before looking at the payload itself.
+// Messages produced before envelopes existed have none of these headers.
+type Envelope struct {
+	EventType     string
+	SchemaVersion int
+	ProducerID    string
+	ContentType   string
+	TraceParent   string
+}
+
+// Headers returns the envelope as message headers, omitting empty fields
+func (e Envelope) Headers() []Header {
+	headers := make([]Header, 0, 5)
+	add := func(key, value string) {
+		if value != "" {
+			headers = append(headers, Header{Key: key, Value: []byte(value)})
+		}
+	}
+
+	add(HeaderEventType, e.EventType)
+	if e.SchemaVersion > 0 {
+		add(HeaderSchemaVersion, strconv.Itoa(e.SchemaVersion))
+	}
+	add(HeaderProducerID, e.ProducerID)
+	add(HeaderContentType, e.ContentType)
+	add(HeaderTraceParent, e.TraceParent)
+	return headers
+}
+
+// EnvelopeFromMessage reads the envelope of a message. The schema version is
+// 0 when the message has none.
+func EnvelopeFromMessage(msg Message) Envelope {
+	version, _ := strconv.Atoi(HeaderValue(msg, HeaderSchemaVersion))
+	return Envelope{
+		EventType:     HeaderValue(msg, HeaderEventType),
+		SchemaVersion: version,
+		ProducerID:    HeaderValue(msg, HeaderProducerID),
+		ContentType:   HeaderValue(msg, HeaderContentType),
+		TraceParent:   HeaderValue(msg, HeaderTraceParent),
+	}
+}
+
+// traceParentKey is the context key of the trace parent
+type traceParentKey struct{}
+
+// ContextWithTraceParent returns a context carrying a W3C traceparent value,
+// which messages produced with it inherit
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, traceParent)
+}
+
+// TraceParentFromContext returns the traceparent carried by the context, or
+// a new root trace when there is none
+func TraceParentFromContext(ctx context.Context) string {
+	if traceParent, ok := ctx.Value(traceParentKey{}).(string); ok && traceParent != "" {
+		return traceParent
+	}
+	return NewTraceParent()
+}
+
+// NewTraceParent starts a new sampled W3C trace
+func NewTraceParent() string {
+	var ids [24]byte
+	_, _ = rand.Read(ids[:])
+	return "00-" + hex.EncodeToString(ids[:16]) + "-" + hex.EncodeToString(ids[16:]) + "-01"
+}
@@ -0,0 +1,281 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by a subscriber after Close
+var ErrClosed = errors.New("bus: subscriber closed")
+
+// MemoryBus is an in-process message bus with Kafka's delivery semantics:
+// keyed partitions, consumer groups with committed offsets, and redelivery
+// of uncommitted messages when a group's partitions are reassigned. It backs
+// tests and the single-process dev mode; nothing is persisted.
+type MemoryBus struct {
+	mu          sync.Mutex
+	partitions  int
+	logs        map[topicPartition][]Message
+	groups      map[string]*memoryGroup
+	nextKeyless int
+	// changed is closed and replaced whenever messages arrive or a group
+	// rebalances, waking up waiting subscribers
+	changed chan struct{}
+}
+
+// topicPartition identifies a partition of a topic
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// memoryGroup is a consumer group of a MemoryBus
+type memoryGroup struct {
+	committed map[topicPartition]int64
+	members   []*memorySubscriber
+	// generation changes on every join or leave, making members pick up
+	// their new partitions from the committed offsets
+	generation int
+}
+
+// NewMemoryBus creates an empty bus whose topics have the given number of partitions
+func NewMemoryBus(partitions int) *MemoryBus {
+	if partitions <= 0 {
+		partitions = 1
+	}
+
+	return &MemoryBus{
+		partitions: partitions,
+		logs:       make(map[topicPartition][]Message),
+		groups:     make(map[string]*memoryGroup),
+		changed:    make(chan struct{}),
+	}
+}
+
+// WriteMessages implements Publisher. Messages are appended to the partition
+// of their key; keyless messages are spread over the partitions.
+func (b *MemoryBus) WriteMessages(ctx context.Context, msgs ...Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range msgs {
+		if msg.Topic == "" {
+			return errors.New("bus: message without topic")
+		}
+
+		tp := topicPartition{topic: msg.Topic, partition: b.partitionFor(msg.Key)}
+		msg.Partition = tp.partition
+		msg.Offset = int64(len(b.logs[tp]))
+		if msg.Time.IsZero() {
+			msg.Time = time.Now()
+		}
+		b.logs[tp] = append(b.logs[tp], msg)
+	}
+
+	b.notify()
+	return nil
+}
+
+// Close implements Publisher. The bus itself stays usable.
+func (b *MemoryBus) Close() error {
+	return nil
+}
+
+// Messages returns every message written to a topic, by partition and offset
+func (b *MemoryBus) Messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []Message
+	for p := 0; p < b.partitions; p++ {
+		messages = append(messages, b.logs[topicPartition{topic: topic, partition: p}]...)
+	}
+	return messages
+}
+
+// Subscribe joins a consumer group for the given topics. The partitions of
+// each topic are shared among the group members subscribed to it, and a
+// member starts every partition it is assigned at the group's committed offset.
+func (b *MemoryBus) Subscribe(group string, topics []string) Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, exists := b.groups[group]
+	if !exists {
+		g = &memoryGroup{committed: make(map[topicPartition]int64)}
+		b.groups[group] = g
+	}
+
+	s := &memorySubscriber{
+		bus:        b,
+		group:      g,
+		topics:     topics,
+		generation: -1,
+	}
+	g.members = append(g.members, s)
+	g.generation++
+	b.notify()
+	return s
+}
+
+// partitionFor picks the partition of a message key. The caller holds b.mu.
+func (b *MemoryBus) partitionFor(key []byte) int {
+	if len(key) == 0 {
+		b.nextKeyless++
+		return b.nextKeyless % b.partitions
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(b.partitions))
+}
+
+// notify wakes up waiting subscribers. The caller holds b.mu.
+func (b *MemoryBus) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// memorySubscriber is a member of a MemoryBus consumer group
+type memorySubscriber struct {
+	bus        *MemoryBus
+	group      *memoryGroup
+	topics     []string
+	generation int
+	assigned   []topicPartition
+	positions  map[topicPartition]int64
+	next       int
+	closed     bool
+}
+
+// Topics implements Subscriber
+func (s *memorySubscriber) Topics() []string {
+	return s.topics
+}
+
+// FetchMessage implements Subscriber. Assigned partitions with a message
+// ready are served in turn.
+func (s *memorySubscriber) FetchMessage(ctx context.Context) (Message, error) {
+	for {
+		s.bus.mu.Lock()
+		if s.closed {
+			s.bus.mu.Unlock()
+			return Message{}, ErrClosed
+		}
+		if s.generation != s.group.generation {
+			s.rebalance()
+		}
+
+		msg, ok := s.take()
+		changed := s.bus.changed
+		s.bus.mu.Unlock()
+
+		if ok {
+			return msg, nil
+		}
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// CommitMessages implements Subscriber
+func (s *memorySubscriber) CommitMessages(ctx context.Context, msgs ...Message) error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	for _, msg := range msgs {
+		tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+		if msg.Offset+1 > s.group.committed[tp] {
+			s.group.committed[tp] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+// Close implements Subscriber. The member leaves its group, whose remaining
+// members take over its partitions from the committed offsets.
+func (s *memorySubscriber) Close() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	members := s.group.members[:0]
+	for _, member := range s.group.members {
+		if member != s {
+			members = append(members, member)
+		}
+	}
+	s.group.members = members
+	s.group.generation++
+	s.bus.notify()
+	return nil
+}
+
+// rebalance recomputes the partitions of the member and restarts them at the
+// committed offsets, so messages fetched but not committed are redelivered.
+// The caller holds the bus lock.
+func (s *memorySubscriber) rebalance() {
+	s.assigned = s.assigned[:0]
+	s.positions = make(map[topicPartition]int64)
+
+	for _, topic := range s.topics {
+		// Members subscribed to the topic, in join order
+		var members []*memorySubscriber
+		for _, member := range s.group.members {
+			for _, t := range member.topics {
+				if t == topic {
+					members = append(members, member)
+					break
+				}
+			}
+		}
+
+		for p := 0; p < s.bus.partitions; p++ {
+			if members[p%len(members)] != s {
+				continue
+			}
+			tp := topicPartition{topic: topic, partition: p}
+			s.assigned = append(s.assigned, tp)
+			s.positions[tp] = s.group.committed[tp]
+		}
+	}
+
+	s.generation = s.group.generation
+	s.next = 0
+}
+
+// take returns the next ready message of the assigned partitions, if any.
+// The caller holds the bus lock.
+func (s *memorySubscriber) take() (Message, bool) {
+	for i := 0; i < len(s.assigned); i++ {
+		idx := (s.next + i) % len(s.assigned)
+		tp := s.assigned[idx]
+		log := s.bus.logs[tp]
+		position := s.positions[tp]
+		if position >= int64(len(log)) {
+			continue
+		}
+
+		s.positions[tp] = position + 1
+		s.next = (idx + 1) % len(s.assigned)
+		return log[position], true
+	}
+	return Message{}, false
+}
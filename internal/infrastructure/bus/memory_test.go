@@ -0,0 +1,162 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const testTopic = "campaign-events"
+
+// drain fetches messages until none arrives for a while
+func drain(t *testing.T, s Subscriber) []Message {
+	t.Helper()
+	var msgs []Message
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		msg, err := s.FetchMessage(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return msgs
+		}
+		if err != nil {
+			t.Fatalf("FetchMessage: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// write writes n messages for each key, interleaving the keys
+func write(t *testing.T, b *MemoryBus, keys []string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		for _, key := range keys {
+			msg := Message{Topic: testTopic, Key: []byte(key), Value: []byte(fmt.Sprintf("%s-%d", key, i))}
+			if err := b.WriteMessages(context.Background(), msg); err != nil {
+				t.Fatalf("WriteMessages: %v", err)
+			}
+		}
+	}
+}
+
+// partitionsOf returns the partitions messages came from
+func partitionsOf(msgs []Message) map[int]bool {
+	partitions := make(map[int]bool)
+	for _, msg := range msgs {
+		partitions[msg.Partition] = true
+	}
+	return partitions
+}
+
+func TestMemoryBusKeyOrdering(t *testing.T) {
+	b := NewMemoryBus(4)
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	write(t, b, keys, 10)
+
+	s := b.Subscribe("group", []string{testTopic})
+	defer s.Close()
+	msgs := drain(t, s)
+	if len(msgs) != len(keys)*10 {
+		t.Fatalf("fetched %d messages, want %d", len(msgs), len(keys)*10)
+	}
+
+	partitionOf := make(map[string]int)
+	seen := make(map[string]int)
+	for _, msg := range msgs {
+		key := string(msg.Key)
+		if p, exists := partitionOf[key]; exists && p != msg.Partition {
+			t.Errorf("key %s on partitions %d and %d", key, p, msg.Partition)
+		}
+		partitionOf[key] = msg.Partition
+
+		if want := fmt.Sprintf("%s-%d", key, seen[key]); string(msg.Value) != want {
+			t.Errorf("key %s: got %s, want %s", key, msg.Value, want)
+		}
+		seen[key]++
+	}
+	if len(partitionsOf(msgs)) < 2 {
+		t.Errorf("keys all landed on one partition of 4")
+	}
+}
+
+func TestMemoryBusRedeliveryAfterClose(t *testing.T) {
+	b := NewMemoryBus(1)
+	write(t, b, []string{"a"}, 5)
+	ctx := context.Background()
+
+	first := b.Subscribe("group", []string{testTopic})
+	msgs := drain(t, first)
+	if len(msgs) != 5 {
+		t.Fatalf("fetched %d messages, want 5", len(msgs))
+	}
+	if err := first.CommitMessages(ctx, msgs[1]); err != nil {
+		t.Fatalf("CommitMessages: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := first.FetchMessage(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("FetchMessage after Close = %v, want ErrClosed", err)
+	}
+
+	// The next member resumes after the last committed message
+	second := b.Subscribe("group", []string{testTopic})
+	defer second.Close()
+	redelivered := drain(t, second)
+	if len(redelivered) != 3 || redelivered[0].Offset != 2 {
+		t.Fatalf("redelivered %d messages from offset %d, want 3 from offset 2", len(redelivered), redelivered[0].Offset)
+	}
+
+	// Other groups read from the start
+	other := b.Subscribe("other", []string{testTopic})
+	defer other.Close()
+	if n := len(drain(t, other)); n != 5 {
+		t.Errorf("other group fetched %d messages, want 5", n)
+	}
+}
+
+func TestMemoryBusRebalance(t *testing.T) {
+	b := NewMemoryBus(4)
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	write(t, b, keys, 3)
+	ctx := context.Background()
+
+	first := b.Subscribe("group", []string{testTopic})
+	defer first.Close()
+	second := b.Subscribe("group", []string{testTopic})
+
+	// The members share the partitions
+	firstMsgs, secondMsgs := drain(t, first), drain(t, second)
+	if total := len(firstMsgs) + len(secondMsgs); total != len(keys)*3 {
+		t.Fatalf("fetched %d messages, want %d", total, len(keys)*3)
+	}
+	for p := range partitionsOf(firstMsgs) {
+		if partitionsOf(secondMsgs)[p] {
+			t.Errorf("partition %d assigned to both members", p)
+		}
+	}
+	if len(firstMsgs) == 0 || len(secondMsgs) == 0 {
+		t.Fatalf("members fetched %d and %d messages, want both to get partitions", len(firstMsgs), len(secondMsgs))
+	}
+
+	// The first member commits, the second leaves without committing
+	if err := first.CommitMessages(ctx, firstMsgs...); err != nil {
+		t.Fatalf("CommitMessages: %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The first member takes over and gets the uncommitted messages again
+	redelivered := drain(t, first)
+	if len(redelivered) != len(secondMsgs) {
+		t.Fatalf("redelivered %d messages, want the %d the second member did not commit", len(redelivered), len(secondMsgs))
+	}
+	for p := range partitionsOf(redelivered) {
+		if !partitionsOf(secondMsgs)[p] {
+			t.Errorf("partition %d redelivered but was committed", p)
+		}
+	}
+}
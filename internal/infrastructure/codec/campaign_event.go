@@ -0,0 +1,366 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/schema"
+)
+
+// EventTypeCampaignEvent is the envelope event type of campaign events
+const EventTypeCampaignEvent = "campaign_event"
+
+// Content types of encoded payloads
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Encodings new events can be written with
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// Schema versions of campaign events. Version 1 is the original payload,
+// a JSON-encoded models.CampaignEvent without any headers. Version 2 carries
+// money as integer micros so amounts survive encoding exactly.
+const (
+	CampaignEventV1 = 1
+	CampaignEventV2 = 2
+
+	// CurrentCampaignEventVersion is the version new events are written with
+	CurrentCampaignEventVersion = CampaignEventV2
+)
+
+// localDateLayout is the format of the local day of an event in payloads
+const localDateLayout = "2006-01-02"
+
+// DecodeError is returned for payloads that can never be decoded, as opposed
+// to failures to reach the schema registry
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string { return "decode campaign event: " + e.Err.Error() }
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// CampaignEventCodec encodes campaign events into Kafka messages with an
+// envelope in their headers, and decodes every schema version still in
+// flight, including messages written before envelopes existed.
+type CampaignEventCodec struct {
+	encoding   string
+	registry   schema.Registry
+	producerID string
+}
+
+// NewCampaignEventCodec creates a codec writing with the encoding configured
+// under kafka.producer.encoding. Protobuf payloads reference their schema in
+// the registry, so that encoding requires one; registry may be nil otherwise.
+func NewCampaignEventCodec(registry schema.Registry) (*CampaignEventCodec, error) {
+	encoding := viper.GetString("kafka.producer.encoding")
+
+	// Use defaults if not provided
+	if encoding == "" {
+		encoding = EncodingJSON
+	}
+
+	switch encoding {
+	case EncodingJSON:
+	case EncodingProtobuf:
+		if registry == nil {
+			return nil, errors.New("protobuf encoding requires kafka.schema_registry.url")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported event encoding %q", encoding)
+	}
+
+	return &CampaignEventCodec{
+		encoding:   encoding,
+		registry:   registry,
+		producerID: producerID(),
+	}, nil
+}
+
+// Encode builds the message of an event for a topic, keyed by campaign. The
+// trace context of ctx, or a new trace, is propagated in the headers.
+func (c *CampaignEventCodec) Encode(ctx context.Context, topic string, event *models.CampaignEvent) (bus.Message, error) {
+	envelope := bus.Envelope{
+		EventType:     EventTypeCampaignEvent,
+		SchemaVersion: CurrentCampaignEventVersion,
+		ProducerID:    c.producerID,
+		TraceParent:   bus.TraceParentFromContext(ctx),
+	}
+
+	var value []byte
+	switch c.encoding {
+	case EncodingProtobuf:
+		// Subjects follow the registry's default topic name strategy
+		schemaID, err := c.registry.Register(ctx, topic+"-value", schema.TypeProtobuf, campaignEventProtoV2)
+		if err != nil {
+			return bus.Message{}, fmt.Errorf("register schema: %w", err)
+		}
+		envelope.ContentType = ContentTypeProtobuf
+		value = schema.FrameProtobuf(schemaID, marshalCampaignEventProto(event))
+	default:
+		data, err := json.Marshal(newCampaignEventJSONV2(event))
+		if err != nil {
+			return bus.Message{}, err
+		}
+		envelope.ContentType = ContentTypeJSON
+		value = data
+	}
+
+	return bus.Message{
+		Key:     []byte(event.CampaignID.String()),
+		Value:   value,
+		Headers: envelope.Headers(),
+		Time:    time.Now(),
+	}, nil
+}
+
+// Decode reads the event of a message. The envelope selects the decoder;
+// messages without one are version 1 JSON. Undecodable payloads are returned
+// as *DecodeError.
+func (c *CampaignEventCodec) Decode(ctx context.Context, msg bus.Message) (*models.CampaignEvent, error) {
+	envelope := bus.EnvelopeFromMessage(msg)
+	if envelope.EventType != "" && envelope.EventType != EventTypeCampaignEvent {
+		return nil, &DecodeError{Err: fmt.Errorf("unexpected event type %q", envelope.EventType)}
+	}
+
+	version := envelope.SchemaVersion
+	if version == 0 {
+		version = CampaignEventV1
+	}
+	contentType := envelope.ContentType
+	if contentType == "" {
+		contentType = ContentTypeJSON
+		if schema.IsFramed(msg.Value) {
+			contentType = ContentTypeProtobuf
+		}
+	}
+
+	switch contentType {
+	case ContentTypeJSON:
+		return decodeCampaignEventJSON(version, msg.Value)
+	case ContentTypeProtobuf:
+		return c.decodeProtobuf(ctx, version, msg.Value)
+	default:
+		return nil, &DecodeError{Err: fmt.Errorf("unsupported content type %q", contentType)}
+	}
+}
+
+// decodeProtobuf decodes a framed Protobuf payload after checking its schema
+// ID against the registry
+func (c *CampaignEventCodec) decodeProtobuf(ctx context.Context, version int, data []byte) (*models.CampaignEvent, error) {
+	if c.registry == nil {
+		return nil, &DecodeError{Err: errors.New("protobuf payload but no schema registry configured")}
+	}
+
+	schemaID, indexes, payload, err := schema.UnframeProtobuf(data)
+	if err != nil {
+		return nil, &DecodeError{Err: err}
+	}
+	registered, err := c.registry.Lookup(ctx, schemaID)
+	if err != nil {
+		if errors.Is(err, schema.ErrSchemaNotFound) {
+			return nil, &DecodeError{Err: fmt.Errorf("schema %d: %w", schemaID, err)}
+		}
+		return nil, err
+	}
+	if registered.Type != schema.TypeProtobuf {
+		return nil, &DecodeError{Err: fmt.Errorf("schema %d is %s, not %s", schemaID, registered.Type, schema.TypeProtobuf)}
+	}
+	if len(indexes) != 1 || indexes[0] != 0 {
+		return nil, &DecodeError{Err: fmt.Errorf("unexpected message index path %v", indexes)}
+	}
+
+	if version != CampaignEventV2 {
+		return nil, &DecodeError{Err: fmt.Errorf("unsupported protobuf schema version %d", version)}
+	}
+	event, err := unmarshalCampaignEventProto(payload)
+	if err != nil {
+		return nil, &DecodeError{Err: err}
+	}
+	return event, nil
+}
+
+// decodeCampaignEventJSON decodes a JSON payload of the given schema version
+func decodeCampaignEventJSON(version int, data []byte) (*models.CampaignEvent, error) {
+	switch version {
+	case CampaignEventV1:
+		var v1 campaignEventJSONV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, &DecodeError{Err: err}
+		}
+		return v1.event(), nil
+	case CampaignEventV2:
+		var v2 campaignEventJSONV2
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, &DecodeError{Err: err}
+		}
+		event, err := v2.event()
+		if err != nil {
+			return nil, &DecodeError{Err: err}
+		}
+		return event, nil
+	default:
+		return nil, &DecodeError{Err: fmt.Errorf("unsupported schema version %d", version)}
+	}
+}
+
+// campaignEventJSONV1 is the original payload. It is frozen here so changes
+// to models.CampaignEvent do not change how old messages are read.
+type campaignEventJSONV1 struct {
+	ID               uuid.UUID `json:"id"`
+	CampaignID       uuid.UUID `json:"campaign_id"`
+	Platform         string    `json:"platform"`
+	EventType        string    `json:"event_type"`
+	Impressions      int64     `json:"impressions"`
+	Clicks           int64     `json:"clicks"`
+	Conversions      int64     `json:"conversions"`
+	Spend            float64   `json:"spend"`
+	Revenue          float64   `json:"revenue"`
+	EventTime        time.Time `json:"event_time"`
+	Region           string    `json:"region"`
+	Currency         string    `json:"currency"`
+	DeduplicationKey string    `json:"deduplication_key"`
+	ReceivedAt       time.Time `json:"received_at"`
+}
+
+func (v *campaignEventJSONV1) event() *models.CampaignEvent {
+	return &models.CampaignEvent{
+		ID:               v.ID,
+		CampaignID:       v.CampaignID,
+		Platform:         models.Platform(v.Platform),
+		EventType:        v.EventType,
+		Impressions:      v.Impressions,
+		Clicks:           v.Clicks,
+		Conversions:      v.Conversions,
+		Spend:            v.Spend,
+		Revenue:          v.Revenue,
+		EventTime:        v.EventTime,
+		Region:           v.Region,
+		Currency:         v.Currency,
+		DeduplicationKey: v.DeduplicationKey,
+		ReceivedAt:       v.ReceivedAt,
+	}
+}
+
+// campaignEventJSONV2 is the version 2 JSON payload. LocalDate and Placement
+// were added later and are empty in older messages.
+type campaignEventJSONV2 struct {
+	ID               uuid.UUID `json:"id"`
+	CampaignID       uuid.UUID `json:"campaign_id"`
+	Platform         string    `json:"platform"`
+	EventType        string    `json:"event_type"`
+	Impressions      int64     `json:"impressions"`
+	Clicks           int64     `json:"clicks"`
+	Conversions      int64     `json:"conversions"`
+	SpendMicros      int64     `json:"spend_micros"`
+	RevenueMicros    int64     `json:"revenue_micros"`
+	EventTime        time.Time `json:"event_time"`
+	LocalDate        string    `json:"local_date,omitempty"`
+	Region           string    `json:"region"`
+	Placement        string    `json:"placement,omitempty"`
+	Currency         string    `json:"currency"`
+	DeduplicationKey string    `json:"deduplication_key"`
+	ReceivedAt       time.Time `json:"received_at"`
+}
+
+func newCampaignEventJSONV2(event *models.CampaignEvent) *campaignEventJSONV2 {
+	return &campaignEventJSONV2{
+		ID:               event.ID,
+		CampaignID:       event.CampaignID,
+		Platform:         string(event.Platform),
+		EventType:        event.EventType,
+		Impressions:      event.Impressions,
+		Clicks:           event.Clicks,
+		Conversions:      event.Conversions,
+		SpendMicros:      toMicros(event.Spend),
+		RevenueMicros:    toMicros(event.Revenue),
+		EventTime:        event.EventTime,
+		LocalDate:        formatLocalDate(event.LocalDate),
+		Region:           event.Region,
+		Placement:        event.Placement,
+		Currency:         event.Currency,
+		DeduplicationKey: event.DeduplicationKey,
+		ReceivedAt:       event.ReceivedAt,
+	}
+}
+
+func (v *campaignEventJSONV2) event() (*models.CampaignEvent, error) {
+	localDate, err := parseLocalDate(v.LocalDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CampaignEvent{
+		ID:               v.ID,
+		CampaignID:       v.CampaignID,
+		Platform:         models.Platform(v.Platform),
+		EventType:        v.EventType,
+		Impressions:      v.Impressions,
+		Clicks:           v.Clicks,
+		Conversions:      v.Conversions,
+		Spend:            fromMicros(v.SpendMicros),
+		Revenue:          fromMicros(v.RevenueMicros),
+		EventTime:        v.EventTime,
+		LocalDate:        localDate,
+		Region:           v.Region,
+		Placement:        v.Placement,
+		Currency:         v.Currency,
+		DeduplicationKey: v.DeduplicationKey,
+		ReceivedAt:       v.ReceivedAt,
+	}, nil
+}
+
+// producerID returns the configured producer ID, or the hostname
+func producerID() string {
+	id := viper.GetString("kafka.producer.id")
+	if id == "" {
+		id, _ = os.Hostname()
+	}
+	return id
+}
+
+// formatLocalDate formats the local day of an event as YYYY-MM-DD, "" for
+// the zero time
+func formatLocalDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format(localDateLayout)
+}
+
+// parseLocalDate parses a day formatted by formatLocalDate
+func parseLocalDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(localDateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid local date %q", s)
+	}
+	return date, nil
+}
+
+// toMicros converts an amount to millionths of the currency unit
+func toMicros(amount float64) int64 {
+	return int64(math.Round(amount * 1e6))
+}
+
+// fromMicros converts millionths of the currency unit to an amount
+func fromMicros(micros int64) float64 {
+	return float64(micros) / 1e6
+}
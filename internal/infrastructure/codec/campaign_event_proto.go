@@ -0,0 +1,220 @@
+package codec
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// campaignEventProtoV2 is the Protobuf schema of version 2 campaign events,
+// as registered with the schema registry. Field numbers must never be reused;
+// marshalCampaignEventProto and unmarshalCampaignEventProto follow it.
+const campaignEventProtoV2 = `syntax = "proto3";
+
+package campaign_analytics.events.v2;
+
+message CampaignEvent {
+  string id = 1;
+  string campaign_id = 2;
+  string platform = 3;
+  string event_type = 4;
+  int64 impressions = 5;
+  int64 clicks = 6;
+  int64 conversions = 7;
+  int64 spend_micros = 8;
+  int64 revenue_micros = 9;
+  int64 event_time_unix_ms = 10;
+  string region = 11;
+  string currency = 12;
+  string deduplication_key = 13;
+  int64 received_at_unix_ms = 14;
+  string local_date = 15;
+  string placement = 16;
+}
+`
+
+// Field numbers of campaignEventProtoV2
+const (
+	protoFieldID               protowire.Number = 1
+	protoFieldCampaignID       protowire.Number = 2
+	protoFieldPlatform         protowire.Number = 3
+	protoFieldEventType        protowire.Number = 4
+	protoFieldImpressions      protowire.Number = 5
+	protoFieldClicks           protowire.Number = 6
+	protoFieldConversions      protowire.Number = 7
+	protoFieldSpendMicros      protowire.Number = 8
+	protoFieldRevenueMicros    protowire.Number = 9
+	protoFieldEventTime        protowire.Number = 10
+	protoFieldRegion           protowire.Number = 11
+	protoFieldCurrency         protowire.Number = 12
+	protoFieldDeduplicationKey protowire.Number = 13
+	protoFieldReceivedAt       protowire.Number = 14
+	protoFieldLocalDate        protowire.Number = 15
+	protoFieldPlacement        protowire.Number = 16
+)
+
+// marshalCampaignEventProto encodes an event as a campaignEventProtoV2
+// message. As in proto3, zero values are omitted.
+func marshalCampaignEventProto(event *models.CampaignEvent) []byte {
+	var b []byte
+	appendString := func(num protowire.Number, value string) {
+		if value != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, value)
+		}
+	}
+	appendInt := func(num protowire.Number, value int64) {
+		if value != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(value))
+		}
+	}
+
+	appendString(protoFieldID, event.ID.String())
+	appendString(protoFieldCampaignID, event.CampaignID.String())
+	appendString(protoFieldPlatform, string(event.Platform))
+	appendString(protoFieldEventType, event.EventType)
+	appendInt(protoFieldImpressions, event.Impressions)
+	appendInt(protoFieldClicks, event.Clicks)
+	appendInt(protoFieldConversions, event.Conversions)
+	appendInt(protoFieldSpendMicros, toMicros(event.Spend))
+	appendInt(protoFieldRevenueMicros, toMicros(event.Revenue))
+	appendInt(protoFieldEventTime, unixMilli(event.EventTime))
+	appendString(protoFieldRegion, event.Region)
+	appendString(protoFieldCurrency, event.Currency)
+	appendString(protoFieldDeduplicationKey, event.DeduplicationKey)
+	appendInt(protoFieldReceivedAt, unixMilli(event.ReceivedAt))
+	appendString(protoFieldLocalDate, formatLocalDate(event.LocalDate))
+	appendString(protoFieldPlacement, event.Placement)
+	return b
+}
+
+// unmarshalCampaignEventProto decodes a campaignEventProtoV2 message.
+// Unknown fields, added by newer producers, are skipped.
+func unmarshalCampaignEventProto(b []byte) (*models.CampaignEvent, error) {
+	event := &models.CampaignEvent{}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case typ == protowire.BytesType && isProtoStringField(num):
+			value, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			if err := setProtoString(event, num, value); err != nil {
+				return nil, err
+			}
+
+		case typ == protowire.VarintType && isProtoIntField(num):
+			value, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			setProtoInt(event, num, int64(value))
+
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	return event, nil
+}
+
+// isProtoStringField reports whether a field number holds a string
+func isProtoStringField(num protowire.Number) bool {
+	switch num {
+	case protoFieldID, protoFieldCampaignID, protoFieldPlatform, protoFieldEventType,
+		protoFieldRegion, protoFieldCurrency, protoFieldDeduplicationKey, protoFieldLocalDate,
+		protoFieldPlacement:
+		return true
+	}
+	return false
+}
+
+// isProtoIntField reports whether a field number holds an int64
+func isProtoIntField(num protowire.Number) bool {
+	switch num {
+	case protoFieldImpressions, protoFieldClicks, protoFieldConversions, protoFieldSpendMicros,
+		protoFieldRevenueMicros, protoFieldEventTime, protoFieldReceivedAt:
+		return true
+	}
+	return false
+}
+
+// setProtoString sets the string field of an event
+func setProtoString(event *models.CampaignEvent, num protowire.Number, value string) error {
+	switch num {
+	case protoFieldID, protoFieldCampaignID:
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+		if num == protoFieldID {
+			event.ID = id
+		} else {
+			event.CampaignID = id
+		}
+	case protoFieldPlatform:
+		event.Platform = models.Platform(value)
+	case protoFieldEventType:
+		event.EventType = value
+	case protoFieldRegion:
+		event.Region = value
+	case protoFieldPlacement:
+		event.Placement = value
+	case protoFieldCurrency:
+		event.Currency = value
+	case protoFieldDeduplicationKey:
+		event.DeduplicationKey = value
+	case protoFieldLocalDate:
+		date, err := parseLocalDate(value)
+		if err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+		event.LocalDate = date
+	}
+	return nil
+}
+
+// setProtoInt sets the int64 field of an event
+func setProtoInt(event *models.CampaignEvent, num protowire.Number, value int64) {
+	switch num {
+	case protoFieldImpressions:
+		event.Impressions = value
+	case protoFieldClicks:
+		event.Clicks = value
+	case protoFieldConversions:
+		event.Conversions = value
+	case protoFieldSpendMicros:
+		event.Spend = fromMicros(value)
+	case protoFieldRevenueMicros:
+		event.Revenue = fromMicros(value)
+	case protoFieldEventTime:
+		event.EventTime = time.UnixMilli(value).UTC()
+	case protoFieldReceivedAt:
+		event.ReceivedAt = time.UnixMilli(value).UTC()
+	}
+}
+
+// unixMilli returns a time in milliseconds since the epoch, 0 for the zero time
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,321 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/schema"
+)
+
+const testTopic = "campaign-events"
+
+func testEvent() *models.CampaignEvent {
+	return &models.CampaignEvent{
+		ID:               uuid.New(),
+		CampaignID:       uuid.New(),
+		Platform:         models.PlatformGoogle,
+		EventType:        "insights",
+		Impressions:      1200,
+		Clicks:           34,
+		Conversions:      5,
+		Spend:            12.345678,
+		Revenue:          99.99,
+		EventTime:        time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		LocalDate:        time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Region:           "US",
+		Placement:        "search",
+		Currency:         "USD",
+		DeduplicationKey: "google:123:2024-03-01",
+		ReceivedAt:       time.Date(2024, 3, 2, 8, 30, 0, 0, time.UTC),
+	}
+}
+
+// newTestCodec creates a codec writing with an encoding
+func newTestCodec(t *testing.T, encoding string, registry schema.Registry) *CampaignEventCodec {
+	t.Helper()
+	viper.Set("kafka.producer.encoding", encoding)
+	t.Cleanup(func() { viper.Set("kafka.producer.encoding", "") })
+
+	codec, err := NewCampaignEventCodec(registry)
+	if err != nil {
+		t.Fatalf("NewCampaignEventCodec(%s): %v", encoding, err)
+	}
+	return codec
+}
+
+func assertEvent(t *testing.T, got, want *models.CampaignEvent) {
+	t.Helper()
+	if got.ID != want.ID || got.CampaignID != want.CampaignID || got.Platform != want.Platform || got.EventType != want.EventType {
+		t.Errorf("identity = %v/%v/%s/%s, want %v/%v/%s/%s", got.ID, got.CampaignID, got.Platform, got.EventType, want.ID, want.CampaignID, want.Platform, want.EventType)
+	}
+	if got.Impressions != want.Impressions || got.Clicks != want.Clicks || got.Conversions != want.Conversions {
+		t.Errorf("counts = %d/%d/%d, want %d/%d/%d", got.Impressions, got.Clicks, got.Conversions, want.Impressions, want.Clicks, want.Conversions)
+	}
+	if got.Spend != want.Spend || got.Revenue != want.Revenue {
+		t.Errorf("spend/revenue = %v/%v, want %v/%v", got.Spend, got.Revenue, want.Spend, want.Revenue)
+	}
+	if !got.EventTime.Equal(want.EventTime) || !got.ReceivedAt.Equal(want.ReceivedAt) || !got.LocalDate.Equal(want.LocalDate) {
+		t.Errorf("times = %v/%v/%v, want %v/%v/%v", got.EventTime, got.ReceivedAt, got.LocalDate, want.EventTime, want.ReceivedAt, want.LocalDate)
+	}
+	if got.Region != want.Region || got.Placement != want.Placement || got.Currency != want.Currency || got.DeduplicationKey != want.DeduplicationKey {
+		t.Errorf("region/placement/currency/key = %s/%s/%s/%s, want %s/%s/%s/%s", got.Region, got.Placement, got.Currency, got.DeduplicationKey, want.Region, want.Placement, want.Currency, want.DeduplicationKey)
+	}
+}
+
+func assertDecodeError(t *testing.T, err error) *DecodeError {
+	t.Helper()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("error = %v, want a *DecodeError", err)
+	}
+	return decodeErr
+}
+
+func TestJSONV2RoundTrip(t *testing.T) {
+	ctx := bus.ContextWithTraceParent(context.Background(), bus.NewTraceParent())
+	codec := newTestCodec(t, EncodingJSON, nil)
+	event := testEvent()
+
+	msg, err := codec.Encode(ctx, testTopic, event)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if string(msg.Key) != event.CampaignID.String() {
+		t.Errorf("key = %s, want the campaign ID", msg.Key)
+	}
+	envelope := bus.EnvelopeFromMessage(msg)
+	if envelope.EventType != EventTypeCampaignEvent || envelope.SchemaVersion != CampaignEventV2 || envelope.ContentType != ContentTypeJSON {
+		t.Errorf("envelope = %+v, want a version 2 JSON campaign event", envelope)
+	}
+	if envelope.TraceParent != bus.TraceParentFromContext(ctx) {
+		t.Errorf("traceparent = %q, want the one of the context", envelope.TraceParent)
+	}
+
+	// Money travels as micros
+	var payload map[string]interface{}
+	if err := json.Unmarshal(msg.Value, &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if payload["spend_micros"] != float64(12345678) {
+		t.Errorf("spend_micros = %v, want 12345678", payload["spend_micros"])
+	}
+
+	decoded, err := codec.Decode(ctx, msg)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	assertEvent(t, decoded, event)
+}
+
+func TestJSONV1(t *testing.T) {
+	ctx := context.Background()
+	codec := newTestCodec(t, EncodingJSON, nil)
+	event := testEvent()
+	event.LocalDate = time.Time{} // not in version 1
+	event.Placement = ""
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("WithoutEnvelope", func(t *testing.T) {
+		decoded, err := codec.Decode(ctx, bus.Message{Value: data})
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		assertEvent(t, decoded, event)
+	})
+
+	t.Run("WithEnvelope", func(t *testing.T) {
+		msg := bus.Message{
+			Value: data,
+			Headers: bus.Envelope{
+				EventType:     EventTypeCampaignEvent,
+				SchemaVersion: CampaignEventV1,
+				ContentType:   ContentTypeJSON,
+			}.Headers(),
+		}
+		decoded, err := codec.Decode(ctx, msg)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		assertEvent(t, decoded, event)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := codec.Decode(ctx, bus.Message{Value: []byte(`{"spend":`)})
+		assertDecodeError(t, err)
+	})
+}
+
+func TestJSONUnsupportedEnvelope(t *testing.T) {
+	ctx := context.Background()
+	codec := newTestCodec(t, EncodingJSON, nil)
+	msg, err := codec.Encode(ctx, testTopic, testEvent())
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	for name, envelope := range map[string]bus.Envelope{
+		"EventType":     {EventType: "lifecycle_event", SchemaVersion: CampaignEventV2, ContentType: ContentTypeJSON},
+		"SchemaVersion": {EventType: EventTypeCampaignEvent, SchemaVersion: 99, ContentType: ContentTypeJSON},
+		"ContentType":   {EventType: EventTypeCampaignEvent, SchemaVersion: CampaignEventV2, ContentType: "application/avro"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := codec.Decode(ctx, bus.Message{Value: msg.Value, Headers: envelope.Headers()})
+			assertDecodeError(t, err)
+		})
+	}
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	registry := schema.NewMemoryRegistry()
+	codec := newTestCodec(t, EncodingProtobuf, registry)
+	event := testEvent()
+
+	msg, err := codec.Encode(ctx, testTopic, event)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	envelope := bus.EnvelopeFromMessage(msg)
+	if envelope.SchemaVersion != CampaignEventV2 || envelope.ContentType != ContentTypeProtobuf {
+		t.Errorf("envelope = %+v, want a version 2 Protobuf campaign event", envelope)
+	}
+
+	// The payload is framed with the ID the schema was registered under
+	schemaID, indexes, _, err := schema.UnframeProtobuf(msg.Value)
+	if err != nil {
+		t.Fatalf("UnframeProtobuf: %v", err)
+	}
+	registered, err := registry.Lookup(ctx, schemaID)
+	if err != nil {
+		t.Fatalf("Lookup(%d): %v", schemaID, err)
+	}
+	if registered.Type != schema.TypeProtobuf || registered.Definition != campaignEventProtoV2 {
+		t.Errorf("schema %d = %s %q, want the version 2 Protobuf schema", schemaID, registered.Type, registered.Definition)
+	}
+	if len(indexes) != 1 || indexes[0] != 0 {
+		t.Errorf("message indexes = %v, want [0]", indexes)
+	}
+
+	// Registering again keeps the ID
+	again, err := codec.Encode(ctx, testTopic, event)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if againID, _, _, _ := schema.UnframeProtobuf(again.Value); againID != schemaID {
+		t.Errorf("schema ID = %d on the second event, want %d", againID, schemaID)
+	}
+
+	decoded, err := codec.Decode(ctx, msg)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	assertEvent(t, decoded, event)
+
+	t.Run("WithoutContentType", func(t *testing.T) {
+		// Framed payloads are recognized without a content type
+		headers := bus.Envelope{EventType: EventTypeCampaignEvent, SchemaVersion: CampaignEventV2}.Headers()
+		decoded, err := codec.Decode(ctx, bus.Message{Value: msg.Value, Headers: headers})
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		assertEvent(t, decoded, event)
+	})
+
+	t.Run("JSONCodecReadsProtobuf", func(t *testing.T) {
+		// Consumers decode whatever producers write, given the registry
+		jsonCodec := newTestCodec(t, EncodingJSON, registry)
+		decoded, err := jsonCodec.Decode(ctx, msg)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		assertEvent(t, decoded, event)
+	})
+
+	t.Run("Redriven", func(t *testing.T) {
+		// The envelope survives a round trip through the dead letter topic
+		deadLetter := bus.NewDeadLetter(msg, errors.New("boom"), 3)
+		deadLetter.Topic = bus.DeadLetterTopic(testTopic)
+		decoded, err := codec.Decode(ctx, bus.NewRedrive(deadLetter, bus.RedriveTopic(testTopic)))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		assertEvent(t, decoded, event)
+	})
+}
+
+func TestProtobufSchemaIDs(t *testing.T) {
+	ctx := context.Background()
+	registry := schema.NewMemoryRegistry()
+	codec := newTestCodec(t, EncodingProtobuf, registry)
+	msg, err := codec.Encode(ctx, testTopic, testEvent())
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	_, _, payload, err := schema.UnframeProtobuf(msg.Value)
+	if err != nil {
+		t.Fatalf("UnframeProtobuf: %v", err)
+	}
+
+	t.Run("Unknown", func(t *testing.T) {
+		unknown := bus.Message{Value: schema.FrameProtobuf(404, payload), Headers: msg.Headers}
+		_, err := codec.Decode(ctx, unknown)
+		decodeErr := assertDecodeError(t, err)
+		if !errors.Is(decodeErr, schema.ErrSchemaNotFound) {
+			t.Errorf("error = %v, want it to wrap ErrSchemaNotFound", err)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		// Protobuf content without the wire format framing
+		unframed := bus.Message{Value: payload, Headers: msg.Headers}
+		_, err := codec.Decode(ctx, unframed)
+		decodeErr := assertDecodeError(t, err)
+		if !errors.Is(decodeErr, schema.ErrNotFramed) {
+			t.Errorf("error = %v, want it to wrap ErrNotFramed", err)
+		}
+	})
+
+	t.Run("NotProtobuf", func(t *testing.T) {
+		avroID, err := registry.Register(ctx, testTopic+"-value", schema.TypeAvro, `{"type":"record","name":"CampaignEvent","fields":[]}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		avro := bus.Message{Value: schema.FrameProtobuf(avroID, payload), Headers: msg.Headers}
+		_, err = codec.Decode(ctx, avro)
+		assertDecodeError(t, err)
+	})
+
+	t.Run("NestedMessage", func(t *testing.T) {
+		schemaID, _, _, _ := schema.UnframeProtobuf(msg.Value)
+		// An index path of [1]: count 1, index 1, both zigzag encoded
+		nested := append(schema.Frame(schemaID, []byte{2, 2}), payload...)
+		_, err := codec.Decode(ctx, bus.Message{Value: nested, Headers: msg.Headers})
+		assertDecodeError(t, err)
+	})
+
+	t.Run("NoRegistry", func(t *testing.T) {
+		_, err := newTestCodec(t, EncodingJSON, nil).Decode(ctx, msg)
+		assertDecodeError(t, err)
+	})
+}
+
+func TestNewCampaignEventCodec(t *testing.T) {
+	for _, encoding := range []string{EncodingProtobuf, "avro"} {
+		viper.Set("kafka.producer.encoding", encoding)
+		if _, err := NewCampaignEventCodec(nil); err == nil {
+			t.Errorf("NewCampaignEventCodec(%s) without a registry succeeded", encoding)
+		}
+	}
+	viper.Set("kafka.producer.encoding", "")
+}
@@ -0,0 +1,51 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// EventTypeCampaignLifecycle is the envelope event type of lifecycle events
+const EventTypeCampaignLifecycle = "campaign_lifecycle"
+
+// CampaignLifecycleVersion is the schema version lifecycle events are written with
+const CampaignLifecycleVersion = 1
+
+// LifecycleEventCodec encodes campaign lifecycle events as enveloped JSON.
+// Downstream services decode them with their own copy of the schema.
+type LifecycleEventCodec struct {
+	producerID string
+}
+
+// NewLifecycleEventCodec creates a lifecycle event codec
+func NewLifecycleEventCodec() *LifecycleEventCodec {
+	return &LifecycleEventCodec{producerID: producerID()}
+}
+
+// Encode builds the message of a lifecycle event, keyed by campaign so the
+// events of a campaign stay in order
+func (c *LifecycleEventCodec) Encode(ctx context.Context, event *models.CampaignLifecycleEvent) (bus.Message, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return bus.Message{}, err
+	}
+
+	envelope := bus.Envelope{
+		EventType:     EventTypeCampaignLifecycle,
+		SchemaVersion: CampaignLifecycleVersion,
+		ProducerID:    c.producerID,
+		ContentType:   ContentTypeJSON,
+		TraceParent:   bus.TraceParentFromContext(ctx),
+	}
+
+	return bus.Message{
+		Key:     []byte(event.CampaignID.String()),
+		Value:   value,
+		Headers: envelope.Headers(),
+		Time:    time.Now(),
+	}, nil
+}
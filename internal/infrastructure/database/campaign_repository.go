@@ -0,0 +1,294 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// CampaignRepository is the Postgres repository.CampaignRepository. Messages
+// are inserted into the outbox table in the transaction of the change.
+type CampaignRepository struct {
+	db *sqlx.DB
+}
+
+// NewCampaignRepository creates a campaign repository on a Postgres client
+func NewCampaignRepository(client *PostgresClient) *CampaignRepository {
+	return &CampaignRepository{db: client.GetDB()}
+}
+
+// Get implements repository.CampaignRepository
+func (r *CampaignRepository) Get(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	query := `
+		SELECT * FROM campaigns
+		WHERE id = $1
+	`
+
+	var campaign models.Campaign
+	if err := r.db.GetContext(ctx, &campaign, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrCampaignNotFound
+		}
+		return nil, err
+	}
+
+	return &campaign, nil
+}
+
+// List implements repository.CampaignRepository
+func (r *CampaignRepository) List(ctx context.Context, filter repository.CampaignFilter) ([]models.Campaign, error) {
+	// Build the query with filters
+	query := "SELECT * FROM campaigns WHERE TRUE"
+	args := []interface{}{}
+
+	if filter.UserID != uuid.Nil {
+		query += " AND user_id = $" + strconv.Itoa(len(args)+1)
+		args = append(args, filter.UserID)
+	}
+
+	if filter.Platform != nil {
+		query += " AND platform = $" + strconv.Itoa(len(args)+1)
+		args = append(args, string(*filter.Platform))
+	}
+
+	if filter.Status != nil {
+		query += " AND status = $" + strconv.Itoa(len(args)+1)
+		args = append(args, *filter.Status)
+	}
+
+	if filter.IDs != nil {
+		ids := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			ids[i] = id.String()
+		}
+		query += " AND id = ANY($" + strconv.Itoa(len(args)+1) + "::uuid[])"
+		args = append(args, pq.Array(ids))
+	}
+
+	if len(filter.Tags) > 0 {
+		query += " AND tags @> $" + strconv.Itoa(len(args)+1) + "::text[]"
+		args = append(args, pq.Array(filter.Tags))
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	campaigns := []models.Campaign{}
+	if err := r.db.SelectContext(ctx, &campaigns, query, args...); err != nil {
+		return nil, err
+	}
+
+	return campaigns, nil
+}
+
+// ListDue implements repository.CampaignRepository
+func (r *CampaignRepository) ListDue(ctx context.Context, day, syncedBefore time.Time) ([]models.Campaign, error) {
+	query := `
+		SELECT c.* FROM campaigns c
+		LEFT JOIN campaign_sync_state s ON s.campaign_id = c.id AND s.platform = c.platform
+		WHERE c.status = $1
+			AND c.start_date::date <= $2::date
+			AND c.end_date::date >= $2::date
+			AND (COALESCE(s.last_attempt_at, s.last_synced_at) IS NULL
+				OR COALESCE(s.last_attempt_at, s.last_synced_at) <= $3)
+		ORDER BY COALESCE(s.last_attempt_at, s.last_synced_at) ASC NULLS FIRST
+	`
+
+	campaigns := []models.Campaign{}
+	if err := r.db.SelectContext(ctx, &campaigns, query, models.CampaignStatusActive, day, syncedBefore); err != nil {
+		return nil, err
+	}
+
+	return campaigns, nil
+}
+
+// Create implements repository.CampaignRepository
+func (r *CampaignRepository) Create(ctx context.Context, campaign *models.Campaign, messages ...bus.Message) error {
+	query := `
+		INSERT INTO campaigns (
+			id, user_id, name, platform, budget, start_date, end_date,
+			status, external_id, timezone, tags, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+		)
+	`
+
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query,
+			campaign.ID,
+			campaign.UserID,
+			campaign.Name,
+			campaign.Platform,
+			campaign.Budget,
+			campaign.StartDate,
+			campaign.EndDate,
+			campaign.Status,
+			campaign.ExternalID,
+			campaign.Timezone,
+			campaignTags(campaign),
+			campaign.CreatedAt,
+			campaign.UpdatedAt,
+		); err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, messages...)
+	})
+}
+
+// Update implements repository.CampaignRepository. The stored row is locked
+// with SELECT ... FOR UPDATE until the transaction ends.
+func (r *CampaignRepository) Update(ctx context.Context, campaign *models.Campaign, messages func(previous *models.Campaign) ([]bus.Message, error)) error {
+	query := `
+		UPDATE campaigns SET
+			name = $1,
+			platform = $2,
+			budget = $3,
+			start_date = $4,
+			end_date = $5,
+			status = $6,
+			external_id = $7,
+			timezone = $8,
+			tags = $9,
+			updated_at = $10
+		WHERE id = $11
+	`
+
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		var previous models.Campaign
+		if err := tx.GetContext(ctx, &previous, "SELECT * FROM campaigns WHERE id = $1 FOR UPDATE", campaign.ID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return repository.ErrCampaignNotFound
+			}
+			return err
+		}
+		campaign.UserID = previous.UserID
+		campaign.CreatedAt = previous.CreatedAt
+
+		if _, err := tx.ExecContext(ctx, query,
+			campaign.Name,
+			campaign.Platform,
+			campaign.Budget,
+			campaign.StartDate,
+			campaign.EndDate,
+			campaign.Status,
+			campaign.ExternalID,
+			campaign.Timezone,
+			campaignTags(campaign),
+			campaign.UpdatedAt,
+			campaign.ID,
+		); err != nil {
+			return err
+		}
+
+		msgs, err := messages(&previous)
+		if err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, msgs...)
+	})
+}
+
+// campaignTags returns the tags of a campaign for the NOT NULL tags column
+func campaignTags(campaign *models.Campaign) pq.StringArray {
+	if campaign.Tags == nil {
+		return pq.StringArray{}
+	}
+	return campaign.Tags
+}
+
+// GetSyncState implements repository.CampaignRepository
+func (r *CampaignRepository) GetSyncState(ctx context.Context, campaignID uuid.UUID, platform models.Platform) (*models.CampaignSyncState, error) {
+	query := `
+		SELECT campaign_id, platform, window_start, window_end, last_synced_at,
+			last_attempt_at, last_status, last_error, event_count, updated_at
+		FROM campaign_sync_state
+		WHERE campaign_id = $1 AND platform = $2
+	`
+
+	var state models.CampaignSyncState
+	if err := r.db.GetContext(ctx, &state, query, campaignID, string(platform)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrSyncStateNotFound
+		}
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// RecordSyncSuccess implements repository.CampaignRepository
+func (r *CampaignRepository) RecordSyncSuccess(ctx context.Context, campaign *models.Campaign, windowStart, windowEnd time.Time, eventCount int, messages ...bus.Message) error {
+	query := `
+		INSERT INTO campaign_sync_state (
+			campaign_id, platform, window_start, window_end, last_synced_at,
+			last_attempt_at, last_status, last_error, event_count, updated_at
+		)
+		VALUES ($1, $2, $3::date, $4::date, $5, $5, $6, NULL, $7, NOW())
+		ON CONFLICT (campaign_id, platform) DO UPDATE SET
+			window_start = EXCLUDED.window_start,
+			window_end = EXCLUDED.window_end,
+			last_synced_at = EXCLUDED.last_synced_at,
+			last_attempt_at = EXCLUDED.last_attempt_at,
+			last_status = EXCLUDED.last_status,
+			last_error = NULL,
+			event_count = EXCLUDED.event_count,
+			updated_at = NOW()
+	`
+
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := insertOutbox(ctx, tx, messages...); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, query,
+			campaign.ID, string(campaign.Platform),
+			windowStart.Format("2006-01-02"), windowEnd.Format("2006-01-02"),
+			time.Now(), string(models.SyncStatusSucceeded), eventCount,
+		)
+		return err
+	})
+}
+
+// RecordSyncAttempt implements repository.CampaignRepository
+func (r *CampaignRepository) RecordSyncAttempt(ctx context.Context, campaign *models.Campaign, status models.SyncStatus, syncErr error, eventCount int, messages ...bus.Message) error {
+	query := `
+		INSERT INTO campaign_sync_state (
+			campaign_id, platform, last_attempt_at, last_status, last_error, event_count, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (campaign_id, platform) DO UPDATE SET
+			last_attempt_at = EXCLUDED.last_attempt_at,
+			last_status = EXCLUDED.last_status,
+			last_error = EXCLUDED.last_error,
+			event_count = EXCLUDED.event_count,
+			updated_at = NOW()
+	`
+
+	return withTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := insertOutbox(ctx, tx, messages...); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, query,
+			campaign.ID, string(campaign.Platform), time.Now(), string(status), errorMessage(syncErr), eventCount,
+		)
+		return err
+	})
+}
+
+// errorMessage returns the message of an error, or nil for a nil error
+func errorMessage(err error) *string {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	return &message
+}
@@ -63,89 +63,6 @@ func NewClickHouseClient() (*ClickHouseClient, error) {
 	return &ClickHouseClient{conn: conn}, nil
 }
 
-// InitSchema initializes the database schema if it doesn't exist
-func (c *ClickHouseClient) InitSchema(ctx context.Context) error {
-	// Create campaign_events table to store raw events
-	if err := c.conn.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS campaign_events (
-			id UUID,
-			campaign_id UUID,
-			platform String,
-			event_type String,
-			impressions Int64,
-			clicks Int64,
-			conversions Int64,
-			spend Float64,
-			revenue Float64,
-			event_time DateTime,
-			region String,
-			currency String,
-			deduplication_key String,
-			received_at DateTime,
-			processed_at DateTime,
-			PRIMARY KEY (campaign_id, event_time, deduplication_key)
-		) ENGINE = ReplacingMergeTree(processed_at)
-		PARTITION BY toYYYYMM(event_time)
-		ORDER BY (campaign_id, event_time, deduplication_key)
-	`); err != nil {
-		return err
-	}
-
-	// Create campaign_insights table for aggregated metrics
-	if err := c.conn.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS campaign_insights (
-			campaign_id UUID,
-			date Date,
-			platform String,
-			region String,
-			impressions Int64,
-			clicks Int64,
-			conversions Int64,
-			spend Float64,
-			revenue Float64,
-			ctr Float64,
-			cpc Float64,
-			cpa Float64,
-			roas Float64,
-			conversion_rate Float64,
-			updated_at DateTime,
-			PRIMARY KEY (campaign_id, date, platform, region)
-		) ENGINE = ReplacingMergeTree(updated_at)
-		PARTITION BY toYYYYMM(date)
-		ORDER BY (campaign_id, date, platform, region)
-	`); err != nil {
-		return err
-	}
-
-	// Create a materialized view to automatically aggregate daily insights
-	if err := c.conn.Exec(ctx, `
-		CREATE MATERIALIZED VIEW IF NOT EXISTS mv_campaign_daily_aggregation
-		TO campaign_insights
-		AS SELECT
-			campaign_id,
-			toDate(event_time) as date,
-			platform,
-			region,
-			sum(impressions) as impressions,
-			sum(clicks) as clicks,
-			sum(conversions) as conversions,
-			sum(spend) as spend,
-			sum(revenue) as revenue,
-			if(sum(impressions) > 0, sum(clicks) / sum(impressions), 0) as ctr,
-			if(sum(clicks) > 0, sum(spend) / sum(clicks), 0) as cpc,
-			if(sum(conversions) > 0, sum(spend) / sum(conversions), 0) as cpa,
-			if(sum(spend) > 0, sum(revenue) / sum(spend), 0) as roas,
-			if(sum(clicks) > 0, sum(conversions) / sum(clicks), 0) as conversion_rate,
-			now() as updated_at
-		FROM campaign_events
-		GROUP BY campaign_id, toDate(event_time), platform, region
-	`); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // Close closes the ClickHouse connection
 func (c *ClickHouseClient) Close() error {
 	return c.conn.Close()
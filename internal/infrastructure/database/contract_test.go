@@ -0,0 +1,53 @@
+//go:build integration
+
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/repository/repotest"
+)
+
+// TestContract runs the repository contract suite against Postgres and
+// ClickHouse. It is built with the integration tag and connects with the
+// CA_POSTGRES_* and CA_CLICKHOUSE_* variables, defaulting to local servers:
+//
+//	go test -tags integration ./internal/infrastructure/database/
+//
+// Migrations are applied first. The suite only reads the rows it writes, but
+// the databases must not hold runnable jobs.
+func TestContract(t *testing.T) {
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.SetEnvPrefix("CA")
+
+	postgres, err := NewPostgresClient()
+	if err != nil {
+		t.Fatalf("connect to Postgres: %v", err)
+	}
+	t.Cleanup(func() { postgres.Close() })
+
+	clickhouse, err := NewClickHouseClient()
+	if err != nil {
+		t.Fatalf("connect to ClickHouse: %v", err)
+	}
+	t.Cleanup(func() { clickhouse.Close() })
+
+	if err := MigrateUp(context.Background(), postgres, clickhouse); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	repotest.Run(t, func(t *testing.T) repotest.Stores {
+		return repotest.Stores{
+			Campaigns: NewCampaignRepository(postgres),
+			Users:     NewUserRepository(postgres),
+			Events:    NewEventStore(clickhouse),
+			Insights:  NewInsightsStore(clickhouse),
+			Jobs:      NewJobRepository(postgres),
+			FXRates:   NewFXRateStore(clickhouse),
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+)
+
+// EventStore is the ClickHouse repository.EventStore. Events are kept in the
+// ReplacingMergeTree campaign_events, so superseded snapshots only disappear
+// once merged; reads use FINAL.
+type EventStore struct {
+	conn driver.Conn
+}
+
+// NewEventStore creates an event store on a ClickHouse client
+func NewEventStore(client *ClickHouseClient) *EventStore {
+	return &EventStore{conn: client.GetConn()}
+}
+
+// Insert implements repository.EventStore
+func (s *EventStore) Insert(ctx context.Context, events []models.CampaignEvent) error {
+	query := `
+		INSERT INTO campaign_events (
+			id, campaign_id, platform, event_type, impressions, clicks, conversions,
+			spend, revenue, event_time, local_date, region, placement, currency,
+			deduplication_key, received_at, processed_at
+		)
+	`
+
+	batch, err := s.conn.PrepareBatch(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	for i := range events {
+		event := &events[i]
+		localDate := event.LocalDate
+		if localDate.IsZero() {
+			localDate = event.EventTime.UTC()
+		}
+		err := batch.Append(
+			event.ID.String(),
+			event.CampaignID.String(),
+			string(event.Platform),
+			event.EventType,
+			event.Impressions,
+			event.Clicks,
+			event.Conversions,
+			event.Spend,
+			event.Revenue,
+			event.EventTime,
+			localDate,
+			event.Region,
+			event.Placement,
+			event.Currency,
+			event.DeduplicationKey,
+			event.ReceivedAt,
+			event.ProcessedAt,
+		)
+		if err != nil {
+			_ = batch.Abort()
+			return &repository.RejectedBatchError{Err: err}
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		var exception *clickhouse.Exception
+		if errors.As(err, &exception) {
+			return &repository.RejectedBatchError{Err: err}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Latest implements repository.EventStore
+func (s *EventStore) Latest(ctx context.Context, campaignID uuid.UUID, eventTime time.Time, deduplicationKey string) (*models.CampaignEvent, error) {
+	query := `
+		SELECT id, platform, event_type, impressions, clicks, conversions, spend, revenue,
+			event_time, local_date, region, placement, currency, received_at, processed_at
+		FROM campaign_events FINAL
+		WHERE campaign_id = ? AND event_time = ? AND deduplication_key = ?
+		LIMIT 1
+	`
+
+	event := models.CampaignEvent{CampaignID: campaignID, DeduplicationKey: deduplicationKey}
+	var id, platform string
+	err := s.conn.QueryRow(ctx, query, campaignID.String(), eventTime, deduplicationKey).Scan(
+		&id,
+		&platform,
+		&event.EventType,
+		&event.Impressions,
+		&event.Clicks,
+		&event.Conversions,
+		&event.Spend,
+		&event.Revenue,
+		&event.EventTime,
+		&event.LocalDate,
+		&event.Region,
+		&event.Placement,
+		&event.Currency,
+		&event.ReceivedAt,
+		&event.ProcessedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if event.ID, err = uuid.Parse(id); err != nil {
+		return nil, err
+	}
+	event.Platform = models.Platform(platform)
+	return &event, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+// FXRateStore is the ClickHouse repository.FXRateStore. Rates are kept in
+// the ReplacingMergeTree fx_rates, where the latest load of a day wins once
+// merged; reads use FINAL.
+type FXRateStore struct {
+	conn driver.Conn
+}
+
+// NewFXRateStore creates an exchange rate store on a ClickHouse client
+func NewFXRateStore(client *ClickHouseClient) *FXRateStore {
+	return &FXRateStore{conn: client.GetConn()}
+}
+
+// Store implements repository.FXRateStore
+func (s *FXRateStore) Store(ctx context.Context, rates []models.FXRate) error {
+	batch, err := s.conn.PrepareBatch(ctx, "INSERT INTO fx_rates (base, date, currency, rate, updated_at)")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, rate := range rates {
+		if err := batch.Append(rate.Base, rate.Date, rate.Currency, rate.Rate, now); err != nil {
+			_ = batch.Abort()
+			return err
+		}
+	}
+
+	return batch.Send()
+}
+
+// List implements repository.FXRateStore
+func (s *FXRateStore) List(ctx context.Context, base string, currencies []string, startDate, endDate time.Time) ([]models.FXRate, error) {
+	query := `
+		SELECT base, date, currency, rate
+		FROM fx_rates FINAL
+		WHERE base = ? AND has(?, currency) AND date >= toDate(?) AND date <= toDate(?)
+		ORDER BY date, currency
+	`
+
+	rows, err := s.conn.Query(ctx, query, base, currencies, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.FXRate{}
+	for rows.Next() {
+		var rate models.FXRate
+		if err := rows.Scan(&rate.Base, &rate.Date, &rate.Currency, &rate.Rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,361 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+// InsightsStore is the ClickHouse repository.InsightsStore. Daily insights
+// are read from campaign_insights, which the materialized view fills from
+// every insert into campaign_events.
+type InsightsStore struct {
+	conn driver.Conn
+}
+
+// NewInsightsStore creates an insights store on a ClickHouse client
+func NewInsightsStore(client *ClickHouseClient) *InsightsStore {
+	return &InsightsStore{conn: client.GetConn()}
+}
+
+// Query implements repository.InsightsStore
+func (s *InsightsStore) Query(ctx context.Context, params models.CampaignInsightsParams) ([]models.CampaignInsights, error) {
+	loc, err := models.LoadTimezone(params.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	if params.CampaignIDs != nil && len(params.CampaignIDs) == 0 {
+		return []models.CampaignInsights{}, nil
+	}
+	query, args := buildInsightsQuery(params, loc)
+
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	insights := []models.CampaignInsights{}
+	for rows.Next() {
+		var row insightsRow
+		if err := rows.Scan(row.dest()...); err != nil {
+			return nil, err
+		}
+		insight, err := row.insight(params)
+		if err != nil {
+			return nil, err
+		}
+		insights = append(insights, insight)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return insights, nil
+}
+
+// QueryPeriods implements repository.InsightsStore. The query of each period
+// is tagged with its position and the queries are combined with UNION ALL.
+func (s *InsightsStore) QueryPeriods(ctx context.Context, params models.CampaignInsightsParams, periods []models.DateRange) ([][]models.CampaignInsights, error) {
+	loc, err := models.LoadTimezone(params.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]models.CampaignInsights, len(periods))
+	for i := range results {
+		results[i] = []models.CampaignInsights{}
+	}
+	if len(periods) == 0 || (params.CampaignIDs != nil && len(params.CampaignIDs) == 0) {
+		return results, nil
+	}
+
+	parts := make([]string, len(periods))
+	var args []interface{}
+	for i, period := range periods {
+		periodParams := params
+		periodParams.StartDate, periodParams.EndDate = period.StartDate, period.EndDate
+		query, periodArgs := buildInsightsSelect(periodParams, loc)
+		parts[i] = fmt.Sprintf("SELECT toUInt8(%d) AS period, * FROM (%s)", i, query)
+		args = append(args, periodArgs...)
+	}
+	query := "SELECT * FROM (" + strings.Join(parts, " UNION ALL ") + ")" +
+		" ORDER BY period ASC, " + insightsOrder
+
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var period uint8
+		var row insightsRow
+		if err := rows.Scan(append([]interface{}{&period}, row.dest()...)...); err != nil {
+			return nil, err
+		}
+		insight, err := row.insight(params)
+		if err != nil {
+			return nil, err
+		}
+		if int(period) >= len(results) {
+			return nil, fmt.Errorf("unexpected period %d", period)
+		}
+		results[period] = append(results[period], insight)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// insightsRow is a row of an insights query as scanned
+type insightsRow struct {
+	models.CampaignInsights
+	campaignID string
+	platform   string
+}
+
+// dest returns the scan destinations of the columns of an insights query
+func (r *insightsRow) dest() []interface{} {
+	return []interface{}{
+		&r.campaignID,
+		&r.Date,
+		&r.platform,
+		&r.Region,
+		&r.Currency,
+		&r.Impressions,
+		&r.Clicks,
+		&r.Conversions,
+		&r.Spend,
+		&r.Revenue,
+		&r.CTR,
+		&r.CPC,
+		&r.CPA,
+		&r.ROAS,
+		&r.ConversionRate,
+		&r.UpdatedAt,
+	}
+}
+
+// insight converts a scanned row of a query for params
+func (r *insightsRow) insight(params models.CampaignInsightsParams) (models.CampaignInsights, error) {
+	insight := r.CampaignInsights
+
+	// Convert string IDs to UUID
+	campaignID, err := uuid.Parse(r.campaignID)
+	if err != nil {
+		return insight, fmt.Errorf("parse campaign ID %q: %w", r.campaignID, err)
+	}
+	insight.CampaignID = campaignID
+	insight.Platform = models.Platform(r.platform)
+	if !params.GroupsBy(models.DimensionDate) {
+		insight.Date = time.Time{}
+	}
+	return insight, nil
+}
+
+// insightsOrder orders the rows of an insights query
+const insightsOrder = "bucket ASC, row_platform ASC, row_region ASC, currency ASC, row_campaign_id ASC"
+
+// buildInsightsQuery builds the SQL query for retrieving insights, ordered
+func buildInsightsQuery(params models.CampaignInsightsParams, loc *time.Location) (string, []interface{}) {
+	query, args := buildInsightsSelect(params, loc)
+	return query + " ORDER BY " + insightsOrder, args
+}
+
+// buildInsightsSelect builds the unordered SQL query for retrieving insights.
+// Rows are rolled up into buckets of the requested granularity, one per
+// currency so amounts in different currencies are never summed: the additive
+// counters are re-summed per bucket and the ratios are recomputed from those
+// sums, never averaged. Hourly buckets are read from the raw events because
+// campaign_insights only holds daily rows; they are hours of loc and the
+// range runs from midnight to midnight in loc. Dimensions the rows are not
+// split by are selected as constants, under aliases that do not shadow the
+// columns the filters use.
+func buildInsightsSelect(params models.CampaignInsightsParams, loc *time.Location) (string, []interface{}) {
+	table := "campaign_insights"
+	timeColumn := "date"
+	updatedColumn := "updated_at"
+	if params.Granularity == models.GranularityHourly {
+		table = "campaign_events FINAL"
+		timeColumn = "event_time"
+		updatedColumn = "processed_at"
+	}
+
+	campaignColumn := "toUUID('00000000-0000-0000-0000-000000000000')"
+	bucketColumn := "toDate(0)"
+	platformColumn := "''"
+	regionColumn := "''"
+	groupBy := []string{}
+	if params.GroupsBy(models.DimensionCampaign) {
+		campaignColumn = "campaign_id"
+		groupBy = append(groupBy, "row_campaign_id")
+	}
+	if params.GroupsBy(models.DimensionDate) {
+		bucketColumn = bucketExpression(params.Granularity, params.WeekStart, timeColumn)
+		groupBy = append(groupBy, "bucket")
+	}
+	if params.GroupsBy(models.DimensionPlatform) {
+		platformColumn = "platform"
+		groupBy = append(groupBy, "row_platform")
+	}
+	if params.GroupsBy(models.DimensionRegion) {
+		regionColumn = "region"
+		groupBy = append(groupBy, "row_region")
+	}
+	groupBy = append(groupBy, "currency")
+
+	// Start with the base query
+	query := fmt.Sprintf(`
+		SELECT
+			%s AS row_campaign_id,
+			%s AS bucket,
+			%s AS row_platform,
+			%s AS row_region,
+			currency,
+			sum(impressions) AS total_impressions,
+			sum(clicks) AS total_clicks,
+			sum(conversions) AS total_conversions,
+			sum(spend) AS total_spend,
+			sum(revenue) AS total_revenue,
+			if(total_impressions > 0, total_clicks / total_impressions, 0) AS ctr,
+			if(total_clicks > 0, total_spend / total_clicks, 0) AS cpc,
+			if(total_conversions > 0, total_spend / total_conversions, 0) AS cpa,
+			if(total_spend > 0, total_revenue / total_spend, 0) AS roas,
+			if(total_clicks > 0, total_conversions / total_clicks, 0) AS conversion_rate,
+			max(%s) AS last_updated
+		FROM %s
+		WHERE 1=1
+	`, campaignColumn, bucketColumn, platformColumn, regionColumn, updatedColumn, table)
+
+	var args []interface{}
+	if params.Granularity == models.GranularityHourly && params.GroupsBy(models.DimensionDate) {
+		args = append(args, loc.String())
+	}
+
+	// Add filters
+	if params.CampaignID != uuid.Nil {
+		query += " AND campaign_id = ?"
+		args = append(args, params.CampaignID.String())
+	}
+
+	if params.CampaignIDs != nil {
+		ids := make([]interface{}, len(params.CampaignIDs))
+		for i, id := range params.CampaignIDs {
+			ids[i] = id.String()
+		}
+		query += " AND campaign_id IN ?"
+		args = append(args, clickhouse.GroupSet{Value: ids})
+	}
+
+	if params.Granularity == models.GranularityHourly {
+		if !params.StartDate.IsZero() {
+			query += " AND event_time >= ?"
+			args = append(args, models.StartOfDayIn(params.StartDate, loc))
+		}
+		if !params.EndDate.IsZero() {
+			// Include every hour of the last requested day
+			query += " AND event_time < ?"
+			args = append(args, models.StartOfDayIn(params.EndDate.AddDate(0, 0, 1), loc))
+		}
+	} else {
+		if !params.StartDate.IsZero() {
+			query += " AND date >= ?"
+			args = append(args, params.StartDate)
+		}
+		if !params.EndDate.IsZero() {
+			query += " AND date <= ?"
+			args = append(args, params.EndDate)
+		}
+	}
+
+	if params.Platform != nil {
+		query += " AND platform = ?"
+		args = append(args, string(*params.Platform))
+	}
+
+	if params.Region != nil && *params.Region != "" {
+		query += " AND region = ?"
+		args = append(args, *params.Region)
+	}
+
+	// Roll up the buckets
+	query += " GROUP BY " + strings.Join(groupBy, ", ")
+
+	return query, args
+}
+
+// bucketExpression returns the ClickHouse expression that truncates column to
+// the start of its granularity bucket. Hours are truncated in a timezone
+// bound as the expression's only argument.
+func bucketExpression(granularity models.Granularity, weekStart time.Weekday, column string) string {
+	switch granularity {
+	case models.GranularityHourly:
+		return fmt.Sprintf("toStartOfHour(%s, ?)", column)
+	case models.GranularityWeekly:
+		// Mode 1 starts weeks on Monday (ISO 8601), mode 0 on Sunday
+		mode := 1
+		if weekStart == time.Sunday {
+			mode = 0
+		}
+		return fmt.Sprintf("toStartOfWeek(%s, %d)", column, mode)
+	case models.GranularityMonthly:
+		return fmt.Sprintf("toStartOfMonth(%s)", column)
+	case models.GranularityQuarterly:
+		return fmt.Sprintf("toStartOfQuarter(%s)", column)
+	default:
+		return fmt.Sprintf("toDate(%s)", column)
+	}
+}
+
+// Reaggregate implements repository.InsightsStore. campaign_insights adds up
+// every insert, so the affected days are deleted first and then rebuilt from
+// the deduplicated raw events.
+func (s *InsightsStore) Reaggregate(ctx context.Context, campaignID uuid.UUID, startDate, endDate time.Time) error {
+	// Drop the existing partial sums for the range, waiting for the mutation
+	deleteQuery := `
+		ALTER TABLE campaign_insights
+		DELETE WHERE campaign_id = ? AND date >= toDate(?) AND date <= toDate(?)
+	`
+
+	mutationCtx := clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"mutations_sync": 2,
+	}))
+	if err := s.conn.Exec(mutationCtx, deleteQuery, campaignID.String(), startDate, endDate); err != nil {
+		return fmt.Errorf("clear insights: %w", err)
+	}
+
+	// Execute a query to re-aggregate the metrics
+	query := `
+		INSERT INTO campaign_insights (
+			campaign_id, date, platform, region, currency,
+			impressions, clicks, conversions, spend, revenue, updated_at
+		)
+		SELECT
+			campaign_id,
+			local_date AS date,
+			platform,
+			region,
+			currency,
+			sum(impressions),
+			sum(clicks),
+			sum(conversions),
+			sum(spend),
+			sum(revenue),
+			now()
+		FROM campaign_events FINAL
+		WHERE campaign_id = ? AND local_date >= toDate(?) AND local_date <= toDate(?)
+		GROUP BY campaign_id, date, platform, region, currency
+	`
+
+	return s.conn.Exec(ctx, query, campaignID.String(), startDate, endDate)
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+func TestBucketExpression(t *testing.T) {
+	tests := []struct {
+		granularity models.Granularity
+		weekStart   time.Weekday
+		want        string
+	}{
+		{granularity: models.GranularityHourly, want: "toStartOfHour(event_time, ?)"},
+		{granularity: models.GranularityDaily, want: "toDate(event_time)"},
+		{granularity: models.GranularityWeekly, weekStart: time.Monday, want: "toStartOfWeek(event_time, 1)"},
+		{granularity: models.GranularityWeekly, weekStart: time.Sunday, want: "toStartOfWeek(event_time, 0)"},
+		{granularity: models.GranularityMonthly, want: "toStartOfMonth(event_time)"},
+		{granularity: models.GranularityQuarterly, want: "toStartOfQuarter(event_time)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.granularity)+"/"+tt.weekStart.String(), func(t *testing.T) {
+			if got := bucketExpression(tt.granularity, tt.weekStart, "event_time"); got != tt.want {
+				t.Errorf("bucketExpression(%s, %v) = %q, want %q", tt.granularity, tt.weekStart, got, tt.want)
+			}
+		})
+	}
+}
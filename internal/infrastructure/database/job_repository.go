@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+)
+
+// JobRepository is the Postgres repository.JobRepository. Leases are timed
+// with the database clock so workers need not agree on the time.
+type JobRepository struct {
+	db *sqlx.DB
+}
+
+// NewJobRepository creates a job repository on a Postgres client
+func NewJobRepository(client *PostgresClient) *JobRepository {
+	return &JobRepository{db: client.GetDB()}
+}
+
+// Create implements repository.JobRepository
+func (r *JobRepository) Create(ctx context.Context, job *models.Job) error {
+	query := `
+		INSERT INTO jobs (
+			id, type, campaign_id, user_id, state, start_date, end_date,
+			chunk_days, chunks_total, chunks_done, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6::date, $7::date, $8, $9, $10, $11, $12)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		job.ID, string(job.Type), job.CampaignID, job.UserID, string(job.State),
+		job.StartDate.Format("2006-01-02"), job.EndDate.Format("2006-01-02"),
+		job.ChunkDays, job.ChunksTotal, job.ChunksDone, job.CreatedAt, job.UpdatedAt,
+	)
+	return err
+}
+
+// Get implements repository.JobRepository
+func (r *JobRepository) Get(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	if err := r.db.GetContext(ctx, &job, "SELECT * FROM jobs WHERE id = $1", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Claim implements repository.JobRepository. Workers claiming at the same
+// time skip each other's rows instead of waiting.
+func (r *JobRepository) Claim(ctx context.Context, owner string, leaseTTL time.Duration) (*models.Job, error) {
+	query := `
+		UPDATE jobs SET
+			state = $1,
+			lease_owner = $2,
+			lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond',
+			attempts = attempts + 1,
+			started_at = COALESCE(started_at, NOW()),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE state = $4 OR (state = $1 AND lease_expires_at < NOW())
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	var job models.Job
+	err := r.db.GetContext(ctx, &job, query,
+		string(models.JobStateRunning), owner, leaseTTL.Milliseconds(), string(models.JobStatePending),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNoJob
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Checkpoint implements repository.JobRepository
+func (r *JobRepository) Checkpoint(ctx context.Context, id uuid.UUID, owner string, checkpoint time.Time, chunksDone int, leaseTTL time.Duration) error {
+	query := `
+		UPDATE jobs SET
+			checkpoint = $4::date,
+			chunks_done = $5,
+			lease_expires_at = NOW() + $6 * INTERVAL '1 millisecond',
+			updated_at = NOW()
+		WHERE id = $1 AND state = $2 AND lease_owner = $3
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		id, string(models.JobStateRunning), owner,
+		checkpoint.Format("2006-01-02"), chunksDone, leaseTTL.Milliseconds(),
+	)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(result)
+}
+
+// Finish implements repository.JobRepository
+func (r *JobRepository) Finish(ctx context.Context, id uuid.UUID, owner string, state models.JobState, jobErr error) error {
+	query := `
+		UPDATE jobs SET
+			state = $4,
+			last_error = COALESCE($5, last_error),
+			lease_owner = NULL,
+			lease_expires_at = NULL,
+			finished_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1 AND state = $2 AND lease_owner = $3
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		id, string(models.JobStateRunning), owner, string(state), errorMessage(jobErr),
+	)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(result)
+}
+
+// Cancel implements repository.JobRepository. A running job stops at its
+// next checkpoint, when its worker finds the lease gone.
+func (r *JobRepository) Cancel(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	query := `
+		UPDATE jobs SET
+			state = $2,
+			lease_owner = NULL,
+			lease_expires_at = NULL,
+			finished_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1 AND state IN ($3, $4)
+		RETURNING *
+	`
+
+	var job models.Job
+	err := r.db.GetContext(ctx, &job, query,
+		id, string(models.JobStateCancelled), string(models.JobStatePending), string(models.JobStateRunning),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either the job does not exist or it already finished
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, repository.ErrJobFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// leaseHeld returns ErrJobLeaseLost when an update guarded by the lease
+// matched no job
+func leaseHeld(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return repository.ErrJobLeaseLost
+	}
+	return nil
+}
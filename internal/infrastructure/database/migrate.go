@@ -0,0 +1,478 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/jmoiron/sqlx"
+)
+
+// Advisory locks serializing the migrations of each database. ClickHouse has
+// no locks of its own, so its migrations are serialized through Postgres too.
+const (
+	postgresMigrationLockID   = 7_001_101
+	clickhouseMigrationLockID = 7_001_102
+)
+
+//go:embed migrations/postgres/*.sql migrations/clickhouse/*.sql
+var migrationFiles embed.FS
+
+// Migration is a numbered schema change with the statements applying and
+// reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// MigrationStatus reports the schema version of a database
+type MigrationStatus struct {
+	// Version is the last applied migration, 0 if none
+	Version int
+	// Dirty is set when a migration failed halfway; the schema has to be
+	// repaired by hand and the version set with Force
+	Dirty      bool
+	Migrations []Migration
+}
+
+// Pending returns the migrations not applied yet
+func (s *MigrationStatus) Pending() []Migration {
+	var pending []Migration
+	for _, m := range s.Migrations {
+		if m.Version > s.Version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// ErrDirtySchema is returned when a previous migration failed halfway
+var ErrDirtySchema = errors.New("schema is dirty, repair it and run migrate force")
+
+// migrationTarget is a database schema_migrations is kept in
+type migrationTarget interface {
+	// ensureVersionTable creates schema_migrations if needed
+	ensureVersionTable(ctx context.Context) error
+	// version returns the recorded version, 0 if none
+	version(ctx context.Context) (int, bool, error)
+	// setVersion records a version
+	setVersion(ctx context.Context, version int, dirty bool) error
+	// apply runs the statements of migration, up or down, and records
+	// version once they all succeeded. A failure leaves migration dirty
+	// unless the database can roll the statements back.
+	apply(ctx context.Context, statements []string, migration, version int) error
+}
+
+// Migrator applies the numbered migrations embedded for a database, keeping
+// the applied version in its schema_migrations table. Each operation holds a
+// Postgres advisory lock, so concurrent startups migrate one at a time.
+type Migrator struct {
+	name       string
+	migrations []Migration
+	target     migrationTarget
+	lockDB     *sqlx.DB
+	lockID     int64
+}
+
+// NewPostgresMigrator creates a migrator for the Postgres schema
+func NewPostgresMigrator(postgres *PostgresClient) (*Migrator, error) {
+	migrations, err := loadMigrations("migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		name:       "postgres",
+		migrations: migrations,
+		target:     &postgresMigrationTarget{db: postgres.GetDB()},
+		lockDB:     postgres.GetDB(),
+		lockID:     postgresMigrationLockID,
+	}, nil
+}
+
+// NewClickHouseMigrator creates a migrator for the ClickHouse schema, locking
+// through Postgres
+func NewClickHouseMigrator(clickhouse *ClickHouseClient, postgres *PostgresClient) (*Migrator, error) {
+	migrations, err := loadMigrations("migrations/clickhouse")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		name:       "clickhouse",
+		migrations: migrations,
+		target:     &clickhouseMigrationTarget{conn: clickhouse.GetConn()},
+		lockDB:     postgres.GetDB(),
+		lockID:     clickhouseMigrationLockID,
+	}, nil
+}
+
+// Name returns the name of the migrated database
+func (m *Migrator) Name() string {
+	return m.name
+}
+
+// Up applies every pending migration in order and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(version int) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			if err := m.target.apply(ctx, migration.Up, migration.Version, migration.Version); err != nil {
+				return fmt.Errorf("%s migration %d_%s: %w", m.name, migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts up to steps of the applied migrations, latest first, and
+// returns how many were reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.withLock(ctx, func(version int) error {
+		for ; steps > 0 && version > 0; steps-- {
+			i := m.index(version)
+			if i < 0 {
+				return fmt.Errorf("%s version %d has no migration", m.name, version)
+			}
+
+			previous := 0
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			migration := m.migrations[i]
+			if err := m.target.apply(ctx, migration.Down, migration.Version, previous); err != nil {
+				return fmt.Errorf("%s migration %d_%s down: %w", m.name, migration.Version, migration.Name, err)
+			}
+			version = previous
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns the applied version and the known migrations
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	if err := m.target.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+	version, dirty, err := m.target.version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MigrationStatus{
+		Version:    version,
+		Dirty:      dirty,
+		Migrations: m.migrations,
+	}, nil
+}
+
+// Force records version as applied and clean without running anything. It
+// is used after repairing a dirty schema by hand.
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%s has no migration %d", m.name, version)
+	}
+
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.unlock(conn)
+
+	if err := m.target.ensureVersionTable(ctx); err != nil {
+		return err
+	}
+	return m.target.setVersion(ctx, version, false)
+}
+
+// withLock runs fn with the current version while holding the migration
+// lock. A dirty schema is refused.
+func (m *Migrator) withLock(ctx context.Context, fn func(version int) error) error {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.unlock(conn)
+
+	if err := m.target.ensureVersionTable(ctx); err != nil {
+		return err
+	}
+	version, dirty, err := m.target.version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%s version %d: %w", m.name, version, ErrDirtySchema)
+	}
+	return fn(version)
+}
+
+// lock waits for the advisory lock on a dedicated connection, as session
+// locks belong to the connection that took them
+func (m *Migrator) lock(ctx context.Context) (*sqlx.Conn, error) {
+	conn, err := m.lockDB.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockID); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("acquire %s migration lock: %w", m.name, err)
+	}
+	return conn, nil
+}
+
+// unlock releases the advisory lock. Closing the connection would release
+// it as well, but only once the pool discards it.
+func (m *Migrator) unlock(conn *sqlx.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _ = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", m.lockID)
+	conn.Close()
+}
+
+// index returns the position of a migration version, or -1
+func (m *Migrator) index(version int) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// MigrateUp applies the pending migrations of Postgres and then ClickHouse
+func MigrateUp(ctx context.Context, postgres *PostgresClient, clickhouse *ClickHouseClient) error {
+	postgresMigrator, err := NewPostgresMigrator(postgres)
+	if err != nil {
+		return err
+	}
+	clickhouseMigrator, err := NewClickHouseMigrator(clickhouse, postgres)
+	if err != nil {
+		return err
+	}
+
+	for _, migrator := range []*Migrator{postgresMigrator, clickhouseMigrator} {
+		if _, err := migrator.Up(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMigrations reads the migrations of a directory. Files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base := strings.TrimSuffix(file, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+
+		versionStr, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if !found || err != nil || version <= 0 || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("invalid migration file name %s", file)
+		}
+
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, name)
+		}
+		if direction == ".up" {
+			migration.Up = splitStatements(string(data))
+		} else {
+			migration.Down = splitStatements(string(data))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == nil || migration.Down == nil {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// splitStatements splits a SQL file into its statements, which end with a
+// semicolon at the end of a line. Comment lines are dropped since the
+// ClickHouse driver executes one statement at a time.
+func splitStatements(sql string) []string {
+	statements := []string{}
+	var current strings.Builder
+
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(current.String()), ";")
+			statements = append(statements, statement)
+			current.Reset()
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// postgresMigrationTarget runs each migration in a transaction together with
+// its version update, so a failed migration is rolled back and never dirty
+type postgresMigrationTarget struct {
+	db *sqlx.DB
+}
+
+func (t *postgresMigrationTarget) ensureVersionTable(ctx context.Context) error {
+	_, err := t.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			dirty BOOLEAN NOT NULL
+		)
+	`)
+	return err
+}
+
+func (t *postgresMigrationTarget) version(ctx context.Context) (int, bool, error) {
+	var rows []struct {
+		Version int  `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+	if err := t.db.SelectContext(ctx, &rows, "SELECT version, dirty FROM schema_migrations LIMIT 1"); err != nil {
+		return 0, false, err
+	}
+	if len(rows) == 0 {
+		return 0, false, nil
+	}
+	return rows[0].Version, rows[0].Dirty, nil
+}
+
+func (t *postgresMigrationTarget) setVersion(ctx context.Context, version int, dirty bool) error {
+	return withTx(ctx, t.db, func(tx *sqlx.Tx) error {
+		return setPostgresVersion(ctx, tx, version, dirty)
+	})
+}
+
+func (t *postgresMigrationTarget) apply(ctx context.Context, statements []string, migration, version int) error {
+	return withTx(ctx, t.db, func(tx *sqlx.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		return setPostgresVersion(ctx, tx, version, false)
+	})
+}
+
+// setPostgresVersion replaces the single row of schema_migrations
+func setPostgresVersion(ctx context.Context, tx *sqlx.Tx, version int, dirty bool) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	if version == 0 && !dirty {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)", version, dirty)
+	return err
+}
+
+// clickhouseMigrationTarget appends every version change to
+// schema_migrations; the latest row is the current version. ClickHouse has no
+// DDL transactions, so a migration is marked dirty until all its statements ran.
+type clickhouseMigrationTarget struct {
+	conn driver.Conn
+}
+
+func (t *clickhouseMigrationTarget) ensureVersionTable(ctx context.Context) error {
+	return t.conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version Int64,
+			dirty UInt8,
+			sequence UInt64
+		) ENGINE = MergeTree
+		ORDER BY sequence
+	`)
+}
+
+func (t *clickhouseMigrationTarget) version(ctx context.Context) (int, bool, error) {
+	rows, err := t.conn.Query(ctx, "SELECT version, dirty FROM schema_migrations ORDER BY sequence DESC LIMIT 1")
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, false, rows.Err()
+	}
+	var version int64
+	var dirty uint8
+	if err := rows.Scan(&version, &dirty); err != nil {
+		return 0, false, err
+	}
+	return int(version), dirty == 1, nil
+}
+
+func (t *clickhouseMigrationTarget) setVersion(ctx context.Context, version int, dirty bool) error {
+	var dirtyFlag uint8
+	if dirty {
+		dirtyFlag = 1
+	}
+	return t.conn.Exec(ctx,
+		"INSERT INTO schema_migrations (version, dirty, sequence) VALUES (?, ?, ?)",
+		int64(version), dirtyFlag, uint64(time.Now().UnixNano()),
+	)
+}
+
+func (t *clickhouseMigrationTarget) apply(ctx context.Context, statements []string, migration, version int) error {
+	// A half-reverted migration is still partly applied, so the migration
+	// being run is the dirty one whichever way it runs
+	if err := t.setVersion(ctx, migration, true); err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if err := t.conn.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return t.setVersion(ctx, version, false)
+}
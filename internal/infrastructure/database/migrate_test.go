@@ -0,0 +1,68 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "one statement per semicolon at the end of a line",
+			sql:  "CREATE TABLE a (id UUID);\nDROP TABLE b;\n",
+			want: []string{"CREATE TABLE a (id UUID)", "DROP TABLE b"},
+		},
+		{
+			name: "statements span lines",
+			sql:  "CREATE TABLE a (\n\tid UUID,\n\tname String\n) ENGINE = MergeTree\nORDER BY id;\n",
+			want: []string{"CREATE TABLE a (\n\tid UUID,\n\tname String\n) ENGINE = MergeTree\nORDER BY id"},
+		},
+		{
+			name: "comment lines and blank lines are dropped",
+			sql:  "-- Daily insights\n\n  -- indented comment\nSELECT 1;\n\n-- trailing comment\n",
+			want: []string{"SELECT 1"},
+		},
+		{
+			name: "comment lines inside a statement are dropped",
+			sql:  "SELECT\n\t-- the day\n\tdate\nFROM a;\n",
+			want: []string{"SELECT\n\tdate\nFROM a"},
+		},
+		{
+			name: "semicolons inside a line do not end a statement",
+			sql:  "INSERT INTO a VALUES ('x;y');\nSELECT ';' AS s,\n\t1;\n",
+			want: []string{"INSERT INTO a VALUES ('x;y')", "SELECT ';' AS s,\n\t1"},
+		},
+		{
+			name: "whitespace after the semicolon",
+			sql:  "SELECT 1;  \r\nSELECT 2;\t\n",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "a last statement without a semicolon",
+			sql:  "SELECT 1;\nSELECT 2\n",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "only comments",
+			sql:  "-- nothing to do\n",
+			want: []string{},
+		},
+		{
+			name: "empty file",
+			sql:  "",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
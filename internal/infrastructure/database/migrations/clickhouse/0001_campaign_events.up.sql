@@ -0,0 +1,21 @@
+-- Raw events; the latest processed snapshot of a deduplication key wins
+CREATE TABLE IF NOT EXISTS campaign_events (
+	id UUID,
+	campaign_id UUID,
+	platform String,
+	event_type String,
+	impressions Int64,
+	clicks Int64,
+	conversions Int64,
+	spend Float64,
+	revenue Float64,
+	event_time DateTime,
+	region String,
+	currency String,
+	deduplication_key String,
+	received_at DateTime,
+	processed_at DateTime,
+	PRIMARY KEY (campaign_id, event_time, deduplication_key)
+) ENGINE = ReplacingMergeTree(processed_at)
+PARTITION BY toYYYYMM(event_time)
+ORDER BY (campaign_id, event_time, deduplication_key);
@@ -0,0 +1,2 @@
+DROP VIEW IF EXISTS mv_campaign_daily_aggregation;
+DROP TABLE IF EXISTS campaign_insights;
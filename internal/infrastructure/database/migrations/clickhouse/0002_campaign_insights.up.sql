@@ -0,0 +1,106 @@
+-- Daily insights. Only additive counters are stored, as
+-- SimpleAggregateFunction state, so every insert block adds to the day's
+-- totals and background merges sum the partial rows. Ratios are derived from
+-- the sums at query time.
+--
+-- Installations created before migrations existed already have a
+-- campaign_insights table, possibly in the old ReplacingMergeTree layout with
+-- per-block ratios. Whatever its engine, the existing table is set aside, the
+-- new one is rebuilt from campaign_events, and days that no longer have raw
+-- events are copied over from the old table. On a new installation this
+-- rebuilds an empty table. Workers should be stopped while it runs.
+CREATE TABLE IF NOT EXISTS campaign_insights (
+	campaign_id UUID,
+	date Date,
+	platform String,
+	region String,
+	impressions SimpleAggregateFunction(sum, Int64),
+	clicks SimpleAggregateFunction(sum, Int64),
+	conversions SimpleAggregateFunction(sum, Int64),
+	spend SimpleAggregateFunction(sum, Float64),
+	revenue SimpleAggregateFunction(sum, Float64),
+	updated_at SimpleAggregateFunction(max, DateTime)
+) ENGINE = AggregatingMergeTree
+PARTITION BY toYYYYMM(date)
+ORDER BY (campaign_id, date, platform, region);
+
+DROP VIEW IF EXISTS mv_campaign_daily_aggregation;
+
+DROP TABLE IF EXISTS campaign_insights_premigration;
+
+RENAME TABLE campaign_insights TO campaign_insights_premigration;
+
+CREATE TABLE campaign_insights (
+	campaign_id UUID,
+	date Date,
+	platform String,
+	region String,
+	impressions SimpleAggregateFunction(sum, Int64),
+	clicks SimpleAggregateFunction(sum, Int64),
+	conversions SimpleAggregateFunction(sum, Int64),
+	spend SimpleAggregateFunction(sum, Float64),
+	revenue SimpleAggregateFunction(sum, Float64),
+	updated_at SimpleAggregateFunction(max, DateTime)
+) ENGINE = AggregatingMergeTree
+PARTITION BY toYYYYMM(date)
+ORDER BY (campaign_id, date, platform, region);
+
+INSERT INTO campaign_insights (
+	campaign_id, date, platform, region,
+	impressions, clicks, conversions, spend, revenue, updated_at
+)
+SELECT
+	campaign_id,
+	toDate(event_time) AS date,
+	platform,
+	region,
+	sum(impressions),
+	sum(clicks),
+	sum(conversions),
+	sum(spend),
+	sum(revenue),
+	max(processed_at)
+FROM campaign_events FINAL
+GROUP BY campaign_id, date, platform, region;
+
+-- FINAL keeps the latest row of a ReplacingMergeTree table and sums the
+-- rows of an AggregatingMergeTree one, so either layout yields a day's totals
+INSERT INTO campaign_insights (
+	campaign_id, date, platform, region,
+	impressions, clicks, conversions, spend, revenue, updated_at
+)
+SELECT
+	campaign_id,
+	date,
+	platform,
+	region,
+	sum(impressions),
+	sum(clicks),
+	sum(conversions),
+	sum(spend),
+	sum(revenue),
+	max(updated_at)
+FROM campaign_insights_premigration FINAL
+WHERE (campaign_id, date) NOT IN (
+	SELECT DISTINCT campaign_id, toDate(event_time) FROM campaign_events
+)
+GROUP BY campaign_id, date, platform, region;
+
+DROP TABLE campaign_insights_premigration;
+
+-- Feed each block inserted into campaign_events into campaign_insights as partial sums
+CREATE MATERIALIZED VIEW mv_campaign_daily_aggregation
+TO campaign_insights
+AS SELECT
+	campaign_id,
+	toDate(event_time) AS date,
+	platform,
+	region,
+	sum(impressions) AS impressions,
+	sum(clicks) AS clicks,
+	sum(conversions) AS conversions,
+	sum(spend) AS spend,
+	sum(revenue) AS revenue,
+	max(processed_at) AS updated_at
+FROM campaign_events
+GROUP BY campaign_id, toDate(event_time), platform, region;
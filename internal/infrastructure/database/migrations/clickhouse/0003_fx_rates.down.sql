@@ -0,0 +1,57 @@
+DROP TABLE fx_rates;
+
+-- Sum the currencies of a day back into a single row
+DROP VIEW mv_campaign_daily_aggregation;
+
+RENAME TABLE campaign_insights TO campaign_insights_by_currency;
+
+CREATE TABLE campaign_insights (
+	campaign_id UUID,
+	date Date,
+	platform String,
+	region String,
+	impressions SimpleAggregateFunction(sum, Int64),
+	clicks SimpleAggregateFunction(sum, Int64),
+	conversions SimpleAggregateFunction(sum, Int64),
+	spend SimpleAggregateFunction(sum, Float64),
+	revenue SimpleAggregateFunction(sum, Float64),
+	updated_at SimpleAggregateFunction(max, DateTime)
+) ENGINE = AggregatingMergeTree
+PARTITION BY toYYYYMM(date)
+ORDER BY (campaign_id, date, platform, region);
+
+INSERT INTO campaign_insights (
+	campaign_id, date, platform, region,
+	impressions, clicks, conversions, spend, revenue, updated_at
+)
+SELECT
+	campaign_id,
+	date,
+	platform,
+	region,
+	sum(impressions),
+	sum(clicks),
+	sum(conversions),
+	sum(spend),
+	sum(revenue),
+	max(updated_at)
+FROM campaign_insights_by_currency
+GROUP BY campaign_id, date, platform, region;
+
+DROP TABLE campaign_insights_by_currency;
+
+CREATE MATERIALIZED VIEW mv_campaign_daily_aggregation
+TO campaign_insights
+AS SELECT
+	campaign_id,
+	toDate(event_time) AS date,
+	platform,
+	region,
+	sum(impressions) AS impressions,
+	sum(clicks) AS clicks,
+	sum(conversions) AS conversions,
+	sum(spend) AS spend,
+	sum(revenue) AS revenue,
+	max(processed_at) AS updated_at
+FROM campaign_events
+GROUP BY campaign_id, toDate(event_time), platform, region;
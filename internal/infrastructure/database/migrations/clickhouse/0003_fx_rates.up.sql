@@ -0,0 +1,63 @@
+-- Insights are kept per currency, so amounts reported in different
+-- currencies are never summed. The view is recreated with the new key and
+-- days with raw events are rebuilt from them; days that only exist in
+-- campaign_insights keep an empty, unknown currency.
+DROP VIEW mv_campaign_daily_aggregation;
+
+ALTER TABLE campaign_insights
+	ADD COLUMN currency String AFTER region,
+	MODIFY ORDER BY (campaign_id, date, platform, region, currency);
+
+-- Mutations only touch the parts that exist when they are issued, so the
+-- rebuilt rows inserted next are kept
+ALTER TABLE campaign_insights
+	DELETE WHERE (campaign_id, date) IN (
+		SELECT DISTINCT campaign_id, toDate(event_time) FROM campaign_events
+	);
+
+INSERT INTO campaign_insights (
+	campaign_id, date, platform, region, currency,
+	impressions, clicks, conversions, spend, revenue, updated_at
+)
+SELECT
+	campaign_id,
+	toDate(event_time) AS date,
+	platform,
+	region,
+	currency,
+	sum(impressions),
+	sum(clicks),
+	sum(conversions),
+	sum(spend),
+	sum(revenue),
+	max(processed_at)
+FROM campaign_events FINAL
+GROUP BY campaign_id, date, platform, region, currency;
+
+CREATE MATERIALIZED VIEW mv_campaign_daily_aggregation
+TO campaign_insights
+AS SELECT
+	campaign_id,
+	toDate(event_time) AS date,
+	platform,
+	region,
+	currency,
+	sum(impressions) AS impressions,
+	sum(clicks) AS clicks,
+	sum(conversions) AS conversions,
+	sum(spend) AS spend,
+	sum(revenue) AS revenue,
+	max(processed_at) AS updated_at
+FROM campaign_events
+GROUP BY campaign_id, toDate(event_time), platform, region, currency;
+
+-- Daily exchange rates in units of currency per one unit of base. Loading a
+-- day again replaces its rates.
+CREATE TABLE fx_rates (
+	base String,
+	date Date,
+	currency String,
+	rate Float64,
+	updated_at DateTime
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (base, date, currency);
@@ -0,0 +1,21 @@
+DROP VIEW mv_campaign_daily_aggregation;
+
+ALTER TABLE campaign_events
+	DROP COLUMN local_date;
+
+CREATE MATERIALIZED VIEW mv_campaign_daily_aggregation
+TO campaign_insights
+AS SELECT
+	campaign_id,
+	toDate(event_time) AS date,
+	platform,
+	region,
+	currency,
+	sum(impressions) AS impressions,
+	sum(clicks) AS clicks,
+	sum(conversions) AS conversions,
+	sum(spend) AS spend,
+	sum(revenue) AS revenue,
+	max(processed_at) AS updated_at
+FROM campaign_events
+GROUP BY campaign_id, toDate(event_time), platform, region, currency;
@@ -0,0 +1,25 @@
+-- Events carry the day they belong to in the ad account's timezone, and the
+-- view aggregates by it instead of the day of event_time in the server's
+-- timezone. Existing events default to their UTC day; re-aggregate campaigns
+-- whose ad accounts report in another timezone.
+DROP VIEW mv_campaign_daily_aggregation;
+
+ALTER TABLE campaign_events
+	ADD COLUMN local_date Date DEFAULT toDate(event_time, 'UTC') AFTER event_time;
+
+CREATE MATERIALIZED VIEW mv_campaign_daily_aggregation
+TO campaign_insights
+AS SELECT
+	campaign_id,
+	local_date AS date,
+	platform,
+	region,
+	currency,
+	sum(impressions) AS impressions,
+	sum(clicks) AS clicks,
+	sum(conversions) AS conversions,
+	sum(spend) AS spend,
+	sum(revenue) AS revenue,
+	max(processed_at) AS updated_at
+FROM campaign_events
+GROUP BY campaign_id, local_date, platform, region, currency;
@@ -0,0 +1,2 @@
+ALTER TABLE campaign_events
+	DROP COLUMN placement;
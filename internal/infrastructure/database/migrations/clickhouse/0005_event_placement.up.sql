@@ -0,0 +1,4 @@
+-- Events broken down by placement, such as Meta's publisher platform and
+-- device, record it. Insights are still summed over placements.
+ALTER TABLE campaign_events
+	ADD COLUMN placement String DEFAULT '' AFTER region;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS platform_credentials;
+DROP TABLE IF EXISTS campaigns;
+DROP TABLE IF EXISTS users;
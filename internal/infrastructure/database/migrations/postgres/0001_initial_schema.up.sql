@@ -0,0 +1,35 @@
+-- Tables created by the original InitSchema. IF NOT EXISTS lets databases
+-- created before migrations adopt them.
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	role VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS campaigns (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id),
+	name VARCHAR(255) NOT NULL,
+	platform VARCHAR(50) NOT NULL,
+	budget DECIMAL(12,2) NOT NULL,
+	start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+	end_date TIMESTAMP WITH TIME ZONE NOT NULL,
+	status VARCHAR(50) NOT NULL,
+	external_id VARCHAR(255),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS platform_credentials (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id),
+	platform VARCHAR(50) NOT NULL,
+	credentials JSONB NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	UNIQUE(user_id, platform)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE platform_credentials
+	DROP COLUMN IF EXISTS status,
+	DROP COLUMN IF EXISTS expires_at,
+	DROP COLUMN IF EXISTS last_error;
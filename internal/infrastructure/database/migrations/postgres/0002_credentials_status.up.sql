@@ -0,0 +1,5 @@
+-- Track token expiry and connection health for OAuth connections
+ALTER TABLE platform_credentials
+	ADD COLUMN IF NOT EXISTS status VARCHAR(50) NOT NULL DEFAULT 'active',
+	ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN IF NOT EXISTS last_error TEXT;
@@ -0,0 +1,8 @@
+-- The last successful sync per campaign
+CREATE TABLE IF NOT EXISTS campaign_sync_state (
+	campaign_id UUID NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+	platform VARCHAR(50) NOT NULL,
+	last_synced_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (campaign_id, platform)
+);
@@ -0,0 +1,11 @@
+-- Campaigns that never synced successfully cannot be represented without windows
+DELETE FROM campaign_sync_state WHERE last_synced_at IS NULL;
+
+ALTER TABLE campaign_sync_state
+	ALTER COLUMN last_synced_at SET NOT NULL,
+	DROP COLUMN IF EXISTS window_start,
+	DROP COLUMN IF EXISTS window_end,
+	DROP COLUMN IF EXISTS last_attempt_at,
+	DROP COLUMN IF EXISTS last_status,
+	DROP COLUMN IF EXISTS last_error,
+	DROP COLUMN IF EXISTS event_count;
@@ -0,0 +1,10 @@
+-- Track the fetch window and outcome of each sync; last_synced_at only
+-- advances on success, so a campaign that never synced has no value
+ALTER TABLE campaign_sync_state
+	ALTER COLUMN last_synced_at DROP NOT NULL,
+	ADD COLUMN IF NOT EXISTS window_start DATE,
+	ADD COLUMN IF NOT EXISTS window_end DATE,
+	ADD COLUMN IF NOT EXISTS last_attempt_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN IF NOT EXISTS last_status VARCHAR(20) NOT NULL DEFAULT 'succeeded',
+	ADD COLUMN IF NOT EXISTS last_error TEXT,
+	ADD COLUMN IF NOT EXISTS event_count INTEGER NOT NULL DEFAULT 0;
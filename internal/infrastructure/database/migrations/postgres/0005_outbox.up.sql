@@ -0,0 +1,15 @@
+-- Kafka messages written in the same transaction as the change they
+-- describe, until the relay publishes them
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGSERIAL PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	message_key BYTEA,
+	payload BYTEA NOT NULL,
+	headers JSONB NOT NULL DEFAULT '[]',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	published_at TIMESTAMP WITH TIME ZONE,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
@@ -0,0 +1,27 @@
+-- Long-running backfill and re-aggregation jobs, split into chunks of days.
+-- The checkpoint is the last day done; a job whose lease expired is resumed
+-- after it by the next worker.
+CREATE TABLE jobs (
+	id UUID PRIMARY KEY,
+	type VARCHAR(50) NOT NULL,
+	campaign_id UUID NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	state VARCHAR(20) NOT NULL,
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	chunk_days INTEGER NOT NULL,
+	chunks_total INTEGER NOT NULL,
+	chunks_done INTEGER NOT NULL DEFAULT 0,
+	checkpoint DATE,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	lease_owner VARCHAR(255),
+	lease_expires_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	started_at TIMESTAMP WITH TIME ZONE,
+	finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX jobs_runnable_idx ON jobs (created_at) WHERE state IN ('pending', 'running');
+CREATE INDEX jobs_campaign_idx ON jobs (campaign_id, created_at);
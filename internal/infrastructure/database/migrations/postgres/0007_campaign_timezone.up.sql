@@ -0,0 +1,4 @@
+-- IANA timezone of the ad account a campaign reports in. Daily insights are
+-- bucketed into the days of this zone.
+ALTER TABLE campaigns
+	ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
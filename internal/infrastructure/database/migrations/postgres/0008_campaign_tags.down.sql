@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS campaigns_tags_idx;
+
+ALTER TABLE campaigns
+	DROP COLUMN IF EXISTS tags;
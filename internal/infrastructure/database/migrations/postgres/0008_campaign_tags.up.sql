@@ -0,0 +1,5 @@
+-- Free-form labels campaigns are filtered and grouped by across a portfolio
+ALTER TABLE campaigns
+	ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX campaigns_tags_idx ON campaigns USING GIN (tags);
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// OutboxHeader is a message header as stored in outbox.headers
+type OutboxHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// insertOutbox queues messages in the outbox within tx. They are published
+// by the outbox relay once tx commits, in insertion order. Each message must
+// name its topic.
+func insertOutbox(ctx context.Context, tx *sqlx.Tx, msgs ...bus.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PreparexContext(ctx, `
+		INSERT INTO outbox (topic, message_key, payload, headers)
+		VALUES ($1, $2, $3, $4)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, msg := range msgs {
+		if msg.Topic == "" {
+			return errors.New("outbox message without topic")
+		}
+
+		headers := make([]OutboxHeader, 0, len(msg.Headers))
+		for _, header := range msg.Headers {
+			headers = append(headers, OutboxHeader{Key: header.Key, Value: header.Value})
+		}
+		headersJSON, err := json.Marshal(headers)
+		if err != nil {
+			return err
+		}
+
+		if _, err := stmt.ExecContext(ctx, msg.Topic, msg.Key, msg.Value, headersJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction that is committed when fn succeeds and
+// rolled back otherwise
+func withTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,7 +1,6 @@
 package database
 
 import (
-	"context"
 	"fmt"
 	"time"
 
@@ -59,60 +58,6 @@ func NewPostgresClient() (*PostgresClient, error) {
 	return &PostgresClient{db: db}, nil
 }
 
-// InitSchema initializes the database schema if it doesn't exist
-func (c *PostgresClient) InitSchema(ctx context.Context) error {
-	// Create users table
-	if _, err := c.db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS users (
-			id UUID PRIMARY KEY,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			name VARCHAR(255) NOT NULL,
-			password VARCHAR(255) NOT NULL,
-			role VARCHAR(50) NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
-		)
-	`); err != nil {
-		return err
-	}
-
-	// Create campaigns table
-	if _, err := c.db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS campaigns (
-			id UUID PRIMARY KEY,
-			user_id UUID NOT NULL REFERENCES users(id),
-			name VARCHAR(255) NOT NULL,
-			platform VARCHAR(50) NOT NULL,
-			budget DECIMAL(12,2) NOT NULL,
-			start_date TIMESTAMP WITH TIME ZONE NOT NULL,
-			end_date TIMESTAMP WITH TIME ZONE NOT NULL,
-			status VARCHAR(50) NOT NULL,
-			external_id VARCHAR(255),
-			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
-		)
-	`); err != nil {
-		return err
-	}
-
-	// Create platform_credentials table
-	if _, err := c.db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS platform_credentials (
-			id UUID PRIMARY KEY,
-			user_id UUID NOT NULL REFERENCES users(id),
-			platform VARCHAR(50) NOT NULL,
-			credentials JSONB NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
-			UNIQUE(user_id, platform)
-		)
-	`); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // Close closes the Postgres connection
 func (c *PostgresClient) Close() error {
 	return c.db.Close()
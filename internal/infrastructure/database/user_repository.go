@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+)
+
+// uniqueViolation is the Postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// UserRepository is the Postgres repository.UserRepository
+type UserRepository struct {
+	db *sqlx.DB
+}
+
+// NewUserRepository creates a user repository on a Postgres client
+func NewUserRepository(client *PostgresClient) *UserRepository {
+	return &UserRepository{db: client.GetDB()}
+}
+
+// GetByEmail implements repository.UserRepository
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.GetContext(ctx, &user, "SELECT * FROM users WHERE email = $1", email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Create implements repository.UserRepository
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO users (id, email, name, password, role, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		user.ID, user.Email, user.Name, user.Password, user.Role, user.CreatedAt, user.UpdatedAt,
+	)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return repository.ErrUserExists
+	}
+	return err
+}
+
+// SetRole implements repository.UserRepository
+func (r *UserRepository) SetRole(ctx context.Context, email, role string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET role = $1, updated_at = NOW() WHERE email = $2",
+		role, email,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return repository.ErrUserNotFound
+	}
+	return nil
+}
@@ -2,18 +2,37 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
 )
 
-// Consumer wraps the Kafka reader with additional methods
+// Consumer is the Kafka implementation of bus.Subscriber. It reads several
+// topics as one stream. kafka-go readers are bound to
+// a single topic, so each topic gets its own reader; their messages are
+// served round-robin so a busy topic cannot starve the others.
 type Consumer struct {
-	reader *kafka.Reader
+	topics  []string
+	readers map[string]*kafka.Reader
+	fetched []chan fetchResult
+	next    int
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
 }
 
-// NewConsumer creates a new Kafka consumer
+// fetchResult is a message, or error, read ahead by a topic's reader
+type fetchResult struct {
+	msg kafka.Message
+	err error
+}
+
+// NewConsumer creates a new Kafka consumer for the given topics
 func NewConsumer(topics []string) (*Consumer, error) {
 	// Get configuration from environment or config file
 	brokers := viper.GetStringSlice("kafka.brokers")
@@ -26,41 +45,140 @@ func NewConsumer(topics []string) (*Consumer, error) {
 	if groupID == "" {
 		groupID = "campaign-analytics-consumer"
 	}
-
-	// Create Kafka reader
-	// Note: kafka-go only supports a single topic per reader as of the current version
-	// If multiple topics are needed, create multiple readers or use a different approach
 	if len(topics) == 0 {
 		// Fallback to a default topic
 		topics = []string{"campaign_events"}
 	}
 
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		GroupID:        groupID,
-		Topic:          topics[0], // Use the first topic from the list
-		MinBytes:       10e3,    // 10KB
-		MaxBytes:       10e6,    // 10MB
-		MaxWait:        1 * time.Second,
-		StartOffset:    kafka.FirstOffset,
-		CommitInterval: 1 * time.Second,
-		RetentionTime:  7 * 24 * time.Hour, // 1 week
-	})
-
-	return &Consumer{reader: reader}, nil
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Consumer{
+		topics:  topics,
+		readers: make(map[string]*kafka.Reader, len(topics)),
+		fetched: make([]chan fetchResult, len(topics)),
+		cancel:  cancel,
+	}
+
+	for i, topic := range topics {
+		// Create one Kafka reader per topic, all in the same group
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        brokers,
+			GroupID:        groupID,
+			Topic:          topic,
+			MinBytes:       10e3, // 10KB
+			MaxBytes:       10e6, // 10MB
+			MaxWait:        1 * time.Second,
+			StartOffset:    kafka.FirstOffset,
+			CommitInterval: 1 * time.Second,
+			RetentionTime:  7 * 24 * time.Hour, // 1 week
+		})
+		c.readers[topic] = reader
+		c.fetched[i] = make(chan fetchResult, 1)
+
+		c.wg.Add(1)
+		go c.readAhead(ctx, reader, c.fetched[i])
+	}
+
+	return c, nil
 }
 
-// ReadMessage reads a message from Kafka
-func (c *Consumer) ReadMessage(ctx context.Context) (kafka.Message, error) {
-	return c.reader.ReadMessage(ctx)
+// readAhead fetches the next message of a reader into out until ctx is cancelled
+func (c *Consumer) readAhead(ctx context.Context, reader *kafka.Reader, out chan<- fetchResult) {
+	defer c.wg.Done()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case out <- fetchResult{msg: msg, err: err}:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-// CommitMessages commits messages up to the provided message
-func (c *Consumer) CommitMessages(ctx context.Context, msg kafka.Message) error {
-	return c.reader.CommitMessages(ctx, msg)
+// Topics returns the topics the consumer reads
+func (c *Consumer) Topics() []string {
+	return c.topics
 }
 
-// Close closes the Kafka consumer
+// FetchMessage reads the next message without committing it. The caller
+// commits once the message is handled, so a crash redelivers it. Topics with
+// a message ready are served in turn.
+func (c *Consumer) FetchMessage(ctx context.Context) (bus.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Take the first ready topic after the one served last
+	n := len(c.fetched)
+	for i := 0; i < n; i++ {
+		idx := (c.next + i) % n
+		select {
+		case result := <-c.fetched[idx]:
+			c.next = (idx + 1) % n
+			return toBusMessage(result.msg), result.err
+		default:
+		}
+	}
+
+	// Nothing ready: wait for whichever topic delivers first
+	cases := make([]reflect.SelectCase, n+1)
+	for i, ch := range c.fetched {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
+	}
+	cases[n] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
+	chosen, value, _ := reflect.Select(cases)
+	if chosen == n {
+		return bus.Message{}, ctx.Err()
+	}
+	c.next = (chosen + 1) % n
+	result := value.Interface().(fetchResult)
+	return toBusMessage(result.msg), result.err
+}
+
+// ReadMessage reads the next message and commits it right away
+func (c *Consumer) ReadMessage(ctx context.Context) (bus.Message, error) {
+	msg, err := c.FetchMessage(ctx)
+	if err != nil {
+		return msg, err
+	}
+	return msg, c.CommitMessages(ctx, msg)
+}
+
+// CommitMessages commits each partition up to the latest of the provided messages
+func (c *Consumer) CommitMessages(ctx context.Context, msgs ...bus.Message) error {
+	byTopic := make(map[string][]kafka.Message)
+	for _, msg := range msgs {
+		byTopic[msg.Topic] = append(byTopic[msg.Topic], fromBusMessage(msg))
+	}
+
+	var errs []error
+	for topic, topicMsgs := range byTopic {
+		reader, exists := c.readers[topic]
+		if !exists {
+			errs = append(errs, errors.New("kafka: commit for unknown topic "+topic))
+			continue
+		}
+		if err := reader.CommitMessages(ctx, topicMsgs...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops reading ahead and closes the readers, flushing pending commits
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	c.cancel()
+	c.wg.Wait()
+
+	var errs []error
+	for _, reader := range c.readers {
+		if err := reader.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
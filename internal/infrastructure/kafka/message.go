@@ -2,8 +2,41 @@ package kafka
 
 import (
 	"github.com/segmentio/kafka-go"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
 )
 
-// Message is a wrapper around kafka-go's Message to maintain a consistent interface
-// and allow for future extensions without changing the consumer code
-type Message = kafka.Message
+// toBusMessage converts a kafka-go message to a bus message
+func toBusMessage(msg kafka.Message) bus.Message {
+	headers := make([]bus.Header, 0, len(msg.Headers))
+	for _, header := range msg.Headers {
+		headers = append(headers, bus.Header{Key: header.Key, Value: header.Value})
+	}
+
+	return bus.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+		Time:      msg.Time,
+	}
+}
+
+// fromBusMessage converts a bus message to a kafka-go message
+func fromBusMessage(msg bus.Message) kafka.Message {
+	headers := make([]kafka.Header, 0, len(msg.Headers))
+	for _, header := range msg.Headers {
+		headers = append(headers, kafka.Header{Key: header.Key, Value: header.Value})
+	}
+
+	return kafka.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+		Time:      msg.Time,
+	}
+}
@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// ErrNoMessage is returned when no message exists at the requested offset
+var ErrNoMessage = errors.New("no message at offset")
+
+// Partitions lists the partition IDs of a topic
+func Partitions(ctx context.Context, topic string) ([]int, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers()[0])
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(partitions))
+	for _, partition := range partitions {
+		ids = append(ids, partition.ID)
+	}
+	return ids, nil
+}
+
+// ReadPartition reads up to limit messages of one partition starting at
+// offset, without joining a consumer group. A negative offset starts at the
+// first retained message. It stops early at the end of the partition.
+func ReadPartition(ctx context.Context, topic string, partition int, offset int64, limit int) ([]bus.Message, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", brokers()[0], topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return nil, err
+	}
+	if offset < first {
+		offset = first
+	}
+	if offset >= last || limit <= 0 {
+		return []bus.Message{}, nil
+	}
+	if _, err := conn.Seek(offset, kafka.SeekAbsolute); err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	want := last - offset
+	if want > int64(limit) {
+		want = int64(limit)
+	}
+
+	messages := make([]bus.Message, 0, want)
+	for int64(len(messages)) < want {
+		batch := conn.ReadBatch(1, 10e6)
+		for int64(len(messages)) < want {
+			msg, err := batch.ReadMessage()
+			if err != nil {
+				break
+			}
+			messages = append(messages, toBusMessage(msg))
+		}
+		// Closing reports why the batch ended early, e.g. the read deadline
+		if err := batch.Close(); err != nil {
+			if len(messages) > 0 {
+				return messages, nil
+			}
+			return nil, err
+		}
+	}
+
+	return messages, nil
+}
+
+// ReadMessageAt reads the message of a partition at an exact offset
+func ReadMessageAt(ctx context.Context, topic string, partition int, offset int64) (bus.Message, error) {
+	messages, err := ReadPartition(ctx, topic, partition, offset, 1)
+	if err != nil {
+		return bus.Message{}, err
+	}
+	if len(messages) == 0 || messages[0].Offset != offset {
+		return bus.Message{}, ErrNoMessage
+	}
+	return messages[0], nil
+}
+
+// brokers returns the configured broker addresses
+func brokers() []string {
+	brokers := viper.GetStringSlice("kafka.brokers")
+	if len(brokers) == 0 {
+		brokers = []string{"localhost:9092"}
+	}
+	return brokers
+}
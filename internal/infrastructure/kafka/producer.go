@@ -7,14 +7,16 @@ import (
 
 	"github.com/segmentio/kafka-go"
 	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
 )
 
-// Producer wraps the Kafka writer with additional methods
+// Producer is the Kafka implementation of bus.Publisher
 type Producer struct {
 	writer *kafka.Writer
 }
 
-// NewProducer creates a new Kafka producer
+// NewProducer creates a new Kafka producer. With an empty topic, each
+// message passed to WriteMessages names its own topic.
 func NewProducer(topic string) (*Producer, error) {
 	// Get configuration from environment or config file
 	brokers := viper.GetStringSlice("kafka.brokers")
@@ -63,6 +65,15 @@ func (p *Producer) SendMessage(ctx context.Context, key string, value interface{
 	})
 }
 
+// WriteMessages sends prepared messages, keeping their keys and headers
+func (p *Producer) WriteMessages(ctx context.Context, msgs ...bus.Message) error {
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		kafkaMsgs = append(kafkaMsgs, fromBusMessage(msg))
+	}
+	return p.writer.WriteMessages(ctx, kafkaMsgs...)
+}
+
 // Close closes the Kafka producer
 func (p *Producer) Close() error {
 	return p.writer.Close()
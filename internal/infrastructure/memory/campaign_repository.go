@@ -0,0 +1,320 @@
+// Package memory holds in-process implementations of the repository
+// interfaces. They back unit tests and keep nothing across restarts.
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/bus"
+)
+
+// CampaignRepository is an in-memory repository.CampaignRepository. Messages
+// queued with a change are kept in order and returned by Outbox.
+type CampaignRepository struct {
+	mu         sync.Mutex
+	campaigns  map[uuid.UUID]models.Campaign
+	syncStates map[syncStateKey]models.CampaignSyncState
+	outbox     []bus.Message
+}
+
+// syncStateKey identifies the sync state of a campaign on a platform
+type syncStateKey struct {
+	campaignID uuid.UUID
+	platform   models.Platform
+}
+
+// NewCampaignRepository creates an empty campaign repository
+func NewCampaignRepository() *CampaignRepository {
+	return &CampaignRepository{
+		campaigns:  make(map[uuid.UUID]models.Campaign),
+		syncStates: make(map[syncStateKey]models.CampaignSyncState),
+	}
+}
+
+// Outbox returns the messages queued so far, oldest first
+func (r *CampaignRepository) Outbox() []bus.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]bus.Message(nil), r.outbox...)
+}
+
+// Get implements repository.CampaignRepository
+func (r *CampaignRepository) Get(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	campaign, exists := r.campaigns[id]
+	if !exists {
+		return nil, repository.ErrCampaignNotFound
+	}
+	return &campaign, nil
+}
+
+// List implements repository.CampaignRepository
+func (r *CampaignRepository) List(ctx context.Context, filter repository.CampaignFilter) ([]models.Campaign, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	campaigns := []models.Campaign{}
+	for _, campaign := range r.campaigns {
+		if filter.UserID != uuid.Nil && campaign.UserID != filter.UserID {
+			continue
+		}
+		if filter.Platform != nil && campaign.Platform != *filter.Platform {
+			continue
+		}
+		if filter.Status != nil && campaign.Status != *filter.Status {
+			continue
+		}
+		if filter.IDs != nil && !containsID(filter.IDs, campaign.ID) {
+			continue
+		}
+		if !hasTags(campaign.Tags, filter.Tags) {
+			continue
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	sort.Slice(campaigns, func(i, j int) bool {
+		return campaigns[i].CreatedAt.After(campaigns[j].CreatedAt)
+	})
+	return campaigns, nil
+}
+
+// ListDue implements repository.CampaignRepository. Dates are compared in UTC.
+func (r *CampaignRepository) ListDue(ctx context.Context, day, syncedBefore time.Time) ([]models.Campaign, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type dueCampaign struct {
+		campaign    models.Campaign
+		lastAttempt *time.Time
+	}
+	var due []dueCampaign
+	for _, campaign := range r.campaigns {
+		if campaign.Status != models.CampaignStatusActive {
+			continue
+		}
+		if dateOf(campaign.StartDate).After(dateOf(day)) || dateOf(campaign.EndDate).Before(dateOf(day)) {
+			continue
+		}
+
+		state := r.syncStates[syncStateKey{campaignID: campaign.ID, platform: campaign.Platform}]
+		lastAttempt := state.LastAttemptAt
+		if lastAttempt == nil {
+			lastAttempt = state.LastSyncedAt
+		}
+		if lastAttempt != nil && lastAttempt.After(syncedBefore) {
+			continue
+		}
+		due = append(due, dueCampaign{campaign: campaign, lastAttempt: lastAttempt})
+	}
+
+	// Never attempted campaigns come first
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := due[i].lastAttempt, due[j].lastAttempt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+
+	campaigns := make([]models.Campaign, 0, len(due))
+	for _, d := range due {
+		campaigns = append(campaigns, d.campaign)
+	}
+	return campaigns, nil
+}
+
+// Create implements repository.CampaignRepository
+func (r *CampaignRepository) Create(ctx context.Context, campaign *models.Campaign, messages ...bus.Message) error {
+	if err := validateOutbox(messages); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.campaigns[campaign.ID]; exists {
+		return errDuplicateKey
+	}
+	stored := *campaign
+	stored.Tags = append(pq.StringArray{}, campaign.Tags...)
+	r.campaigns[campaign.ID] = stored
+	r.outbox = append(r.outbox, messages...)
+	return nil
+}
+
+// Update implements repository.CampaignRepository. The repository stays
+// locked while messages runs, so it must not call back into it.
+func (r *CampaignRepository) Update(ctx context.Context, campaign *models.Campaign, messages func(previous *models.Campaign) ([]bus.Message, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, exists := r.campaigns[campaign.ID]
+	if !exists {
+		return repository.ErrCampaignNotFound
+	}
+	campaign.UserID = previous.UserID
+	campaign.CreatedAt = previous.CreatedAt
+
+	msgs, err := messages(&previous)
+	if err != nil {
+		return err
+	}
+	if err := validateOutbox(msgs); err != nil {
+		return err
+	}
+
+	stored := *campaign
+	stored.Tags = append(pq.StringArray{}, campaign.Tags...)
+	r.campaigns[campaign.ID] = stored
+	r.outbox = append(r.outbox, msgs...)
+	return nil
+}
+
+// GetSyncState implements repository.CampaignRepository
+func (r *CampaignRepository) GetSyncState(ctx context.Context, campaignID uuid.UUID, platform models.Platform) (*models.CampaignSyncState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, exists := r.syncStates[syncStateKey{campaignID: campaignID, platform: platform}]
+	if !exists {
+		return nil, repository.ErrSyncStateNotFound
+	}
+	return copySyncState(state), nil
+}
+
+// RecordSyncSuccess implements repository.CampaignRepository
+func (r *CampaignRepository) RecordSyncSuccess(ctx context.Context, campaign *models.Campaign, windowStart, windowEnd time.Time, eventCount int, messages ...bus.Message) error {
+	if err := validateOutbox(messages); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	start, end := dateOf(windowStart), dateOf(windowEnd)
+	r.syncStates[syncStateKey{campaignID: campaign.ID, platform: campaign.Platform}] = models.CampaignSyncState{
+		CampaignID:    campaign.ID,
+		Platform:      campaign.Platform,
+		WindowStart:   &start,
+		WindowEnd:     &end,
+		LastSyncedAt:  &now,
+		LastAttemptAt: &now,
+		LastStatus:    models.SyncStatusSucceeded,
+		EventCount:    eventCount,
+		UpdatedAt:     now,
+	}
+	r.outbox = append(r.outbox, messages...)
+	return nil
+}
+
+// RecordSyncAttempt implements repository.CampaignRepository
+func (r *CampaignRepository) RecordSyncAttempt(ctx context.Context, campaign *models.Campaign, status models.SyncStatus, syncErr error, eventCount int, messages ...bus.Message) error {
+	if err := validateOutbox(messages); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := syncStateKey{campaignID: campaign.ID, platform: campaign.Platform}
+	state := r.syncStates[key]
+	now := time.Now()
+
+	state.CampaignID = campaign.ID
+	state.Platform = campaign.Platform
+	state.LastAttemptAt = &now
+	state.LastStatus = status
+	state.LastError = nil
+	if syncErr != nil {
+		lastError := syncErr.Error()
+		state.LastError = &lastError
+	}
+	state.EventCount = eventCount
+	state.UpdatedAt = now
+	r.syncStates[key] = state
+	r.outbox = append(r.outbox, messages...)
+	return nil
+}
+
+// copySyncState returns a copy of a state that shares no pointers with it
+func copySyncState(state models.CampaignSyncState) *models.CampaignSyncState {
+	copyTime := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		c := *t
+		return &c
+	}
+
+	state.WindowStart = copyTime(state.WindowStart)
+	state.WindowEnd = copyTime(state.WindowEnd)
+	state.LastSyncedAt = copyTime(state.LastSyncedAt)
+	state.LastAttemptAt = copyTime(state.LastAttemptAt)
+	if state.LastError != nil {
+		lastError := *state.LastError
+		state.LastError = &lastError
+	}
+	return &state
+}
+
+// validateOutbox checks that every message names its topic, as the outbox
+// table requires
+func validateOutbox(messages []bus.Message) error {
+	for _, msg := range messages {
+		if msg.Topic == "" {
+			return errMessageWithoutTopic
+		}
+	}
+	return nil
+}
+
+// dateOf returns the UTC date of t as midnight
+func dateOf(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// containsID reports whether ids contains id
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTags reports whether tags contains every wanted tag
+func hasTags(tags, wanted []string) bool {
+	for _, tag := range wanted {
+		found := false
+		for _, candidate := range tags {
+			if candidate == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Error definitions
+var (
+	errDuplicateKey        = errors.New("memory: duplicate key")
+	errMessageWithoutTopic = errors.New("outbox message without topic")
+)
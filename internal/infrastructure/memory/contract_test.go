@@ -0,0 +1,21 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/zocket/campaign-analytics/internal/domain/repository/repotest"
+)
+
+func TestContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Stores {
+		events := NewEventStore()
+		return repotest.Stores{
+			Campaigns: NewCampaignRepository(),
+			Users:     NewUserRepository(),
+			Events:    events,
+			Insights:  NewInsightsStore(events),
+			Jobs:      NewJobRepository(),
+			FXRates:   NewFXRateStore(),
+		}
+	})
+}
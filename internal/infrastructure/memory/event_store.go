@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+)
+
+// EventStore is an in-memory repository.EventStore. Like a DateTime column,
+// it keeps times to the second.
+type EventStore struct {
+	mu     sync.RWMutex
+	events map[eventKey]models.CampaignEvent
+}
+
+// eventKey identifies the snapshot an event belongs to
+type eventKey struct {
+	campaignID       uuid.UUID
+	eventTime        int64
+	deduplicationKey string
+}
+
+// NewEventStore creates an empty event store
+func NewEventStore() *EventStore {
+	return &EventStore{events: make(map[eventKey]models.CampaignEvent)}
+}
+
+// Insert implements repository.EventStore. An event replaces the stored
+// snapshot unless that one was processed later.
+func (s *EventStore) Insert(ctx context.Context, events []models.CampaignEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		event.EventTime = toSecond(event.EventTime)
+		if event.LocalDate.IsZero() {
+			event.LocalDate = event.EventTime
+		}
+		event.LocalDate = dateOf(event.LocalDate)
+		event.ReceivedAt = toSecond(event.ReceivedAt)
+		event.ProcessedAt = toSecond(event.ProcessedAt)
+
+		key := eventKey{
+			campaignID:       event.CampaignID,
+			eventTime:        event.EventTime.Unix(),
+			deduplicationKey: event.DeduplicationKey,
+		}
+		if stored, exists := s.events[key]; exists && stored.ProcessedAt.After(event.ProcessedAt) {
+			continue
+		}
+		s.events[key] = event
+	}
+	return nil
+}
+
+// Latest implements repository.EventStore
+func (s *EventStore) Latest(ctx context.Context, campaignID uuid.UUID, eventTime time.Time, deduplicationKey string) (*models.CampaignEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	event, exists := s.events[eventKey{
+		campaignID:       campaignID,
+		eventTime:        eventTime.Unix(),
+		deduplicationKey: deduplicationKey,
+	}]
+	if !exists {
+		return nil, repository.ErrEventNotFound
+	}
+	return &event, nil
+}
+
+// toSecond truncates t to the second in UTC, the precision of a DateTime column
+func toSecond(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+// FXRateStore is an in-memory repository.FXRateStore
+type FXRateStore struct {
+	mu    sync.RWMutex
+	rates map[fxRateKey]float64
+}
+
+// fxRateKey identifies the rate of a currency on a day
+type fxRateKey struct {
+	base     string
+	date     int64
+	currency string
+}
+
+// NewFXRateStore creates an empty exchange rate store
+func NewFXRateStore() *FXRateStore {
+	return &FXRateStore{rates: make(map[fxRateKey]float64)}
+}
+
+// Store implements repository.FXRateStore
+func (s *FXRateStore) Store(ctx context.Context, rates []models.FXRate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rate := range rates {
+		s.rates[fxRateKey{base: rate.Base, date: dateOf(rate.Date).Unix(), currency: rate.Currency}] = rate.Rate
+	}
+	return nil
+}
+
+// List implements repository.FXRateStore
+func (s *FXRateStore) List(ctx context.Context, base string, currencies []string, startDate, endDate time.Time) ([]models.FXRate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(currencies))
+	for _, currency := range currencies {
+		wanted[currency] = true
+	}
+
+	start, end := dateOf(startDate).Unix(), dateOf(endDate).Unix()
+	rates := []models.FXRate{}
+	for key, rate := range s.rates {
+		if key.base != base || !wanted[key.currency] || key.date < start || key.date > end {
+			continue
+		}
+		rates = append(rates, models.FXRate{
+			Base:     key.base,
+			Date:     time.Unix(key.date, 0).UTC(),
+			Currency: key.currency,
+			Rate:     rate,
+		})
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		if !rates[i].Date.Equal(rates[j].Date) {
+			return rates[i].Date.Before(rates[j].Date)
+		}
+		return rates[i].Currency < rates[j].Currency
+	})
+	return rates, nil
+}
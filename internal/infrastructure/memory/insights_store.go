@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+// InsightsStore is an in-memory repository.InsightsStore. Insights are
+// computed from the latest events of an EventStore on every query, so they
+// never need re-aggregating.
+type InsightsStore struct {
+	events *EventStore
+}
+
+// NewInsightsStore creates an insights store over the events of an event store
+func NewInsightsStore(events *EventStore) *InsightsStore {
+	return &InsightsStore{events: events}
+}
+
+// Query implements repository.InsightsStore
+func (s *InsightsStore) Query(ctx context.Context, params models.CampaignInsightsParams) ([]models.CampaignInsights, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	loc, err := models.LoadTimezone(params.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	s.events.mu.RLock()
+	defer s.events.mu.RUnlock()
+
+	var rows []models.CampaignInsights
+	for _, event := range s.events.events {
+		if !matchesInsightsParams(&event, params, loc) {
+			continue
+		}
+
+		// Hourly buckets are hours in the requested timezone, coarser ones
+		// start from the day in the ad account's timezone
+		date := event.LocalDate
+		if params.Granularity == models.GranularityHourly {
+			date = event.EventTime.In(loc)
+		}
+
+		rows = append(rows, models.CampaignInsights{
+			CampaignID:  event.CampaignID,
+			Date:        date,
+			Platform:    event.Platform,
+			Region:      event.Region,
+			Currency:    event.Currency,
+			Impressions: event.Impressions,
+			Clicks:      event.Clicks,
+			Conversions: event.Conversions,
+			Spend:       event.Spend,
+			Revenue:     event.Revenue,
+			UpdatedAt:   event.ProcessedAt,
+		})
+	}
+
+	return models.GroupInsights(rows, params.GroupBy, params.Granularity, params.WeekStart), nil
+}
+
+// QueryPeriods implements repository.InsightsStore
+func (s *InsightsStore) QueryPeriods(ctx context.Context, params models.CampaignInsightsParams, periods []models.DateRange) ([][]models.CampaignInsights, error) {
+	results := make([][]models.CampaignInsights, len(periods))
+	for i, period := range periods {
+		params.StartDate, params.EndDate = period.StartDate, period.EndDate
+		rows, err := s.Query(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = rows
+	}
+	return results, nil
+}
+
+// Reaggregate implements repository.InsightsStore. Queries always read the
+// latest events, so there is nothing to rebuild.
+func (s *InsightsStore) Reaggregate(ctx context.Context, campaignID uuid.UUID, startDate, endDate time.Time) error {
+	return ctx.Err()
+}
+
+// matchesInsightsParams reports whether an event falls within the filters of
+// an insights query. Daily and coarser queries filter on the event's local
+// date, hourly ones on its time between the midnights of loc.
+func matchesInsightsParams(event *models.CampaignEvent, params models.CampaignInsightsParams, loc *time.Location) bool {
+	if params.CampaignID != uuid.Nil && event.CampaignID != params.CampaignID {
+		return false
+	}
+	if params.CampaignIDs != nil && !containsID(params.CampaignIDs, event.CampaignID) {
+		return false
+	}
+	if params.Platform != nil && event.Platform != *params.Platform {
+		return false
+	}
+	if params.Region != nil && *params.Region != "" && event.Region != *params.Region {
+		return false
+	}
+
+	if params.Granularity == models.GranularityHourly {
+		if !params.StartDate.IsZero() && event.EventTime.Before(models.StartOfDayIn(params.StartDate, loc)) {
+			return false
+		}
+		// Include every hour of the last requested day
+		if !params.EndDate.IsZero() && !event.EventTime.Before(models.StartOfDayIn(params.EndDate.AddDate(0, 0, 1), loc)) {
+			return false
+		}
+		return true
+	}
+
+	if !params.StartDate.IsZero() && event.LocalDate.Before(dateOf(params.StartDate)) {
+		return false
+	}
+	if !params.EndDate.IsZero() && event.LocalDate.After(dateOf(params.EndDate)) {
+		return false
+	}
+	return true
+}
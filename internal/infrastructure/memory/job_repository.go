@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+)
+
+// JobRepository is an in-memory repository.JobRepository
+type JobRepository struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]models.Job
+}
+
+// NewJobRepository creates an empty job repository
+func NewJobRepository() *JobRepository {
+	return &JobRepository{jobs: make(map[uuid.UUID]models.Job)}
+}
+
+// Create implements repository.JobRepository
+func (r *JobRepository) Create(ctx context.Context, job *models.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.jobs[job.ID]; exists {
+		return errDuplicateKey
+	}
+
+	stored := *copyJob(*job)
+	stored.StartDate = dateOf(stored.StartDate)
+	stored.EndDate = dateOf(stored.EndDate)
+	r.jobs[job.ID] = stored
+	return nil
+}
+
+// Get implements repository.JobRepository
+func (r *JobRepository) Get(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return nil, repository.ErrJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+// Claim implements repository.JobRepository
+func (r *JobRepository) Claim(ctx context.Context, owner string, leaseTTL time.Duration) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var claimed *models.Job
+	for _, job := range r.jobs {
+		expired := job.State == models.JobStateRunning && job.LeaseExpiresAt != nil && job.LeaseExpiresAt.Before(now)
+		if job.State != models.JobStatePending && !expired {
+			continue
+		}
+		if claimed == nil || job.CreatedAt.Before(claimed.CreatedAt) {
+			claimed = copyJob(job)
+		}
+	}
+	if claimed == nil {
+		return nil, repository.ErrNoJob
+	}
+
+	expiresAt := now.Add(leaseTTL)
+	claimed.State = models.JobStateRunning
+	claimed.LeaseOwner = &owner
+	claimed.LeaseExpiresAt = &expiresAt
+	claimed.Attempts++
+	if claimed.StartedAt == nil {
+		claimed.StartedAt = &now
+	}
+	claimed.UpdatedAt = now
+	r.jobs[claimed.ID] = *claimed
+	return copyJob(*claimed), nil
+}
+
+// Checkpoint implements repository.JobRepository
+func (r *JobRepository) Checkpoint(ctx context.Context, id uuid.UUID, owner string, checkpoint time.Time, chunksDone int, leaseTTL time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, err := r.leased(id, owner)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	day := dateOf(checkpoint)
+	expiresAt := now.Add(leaseTTL)
+	job.Checkpoint = &day
+	job.ChunksDone = chunksDone
+	job.LeaseExpiresAt = &expiresAt
+	job.UpdatedAt = now
+	r.jobs[id] = job
+	return nil
+}
+
+// Finish implements repository.JobRepository
+func (r *JobRepository) Finish(ctx context.Context, id uuid.UUID, owner string, state models.JobState, jobErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, err := r.leased(id, owner)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.State = state
+	if jobErr != nil {
+		lastError := jobErr.Error()
+		job.LastError = &lastError
+	}
+	job.LeaseOwner = nil
+	job.LeaseExpiresAt = nil
+	job.FinishedAt = &now
+	job.UpdatedAt = now
+	r.jobs[id] = job
+	return nil
+}
+
+// Cancel implements repository.JobRepository
+func (r *JobRepository) Cancel(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return nil, repository.ErrJobNotFound
+	}
+	if job.State.IsFinal() {
+		return nil, repository.ErrJobFinished
+	}
+
+	now := time.Now()
+	job.State = models.JobStateCancelled
+	job.LeaseOwner = nil
+	job.LeaseExpiresAt = nil
+	job.FinishedAt = &now
+	job.UpdatedAt = now
+	r.jobs[id] = job
+	return copyJob(job), nil
+}
+
+// leased returns a running job held by owner, or ErrJobLeaseLost
+func (r *JobRepository) leased(id uuid.UUID, owner string) (models.Job, error) {
+	job, exists := r.jobs[id]
+	if !exists || job.State != models.JobStateRunning || job.LeaseOwner == nil || *job.LeaseOwner != owner {
+		return models.Job{}, repository.ErrJobLeaseLost
+	}
+	return job, nil
+}
+
+// copyJob returns a copy of a job that shares no pointers with it
+func copyJob(job models.Job) *models.Job {
+	copyTime := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		c := *t
+		return &c
+	}
+	copyString := func(s *string) *string {
+		if s == nil {
+			return nil
+		}
+		c := *s
+		return &c
+	}
+
+	job.Checkpoint = copyTime(job.Checkpoint)
+	job.StartedAt = copyTime(job.StartedAt)
+	job.FinishedAt = copyTime(job.FinishedAt)
+	job.LeaseExpiresAt = copyTime(job.LeaseExpiresAt)
+	job.LastError = copyString(job.LastError)
+	job.LeaseOwner = copyString(job.LeaseOwner)
+	return &job
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"github.com/zocket/campaign-analytics/internal/domain/repository"
+)
+
+// UserRepository is an in-memory repository.UserRepository
+type UserRepository struct {
+	mu      sync.Mutex
+	byEmail map[string]models.User
+}
+
+// NewUserRepository creates an empty user repository
+func NewUserRepository() *UserRepository {
+	return &UserRepository{byEmail: make(map[string]models.User)}
+}
+
+// GetByEmail implements repository.UserRepository
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.byEmail[email]
+	if !exists {
+		return nil, repository.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// Create implements repository.UserRepository
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byEmail[user.Email]; exists {
+		return repository.ErrUserExists
+	}
+	for _, existing := range r.byEmail {
+		if existing.ID == user.ID {
+			return errDuplicateKey
+		}
+	}
+
+	r.byEmail[user.Email] = *user
+	return nil
+}
+
+// SetRole implements repository.UserRepository
+func (r *UserRepository) SetRole(ctx context.Context, email, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.byEmail[email]
+	if !exists {
+		return repository.ErrUserNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	r.byEmail[email] = user
+	return nil
+}
@@ -0,0 +1,306 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+// ErrProviderNotConfigured is returned for platforms without OAuth client settings
+var ErrProviderNotConfigured = errors.New("oauth provider not configured")
+
+// tokenStyle describes how a platform's token endpoint deviates from RFC 6749
+type tokenStyle int
+
+const (
+	// styleStandard is a form-encoded RFC 6749 token endpoint (Google, LinkedIn)
+	styleStandard tokenStyle = iota
+	// styleMeta has no refresh tokens; long-lived tokens are re-exchanged
+	// with the fb_exchange_token grant
+	styleMeta
+	// styleTikTok takes a JSON body with app_id/secret/auth_code and wraps
+	// the token in a data envelope
+	styleTikTok
+)
+
+// Config holds the OAuth client settings for one platform
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Token is the result of a code exchange or refresh
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    *time.Time
+}
+
+// TokenError is an error response from a token endpoint
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("oauth token endpoint returned %d: %s %s", e.StatusCode, e.Code, e.Description)
+}
+
+// Permanent reports whether retrying the same grant can never succeed,
+// e.g. a revoked or expired refresh token
+func (e *TokenError) Permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+// Provider runs the authorization code flow against one platform
+type Provider struct {
+	platform   models.Platform
+	config     Config
+	style      tokenStyle
+	httpClient *http.Client
+}
+
+// NewProvider creates a provider for a platform
+func NewProvider(platform models.Platform, config Config) *Provider {
+	style := styleStandard
+	switch platform {
+	case models.PlatformMeta:
+		style = styleMeta
+	case models.PlatformTikTok:
+		style = styleTikTok
+	}
+
+	return &Provider{
+		platform: platform,
+		config:   config,
+		style:    style,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// NewProviders creates providers for every platform with a configured client
+// ID under platforms.<platform>.oauth
+func NewProviders() map[models.Platform]*Provider {
+	providers := make(map[models.Platform]*Provider)
+	for _, platform := range []models.Platform{
+		models.PlatformMeta,
+		models.PlatformGoogle,
+		models.PlatformLinkedIn,
+		models.PlatformTikTok,
+	} {
+		prefix := "platforms." + string(platform) + ".oauth."
+		config := Config{
+			ClientID:     viper.GetString(prefix + "client_id"),
+			ClientSecret: viper.GetString(prefix + "client_secret"),
+			AuthURL:      viper.GetString(prefix + "auth_url"),
+			TokenURL:     viper.GetString(prefix + "token_url"),
+			RedirectURL:  viper.GetString(prefix + "redirect_url"),
+			Scopes:       viper.GetStringSlice(prefix + "scopes"),
+		}
+		if config.ClientID == "" || config.AuthURL == "" || config.TokenURL == "" {
+			continue
+		}
+		providers[platform] = NewProvider(platform, config)
+	}
+	return providers
+}
+
+// AuthCodeURL returns the consent page URL the user is redirected to
+func (p *Provider) AuthCodeURL(state string) string {
+	params := url.Values{}
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("state", state)
+
+	if p.style == styleTikTok {
+		params.Set("app_id", p.config.ClientID)
+	} else {
+		params.Set("client_id", p.config.ClientID)
+		params.Set("response_type", "code")
+		if len(p.config.Scopes) > 0 {
+			params.Set("scope", strings.Join(p.config.Scopes, " "))
+		}
+	}
+
+	if p.platform == models.PlatformGoogle {
+		// Google only issues a refresh token for offline access, and only
+		// on a fresh consent
+		params.Set("access_type", "offline")
+		params.Set("prompt", "consent")
+	}
+
+	separator := "?"
+	if strings.Contains(p.config.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.config.AuthURL + separator + params.Encode()
+}
+
+// Exchange trades an authorization code for a token
+func (p *Provider) Exchange(ctx context.Context, code string) (*Token, error) {
+	if p.style == styleTikTok {
+		return p.requestJSON(ctx, map[string]string{
+			"app_id":    p.config.ClientID,
+			"secret":    p.config.ClientSecret,
+			"auth_code": code,
+		})
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", "authorization_code")
+	params.Set("code", code)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	return p.requestForm(ctx, params)
+}
+
+// Refresh renews a token. Meta has no refresh tokens, so its current
+// long-lived access token is exchanged for a new one instead.
+func (p *Provider) Refresh(ctx context.Context, current Token) (*Token, error) {
+	params := url.Values{}
+	switch {
+	case p.style == styleMeta:
+		params.Set("grant_type", "fb_exchange_token")
+		params.Set("fb_exchange_token", current.AccessToken)
+	case current.RefreshToken == "":
+		return nil, &TokenError{StatusCode: http.StatusBadRequest, Code: "invalid_grant", Description: "no refresh token"}
+	case p.style == styleTikTok:
+		return p.requestJSON(ctx, map[string]string{
+			"app_id":        p.config.ClientID,
+			"secret":        p.config.ClientSecret,
+			"grant_type":    "refresh_token",
+			"refresh_token": current.RefreshToken,
+		})
+	default:
+		params.Set("grant_type", "refresh_token")
+		params.Set("refresh_token", current.RefreshToken)
+	}
+
+	token, err := p.requestForm(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers may omit the refresh token when it is unchanged
+	if token.RefreshToken == "" {
+		token.RefreshToken = current.RefreshToken
+	}
+	return token, nil
+}
+
+// tokenResponse is the RFC 6749 token response, also used inside TikTok's data envelope
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestForm posts a form-encoded grant with the client credentials
+func (p *Provider) requestForm(ctx context.Context, params url.Values) (*Token, error) {
+	params.Set("client_id", p.config.ClientID)
+	params.Set("client_secret", p.config.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	body, status, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp tokenResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, &TokenError{StatusCode: status, Code: "invalid_response", Description: err.Error()}
+	}
+	if status != http.StatusOK || resp.AccessToken == "" {
+		return nil, &TokenError{StatusCode: status, Code: resp.Error, Description: resp.ErrorDescription}
+	}
+
+	return resp.token(), nil
+}
+
+// requestJSON posts a JSON grant and unwraps TikTok's response envelope
+func (p *Provider) requestJSON(ctx context.Context, payload map[string]string) (*Token, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	body, status, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Code    int           `json:"code"`
+		Message string        `json:"message"`
+		Data    tokenResponse `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, &TokenError{StatusCode: status, Code: "invalid_response", Description: err.Error()}
+	}
+	if status != http.StatusOK || resp.Code != 0 || resp.Data.AccessToken == "" {
+		// TikTok reports grant errors with HTTP 200 and a non-zero code
+		if status == http.StatusOK {
+			status = http.StatusBadRequest
+		}
+		return nil, &TokenError{StatusCode: status, Code: fmt.Sprintf("%d", resp.Code), Description: resp.Message}
+	}
+
+	return resp.Data.token(), nil
+}
+
+// do executes a token request and returns the body and status code
+func (p *Provider) do(req *http.Request) ([]byte, int, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return body, resp.StatusCode, nil
+}
+
+// token converts the response to a Token with an absolute expiry
+func (r tokenResponse) token() *Token {
+	token := &Token{
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+	}
+	if r.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+		token.ExpiresAt = &expiresAt
+	}
+	return token
+}
@@ -0,0 +1,99 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrInvalidState is returned when a callback state is forged, malformed or expired
+var ErrInvalidState = errors.New("invalid or expired oauth state")
+
+// State is carried through the provider's consent page and identifies who
+// started the flow, so the callback needs no session. Its nonce is also held
+// by the browser that started the flow, tying the callback to it.
+type State struct {
+	UserID    uuid.UUID       `json:"user_id"`
+	Platform  models.Platform `json:"platform"`
+	AccountID string          `json:"account_id"`
+	Nonce     string          `json:"nonce"`
+	ExpiresAt int64           `json:"exp"`
+}
+
+// stateKeyLabel separates the derived state key from other uses of the JWT key
+const stateKeyLabel = "oauth-state"
+
+// StateKey returns the key states are signed with: oauth.state_key when
+// configured, otherwise a key derived from jwtKey with HKDF-SHA256, so a
+// state signature is never valid as a JWT signature or the other way round
+func StateKey(jwtKey string) []byte {
+	if key := viper.GetString("oauth.state_key"); key != "" {
+		return []byte(key)
+	}
+
+	// HKDF-SHA256 yields up to 8160 bytes, so reading 32 cannot fail
+	key := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, []byte(jwtKey), nil, []byte(stateKeyLabel)), key)
+	return key
+}
+
+// NewNonce returns a random nonce for a state
+func NewNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(nonce), nil
+}
+
+// SignState encodes and signs a state with HMAC-SHA256
+func SignState(key []byte, state State) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(key, encoded), nil
+}
+
+// VerifyState checks the signature and expiry of a signed state
+func VerifyState(key []byte, signed string) (*State, error) {
+	encoded, signature, found := strings.Cut(signed, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(sign(key, encoded))) {
+		return nil, ErrInvalidState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+
+	var state State
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, ErrInvalidState
+	}
+	if time.Now().Unix() > state.ExpiresAt {
+		return nil, ErrInvalidState
+	}
+
+	return &state, nil
+}
+
+// sign returns the base64url HMAC of value
+func sign(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
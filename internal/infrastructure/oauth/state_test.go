@@ -0,0 +1,77 @@
+package oauth
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+func TestStateKey(t *testing.T) {
+	const jwtKey = "jwt-secret"
+	key := StateKey(jwtKey)
+	if len(key) != 32 || bytes.Equal(key, []byte(jwtKey)) {
+		t.Fatalf("derived key = %x, want 32 bytes other than the JWT key", key)
+	}
+	if !bytes.Equal(StateKey(jwtKey), key) {
+		t.Error("derived key differs between calls")
+	}
+	if bytes.Equal(StateKey("other-secret"), key) {
+		t.Error("different JWT keys derive the same state key")
+	}
+
+	// A state signed with the JWT key itself is rejected
+	signed, err := SignState([]byte(jwtKey), State{
+		UserID:    uuid.New(),
+		Platform:  models.PlatformMeta,
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyState(key, signed); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("VerifyState = %v, want ErrInvalidState", err)
+	}
+
+	// A configured key takes precedence
+	viper.Set("oauth.state_key", "state-secret")
+	t.Cleanup(func() { viper.Set("oauth.state_key", "") })
+	if got := StateKey(jwtKey); string(got) != "state-secret" {
+		t.Errorf("StateKey = %q, want the configured key", got)
+	}
+}
+
+func TestVerifyState(t *testing.T) {
+	key := StateKey("jwt-secret")
+	state := State{
+		UserID:    uuid.New(),
+		Platform:  models.PlatformGoogle,
+		AccountID: "1234567890",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}
+
+	signed, err := SignState(key, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := VerifyState(key, signed)
+	if err != nil {
+		t.Fatalf("VerifyState: %v", err)
+	}
+	if got.UserID != state.UserID || got.Platform != state.Platform || got.AccountID != state.AccountID {
+		t.Errorf("state = %+v, want %+v", got, state)
+	}
+
+	state.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	expired, err := SignState(key, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyState(key, expired); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expired state: VerifyState = %v, want ErrInvalidState", err)
+	}
+}
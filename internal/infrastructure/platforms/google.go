@@ -1,25 +1,42 @@
 package platforms
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/spf13/viper"
 	"github.com/zocket/campaign-analytics/internal/domain/models"
 )
 
 // GoogleClient implements the PlatformClient interface for Google Ads
 type GoogleClient struct {
-	apiURL     string
-	httpClient *http.Client
+	apiURL          string
+	developerToken  string
+	loginCustomerID string
+	httpClient      *http.Client
 }
 
 // NewGoogleClient creates a new Google Ads client
 func NewGoogleClient() *GoogleClient {
+	apiURL := viper.GetString("platforms.google.base_url")
+	if apiURL == "" {
+		apiURL = "https://googleads.googleapis.com/v13"
+	}
+
 	return &GoogleClient{
-		apiURL: "https://googleads.googleapis.com/v13",
+		apiURL:          strings.TrimRight(apiURL, "/"),
+		developerToken:  viper.GetString("platforms.google.developer_token"),
+		loginCustomerID: normalizeCustomerID(viper.GetString("platforms.google.login_customer_id")),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -31,45 +48,308 @@ func (c *GoogleClient) GetName() models.Platform {
 	return models.PlatformGoogle
 }
 
-// FetchData fetches ad performance data from Google Ads
-// In a real implementation, this would use the Google Ads API
-func (c *GoogleClient) FetchData(ctx context.Context, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
-	// This is a stub implementation
-	// In a real-world scenario, you would call the Google Ads API
-	
-	campaignUUID, err := uuid.Parse(campaignID)
+// googleSearchStreamRequest is the body of a googleAds:searchStream call
+type googleSearchStreamRequest struct {
+	Query string `json:"query"`
+}
+
+// googleSearchStreamBatch is one element of the searchStream response array.
+// The stream is a JSON array of batches; an error raised mid-stream arrives
+// as an element carrying only the error field.
+type googleSearchStreamBatch struct {
+	Results   []googleAdsRow  `json:"results"`
+	FieldMask string          `json:"fieldMask"`
+	RequestID string          `json:"requestId"`
+	Error     *GoogleAdsError `json:"error,omitempty"`
+}
+
+// googleAdsRow is a single GAQL result row. Int64 metrics are encoded as
+// strings by the REST API, doubles as numbers.
+type googleAdsRow struct {
+	Customer struct {
+		CurrencyCode string `json:"currencyCode"`
+	} `json:"customer"`
+	Campaign struct {
+		ResourceName string `json:"resourceName"`
+		ID           string `json:"id"`
+	} `json:"campaign"`
+	Segments struct {
+		Date            string `json:"date"`
+		GeoTargetRegion string `json:"geoTargetRegion"`
+	} `json:"segments"`
+	Metrics struct {
+		Impressions      string  `json:"impressions"`
+		Clicks           string  `json:"clicks"`
+		Conversions      float64 `json:"conversions"`
+		ConversionsValue float64 `json:"conversionsValue"`
+		CostMicros       string  `json:"costMicros"`
+	} `json:"metrics"`
+}
+
+// GoogleAdsError is the error status returned by the Google Ads API
+type GoogleAdsError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+	Details []struct {
+		Type   string `json:"@type"`
+		Errors []struct {
+			ErrorCode map[string]string `json:"errorCode"`
+			Message   string            `json:"message"`
+		} `json:"errors"`
+	} `json:"details,omitempty"`
+}
+
+func (e *GoogleAdsError) Error() string {
+	msg := fmt.Sprintf("google ads API error %d (%s): %s", e.Code, e.Status, e.Message)
+	for _, detail := range e.Details {
+		for _, failure := range detail.Errors {
+			msg += "; " + failure.Message
+		}
+	}
+	return msg
+}
+
+// googleMetricKey identifies the (day, region) bucket a row contributes to
+type googleMetricKey struct {
+	date   string
+	region string
+}
+
+// FetchData fetches ad performance data from Google Ads using a GAQL
+// searchStream request against the geographic view, so each event carries
+// one day for one region. campaignID is the campaign's resource name
+// (customers/{customer_id}/campaigns/{campaign_id}) or "{customer_id}:{campaign_id}".
+func (c *GoogleClient) FetchData(ctx context.Context, creds *models.PlatformCredentials, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
+	customerID, googleCampaignID, err := parseGoogleCampaignID(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count each user once, by physical location, to avoid double counting
+	// rows that also match an area of interest
+	query := fmt.Sprintf(`
+		SELECT
+			customer.currency_code,
+			campaign.id,
+			segments.date,
+			segments.geo_target_region,
+			metrics.impressions,
+			metrics.clicks,
+			metrics.conversions,
+			metrics.conversions_value,
+			metrics.cost_micros
+		FROM geographic_view
+		WHERE campaign.id = %s
+			AND geographic_view.location_type = 'LOCATION_OF_PRESENCE'
+			AND segments.date BETWEEN '%s' AND '%s'
+		ORDER BY segments.date`,
+		googleCampaignID, startTime.Format("2006-01-02"), endTime.Format("2006-01-02"),
+	)
+
+	body, err := json.Marshal(googleSearchStreamRequest{Query: query})
 	if err != nil {
 		return nil, err
 	}
-	
-	// Simulate some data for demonstration purposes
-	var events []models.CampaignEvent
-	currentTime := startTime
-	
-	for currentTime.Before(endTime) || currentTime.Equal(endTime) {
-		// Create a deduplication key
-		dedupKey := fmt.Sprintf("google:%s:%s", campaignID, currentTime.Format("2006-01-02"))
-		
-		// Generate some fake data
-		events = append(events, models.CampaignEvent{
-			ID:               uuid.New(),
-			CampaignID:       campaignUUID,
-			Platform:         models.PlatformGoogle,
-			EventType:        "daily_stats",
-			Impressions:      1000 + int64(currentTime.Day()*100),
-			Clicks:           50 + int64(currentTime.Day()*5),
-			Conversions:      5 + int64(currentTime.Day()),
-			Spend:            50.0 + float64(currentTime.Day()*5),
-			Revenue:          100.0 + float64(currentTime.Day()*10),
-			EventTime:        currentTime,
-			Region:           "all",
-			Currency:         "USD",
-			DeduplicationKey: dedupKey,
-			ReceivedAt:       time.Now(),
-		})
-		
-		currentTime = currentTime.Add(24 * time.Hour)
-	}
-	
+
+	url := fmt.Sprintf("%s/customers/%s/googleAds:searchStream", c.apiURL, customerID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+creds.AccessToken)
+	req.Header.Set("developer-token", c.developerToken)
+
+	// A manager account on the connection takes precedence over the configured one
+	loginCustomerID := c.loginCustomerID
+	if creds.LoginCustomerID != "" {
+		loginCustomerID = normalizeCustomerID(creds.LoginCustomerID)
+	}
+	if loginCustomerID != "" {
+		req.Header.Set("login-customer-id", loginCustomerID)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeGoogleError(resp)
+	}
+
+	// Rows are summed per (date, region): a region can be split across
+	// several rows, e.g. by country criterion. Conversions are fractional
+	// under data-driven attribution, so they are rounded once summed.
+	totals := make(map[googleMetricKey]*models.CampaignEvent)
+	conversions := make(map[googleMetricKey]float64)
+	var order []googleMetricKey
+	streamErr := c.readSearchStream(resp.Body, func(row googleAdsRow) error {
+		key := googleMetricKey{date: row.Segments.Date, region: googleRegion(row.Segments.GeoTargetRegion)}
+		event, exists := totals[key]
+		if !exists {
+			eventTime, err := time.Parse("2006-01-02", row.Segments.Date)
+			if err != nil {
+				return err
+			}
+			event = &models.CampaignEvent{
+				ID:               uuid.New(),
+				Platform:         models.PlatformGoogle,
+				EventType:        "daily_stats",
+				EventTime:        eventTime,
+				LocalDate:        eventTime, // days are reported in the ad account's timezone
+				Region:           key.region,
+				Currency:         row.Customer.CurrencyCode,
+				DeduplicationKey: fmt.Sprintf("google:%s:%s:%s", campaignID, key.date, key.region),
+				ReceivedAt:       time.Now(),
+			}
+			totals[key] = event
+			order = append(order, key)
+		}
+
+		impressions, err := parseGoogleInt64(row.Metrics.Impressions)
+		if err != nil {
+			return err
+		}
+		clicks, err := parseGoogleInt64(row.Metrics.Clicks)
+		if err != nil {
+			return err
+		}
+		costMicros, err := parseGoogleInt64(row.Metrics.CostMicros)
+		if err != nil {
+			return err
+		}
+
+		event.Impressions += impressions
+		event.Clicks += clicks
+		conversions[key] += row.Metrics.Conversions
+		event.Spend += microsToCurrency(costMicros)
+		event.Revenue += row.Metrics.ConversionsValue
+		return nil
+	})
+
+	events := make([]models.CampaignEvent, 0, len(order))
+	for _, key := range order {
+		event := *totals[key]
+		event.Conversions = int64(math.Round(conversions[key]))
+		events = append(events, event)
+	}
+
+	if streamErr != nil {
+		// Batches received before the failure are still valid
+		if len(events) > 0 {
+			return events, &PartialResultError{Err: streamErr}
+		}
+		return nil, streamErr
+	}
+
 	return events, nil
 }
+
+// readSearchStream walks the searchStream response array batch by batch so
+// large result sets are never held in memory as a whole
+func (c *GoogleClient) readSearchStream(r io.Reader, handle func(row googleAdsRow) error) error {
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("google ads searchStream response is not an array")
+	}
+
+	for decoder.More() {
+		var batch googleSearchStreamBatch
+		if err := decoder.Decode(&batch); err != nil {
+			return err
+		}
+		if batch.Error != nil {
+			return batch.Error
+		}
+		for _, row := range batch.Results {
+			if err := handle(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = decoder.Token()
+	return err
+}
+
+// decodeGoogleError extracts the API error from a non-200 response, which is
+// either a bare error object or a one-element stream array
+func decodeGoogleError(resp *http.Response) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("google ads API returned non-200 status: %d", resp.StatusCode)
+	}
+
+	var single struct {
+		Error *GoogleAdsError `json:"error"`
+	}
+	if json.Unmarshal(data, &single) == nil && single.Error != nil {
+		return single.Error
+	}
+
+	var stream []struct {
+		Error *GoogleAdsError `json:"error"`
+	}
+	if json.Unmarshal(data, &stream) == nil && len(stream) > 0 && stream[0].Error != nil {
+		return stream[0].Error
+	}
+
+	return fmt.Errorf("google ads API returned non-200 status: %d", resp.StatusCode)
+}
+
+// parseGoogleCampaignID splits a campaign external ID into customer and campaign IDs
+func parseGoogleCampaignID(externalID string) (string, string, error) {
+	var customerID, campaignID string
+	if strings.HasPrefix(externalID, "customers/") {
+		parts := strings.Split(externalID, "/")
+		if len(parts) == 4 && parts[2] == "campaigns" {
+			customerID, campaignID = parts[1], parts[3]
+		}
+	} else if parts := strings.SplitN(externalID, ":", 2); len(parts) == 2 {
+		customerID, campaignID = parts[0], parts[1]
+	}
+
+	customerID = normalizeCustomerID(customerID)
+	if customerID == "" || campaignID == "" {
+		return "", "", fmt.Errorf("invalid google ads campaign ID %q (use customers/{customer_id}/campaigns/{campaign_id})", externalID)
+	}
+	if _, err := strconv.ParseInt(campaignID, 10, 64); err != nil {
+		return "", "", fmt.Errorf("invalid google ads campaign ID %q: %w", externalID, err)
+	}
+
+	return customerID, campaignID, nil
+}
+
+// normalizeCustomerID strips the dashes from a customer ID as shown in the UI (123-456-7890)
+func normalizeCustomerID(id string) string {
+	return strings.ReplaceAll(strings.TrimSpace(id), "-", "")
+}
+
+// googleRegion maps a geoTargetConstants resource name to its criterion ID
+func googleRegion(resourceName string) string {
+	if resourceName == "" {
+		return "all"
+	}
+	return strings.TrimPrefix(resourceName, "geoTargetConstants/")
+}
+
+// parseGoogleInt64 parses an int64 metric, which the REST API encodes as a string
+func parseGoogleInt64(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// microsToCurrency converts a Google Ads micros amount to currency units
+func microsToCurrency(micros int64) float64 {
+	return float64(micros) / 1e6
+}
@@ -0,0 +1,177 @@
+package platforms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+const googleTestCampaignID = "customers/1234567890/campaigns/987654321"
+
+var googleTestCreds = &models.PlatformCredentials{
+	AccessToken:     "ya29.test-token",
+	LoginCustomerID: "111-222-3333",
+}
+
+// newGoogleFixtureServer serves a recorded searchStream response with a
+// status, flushing it in small chunks the way the stream arrives
+func newGoogleFixtureServer(t *testing.T, status int, fixture string) *GoogleClient {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "google", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/customers/1234567890/googleAds:searchStream" {
+			t.Errorf("request = %s %s, want POST /customers/1234567890/googleAds:searchStream", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer "+googleTestCreds.AccessToken {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("developer-token"); got != "dev-token" {
+			t.Errorf("developer-token = %q, want dev-token", got)
+		}
+		if got := r.Header.Get("login-customer-id"); got != "1112223333" {
+			t.Errorf("login-customer-id = %q, want the connection's manager account", got)
+		}
+		var body googleSearchStreamRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		if !strings.Contains(body.Query, "campaign.id = 987654321") || !strings.Contains(body.Query, "BETWEEN '2024-03-01' AND '2024-03-02'") {
+			t.Errorf("query = %s", body.Query)
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(status)
+		for chunk := data; len(chunk) > 0; {
+			n := 64
+			if n > len(chunk) {
+				n = len(chunk)
+			}
+			w.Write(chunk[:n])
+			w.(http.Flusher).Flush()
+			chunk = chunk[n:]
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	viper.Set("platforms.google.base_url", server.URL)
+	viper.Set("platforms.google.developer_token", "dev-token")
+	t.Cleanup(func() {
+		viper.Set("platforms.google.base_url", "")
+		viper.Set("platforms.google.developer_token", "")
+	})
+	return NewGoogleClient()
+}
+
+func fetchGoogleFixture(t *testing.T, client *GoogleClient) ([]models.CampaignEvent, error) {
+	t.Helper()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	return client.FetchData(context.Background(), googleTestCreds, googleTestCampaignID, start, start.AddDate(0, 0, 1))
+}
+
+// googleEvent is the part of an event a fixture determines
+type googleEvent struct {
+	key         string
+	impressions int64
+	clicks      int64
+	conversions int64
+	spend       float64
+	revenue     float64
+}
+
+func assertGoogleEvents(t *testing.T, events []models.CampaignEvent, want []googleEvent) {
+	t.Helper()
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		w := want[i]
+		if event.DeduplicationKey != w.key {
+			t.Errorf("event %d: key = %s, want %s", i, event.DeduplicationKey, w.key)
+		}
+		if event.Impressions != w.impressions || event.Clicks != w.clicks || event.Conversions != w.conversions {
+			t.Errorf("%s: counts = %d/%d/%d, want %d/%d/%d", w.key, event.Impressions, event.Clicks, event.Conversions, w.impressions, w.clicks, w.conversions)
+		}
+		if math.Abs(event.Spend-w.spend) > 1e-9 || math.Abs(event.Revenue-w.revenue) > 1e-9 {
+			t.Errorf("%s: spend/revenue = %v/%v, want %v/%v", w.key, event.Spend, event.Revenue, w.spend, w.revenue)
+		}
+		if event.Platform != models.PlatformGoogle || event.Currency != "EUR" {
+			t.Errorf("%s: platform/currency = %s/%s, want google/EUR", w.key, event.Platform, event.Currency)
+		}
+		if !event.LocalDate.Equal(event.EventTime) {
+			t.Errorf("%s: local date %v differs from the reported day %v", w.key, event.LocalDate, event.EventTime)
+		}
+	}
+}
+
+func TestGoogleFetchData(t *testing.T) {
+	client := newGoogleFixtureServer(t, http.StatusOK, "search_stream.json")
+	events, err := fetchGoogleFixture(t, client)
+	if err != nil {
+		t.Fatalf("FetchData: %v", err)
+	}
+
+	// Rows of a region on a day are summed, across batches, and fractional
+	// conversions are rounded once summed
+	prefix := "google:" + googleTestCampaignID + ":"
+	assertGoogleEvents(t, events, []googleEvent{
+		{key: prefix + "2024-03-01:20228", impressions: 1500, clicks: 50, conversions: 4, spend: 15, revenue: 170.5},
+		{key: prefix + "2024-03-01:20229", impressions: 800, clicks: 12, spend: 4},
+		{key: prefix + "2024-03-02:20228", impressions: 1100, clicks: 35, conversions: 2, spend: 11, revenue: 99.9},
+	})
+}
+
+func TestGoogleFetchDataMidStreamError(t *testing.T) {
+	client := newGoogleFixtureServer(t, http.StatusOK, "search_stream_error.json")
+	events, err := fetchGoogleFixture(t, client)
+
+	// The batches before the error are returned with it
+	var partial *PartialResultError
+	if !errors.As(err, &partial) {
+		t.Fatalf("error = %v, want a *PartialResultError", err)
+	}
+	var apiErr *GoogleAdsError
+	if !errors.As(err, &apiErr) || apiErr.Status != "RESOURCE_EXHAUSTED" {
+		t.Errorf("error = %v, want the RESOURCE_EXHAUSTED API error", err)
+	}
+	assertGoogleEvents(t, events, []googleEvent{
+		{key: "google:" + googleTestCampaignID + ":2024-03-01:20228", impressions: 1200, clicks: 40, conversions: 3, spend: 12.5, revenue: 150.5},
+	})
+}
+
+func TestGoogleFetchDataUnauthenticated(t *testing.T) {
+	client := newGoogleFixtureServer(t, http.StatusUnauthorized, "unauthenticated.json")
+	events, err := fetchGoogleFixture(t, client)
+	if events != nil {
+		t.Errorf("got %d events, want none", len(events))
+	}
+
+	var partial *PartialResultError
+	if errors.As(err, &partial) {
+		t.Errorf("error = %v, want a failure rather than a partial result", err)
+	}
+	var apiErr *GoogleAdsError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want a *GoogleAdsError", err)
+	}
+	if apiErr.Code != http.StatusUnauthorized || apiErr.Status != "UNAUTHENTICATED" {
+		t.Errorf("API error = %d %s, want 401 UNAUTHENTICATED", apiErr.Code, apiErr.Status)
+	}
+	if !strings.Contains(apiErr.Error(), "Oauth token is invalid") {
+		t.Errorf("error message %q lacks the failure details", apiErr.Error())
+	}
+}
@@ -33,7 +33,7 @@ func (c *LinkedInClient) GetName() models.Platform {
 
 // FetchData fetches ad performance data from LinkedIn Ads
 // In a real implementation, this would use the LinkedIn Marketing API
-func (c *LinkedInClient) FetchData(ctx context.Context, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
+func (c *LinkedInClient) FetchData(ctx context.Context, creds *models.PlatformCredentials, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
 	// This is a stub implementation
 	campaignUUID, err := uuid.Parse(campaignID)
 	if err != nil {
@@ -4,23 +4,52 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/spf13/viper"
 	"github.com/zocket/campaign-analytics/internal/domain/models"
 )
 
+// metaMaxPages guards against a paging loop returned by the API
+const metaMaxPages = 1000
+
 // MetaClient implements the PlatformClient interface for Meta (Facebook) ads
 type MetaClient struct {
-	apiURL     string
-	httpClient *http.Client
+	apiURL               string
+	breakdowns           []string
+	conversionActionType string
+	httpClient           *http.Client
 }
 
 // NewMetaClient creates a new Meta client
 func NewMetaClient() *MetaClient {
+	apiURL := viper.GetString("platforms.meta.base_url")
+	if apiURL == "" {
+		apiURL = "https://graph.facebook.com/v16.0"
+	}
+
+	breakdowns := viper.GetStringSlice("platforms.meta.breakdowns")
+	if len(breakdowns) == 0 {
+		breakdowns = []string{"region"}
+	}
+
+	conversionActionType := viper.GetString("platforms.meta.conversion_action_type")
+	if conversionActionType == "" {
+		conversionActionType = "offsite_conversion.fb_pixel_purchase"
+	}
+
 	return &MetaClient{
-		apiURL: "https://graph.facebook.com/v16.0",
+		apiURL:               strings.TrimRight(apiURL, "/"),
+		breakdowns:           breakdowns,
+		conversionActionType: conversionActionType,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -32,17 +61,32 @@ func (c *MetaClient) GetName() models.Platform {
 	return models.PlatformMeta
 }
 
+// MetaAction is an entry of the actions / action_values arrays
+type MetaAction struct {
+	ActionType string `json:"action_type"`
+	Value      string `json:"value"`
+}
+
+// MetaInsightsRow is one row of the Insights API. Numeric fields are encoded
+// as strings; breakdown fields are only present when requested.
+type MetaInsightsRow struct {
+	CampaignID        string       `json:"campaign_id"`
+	DateStart         string       `json:"date_start"`
+	DateStop          string       `json:"date_stop"`
+	Impressions       string       `json:"impressions"`
+	Clicks            string       `json:"clicks"`
+	Spend             string       `json:"spend"`
+	AccountCurrency   string       `json:"account_currency"`
+	Actions           []MetaAction `json:"actions"`
+	ActionValues      []MetaAction `json:"action_values"`
+	Region            string       `json:"region,omitempty"`
+	PublisherPlatform string       `json:"publisher_platform,omitempty"`
+	DevicePlatform    string       `json:"device_platform,omitempty"`
+}
+
 // MetaInsightsResponse represents the response from the Meta Insights API
 type MetaInsightsResponse struct {
-	Data []struct {
-		DateStart   string  `json:"date_start"`
-		DateStop    string  `json:"date_stop"`
-		Impressions int64   `json:"impressions"`
-		Clicks      int64   `json:"clicks"`
-		Conversions int64   `json:"actions"`
-		Spend       float64 `json:"spend"`
-		Revenue     float64 `json:"action_values"`
-	} `json:"data"`
+	Data   []MetaInsightsRow `json:"data"`
 	Paging struct {
 		Cursors struct {
 			Before string `json:"before"`
@@ -52,26 +96,105 @@ type MetaInsightsResponse struct {
 	} `json:"paging"`
 }
 
-// FetchData fetches ad performance data from Meta
-func (c *MetaClient) FetchData(ctx context.Context, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
-	// Format the time range for the API request
-	startDate := startTime.Format("2006-01-02")
-	endDate := endTime.Format("2006-01-02")
+// MetaAPIError is the error object returned by the Graph API
+type MetaAPIError struct {
+	Message   string `json:"message"`
+	Type      string `json:"type"`
+	Code      int    `json:"code"`
+	FBTraceID string `json:"fbtrace_id"`
+}
+
+func (e *MetaAPIError) Error() string {
+	return fmt.Sprintf("meta API error %d (%s): %s", e.Code, e.Type, e.Message)
+}
+
+// FetchData fetches ad performance data from Meta. It requests one row per
+// day and breakdown and follows the paging cursors until every page is read.
+func (c *MetaClient) FetchData(ctx context.Context, creds *models.PlatformCredentials, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
+	timeRange, err := json.Marshal(map[string]string{
+		"since": startTime.Format("2006-01-02"),
+		"until": endTime.Format("2006-01-02"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("level", "campaign")
+	params.Set("time_range", string(timeRange))
+	params.Set("time_increment", "1")
+	params.Set("fields", "campaign_id,impressions,clicks,spend,actions,action_values,account_currency")
+	params.Set("breakdowns", strings.Join(c.breakdowns, ","))
+	params.Set("limit", "500")
 
 	// Build the API URL
-	url := fmt.Sprintf(
-		"%s/act_%s/insights?time_range={'since':'%s','until':'%s'}&level=campaign&fields=campaign_id,impressions,clicks,actions,spend,action_values",
-		c.apiURL, campaignID, startDate, endDate,
-	)
+	nextURL := fmt.Sprintf("%s/%s/insights?%s", c.apiURL, campaignID, params.Encode())
+
+	var events []models.CampaignEvent
+	for page := 0; nextURL != ""; page++ {
+		if page >= metaMaxPages {
+			return events, &PartialResultError{Err: fmt.Errorf("meta insights exceeded %d pages", metaMaxPages)}
+		}
+
+		insightsResp, err := c.fetchPage(ctx, creds, nextURL)
+		if err != nil {
+			if len(events) > 0 {
+				return events, &PartialResultError{Err: err}
+			}
+			return nil, err
+		}
+
+		for _, row := range insightsResp.Data {
+			event, err := c.toEvent(campaignID, row)
+			if err != nil {
+				// Rows converted before the malformed one are still valid
+				if len(events) > 0 {
+					return events, &PartialResultError{Err: err}
+				}
+				return nil, err
+			}
+			events = append(events, event)
+		}
+
+		nextURL = insightsResp.Paging.Next
+		if nextURL != "" {
+			// The page URL is requested with the user's token, so it must
+			// not lead anywhere but the Graph API
+			if err := c.checkPageURL(nextURL); err != nil {
+				return events, &PartialResultError{Err: err}
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// checkPageURL verifies that a paging URL has the scheme and host of the API
+func (c *MetaClient) checkPageURL(pageURL string) error {
+	api, err := url.Parse(c.apiURL)
+	if err != nil {
+		return err
+	}
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Errorf("invalid meta paging URL: %w", err)
+	}
+	if page.Scheme != api.Scheme || page.Host != api.Host {
+		return fmt.Errorf("meta paging URL points to %s://%s, not the API", page.Scheme, page.Host)
+	}
+	return nil
+}
 
+// fetchPage requests one page of insights
+func (c *MetaClient) fetchPage(ctx context.Context, creds *models.PlatformCredentials, pageURL string) (*MetaInsightsResponse, error) {
 	// Create a new request
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add authentication headers (in a real implementation, you would get these from a secret store)
-	req.Header.Add("Authorization", "Bearer YOUR_ACCESS_TOKEN")
+	// Authenticate as the campaign owner
+	req.Header.Add("Authorization", "Bearer "+creds.AccessToken)
 
 	// Execute the request
 	resp, err := c.httpClient.Do(req)
@@ -82,6 +205,13 @@ func (c *MetaClient) FetchData(ctx context.Context, campaignID string, startTime
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error *MetaAPIError `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error != nil {
+			return nil, errResp.Error
+		}
 		return nil, fmt.Errorf("meta API returned non-200 status: %d", resp.StatusCode)
 	}
 
@@ -91,39 +221,123 @@ func (c *MetaClient) FetchData(ctx context.Context, campaignID string, startTime
 		return nil, err
 	}
 
-	// Convert the response to CampaignEvent objects
-	var events []models.CampaignEvent
-	for _, item := range insightsResp.Data {
-		eventTime, err := time.Parse("2006-01-02", item.DateStart)
-		if err != nil {
-			return nil, err
+	return &insightsResp, nil
+}
+
+// toEvent converts an insights row to a CampaignEvent
+func (c *MetaClient) toEvent(campaignID string, row MetaInsightsRow) (models.CampaignEvent, error) {
+	eventTime, err := time.Parse("2006-01-02", row.DateStart)
+	if err != nil {
+		return models.CampaignEvent{}, err
+	}
+
+	impressions, err := parseMetaInt64(row.Impressions)
+	if err != nil {
+		return models.CampaignEvent{}, err
+	}
+	clicks, err := parseMetaInt64(row.Clicks)
+	if err != nil {
+		return models.CampaignEvent{}, err
+	}
+	spend, err := parseMetaFloat(row.Spend)
+	if err != nil {
+		return models.CampaignEvent{}, err
+	}
+	conversions, err := sumMetaActions(row.Actions, c.conversionActionType)
+	if err != nil {
+		return models.CampaignEvent{}, err
+	}
+	revenue, err := sumMetaActions(row.ActionValues, c.conversionActionType)
+	if err != nil {
+		return models.CampaignEvent{}, err
+	}
+
+	region := row.Region
+	if region == "" {
+		region = "all"
+	}
+
+	// The breakdown is part of the deduplication key so each region /
+	// placement row of a day is kept as its own event
+	dedupKey := fmt.Sprintf("meta:%s:%s:%s", campaignID, row.DateStart, c.breakdownKey(row))
+
+	return models.CampaignEvent{
+		ID:               uuid.New(),
+		Platform:         models.PlatformMeta,
+		EventType:        "daily_stats",
+		Impressions:      impressions,
+		Clicks:           clicks,
+		Conversions:      int64(math.Round(conversions)),
+		Spend:            spend,
+		Revenue:          revenue,
+		EventTime:        eventTime,
+		LocalDate:        eventTime, // days are reported in the ad account's timezone
+		Region:           region,
+		Placement:        metaPlacement(row),
+		Currency:         row.AccountCurrency,
+		DeduplicationKey: dedupKey,
+		ReceivedAt:       time.Now(),
+	}, nil
+}
+
+// breakdownKey renders the requested breakdown values of a row in a stable order
+func (c *MetaClient) breakdownKey(row MetaInsightsRow) string {
+	values := map[string]string{
+		"region":             row.Region,
+		"publisher_platform": row.PublisherPlatform,
+		"device_platform":    row.DevicePlatform,
+	}
+
+	breakdowns := append([]string(nil), c.breakdowns...)
+	sort.Strings(breakdowns)
+
+	parts := make([]string, 0, len(breakdowns))
+	for _, breakdown := range breakdowns {
+		parts = append(parts, breakdown+"="+values[breakdown])
+	}
+	return strings.Join(parts, "|")
+}
+
+// metaPlacement joins the publisher platform and device of a row, e.g.
+// instagram/mobile_app, leaving out the ones not broken down by
+func metaPlacement(row MetaInsightsRow) string {
+	var parts []string
+	for _, value := range []string{row.PublisherPlatform, row.DevicePlatform} {
+		if value != "" {
+			parts = append(parts, value)
 		}
+	}
+	return strings.Join(parts, "/")
+}
 
-		campaignUUID, err := uuid.Parse(campaignID)
+// sumMetaActions sums the values of the actions matching actionType
+func sumMetaActions(actions []MetaAction, actionType string) (float64, error) {
+	var total float64
+	for _, action := range actions {
+		if action.ActionType != actionType {
+			continue
+		}
+		value, err := parseMetaFloat(action.Value)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
+		total += value
+	}
+	return total, nil
+}
 
-		// Create a deduplication key to prevent duplicate processing
-		dedupKey := fmt.Sprintf("meta:%s:%s", campaignID, item.DateStart)
-
-		events = append(events, models.CampaignEvent{
-			ID:              uuid.New(),
-			CampaignID:      campaignUUID,
-			Platform:        models.PlatformMeta,
-			EventType:       "daily_stats",
-			Impressions:     item.Impressions,
-			Clicks:          item.Clicks,
-			Conversions:     item.Conversions,
-			Spend:           item.Spend,
-			Revenue:         item.Revenue,
-			EventTime:       eventTime,
-			Region:          "all", // Meta doesn't provide region in this API call
-			Currency:        "USD", // Assuming USD, would be configurable in a real system
-			DeduplicationKey: dedupKey,
-			ReceivedAt:      time.Now(),
-		})
+// parseMetaInt64 parses an integer metric encoded as a string
+func parseMetaInt64(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
 	}
+	return strconv.ParseInt(value, 10, 64)
+}
 
-	return events, nil
+// parseMetaFloat parses a decimal metric encoded as a string
+func parseMetaFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
 }
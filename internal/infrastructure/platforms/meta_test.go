@@ -0,0 +1,144 @@
+package platforms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/domain/models"
+)
+
+func TestMetaFetchDataMalformedPage(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("after") == "" {
+			if got := r.URL.Query().Get("breakdowns"); got != "region" {
+				t.Errorf("breakdowns = %q, want region", got)
+			}
+			fmt.Fprintf(w, `{
+				"data": [
+					{"campaign_id": "42", "date_start": "2024-03-01", "date_stop": "2024-03-01", "impressions": "100", "clicks": "5", "spend": "12.50", "account_currency": "USD", "region": "California"},
+					{"campaign_id": "42", "date_start": "2024-03-01", "date_stop": "2024-03-01", "impressions": "80", "clicks": "2", "spend": "7.25", "account_currency": "USD", "region": "Texas"}
+				],
+				"paging": {"cursors": {"after": "p2"}, "next": "%s/42/insights?after=p2"}
+			}`, server.URL)
+			return
+		}
+		fmt.Fprint(w, `{
+			"data": [
+				{"campaign_id": "42", "date_start": "2024-03-02", "date_stop": "2024-03-02", "impressions": "90", "clicks": "3", "spend": "9.00", "account_currency": "USD", "region": "California"},
+				{"campaign_id": "42", "date_start": "2024-03-02", "date_stop": "2024-03-02", "impressions": "lots", "clicks": "1", "spend": "1.00", "account_currency": "USD", "region": "Texas"}
+			],
+			"paging": {}
+		}`)
+	}))
+	defer server.Close()
+
+	viper.Set("platforms.meta.base_url", server.URL)
+	defer viper.Set("platforms.meta.base_url", "")
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	events, err := NewMetaClient().FetchData(context.Background(), &models.PlatformCredentials{AccessToken: "token"}, "42", start, start.AddDate(0, 0, 1))
+
+	// The rows before the malformed one are kept, earlier pages included
+	var partial *PartialResultError
+	if !errors.As(err, &partial) {
+		t.Fatalf("error = %v, want a *PartialResultError", err)
+	}
+	want := []string{
+		"meta:42:2024-03-01:region=California",
+		"meta:42:2024-03-01:region=Texas",
+		"meta:42:2024-03-02:region=California",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.DeduplicationKey != want[i] {
+			t.Errorf("event %d: key = %s, want %s", i, event.DeduplicationKey, want[i])
+		}
+	}
+	if events[1].Region != "Texas" || events[1].Spend != 7.25 {
+		t.Errorf("event 1 = %s %v, want Texas 7.25", events[1].Region, events[1].Spend)
+	}
+}
+
+func TestMetaFetchDataPlacementBreakdowns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("breakdowns"); got != "publisher_platform,device_platform,region" {
+			t.Errorf("breakdowns = %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"data": [
+				{"campaign_id": "42", "date_start": "2024-03-01", "date_stop": "2024-03-01", "impressions": "100", "spend": "10", "account_currency": "USD", "region": "Texas", "publisher_platform": "facebook", "device_platform": "desktop"},
+				{"campaign_id": "42", "date_start": "2024-03-01", "date_stop": "2024-03-01", "impressions": "60", "spend": "4", "account_currency": "USD", "region": "Texas", "publisher_platform": "instagram", "device_platform": "mobile_app"}
+			],
+			"paging": {}
+		}`)
+	}))
+	defer server.Close()
+
+	viper.Set("platforms.meta.base_url", server.URL)
+	viper.Set("platforms.meta.breakdowns", []string{"publisher_platform", "device_platform", "region"})
+	defer func() {
+		viper.Set("platforms.meta.base_url", "")
+		viper.Set("platforms.meta.breakdowns", nil)
+	}()
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	events, err := NewMetaClient().FetchData(context.Background(), &models.PlatformCredentials{AccessToken: "token"}, "42", start, start)
+	if err != nil {
+		t.Fatalf("FetchData: %v", err)
+	}
+
+	// Each placement of a region is its own event, keyed by every breakdown
+	want := []struct{ key, placement string }{
+		{"meta:42:2024-03-01:device_platform=desktop|publisher_platform=facebook|region=Texas", "facebook/desktop"},
+		{"meta:42:2024-03-01:device_platform=mobile_app|publisher_platform=instagram|region=Texas", "instagram/mobile_app"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.DeduplicationKey != want[i].key || event.Placement != want[i].placement || event.Region != "Texas" {
+			t.Errorf("event %d = %s %s %s, want %s %s Texas", i, event.DeduplicationKey, event.Placement, event.Region, want[i].key, want[i].placement)
+		}
+	}
+}
+
+func TestMetaFetchDataForeignPagingURL(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"data": [
+				{"campaign_id": "42", "date_start": "2024-03-01", "date_stop": "2024-03-01", "impressions": "100", "spend": "10", "account_currency": "USD", "region": "Texas"}
+			],
+			"paging": {"next": "https://attacker.example.com/42/insights?after=p2"}
+		}`)
+	}))
+	defer server.Close()
+
+	viper.Set("platforms.meta.base_url", server.URL)
+	defer viper.Set("platforms.meta.base_url", "")
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	events, err := NewMetaClient().FetchData(context.Background(), &models.PlatformCredentials{AccessToken: "token"}, "42", start, start)
+
+	// The page is kept, the foreign URL is not followed with the token
+	var partial *PartialResultError
+	if !errors.As(err, &partial) {
+		t.Fatalf("error = %v, want a *PartialResultError", err)
+	}
+	if len(events) != 1 || requests != 1 {
+		t.Errorf("got %d events from %d requests, want 1 from 1", len(events), requests)
+	}
+}
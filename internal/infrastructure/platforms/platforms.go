@@ -10,13 +10,29 @@ import (
 
 // PlatformClient defines the interface for ad platform clients
 type PlatformClient interface {
-	// FetchData fetches ad performance data for a campaign
-	FetchData(ctx context.Context, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error)
+	// FetchData fetches ad performance data for a campaign using the
+	// credentials of the campaign owner's connected account
+	FetchData(ctx context.Context, creds *models.PlatformCredentials, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error)
 	
 	// GetName returns the platform name
 	GetName() models.Platform
 }
 
+// PartialResultError is returned alongside the events that were fetched
+// before a platform reported a failure part way through a response
+type PartialResultError struct {
+	Err error
+}
+
+func (e *PartialResultError) Error() string {
+	return "partial result: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying platform error
+func (e *PartialResultError) Unwrap() error {
+	return e.Err
+}
+
 // PlatformClients holds all platform clients
 type PlatformClients struct {
 	clients map[models.Platform]PlatformClient
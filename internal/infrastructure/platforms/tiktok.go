@@ -33,7 +33,7 @@ func (c *TikTokClient) GetName() models.Platform {
 
 // FetchData fetches ad performance data from TikTok Ads
 // In a real implementation, this would use the TikTok Marketing API
-func (c *TikTokClient) FetchData(ctx context.Context, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
+func (c *TikTokClient) FetchData(ctx context.Context, creds *models.PlatformCredentials, campaignID string, startTime, endTime time.Time) ([]models.CampaignEvent, error) {
 	// This is a stub implementation
 	campaignUUID, err := uuid.Parse(campaignID)
 	if err != nil {
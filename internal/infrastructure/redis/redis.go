@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -86,15 +87,130 @@ func (c *Client) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
 
-// IsDeduplicationKeyProcessed checks if a deduplication key has been processed
-func (c *Client) IsDeduplicationKeyProcessed(ctx context.Context, key string) (bool, error) {
-	exists, err := c.client.Exists(ctx, "dedup:"+key).Result()
-	return exists > 0, err
+// GetSnapshotHash returns the content hash of the last processed snapshot of
+// a deduplication key, or an empty string when none is recorded
+func (c *Client) GetSnapshotHash(ctx context.Context, key string) (string, error) {
+	hash, err := c.client.Get(ctx, "snapshot:"+key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return hash, err
+}
+
+// SetSnapshotHash records the content hash of the last processed snapshot of a deduplication key
+func (c *Client) SetSnapshotHash(ctx context.Context, key, hash string, expiration time.Duration) error {
+	return c.client.Set(ctx, "snapshot:"+key, hash, expiration).Err()
+}
+
+// snapshotScanCount is the number of keys asked for per SCAN call
+const snapshotScanCount = 500
+
+// ScanSnapshotHashes returns the snapshot hashes of the deduplication keys
+// matching a glob pattern, keyed by deduplication key. A positive limit stops
+// the scan once that many keys were found.
+func (c *Client) ScanSnapshotHashes(ctx context.Context, pattern string, limit int) (map[string]string, error) {
+	hashes := make(map[string]string)
+	iter := c.client.Scan(ctx, 0, "snapshot:"+pattern, snapshotScanCount).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		hash, err := c.client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue // expired since the scan returned it
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hashes[strings.TrimPrefix(key, "snapshot:")] = hash
+		if limit > 0 && len(hashes) >= limit {
+			break
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// PurgedSnapshotHash replaces the hashes of purged deduplication keys. It
+// never equals the hash of a snapshot, so the next snapshot of a purged key is
+// processed, and it keeps the stored event from being compared instead.
+const PurgedSnapshotHash = "purged"
+
+// PurgeSnapshotHashes replaces the snapshot hashes of the deduplication keys
+// matching a glob pattern with PurgedSnapshotHash, so their next snapshots are
+// processed even if unchanged. Hashes keep their expiry; keys whose hash has
+// already expired are not affected. It returns the number of hashes purged.
+func (c *Client) PurgeSnapshotHashes(ctx context.Context, pattern string) (int64, error) {
+	var purged int64
+	keys := make([]string, 0, snapshotScanCount)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		pipe := c.client.Pipeline()
+		cmds := make([]*redis.BoolCmd, 0, len(keys))
+		for _, key := range keys {
+			// Only keys that still exist, keeping their TTL
+			cmds = append(cmds, pipe.SetXX(ctx, key, PurgedSnapshotHash, redis.KeepTTL))
+		}
+		keys = keys[:0]
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			if cmd.Val() {
+				purged++
+			}
+		}
+		return nil
+	}
+
+	iter := c.client.Scan(ctx, 0, "snapshot:"+pattern, snapshotScanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == snapshotScanCount {
+			if err := flush(); err != nil {
+				return purged, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return purged, err
+	}
+	return purged, flush()
+}
+
+// releaseLockScript deletes a lock only if it is still held by the caller's token
+var releaseLockScript = redis.NewScript(`
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`)
+
+// AcquireLock tries to take a distributed lock identified by key.
+// The token identifies the holder and must be passed to ReleaseLock.
+func (c *Client) AcquireLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, "lock:"+key, token, ttl).Result()
+}
+
+// ReleaseLock releases a lock taken with AcquireLock, unless it has expired
+// and been taken by another holder in the meantime
+func (c *Client) ReleaseLock(ctx context.Context, key, token string) error {
+	return releaseLockScript.Run(ctx, c.client, []string{"lock:" + key}, token).Err()
+}
+
+// AddNonce records a single-use nonce for ttl
+func (c *Client) AddNonce(ctx context.Context, scope, nonce string, ttl time.Duration) error {
+	return c.client.Set(ctx, "nonce:"+scope+":"+nonce, "1", ttl).Err()
 }
 
-// MarkDeduplicationKeyProcessed marks a deduplication key as processed
-func (c *Client) MarkDeduplicationKeyProcessed(ctx context.Context, key string, expiration time.Duration) error {
-	return c.client.Set(ctx, "dedup:"+key, "1", expiration).Err()
+// ConsumeNonce deletes a nonce recorded with AddNonce, reporting whether it
+// was still there. Only the first of concurrent calls for a nonce succeeds.
+func (c *Client) ConsumeNonce(ctx context.Context, scope, nonce string) (bool, error) {
+	deleted, err := c.client.Del(ctx, "nonce:"+scope+":"+nonce).Result()
+	return deleted == 1, err
 }
 
 // Close closes the Redis client
@@ -0,0 +1,58 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis/redistest"
+)
+
+func TestPurgeSnapshotHashes(t *testing.T) {
+	ctx := context.Background()
+	client := redistest.NewClient(t)
+
+	hashes := map[string]string{
+		"meta:c1:2024-03-01:US":   "h1",
+		"meta:c1:2024-03-02:US":   "h2",
+		"google:c2:2024-03-01:FR": "h3",
+	}
+	for key, hash := range hashes {
+		if err := client.SetSnapshotHash(ctx, key, hash, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := client.PurgeSnapshotHashes(ctx, "*:c1:*")
+	if err != nil {
+		t.Fatalf("PurgeSnapshotHashes: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("purged %d hashes, want 2", purged)
+	}
+
+	// Purged keys are tombstoned, with their expiry, rather than deleted
+	for key, hash := range hashes {
+		want := hash
+		if key != "google:c2:2024-03-01:FR" {
+			want = redis.PurgedSnapshotHash
+		}
+		got, err := client.GetSnapshotHash(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("hash of %s = %q, want %q", key, got, want)
+		}
+		if ttl := client.GetClient().TTL(ctx, "snapshot:"+key).Val(); ttl <= 0 {
+			t.Errorf("hash of %s has no expiry", key)
+		}
+	}
+
+	// Nothing matches once the keys are gone
+	purged, err = client.PurgeSnapshotHashes(ctx, "*:c3:*")
+	if err != nil || purged != 0 {
+		t.Errorf("PurgeSnapshotHashes of no keys = %d, %v; want 0, nil", purged, err)
+	}
+}
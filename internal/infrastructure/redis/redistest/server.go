@@ -0,0 +1,368 @@
+// Package redistest runs an in-process stand-in for Redis, so services built
+// on redis.Client can be tested without a server:
+//
+//	func TestSomething(t *testing.T) {
+//		client := redistest.NewClient(t)
+//		...
+//	}
+//
+// It speaks enough of the protocol for the commands of package redis: PING,
+// GET, SET with its expiry and existence options, DEL, TTL, KEYS, SCAN,
+// pipelines, and the lock release script.
+package redistest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zocket/campaign-analytics/internal/infrastructure/redis"
+)
+
+// Server is an in-memory Redis server listening on a local port
+type Server struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]entry
+}
+
+// entry is a stored value and its expiry, zero when it never expires
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewServer starts a server, stopped when the test ends
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("redistest: listen: %v", err)
+	}
+
+	s := &Server{listener: listener, values: make(map[string]entry)}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// NewClient starts a server and returns a client connected to it
+func NewClient(t *testing.T) *redis.Client {
+	t.Helper()
+	s := NewServer(t)
+
+	addr := viper.GetString("redis.addr")
+	viper.Set("redis.addr", s.Addr())
+	defer viper.Set("redis.addr", addr)
+
+	client, err := redis.NewClient(context.Background())
+	if err != nil {
+		t.Fatalf("redistest: connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Keys returns the live keys, sorted
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.match("*")
+}
+
+// serve accepts connections until the listener is closed
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the commands of a connection
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.exec(w, args)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs a command and writes its reply
+func (s *Server) exec(w *bufio.Writer, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		writeSimple(w, "PONG")
+	case "GET":
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'get' command")
+			return
+		}
+		if value, ok := s.get(args[1]); ok {
+			writeBulk(w, value)
+		} else {
+			writeNull(w)
+		}
+	case "SET":
+		s.set(w, args)
+	case "DEL":
+		var deleted int64
+		for _, key := range args[1:] {
+			if _, ok := s.get(key); ok {
+				delete(s.values, key)
+				deleted++
+			}
+		}
+		writeInt(w, deleted)
+	case "TTL":
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'ttl' command")
+			return
+		}
+		if _, ok := s.get(args[1]); !ok {
+			writeInt(w, -2)
+		} else if expiresAt := s.values[args[1]].expiresAt; expiresAt.IsZero() {
+			writeInt(w, -1)
+		} else {
+			writeInt(w, int64(time.Until(expiresAt).Round(time.Second)/time.Second))
+		}
+	case "KEYS":
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'keys' command")
+			return
+		}
+		writeArray(w, s.match(args[1]))
+	case "SCAN":
+		// Every key is returned by the first call
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+		fmt.Fprintf(w, "*2\r\n")
+		writeBulk(w, "0")
+		writeArray(w, s.match(pattern))
+	case "EVALSHA":
+		writeError(w, "NOSCRIPT No matching script. Please use EVAL.")
+	case "EVAL":
+		s.eval(w, args)
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+// set runs SET key value [EX seconds|PX milliseconds|KEEPTTL] [NX|XX]
+func (s *Server) set(w *bufio.Writer, args []string) {
+	if len(args) < 3 {
+		writeError(w, "ERR wrong number of arguments for 'set' command")
+		return
+	}
+
+	e := entry{value: args[2]}
+	nx, xx, keepTTL := false, false, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				writeError(w, "ERR syntax error")
+				return
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if strings.EqualFold(args[i], "PX") {
+				unit = time.Millisecond
+			}
+			e.expiresAt = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	_, exists := s.get(args[1])
+	if (nx && exists) || (xx && !exists) {
+		writeNull(w)
+		return
+	}
+	if keepTTL && exists {
+		e.expiresAt = s.values[args[1]].expiresAt
+	}
+	s.values[args[1]] = e
+	writeSimple(w, "OK")
+}
+
+// eval runs the scripts of package redis, recognized by their commands
+func (s *Server) eval(w *bufio.Writer, args []string) {
+	if len(args) < 3 {
+		writeError(w, "ERR wrong number of arguments for 'eval' command")
+		return
+	}
+	script := args[1]
+	numKeys, err := strconv.Atoi(args[2])
+	if err != nil || len(args) < 3+numKeys {
+		writeError(w, "ERR invalid number of keys")
+		return
+	}
+	keys, argv := args[3:3+numKeys], args[3+numKeys:]
+
+	// The compare-and-delete of ReleaseLock
+	if strings.Contains(script, `redis.call("GET", KEYS[1]) == ARGV[1]`) && strings.Contains(script, `redis.call("DEL", KEYS[1])`) {
+		if value, ok := s.get(keys[0]); ok && len(argv) > 0 && value == argv[0] {
+			delete(s.values, keys[0])
+			writeInt(w, 1)
+			return
+		}
+		writeInt(w, 0)
+		return
+	}
+	writeError(w, "ERR unsupported script")
+}
+
+// get returns the live value of a key. The caller holds s.mu.
+func (s *Server) get(key string) (string, bool) {
+	e, exists := s.values[key]
+	if !exists {
+		return "", false
+	}
+	if !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		delete(s.values, key)
+		return "", false
+	}
+	return e.value, true
+}
+
+// match returns the live keys matching a glob pattern, sorted. The caller
+// holds s.mu.
+func (s *Server) match(pattern string) []string {
+	re := globRegexp(pattern)
+	keys := []string{}
+	for key := range s.values {
+		if _, ok := s.get(key); ok && re.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// globRegexp translates the * and ? wildcards of a Redis glob pattern
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[0] != '*' {
+		return nil, errors.New("redistest: expected an array")
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, errors.New("redistest: invalid array length")
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 2 || line[0] != '$' {
+			return nil, errors.New("redistest: expected a bulk string")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errors.New("redistest: invalid bulk string length")
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+// readLine reads a line without its CRLF
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func writeSimple(w *bufio.Writer, s string) { fmt.Fprintf(w, "+%s\r\n", s) }
+
+func writeError(w *bufio.Writer, s string) { fmt.Fprintf(w, "-%s\r\n", s) }
+
+func writeInt(w *bufio.Writer, n int64) { fmt.Fprintf(w, ":%d\r\n", n) }
+
+func writeBulk(w *bufio.Writer, s string) { fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s) }
+
+func writeNull(w *bufio.Writer) { fmt.Fprintf(w, "$-1\r\n") }
+
+func writeArray(w *bufio.Writer, items []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(items))
+	for _, item := range items {
+		writeBulk(w, item)
+	}
+}
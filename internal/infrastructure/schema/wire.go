@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// magicByte starts every payload in the Confluent wire format
+const magicByte = 0
+
+// ErrNotFramed is returned for payloads not in the Confluent wire format
+var ErrNotFramed = errors.New("payload is not in the Confluent wire format")
+
+// Frame prefixes a payload with the magic byte and the big-endian schema ID,
+// as Confluent serializers do
+func Frame(schemaID int, payload []byte) []byte {
+	framed := make([]byte, 5, 5+len(payload))
+	framed[0] = magicByte
+	binary.BigEndian.PutUint32(framed[1:5], uint32(schemaID))
+	return append(framed, payload...)
+}
+
+// Unframe splits a framed payload into its schema ID and the payload itself
+func Unframe(data []byte) (int, []byte, error) {
+	if !IsFramed(data) {
+		return 0, nil, ErrNotFramed
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
+
+// IsFramed reports whether data looks like a Confluent wire format payload.
+// JSON documents never start with a zero byte, so the two cannot be confused.
+func IsFramed(data []byte) bool {
+	return len(data) >= 5 && data[0] == magicByte
+}
+
+// FrameProtobuf frames a Protobuf message. After the schema ID, Protobuf
+// payloads name the message type within the schema by its index path; the
+// first top-level message is written as a single zero byte.
+func FrameProtobuf(schemaID int, payload []byte) []byte {
+	return Frame(schemaID, append([]byte{0}, payload...))
+}
+
+// UnframeProtobuf splits a framed Protobuf payload into its schema ID, the
+// index path of its message type and the message itself
+func UnframeProtobuf(data []byte) (int, []int, []byte, error) {
+	schemaID, payload, err := Unframe(data)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	// The index path is a zigzag varint count followed by as many indexes
+	count, n := protowire.ConsumeVarint(payload)
+	if n < 0 {
+		return 0, nil, nil, protowire.ParseError(n)
+	}
+	payload = payload[n:]
+
+	length := protowire.DecodeZigZag(count)
+	if length == 0 {
+		return schemaID, []int{0}, payload, nil
+	}
+	if length < 0 || length > int64(len(payload)) {
+		return 0, nil, nil, errors.New("invalid protobuf message index path")
+	}
+
+	indexes := make([]int, length)
+	for i := range indexes {
+		index, n := protowire.ConsumeVarint(payload)
+		if n < 0 {
+			return 0, nil, nil, protowire.ParseError(n)
+		}
+		indexes[i] = int(protowire.DecodeZigZag(index))
+		payload = payload[n:]
+	}
+	return schemaID, indexes, payload, nil
+}
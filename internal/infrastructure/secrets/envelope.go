@@ -0,0 +1,213 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+)
+
+// ErrUnknownKey is returned when an envelope was sealed with a key that is not configured
+var ErrUnknownKey = errors.New("envelope sealed with an unknown key")
+
+// Envelope is a secret encrypted with a random per-secret data key.
+// The data key itself is encrypted with the configured key-encryption key,
+// so rotating the master key only requires re-wrapping data keys: envelopes
+// of a previous key still open while Rewrap moves them to the current one.
+type Envelope struct {
+	KeyID        string `json:"key_id"`
+	EncryptedKey []byte `json:"encrypted_key"`
+	KeyNonce     []byte `json:"key_nonce"`
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// Sealer encrypts envelopes with the current locally configured key and
+// decrypts those of the current and previous keys
+type Sealer struct {
+	keyID string
+	keks  map[string]cipher.AEAD
+}
+
+// NewSealer creates a sealer from the credentials.encryption_key setting,
+// a base64 encoded 32 byte AES-256 key, and the credentials.previous_keys
+// setting, the keys rotated out by key ID
+func NewSealer() (*Sealer, error) {
+	encodedKey := viper.GetString("credentials.encryption_key")
+	keyID := viper.GetString("credentials.key_id")
+
+	if encodedKey == "" {
+		return nil, errors.New("credentials.encryption_key is not configured")
+	}
+	if keyID == "" {
+		keyID = "local"
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials.encryption_key: %w", err)
+	}
+
+	keys := map[string][]byte{keyID: key}
+	for previousID, encodedKey := range viper.GetStringMapString("credentials.previous_keys") {
+		if previousID == keyID {
+			return nil, fmt.Errorf("credentials.previous_keys repeats the current key ID %q", keyID)
+		}
+		previous, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credentials.previous_keys.%s: %w", previousID, err)
+		}
+		keys[previousID] = previous
+	}
+
+	return NewSealerWithKeys(keyID, keys)
+}
+
+// NewSealerWithKey creates a sealer from a raw 32 byte key
+func NewSealerWithKey(keyID string, key []byte) (*Sealer, error) {
+	return NewSealerWithKeys(keyID, map[string][]byte{keyID: key})
+}
+
+// NewSealerWithKeys creates a sealer from raw 32 byte keys by key ID. Seal
+// uses the key of keyID; Open accepts envelopes of any of the keys.
+func NewSealerWithKeys(keyID string, keys map[string][]byte) (*Sealer, error) {
+	if _, ok := keys[keyID]; !ok {
+		return nil, fmt.Errorf("no key for the current key ID %q", keyID)
+	}
+
+	keks := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, got %d", id, len(key))
+		}
+		kek, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		keks[id] = kek
+	}
+
+	return &Sealer{keyID: keyID, keks: keks}, nil
+}
+
+// KeyID returns the ID of the key new envelopes are sealed with
+func (s *Sealer) KeyID() string {
+	return s.keyID
+}
+
+// Seal encrypts plaintext under a fresh data key. The envelope only opens
+// with the same additional data, which binds it to its owner: an envelope
+// copied to another record fails to open.
+func (s *Sealer) Seal(plaintext, additionalData []byte) (*Envelope, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	dek, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomNonce(dek)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := s.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapped.Nonce = nonce
+	wrapped.Ciphertext = dek.Seal(nil, nonce, plaintext, additionalData)
+	return wrapped, nil
+}
+
+// Open decrypts an envelope sealed with the current or a previous key and
+// the same additional data
+func (s *Sealer) Open(envelope *Envelope, additionalData []byte) ([]byte, error) {
+	dataKey, err := s.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := dek.Open(nil, envelope.Nonce, envelope.Ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// Rewrap returns the envelope with its data key wrapped by the current key.
+// The secret itself is not decrypted, so no additional data is needed.
+func (s *Sealer) Rewrap(envelope *Envelope) (*Envelope, error) {
+	dataKey, err := s.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := s.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapped.Nonce = envelope.Nonce
+	wrapped.Ciphertext = envelope.Ciphertext
+	return wrapped, nil
+}
+
+// wrap encrypts a data key with the current key, bound to its key ID
+func (s *Sealer) wrap(dataKey []byte) (*Envelope, error) {
+	kek := s.keks[s.keyID]
+	keyNonce, err := randomNonce(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		KeyID:        s.keyID,
+		EncryptedKey: kek.Seal(nil, keyNonce, dataKey, []byte(s.keyID)),
+		KeyNonce:     keyNonce,
+	}, nil
+}
+
+// unwrap decrypts the data key of an envelope with the key it names
+func (s *Sealer) unwrap(envelope *Envelope) ([]byte, error) {
+	kek, ok := s.keks[envelope.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	dataKey, err := kek.Open(nil, envelope.KeyNonce, envelope.EncryptedKey, []byte(envelope.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// newGCM creates an AES-GCM AEAD for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// randomNonce generates a nonce sized for aead
+func randomNonce(aead cipher.AEAD) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func newTestSealer(t *testing.T, keyID string, fill byte) *Sealer {
+	t.Helper()
+	sealer, err := NewSealerWithKey(keyID, bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealer
+}
+
+func TestSealerRoundTrip(t *testing.T) {
+	sealer := newTestSealer(t, "local", 1)
+	aad := []byte("0b1c6f4e-6a4f-4a39-9d0b-2f1c7a9d3e55|meta")
+
+	envelope, err := sealer.Seal([]byte(`{"access_token":"secret"}`), aad)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if bytes.Contains(envelope.Ciphertext, []byte("secret")) {
+		t.Error("ciphertext contains the plaintext")
+	}
+
+	plaintext, err := sealer.Open(envelope, aad)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if string(plaintext) != `{"access_token":"secret"}` {
+		t.Errorf("plaintext = %s", plaintext)
+	}
+}
+
+func TestSealerOpenWithOtherAdditionalData(t *testing.T) {
+	sealer := newTestSealer(t, "local", 1)
+	envelope, err := sealer.Seal([]byte("secret"), []byte("user-a|meta"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	// An envelope copied to another user's or platform's row does not open
+	for _, aad := range []string{"user-b|meta", "user-a|google", ""} {
+		if _, err := sealer.Open(envelope, []byte(aad)); err == nil {
+			t.Errorf("Open with %q succeeded", aad)
+		}
+	}
+}
+
+func TestSealerOpenUnknownKey(t *testing.T) {
+	envelope, err := newTestSealer(t, "old", 1).Seal([]byte("secret"), nil)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	if _, err := newTestSealer(t, "new", 2).Open(envelope, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestSealerRotation(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	aad := []byte("user-a|meta")
+
+	envelope, err := newTestSealer(t, "old", 1).Seal([]byte("secret"), aad)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	rotated, err := NewSealerWithKeys("new", map[string][]byte{"new": newKey, "old": oldKey})
+	if err != nil {
+		t.Fatalf("NewSealerWithKeys: %v", err)
+	}
+
+	// Envelopes of the previous key still open
+	if plaintext, err := rotated.Open(envelope, aad); err != nil || string(plaintext) != "secret" {
+		t.Fatalf("Open = %q, %v, want the secret", plaintext, err)
+	}
+
+	// Re-wrapped envelopes open without the previous key
+	rewrapped, err := rotated.Rewrap(envelope)
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if rewrapped.KeyID != "new" || !bytes.Equal(rewrapped.Ciphertext, envelope.Ciphertext) {
+		t.Errorf("rewrapped key ID = %q, want new with the ciphertext unchanged", rewrapped.KeyID)
+	}
+	if plaintext, err := newTestSealer(t, "new", 2).Open(rewrapped, aad); err != nil || string(plaintext) != "secret" {
+		t.Errorf("Open re-wrapped = %q, %v, want the secret", plaintext, err)
+	}
+	if _, err := rotated.Open(rewrapped, []byte("user-b|meta")); err == nil {
+		t.Error("re-wrapped envelope opened with other additional data")
+	}
+
+	// New envelopes use the current key
+	sealed, err := rotated.Seal([]byte("secret"), aad)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if sealed.KeyID != "new" {
+		t.Errorf("sealed with key %q, want new", sealed.KeyID)
+	}
+}
+
+func TestNewSealerWithKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		name  string
+		keyID string
+		keys  map[string][]byte
+	}{
+		{name: "no current key", keyID: "new", keys: map[string][]byte{"old": key}},
+		{name: "short previous key", keyID: "new", keys: map[string][]byte{"new": key, "old": key[:16]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSealerWithKeys(tt.keyID, tt.keys); err == nil {
+				t.Error("NewSealerWithKeys succeeded, want an error")
+			}
+		})
+	}
+}
@@ -11,5 +11,5 @@ export CA_POSTGRES_PASSWORD=postgres
 export CA_POSTGRES_SSLMODE=disable
 
 # Execute the API with these environment variables
-go run cmd/api/main.go
+go run ./cmd/api
 
@@ -29,7 +29,11 @@ CGO_ENABLED=0 go build -ldflags="${LDFLAGS}" -o bin/api ./cmd/api
 echo "Building Worker service..."
 CGO_ENABLED=0 go build -ldflags="${LDFLAGS}" -o bin/worker ./cmd/worker
 
+echo "Building admin CLI..."
+CGO_ENABLED=0 go build -ldflags="${LDFLAGS}" -o bin/campaignctl ./cmd/campaignctl
+
 echo "Build completed successfully."
 echo "Binaries are available in the 'bin' directory:"
 echo "  - bin/api"
 echo "  - bin/worker"
+echo "  - bin/campaignctl"
@@ -25,13 +25,13 @@ cd ../..
 echo "Waiting for databases to be ready..."
 sleep 10
 
-# Initialize database schema
-echo "Initializing database schema..."
-go run cmd/api/main.go --init-schema
+# Apply database migrations
+echo "Applying database migrations..."
+go run ./cmd/api migrate up
 
 # Run the API in the background
 echo "Starting API service..."
-go run cmd/api/main.go &
+go run ./cmd/api &
 API_PID=$!
 
 # Run the worker in the background